@@ -1,18 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 
 	"github.com/kpotier/molsolvent/pkg/cfg"
+	"github.com/kpotier/molsolvent/pkg/util"
 )
 
 func main() {
-	log := log.New(os.Stdout, "", log.LstdFlags)
+	log := log.New(os.Stderr, "", log.LstdFlags)
+
+	if len(os.Args) == 3 && os.Args[1] == "index" {
+		err := index(os.Args[2])
+		if err != nil {
+			log.Fatal(fmt.Errorf("index: %w", err))
+		}
+		return
+	}
+
+	if len(os.Args) == 3 && os.Args[1] == "check" {
+		err := check(log, os.Args[2])
+		if err != nil {
+			log.Fatal(fmt.Errorf("check: %w", err))
+		}
+		return
+	}
 
 	if len(os.Args) != 2 {
-		log.Fatal("one argument is needed: path of the configuration file")
+		log.Fatal("one argument is needed: path of the configuration file (or index and the path of a trajectory, or check and the path of a configuration file)")
 	}
 
 	c, err := cfg.New(os.Args[1])
@@ -20,5 +40,70 @@ func main() {
 		log.Fatal(fmt.Errorf("New: %w", err))
 	}
 
-	c.Start(log)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt(log, cancel)
+
+	c.Start(ctx, log)
+}
+
+// interrupt calls cancel on the first interrupt signal (Ctrl-C) so that the
+// calculations supporting it write their partial results. The next signal
+// terminates the program as usual.
+func interrupt(log *log.Logger, cancel context.CancelFunc) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		signal.Stop(sig)
+		log.Println("interrupted: writing the partial results (interrupt again to quit)")
+		cancel()
+	}()
+}
+
+// check validates the configuration file path and the configuration files of
+// its calculations without reading the trajectories (see cfg.Cfg.Check). Every
+// error is written in log.
+func check(log *log.Logger, path string) error {
+	c, err := cfg.New(path)
+	if err != nil {
+		return fmt.Errorf("New: %w", err)
+	}
+
+	errs := c.Check()
+	for _, err := range errs {
+		log.Println(err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d invalid calculation(s)", len(errs))
+	}
+	return nil
+}
+
+// index builds the index of the trajectory path and writes it next to the
+// trajectory (see util.IndexPath). The calculations then use it to go directly
+// to the configurations they need.
+func index(path string) error {
+	if util.Compressed(path) {
+		return errors.New("a compressed trajectory cannot be indexed")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	idx, err := util.BuildIndex(f)
+	if err != nil {
+		return fmt.Errorf("BuildIndex: %w", err)
+	}
+
+	err = util.WriteIndex(util.IndexPath(path), idx)
+	if err != nil {
+		return fmt.Errorf("WriteIndex: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests if MOLSOLVENT_MAIN is set, so that
+// the tests can run the program.
+func TestMain(m *testing.M) {
+	if os.Getenv("MOLSOLVENT_MAIN") != "" {
+		os.Args = append(os.Args[:1], strings.Fields(os.Getenv("MOLSOLVENT_MAIN"))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStdout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "molsolvent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 0 0 0\n2 1 %d 0 0\n", i)
+	}
+
+	files := map[string]string{
+		"traj.lammpstrj": traj.String(),
+		"dist.toml": fmt.Sprintf("[dist_two_atoms]\nfile_in = %q\nfile_out = \"-\"\ncfg_end = 3\natom_1 = 1\natom_2 = 2\ndt = 1.0\n",
+			filepath.Join(dir, "traj.lammpstrj")),
+		"cfg.toml": fmt.Sprintf("progress_log = 1e-9\ntypes = [[\"dist_two_atoms\"]]\nfiles = [[%q]]\noutput_dir = %q\n",
+			filepath.Join(dir, "dist.toml"), filepath.Join(dir, "out")),
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "MOLSOLVENT_MAIN="+filepath.Join(dir, "cfg.toml"))
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+
+	// The results are on the standard output, the logs on the standard error.
+	out := stdout.String()
+	if !strings.HasPrefix(out, "Date: ") || !strings.HasSuffix(out, "cfg t x y z dist\n0 0 0 0 0 0\n1 1 -1 0 0 1\n2 2 -2 0 0 2\n") {
+		t.Errorf("standard output:\n%s", out)
+	}
+	if strings.Contains(out, "processed") {
+		t.Errorf("logs on the standard output:\n%s", out)
+	}
+
+	logs := stderr.String()
+	if !strings.Contains(logs, "dist_two_atoms (step 0, routine 0): done: 3/3 configurations") {
+		t.Errorf("standard error:\n%s", logs)
+	}
+	if strings.Contains(logs, "cfg t ") {
+		t.Errorf("results on the standard error:\n%s", logs)
+	}
+
+	// Nothing is written into the output directory.
+	if entries, err := ioutil.ReadDir(filepath.Join(dir, "out")); err != nil || len(entries) != 0 {
+		t.Errorf("output directory: %d files (%v)", len(entries), err)
+	}
+}
@@ -0,0 +1,281 @@
+// Package bondcorr calculates the intermittent and continuous bond
+// autocorrelation functions. A bond is defined as a pair of atoms whose
+// distance is lower than a cutoff.
+//
+// The intermittent function C_intermittent(t) is the probability that a bond
+// existing at t0 exists at t0+t, whether or not it broke in between. The
+// continuous function C_continuous(t) is the probability that it exists at
+// every configuration from t0 to t0+t. The integrated lifetimes are the
+// integrals of these functions from 0 to LagMax. They are equal to the time
+// constants of exponential decays only if the functions decay to 0 before
+// LagMax; no exponential is fitted.
+package bondcorr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "bond_corr"
+
+// XYZ is a type that represents the coordinates for each atom.
+type XYZ map[string][][3]float64
+
+// pair identifies a bond. The indexes are the positions of the atoms among the
+// atoms of the same type.
+type pair struct {
+	at1, at2 string
+	id1, id2 int
+}
+
+// BondCorr is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the bonds of each configuration.
+// CfgStart must be lower than CfgEnd. LagMax must be lower than the number of
+// configurations. If the trajectory ends before CfgEnd, the configurations read
+// are used, the lags stop at the last configuration read, and a warning is
+// logged.
+type BondCorr struct {
+	FileIn  string `toml:"bond_corr.file_in"`
+	FileOut string `toml:"bond_corr.file_out"`
+
+	CfgStart int `toml:"bond_corr.cfg_start"`
+	CfgEnd   int `toml:"bond_corr.cfg_end"`
+
+	Atoms map[string][]string `toml:"bond_corr.atoms"`
+
+	RCut   float64 `toml:"bond_corr.rcut"`
+	LagMax int     `toml:"bond_corr.lag_max"`
+
+	Dt float64 `toml:"bond_corr.dt"`
+
+	rcut2    float64
+	atomsTyp []string
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	bonds []map[pair]bool
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the BondCorr structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*BondCorr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bondCorr BondCorr
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&bondCorr)
+	if err != nil {
+		return nil, err
+	}
+
+	if bondCorr.CfgStart >= bondCorr.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if bondCorr.LagMax <= 0 || bondCorr.LagMax >= (bondCorr.CfgEnd-bondCorr.CfgStart) {
+		return nil, errors.New("LagMax must be strictly positive and lower than the number of configurations")
+	}
+
+	if bondCorr.RCut <= 0 {
+		return nil, errors.New("RCut must be strictly positive")
+	}
+
+	bondCorr.rcut2 = util.Pow(bondCorr.RCut, 2)
+
+	for at1, arrAt2 := range bondCorr.Atoms {
+		bondCorr.addType(at1)
+		for _, at2 := range arrAt2 {
+			bondCorr.addType(at2)
+		}
+	}
+
+	return &bondCorr, nil
+}
+
+// addType adds an atom type to the list of types that must be read if it is
+// not already in it.
+func (b *BondCorr) addType(typ string) {
+	for _, v := range b.atomsTyp {
+		if v == typ {
+			return
+		}
+	}
+	b.atomsTyp = append(b.atomsTyp, typ)
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (b *BondCorr) SetOutputDir(dir string) {
+	b.FileOut = util.FileOut(b.FileOut, dir, b.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (b *BondCorr) SetOutputFormat(format string) {
+	b.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (b *BondCorr) SetProgress(p *util.Progress) {
+	b.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (b *BondCorr) SetInput(in util.Input) {
+	b.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (b *BondCorr) SetLog(log *log.Logger) {
+	b.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread. The bonds of every configuration are kept
+// in memory.
+func (b *BondCorr) Start() error {
+	f, traj, err := util.OpenTrajectory(b.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(b.input.Reader(traj))
+
+	err = b.input.SkipTo(f, r, 0, b.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := b.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	b.bonds = make([]map[pair]bool, 0, b.CfgEnd-b.CfgStart)
+	b.bonds = append(b.bonds, b.calc(box, xyz))
+
+	for i := 1; i < (b.CfgEnd - b.CfgStart); i++ {
+		err = b.input.SkipTo(f, r, b.CfgStart+i, b.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(b.log, Type, b.CfgStart+i, b.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := b.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		b.bonds = append(b.bonds, b.calc(box, xyz))
+		b.progress.Update(i+1, b.CfgEnd-b.CfgStart)
+	}
+
+	out, err := util.WriteFormat(b.FileOut, b, b.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	b.write(out)
+
+	return nil
+}
+
+// calc returns the bonds of a configuration.
+func (b *BondCorr) calc(box [3]float64, xyz XYZ) map[pair]bool {
+	bonds := make(map[pair]bool)
+	for at1, arrAt2 := range b.Atoms {
+		for id1, xyzAt1 := range xyz[at1] {
+			for _, at2 := range arrAt2 {
+				for id2, xyzAt2 := range xyz[at2] {
+					if at1 == at2 && id1 == id2 {
+						continue
+					}
+
+					dist := util.MinImageDist2(xyzAt1, xyzAt2, box)
+
+					if dist <= b.rcut2 {
+						bonds[pair{at1, at2, id1, id2}] = true
+					}
+				}
+			}
+		}
+	}
+	return bonds
+}
+
+// write calculates the correlation functions using every configuration as a
+// time origin and writes the results into a file. The integrated lifetimes are
+// the integrals of the correlation functions (trapezoidal rule).
+func (b *BondCorr) write(w io.Writer) {
+	lagMax := b.LagMax
+	if lagMax >= len(b.bonds) {
+		lagMax = len(b.bonds) - 1
+	}
+
+	intermittent := make([]float64, lagMax+1)
+	continuous := make([]float64, lagMax+1)
+	norm := make([]float64, lagMax+1)
+
+	for t0, bonds := range b.bonds {
+		for p := range bonds {
+			for lag := 0; lag <= lagMax && (t0+lag) < len(b.bonds); lag++ {
+				if b.bonds[t0+lag][p] {
+					intermittent[lag]++
+				}
+			}
+
+			for lag := 0; lag <= lagMax && (t0+lag) < len(b.bonds); lag++ {
+				if !b.bonds[t0+lag][p] {
+					break
+				}
+				continuous[lag]++
+			}
+		}
+
+		for lag := 0; lag <= lagMax && (t0+lag) < len(b.bonds); lag++ {
+			norm[lag] += float64(len(bonds))
+		}
+	}
+
+	fmt.Fprint(w, "lag t C_intermittent C_continuous\n")
+
+	var tauInt, tauCont float64
+	for lag := 0; lag <= lagMax; lag++ {
+		if norm[lag] > 0 {
+			intermittent[lag] /= norm[lag]
+			continuous[lag] /= norm[lag]
+		}
+
+		if lag > 0 {
+			tauInt += (intermittent[lag] + intermittent[lag-1]) / 2. * b.Dt
+			tauCont += (continuous[lag] + continuous[lag-1]) / 2. * b.Dt
+		}
+
+		fmt.Fprintf(w, "%d %g %g %g\n", lag, float64(lag)*b.Dt, intermittent[lag], continuous[lag])
+	}
+
+	fmt.Fprintf(w, "\nIntegrated lifetime (intermittent): %g\nIntegrated lifetime (continuous): %g\n",
+		tauInt, tauCont)
+}
@@ -0,0 +1,132 @@
+package bondcorr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBondCorr writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [bond_corr]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newBondCorr(t *testing.T, params, traj string) *BondCorr {
+	dir, err := ioutil.TempDir("", "bondcorr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "bondcorr.toml")
+	cfg := fmt.Sprintf("[bond_corr]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "bondcorr.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// history returns a trajectory of a cubic box of length 10 containing an atom
+// of type 1 and an atom of type 2. At each configuration, they are at the
+// distance 1 if the bond exists and at the distance 3 otherwise.
+func history(bonded ...bool) string {
+	var b strings.Builder
+	for i, v := range bonded {
+		dist := 3.
+		if v {
+			dist = 1.
+		}
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&b, "1 1 5 5 5\n2 2 %g 5 5\n", 5+dist)
+	}
+	return b.String()
+}
+
+func TestShortTrajectory(t *testing.T) {
+	b := newBondCorr(t, "cfg_end = 10\natoms = {1 = [\"2\"]}\nrcut = 1.5\nlag_max = 5\ndt = 1.0\n",
+		history(true, false, true))
+	var logs strings.Builder
+	b.SetLog(log.New(&logs, "", 0))
+	err := b.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "bond_corr: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	// The lags stop at 2, the last configuration read.
+	out, err := ioutil.ReadFile(b.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "lag t C_intermittent C_continuous\n0 0 1 1\n1 1 0 0\n2 2 1 0\n\n") {
+		t.Errorf("wrong correlations:\n%s", out)
+	}
+}
+
+func TestCorrelations(t *testing.T) {
+	// The bond exists at the configurations 0, 1, 3, and 4. At the lag 1, it
+	// exists again after 2 of its 3 occurrences at the time origins 0 to 3 (0
+	// and 3, without break), at the lag 2 after 1 of 2 (1, with a break), and
+	// at the lag 3 after 2 of 2 (0 and 1, with a break):
+	//	C_intermittent = 4/4, 2/3, 1/2, 2/2
+	//	C_continuous   = 4/4, 2/3, 0/2, 0/2
+	// and the integrated lifetimes (trapezoidal rule) are 13/6 and 7/6.
+	b := newBondCorr(t, "cfg_end = 5\natoms = {1 = [\"2\"]}\nrcut = 1.5\nlag_max = 3\ndt = 1.0\n",
+		history(true, true, false, true, true))
+	err := b.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(b.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	s = s[strings.Index(s, "lag t C_intermittent C_continuous\n"):]
+
+	want := [][4]float64{{0, 0, 1, 1}, {1, 1, 2. / 3., 2. / 3.}, {2, 2, 0.5, 0}, {3, 3, 1, 0}}
+	lines := strings.Split(s, "\n")
+	for i, w := range want {
+		var got [4]float64
+		_, err := fmt.Sscanf(lines[i+1], "%g %g %g %g", &got[0], &got[1], &got[2], &got[3])
+		if err != nil {
+			t.Fatalf("lag %d: %v", i, err)
+		}
+		for k := range got {
+			if math.Abs(got[k]-w[k]) > 1e-12 {
+				t.Errorf("lag %d: got %v, want %v", i, got, w)
+				break
+			}
+		}
+	}
+
+	var tauInt, tauCont float64
+	_, err = fmt.Sscanf(s[strings.Index(s, "\n\n")+2:],
+		"Integrated lifetime (intermittent): %g\nIntegrated lifetime (continuous): %g\n", &tauInt, &tauCont)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, s)
+	}
+	if math.Abs(tauInt-13./6.) > 1e-12 || math.Abs(tauCont-7./6.) > 1e-12 {
+		t.Errorf("integrated lifetimes %g and %g, want %g and %g", tauInt, tauCont, 13./6., 7./6.)
+	}
+}
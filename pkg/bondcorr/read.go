@@ -0,0 +1,116 @@
+package bondcorr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (b *BondCorr) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	b.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	l, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(l))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	b.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			b.cols[0] = k
+		case "y":
+			b.cols[1] = k
+		case "z":
+			b.cols[2] = k
+		case "type":
+			b.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(b.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = b.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (b *BondCorr) readCfg(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = b.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms whose type is in atomsTyp.
+func (b *BondCorr) fetchXYZ(r *bufio.Reader) (XYZ, error) {
+	xyz := make(XYZ, len(b.atomsTyp))
+	nbat := b.atoms / len(b.atomsTyp)
+	for _, v := range b.atomsTyp {
+		xyz[v] = make([][3]float64, 0, nbat)
+	}
+
+	for i := 0; i < b.atoms; i++ {
+		l, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(l))
+		if len(fields) != b.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), b.colsLen)
+		}
+
+		typ := fields[b.cols[3]]
+		xyzTyp, ok := xyz[typ]
+		if !ok {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[b.cols[k]], 64)
+		}
+
+		xyz[typ] = append(xyzTyp, xyzTmp)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,311 @@
+// Package bondlength calculates the distribution of the length of the bonds
+// defined by a topology, for each bond type.
+//
+// Unlike a cutoff, the topology gives the bonds explicitly: they are read from
+// the Bonds section of a LAMMPS data file and the atoms are selected by
+// identifier (id column). If a temperature is given, the force constant of each
+// bond type is estimated from the variance of the length. For a harmonic bond
+// E = k/2 (r - r0)², the equipartition gives k = kB T / <δr²>. The K of the
+// harmonic bond style of LAMMPS (E = K (r - r0)²) is k/2.
+package bondlength
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "bond_length"
+
+// BoltzmannReal is the Boltzmann constant in the real units of LAMMPS
+// (kcal/mol/K).
+const BoltzmannReal = 0.0019872067
+
+// stats contains the accumulated lengths of a bond type.
+type stats struct {
+	n, sum, sum2 float64
+	hstg         []float64
+}
+
+// BondLength is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the bonds.
+// The bonds are read from FileData (see util.ReadBonds). If BondTypes is set,
+// only these bond types are used. The histograms go up to RMax with bins of
+// width Dr; the longer bonds are only used for the mean and the standard
+// deviation. The force constant is written if Temperature is set. Boltzmann
+// is the Boltzmann constant in the energy units of the force constant
+// (BoltzmannReal if 0). CfgStart must be lower than CfgEnd. If the trajectory
+// ends before CfgEnd, the configurations read are used and a warning is logged.
+type BondLength struct {
+	FileIn   string `toml:"bond_length.file_in"`
+	FileOut  string `toml:"bond_length.file_out"`
+	FileData string `toml:"bond_length.file_data"`
+
+	CfgStart int `toml:"bond_length.cfg_start"`
+	CfgEnd   int `toml:"bond_length.cfg_end"`
+
+	BondTypes []string `toml:"bond_length.bond_types"`
+
+	RMax float64 `toml:"bond_length.rmax"`
+	Dr   float64 `toml:"bond_length.dr"`
+
+	Temperature float64 `toml:"bond_length.temperature"`
+	Boltzmann   float64 `toml:"bond_length.boltzmann"`
+
+	bonds []util.Bond
+	ids   map[int]bool
+	types []string
+	stats map[string]*stats
+	bins  int
+	nbCfg int
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the BondLength structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*BondLength, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var bondLength BondLength
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&bondLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if bondLength.CfgStart >= bondLength.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if bondLength.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	bondLength.bins = int(bondLength.RMax / bondLength.Dr)
+	if bondLength.bins <= 1 {
+		return nil, errors.New("the number of bins must be greater than 1")
+	}
+
+	if bondLength.Temperature < 0 {
+		return nil, errors.New("Temperature must be positive")
+	}
+
+	if bondLength.Boltzmann == 0 {
+		bondLength.Boltzmann = BoltzmannReal
+	}
+
+	bonds, err := util.ReadBonds(bondLength.FileData)
+	if err != nil {
+		return nil, fmt.Errorf("ReadBonds: %w", err)
+	}
+
+	selected := make(map[string]bool, len(bondLength.BondTypes))
+	for _, v := range bondLength.BondTypes {
+		selected[v] = true
+	}
+
+	bondLength.ids = make(map[int]bool)
+	bondLength.stats = make(map[string]*stats)
+	for _, v := range bonds {
+		if len(selected) > 0 && !selected[v.Type] {
+			continue
+		}
+
+		if _, ok := bondLength.stats[v.Type]; !ok {
+			bondLength.stats[v.Type] = &stats{hstg: make([]float64, bondLength.bins)}
+			bondLength.types = append(bondLength.types, v.Type)
+		}
+
+		bondLength.bonds = append(bondLength.bonds, v)
+		bondLength.ids[v.Atoms[0]] = true
+		bondLength.ids[v.Atoms[1]] = true
+	}
+
+	for _, v := range bondLength.BondTypes {
+		if _, ok := bondLength.stats[v]; !ok {
+			return nil, fmt.Errorf("no bond of type `%s`", v)
+		}
+	}
+
+	if len(bondLength.bonds) == 0 {
+		return nil, errors.New("no bond selected")
+	}
+
+	sort.Strings(bondLength.types)
+	return &bondLength, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (b *BondLength) SetOutputDir(dir string) {
+	b.FileOut = util.FileOut(b.FileOut, dir, b.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (b *BondLength) SetOutputFormat(format string) {
+	b.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (b *BondLength) SetProgress(p *util.Progress) {
+	b.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (b *BondLength) SetInput(in util.Input) {
+	b.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (b *BondLength) SetLog(log *log.Logger) {
+	b.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (b *BondLength) Start() error {
+	f, traj, err := util.OpenTrajectory(b.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(b.input.Reader(traj))
+
+	err = b.input.SkipTo(f, r, 0, b.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := b.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	err = b.calc(box, xyz)
+	if err != nil {
+		return fmt.Errorf("calc: %w", err)
+	}
+
+	for i := 1; i < (b.CfgEnd - b.CfgStart); i++ {
+		err = b.input.SkipTo(f, r, b.CfgStart+i, b.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(b.log, Type, b.CfgStart+i, b.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := b.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+
+		err = b.calc(box, xyz)
+		if err != nil {
+			return fmt.Errorf("calc (step %d): %w", i, err)
+		}
+		b.progress.Update(i+1, b.CfgEnd-b.CfgStart)
+	}
+
+	out, err := util.WriteFormat(b.FileOut, b, b.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	b.write(out)
+
+	return nil
+}
+
+// calc adds the length of each bond to the statistics of its type. It returns
+// an error if a bonded atom is missing from the configuration.
+func (b *BondLength) calc(box [3]float64, xyz map[int][3]float64) error {
+	for _, bond := range b.bonds {
+		xyz1, ok1 := xyz[bond.Atoms[0]]
+		xyz2, ok2 := xyz[bond.Atoms[1]]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("atoms %d and %d of a bond are not both in the configuration",
+				bond.Atoms[0], bond.Atoms[1])
+		}
+
+		dist := util.MinImageDist2(xyz1, xyz2, box)
+		dist = math.Sqrt(dist)
+
+		s := b.stats[bond.Type]
+		s.n++
+		s.sum += dist
+		s.sum2 += dist * dist
+		if bin := int(dist / b.Dr); bin < b.bins {
+			s.hstg[bin]++
+		}
+	}
+
+	b.nbCfg++
+	return nil
+}
+
+// write writes the number of bonds per configuration, the mean and the standard deviation of the
+// length (and the force constant if Temperature is set) for each bond type,
+// followed by the normalized histograms.
+func (b *BondLength) write(w io.Writer) {
+	fmt.Fprint(w, "type bonds mean std")
+	if b.Temperature > 0 {
+		fmt.Fprint(w, " k")
+	}
+	fmt.Fprint(w, "\n")
+
+	for _, typ := range b.types {
+		s := b.stats[typ]
+		mean := s.sum / s.n
+		variance := math.Max(s.sum2/s.n-mean*mean, 0)
+
+		fmt.Fprintf(w, "%s %d %g %g", typ, int(s.n)/b.nbCfg, mean, math.Sqrt(variance))
+		if b.Temperature > 0 {
+			var k float64
+			if variance > 0 {
+				k = b.Boltzmann * b.Temperature / variance
+			}
+			fmt.Fprintf(w, " %g", k)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprint(w, "\ndist")
+	for _, typ := range b.types {
+		fmt.Fprintf(w, " p(%s)", typ)
+	}
+	fmt.Fprint(w, "\n")
+
+	for i := 0; i < b.bins; i++ {
+		fmt.Fprint(w, (float64(i)+0.5)*b.Dr)
+		for _, typ := range b.types {
+			s := b.stats[typ]
+			fmt.Fprint(w, " ", s.hstg[i]/(s.n*b.Dr))
+		}
+		fmt.Fprint(w, "\n")
+	}
+}
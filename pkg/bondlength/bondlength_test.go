@@ -0,0 +1,77 @@
+package bondlength
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newBondLength writes the trajectory traj, the data file data, and the
+// configuration file made of the parameters params (without the table
+// [bond_length]) into a temporary directory, and returns the calculation read
+// from this file by New.
+func newBondLength(t *testing.T, params, traj, data string) *BondLength {
+	dir, err := ioutil.TempDir("", "bondlength")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "bondlength.toml")
+	cfg := fmt.Sprintf("[bond_length]\nfile_in = %q\nfile_out = %q\nfile_data = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "bondlength.dat"),
+		filepath.Join(dir, "data.lmp"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "data.lmp"), []byte(data), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of two bonds of type 1, of lengths
+	// 1 and 2.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n4\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		traj.WriteString("1 1 1 1 1\n2 1 2 1 1\n3 1 1 5 1\n4 1 3 5 1\n")
+	}
+
+	b := newBondLength(t, "cfg_end = 10\nrmax = 3.0\ndr = 0.5\n", traj.String(), "Bonds\n\n1 1 1 2\n2 1 3 4\n")
+	var logs strings.Builder
+	b.SetLog(log.New(&logs, "", 0))
+	err := b.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "bond_length: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	out, err := ioutil.ReadFile(b.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "type bonds mean std\n1 2 1.5 0.5\n") {
+		t.Errorf("the number of bonds isn't per configuration read:\n%s", out)
+	}
+}
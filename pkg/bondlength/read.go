@@ -0,0 +1,146 @@
+package bondlength
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (b *BondLength) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz map[int][3]float64, err error) {
+	b.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	line, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(line))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	b.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			b.cols[0] = k
+		case "y":
+			b.cols[1] = k
+		case "z":
+			b.cols[2] = k
+		case "id":
+			b.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(b.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and id")
+	}
+
+	xyz, err = b.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (b *BondLength) readCfg(r *bufio.Reader) (box [3]float64, xyz map[int][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = b.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the bonded atoms by identifier. Each of
+// them must appear exactly once in the configuration.
+func (b *BondLength) fetchXYZ(r *bufio.Reader) (map[int][3]float64, error) {
+	xyz := make(map[int][3]float64, len(b.ids))
+	for i := 0; i < b.atoms; i++ {
+		line, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(line))
+		if len(fields) != b.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), b.colsLen)
+		}
+
+		id, err := strconv.Atoi(fields[b.cols[3]])
+		if err != nil {
+			return nil, fmt.Errorf("id: %w", err)
+		}
+
+		if !b.ids[id] {
+			continue
+		}
+
+		if _, ok := xyz[id]; ok {
+			return nil, fmt.Errorf("id %d appears more than once", id)
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[b.cols[k]], 64)
+		}
+
+		xyz[id] = xyzTmp
+	}
+
+	if len(xyz) < len(b.ids) {
+		return nil, fmt.Errorf("ids not found: %s", b.missing(xyz))
+	}
+
+	return xyz, nil
+}
+
+// missing returns the bonded atoms that are not in xyz (the ten first, in
+// increasing order).
+func (b *BondLength) missing(xyz map[int][3]float64) string {
+	var ids []int
+	for id := range b.ids {
+		if _, ok := xyz[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	var list []string
+	for i, id := range ids {
+		if i == 10 {
+			list = append(list, fmt.Sprintf("and %d more", len(ids)-i))
+			break
+		}
+		list = append(list, strconv.Itoa(id))
+	}
+	return strings.Join(list, " ")
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,79 @@
+package bondlength
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIDs(t *testing.T) {
+	// The bonds 1-2 and 3-4. Each configuration is a list of 6 ids.
+	valid := []int{1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		name string
+		cfgs [][]int
+		err  string // empty if no error is expected
+	}{
+		{"valid", [][]int{valid, valid, valid}, ""},
+		{"out of order", [][]int{valid, {6, 5, 4, 3, 2, 1}, {2, 1, 5, 6, 3, 4}}, ""},
+		{"duplicated unbonded atom", [][]int{valid, {1, 2, 3, 4, 5, 5}, valid}, ""},
+		{"duplicated", [][]int{valid, valid, {1, 2, 3, 3, 4, 5}},
+			"readCfg (step 2): fetchXYZ: id 3 appears more than once"},
+		{"duplicated in the first configuration", [][]int{{1, 1, 2, 3, 4, 5}, valid, valid},
+			"readCfgFirst: fetchXYZ: id 1 appears more than once"},
+		{"missing", [][]int{valid, {1, 2, 3, 5, 6, 7}, valid},
+			"readCfg (step 1): fetchXYZ: ids not found: 4"},
+		{"several missing", [][]int{valid, valid, {2, 5, 6, 7, 8, 9}},
+			"readCfg (step 2): fetchXYZ: ids not found: 1 3 4"},
+	}
+
+	dir, err := ioutil.TempDir("", "bondlength")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data.lmp")
+	err = ioutil.WriteFile(data, []byte("Bonds\n\n1 1 1 2\n2 1 3 4\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		var traj strings.Builder
+		for i, ids := range tt.cfgs {
+			fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", i, len(ids))
+			traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+			for _, id := range ids {
+				fmt.Fprintf(&traj, "%d 1 %d 1 1\n", id, id)
+			}
+		}
+
+		path := filepath.Join(dir, "bondlength.toml")
+		cfg := fmt.Sprintf("[bond_length]\nfile_in = %q\nfile_out = %q\nfile_data = %q\ncfg_end = %d\nrmax = 3.0\ndr = 0.1\n",
+			filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "out.dat"), data, len(tt.cfgs))
+		err = ioutil.WriteFile(path, []byte(cfg), 0644)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj.String()), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = b.Start()
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
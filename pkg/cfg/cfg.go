@@ -3,11 +3,16 @@
 package cfg
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"sync"
 
+	"github.com/kpotier/molsolvent/pkg/util"
+
 	"github.com/pelletier/go-toml"
 )
 
@@ -15,9 +20,42 @@ import (
 // instanced through the New method. The length of the Files slice must be equal
 // to the length of the Types files. Each calculation requires a configuration
 // file where the parameters required to run the calculation are stored.
+// If ProgressJSON is set, the calculations report their progress in this file
+// (see util.Progress). If ProgressLog is set, they log the number of processed
+// configurations every ProgressLog seconds at most. The output files that are
+// not specified in the configuration files of the calculations are placed in
+// OutputDir, which is created by Start if it doesn't exist. The output files of
+// the calculations implementing Formatter are written in FileOutFormat
+// (util.FormatText by default); the others, like the trajectories written by
+// displacement, extract, nopbc, and occupancy, are always written in
+// util.FormatText and FileOutFormat is ignored. If ReadLimit is set, the trajectories are read at ReadLimit
+// bytes per second at most. If SkipDuplicateFrames is true, the configurations
+// repeated by restarted runs are skipped (see util.Input). If SyncEvery is set,
+// the calculations writing their results configuration by configuration store
+// them on disk every SyncEvery configurations (see util.Syncer). If VolumeStats
+// is true, the statistics of the volume of the box computed by a calculation
+// are reused by the next ones processing the same configurations (see
+// util.VolumeStats).
+// If Report is set, the headline result of each calculation implementing
+// Summarizer is written in this file at the end of the batch.
 type Cfg struct {
 	Types [][]string `toml:"types"`
 	Files [][]string `toml:"files"`
+
+	ProgressJSON string  `toml:"progress_json"`
+	ProgressLog  float64 `toml:"progress_log"`
+	OutputDir    string  `toml:"output_dir"`
+	ReadLimit    int64   `toml:"read_limit"`
+
+	FileOutFormat string `toml:"file_out_format"`
+
+	SkipDuplicateFrames bool `toml:"skip_duplicate_frames"`
+	SyncEvery           int  `toml:"sync_every"`
+	VolumeStats         bool `toml:"volume_stats"`
+
+	Report string `toml:"report"`
+
+	summaries *summaries
 }
 
 // New returns an instance of the Cfg structure. It opens and reads the
@@ -49,6 +87,15 @@ func New(path string) (Cfg, error) {
 		}
 	}
 
+	if cfg.ProgressLog < 0 {
+		return Cfg{}, errors.New("ProgressLog must be positive")
+	}
+
+	err = util.CheckFormat(cfg.FileOutFormat)
+	if err != nil {
+		return Cfg{}, fmt.Errorf("FileOutFormat: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -60,33 +107,126 @@ func New(path string) (Cfg, error) {
 //
 // It is a thread blocking method. If an error occurs for a specific
 // calculation, the calculation will stop and log the error but the method won't
-// stop.
-func (c Cfg) Start(log *log.Logger) {
+// stop. When ctx is done, the calculations that support it are interrupted
+// (see Canceler) and the next steps are not launched. If OutputDir cannot be
+// created, the error is logged and no calculation is launched.
+func (c Cfg) Start(ctx context.Context, log *log.Logger) {
+	if c.OutputDir != "" {
+		err := os.MkdirAll(c.OutputDir, 0755)
+		if err != nil {
+			log.Println(fmt.Errorf("OutputDir: %w", err))
+			return
+		}
+	}
+
+	if c.Report != "" {
+		c.summaries = new(summaries)
+		defer c.writeReport(log)
+	}
+
 	var wg sync.WaitGroup
 	for step, types := range c.Types {
+		if ctx.Err() != nil {
+			log.Printf("interrupted: steps %d to %d not launched", step, len(c.Types)-1)
+			return
+		}
+
 		if len(types) == 0 {
 			continue
 		}
 
 		if len(types) > 1 {
-			for rtn, name := range types[1:] { // For each calculation
+			for rtn := range types[1:] { // For each calculation
 				wg.Add(1)
-				go func(step, rtn int, name string) {
-					err := Launch(name, c.Files[step][rtn])
+				go func(step, rtn int) {
+					err := c.launch(ctx, log, step, rtn)
 					if err != nil {
 						log.Println(fmt.Errorf("Launch (step %d, routine %d): %w", step, rtn, err))
 					}
 
 					wg.Done()
-				}(step, rtn, name)
+				}(step, rtn+1)
 
 			}
 		}
 
-		err := Launch(types[0], c.Files[step][0])
+		err := c.launch(ctx, log, step, 0)
 		if err != nil {
 			log.Println(fmt.Errorf("Launch (step %d, routine %d): %w", step, 0, err))
 		}
 		wg.Wait()
 	}
 }
+
+// Check instances every calculation without launching it, e.g. to validate
+// the configuration files before a long batch. The parameters of the
+// calculations are parsed and checked like in Start but the trajectories
+// aren't read and nothing is written on disk. It returns every error found, or
+// nil if there is none.
+func (c Cfg) Check() []error {
+	var errs []error
+	for step, types := range c.Types {
+		for rtn, name := range types {
+			_, _, err := c.setup(name, c.Files[step][rtn])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("Check (step %d, routine %d): %w", step, rtn, err))
+			}
+		}
+	}
+	return errs
+}
+
+// summaries contains the headline results of the calculations of a batch (see
+// Summarizer). Its methods can be called on a nil summaries, in which case
+// nothing is recorded.
+type summaries struct {
+	lines []summary
+	mux   sync.Mutex
+}
+
+// summary is the headline result of the calculation rtn of the step step.
+type summary struct {
+	step, rtn  int
+	name, path string
+	text       string
+}
+
+// add records the headline result of a calculation. It is safe for concurrent
+// use.
+func (s *summaries) add(sum summary) {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	s.lines = append(s.lines, sum)
+	s.mux.Unlock()
+}
+
+// writeReport writes the headline results of the calculations in Report, in
+// the order of the batch. The errors are logged.
+func (c Cfg) writeReport(log *log.Logger) {
+	lines := c.summaries.lines
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].step != lines[j].step {
+			return lines[i].step < lines[j].step
+		}
+		return lines[i].rtn < lines[j].rtn
+	})
+
+	out, err := util.Write(c.Report, c)
+	if err != nil {
+		log.Println(fmt.Errorf("Report: Write: %w", err))
+		return
+	}
+
+	out.WriteString("step routine type file summary\n")
+	for _, v := range lines {
+		fmt.Fprintf(out, "%d %d %s %s %s\n", v.step, v.rtn, v.name, v.path, v.text)
+	}
+
+	err = out.Close()
+	if err != nil {
+		log.Println(fmt.Errorf("Report: Close: %w", err))
+	}
+}
@@ -0,0 +1,124 @@
+package cfg
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tempDir returns a new temporary directory, removed at the end of the test.
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// write writes the files of content (path relative to dir: content) into dir.
+func write(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ls returns the names of the files of dir.
+func ls(t *testing.T, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestCheckDoesNotWrite(t *testing.T) {
+	dir := tempDir(t)
+	write(t, dir, map[string]string{
+		"cfg.toml": "types = [[\"gr\"]]\nfiles = [[\"" + filepath.Join(dir, "gr.toml") + "\"]]\n" +
+			"output_dir = \"" + filepath.Join(dir, "out") + "\"\n",
+		"gr.toml": "[gr]\nfile_in = \"traj.lammpstrj\"\ncfg_start = 0\ncfg_end = 10\n" +
+			"atoms = {1 = [\"1\"]}\nrmax = 5.0\ndr = 0.1\n",
+	})
+
+	c, err := New(filepath.Join(dir, "cfg.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := c.Check(); errs != nil {
+		t.Fatalf("Check: %v", errs)
+	}
+
+	if names := ls(t, dir); len(names) != 2 {
+		t.Errorf("New and Check wrote into the directory: %v", names)
+	}
+}
+
+func TestStartCreatesOutputDir(t *testing.T) {
+	dir := tempDir(t)
+	out := filepath.Join(dir, "a", "b")
+	write(t, dir, map[string]string{"cfg.toml": "types = []\nfiles = []\noutput_dir = \"" + out + "\"\n"})
+
+	c, err := New(filepath.Join(dir, "cfg.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("New created OutputDir (Stat: %v)", err)
+	}
+
+	c.Start(context.Background(), log.New(ioutil.Discard, "", 0))
+	if fi, err := os.Stat(out); err != nil || !fi.IsDir() {
+		t.Errorf("Start didn't create OutputDir (Stat: %v)", err)
+	}
+}
+
+func TestCheckFormat(t *testing.T) {
+	// displacement writes a trajectory: it ignores the JSON format instead of
+	// failing, but the format must exist.
+	tests := []struct {
+		format string
+		ok     bool
+	}{
+		{"text", true},
+		{"json", true},
+		{"xml", false},
+	}
+
+	for _, tt := range tests {
+		dir := tempDir(t)
+		write(t, dir, map[string]string{
+			"cfg.toml": "types = [[\"gr\", \"displacement\"]]\nfiles = [[\"" + filepath.Join(dir, "gr.toml") +
+				"\", \"" + filepath.Join(dir, "displacement.toml") + "\"]]\n" +
+				"output_dir = \"" + filepath.Join(dir, "out") + "\"\n",
+			"gr.toml": "[gr]\nfile_in = \"traj.lammpstrj\"\ncfg_end = 10\n" +
+				"atoms = {1 = [\"1\"]}\nrmax = 5.0\ndr = 0.1\n",
+			"displacement.toml": "[displacement]\nfile_in = \"traj.lammpstrj\"\ncfg_end = 10\nlag = 1\n" +
+				"file_out_format = \"" + tt.format + "\"\n",
+		})
+
+		c, err := New(filepath.Join(dir, "cfg.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := c.Check()
+		if tt.ok && errs != nil {
+			t.Errorf("%s: Check: %v", tt.format, errs)
+		} else if !tt.ok && len(errs) != 1 {
+			t.Errorf("%s: Check returned %v, want an error for displacement", tt.format, errs)
+		}
+	}
+}
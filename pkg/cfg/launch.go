@@ -1,13 +1,45 @@
 package cfg
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"math"
+	"time"
 
+	"github.com/kpotier/molsolvent/pkg/bondcorr"
+	"github.com/kpotier/molsolvent/pkg/bondlength"
+	"github.com/kpotier/molsolvent/pkg/channel"
+	"github.com/kpotier/molsolvent/pkg/coordination"
+	"github.com/kpotier/molsolvent/pkg/densityprofile"
+	"github.com/kpotier/molsolvent/pkg/dielectric"
+	"github.com/kpotier/molsolvent/pkg/displacement"
 	"github.com/kpotier/molsolvent/pkg/disttwoatoms"
+	"github.com/kpotier/molsolvent/pkg/extract"
+	"github.com/kpotier/molsolvent/pkg/fluctuation"
 	"github.com/kpotier/molsolvent/pkg/gr"
+	"github.com/kpotier/molsolvent/pkg/mindist"
+	"github.com/kpotier/molsolvent/pkg/msd"
 	"github.com/kpotier/molsolvent/pkg/nopbc"
+	"github.com/kpotier/molsolvent/pkg/occupancy"
+	"github.com/kpotier/molsolvent/pkg/orientation"
+	"github.com/kpotier/molsolvent/pkg/pairentropy"
+	"github.com/kpotier/molsolvent/pkg/persistence"
+	"github.com/kpotier/molsolvent/pkg/prefsolvation"
+	"github.com/kpotier/molsolvent/pkg/pressure"
 	"github.com/kpotier/molsolvent/pkg/radiusgyration"
+	"github.com/kpotier/molsolvent/pkg/shellreorient"
+	"github.com/kpotier/molsolvent/pkg/sq3d"
+	"github.com/kpotier/molsolvent/pkg/sqslab"
+	"github.com/kpotier/molsolvent/pkg/surfacedist"
+	"github.com/kpotier/molsolvent/pkg/tempprofile"
+	"github.com/kpotier/molsolvent/pkg/tetrahedral"
+	"github.com/kpotier/molsolvent/pkg/util"
+	"github.com/kpotier/molsolvent/pkg/vacf"
+	"github.com/kpotier/molsolvent/pkg/velprofile"
 	"github.com/kpotier/molsolvent/pkg/volume"
+
+	"github.com/pelletier/go-toml"
 )
 
 // Calculation is an interface that only contains one method: Start. Every
@@ -17,9 +49,208 @@ type Calculation interface {
 	Start() error
 }
 
+// Reporter is implemented by the calculations that can report their progress
+// (see util.Progress).
+type Reporter interface {
+	SetProgress(p *util.Progress)
+}
+
+// Inputter is implemented by the calculations whose reading of the trajectory
+// can be configured (see util.Input).
+type Inputter interface {
+	SetInput(in util.Input)
+}
+
+// Logger is implemented by the calculations that log warnings, e.g. when the
+// trajectory is shorter than requested.
+type Logger interface {
+	SetLog(log *log.Logger)
+}
+
+// Canceler is implemented by the calculations that can be interrupted through
+// a context, e.g. on Ctrl-C, and still write the results accumulated so far.
+type Canceler interface {
+	SetContext(ctx context.Context)
+}
+
+// Syncer is implemented by the calculations writing their results
+// configuration by configuration, which can store them on disk periodically
+// (see util.Syncer).
+type Syncer interface {
+	SetSyncEvery(every int)
+}
+
+// Outputter is implemented by the calculations whose output files can be named
+// automatically (see util.FileOut).
+type Outputter interface {
+	SetOutputDir(dir string)
+}
+
+// Formatter is implemented by the calculations whose output files can be
+// written in another format than util.FormatText (see util.WriteFormat).
+type Formatter interface {
+	SetOutputFormat(format string)
+}
+
+// Summarizer is implemented by the calculations that can sum up their main
+// result in one line, e.g. the mean radius of gyration. The lines of the
+// calculations of a batch are gathered in its report (see Cfg.Report).
+type Summarizer interface {
+	Summary() string
+}
+
 // Launch launchs a specific calculation. It is a thread blocking method. The
 // parameters required to launch the calculation must be in a file.
 func Launch(name string, path string) error {
+	cal, err := newCalculation(name, path, "")
+	if err != nil {
+		return err
+	}
+
+	err = cal.Start()
+	if err != nil {
+		return fmt.Errorf("%s: Start: %w", name, err)
+	}
+
+	return nil
+}
+
+// launch is like Launch but the calculation reports its progress in the JSON
+// format if ProgressJSON is set in the configuration file of the calculation
+// (progress_json in its section) or globally, and in log following
+// ProgressLog set in the same way (progress_log), its reading of the trajectory
+// follows ReadLimit, SkipDuplicateFrames, and VolumeStats set in the same way
+// (read_limit, skip_duplicate_frames, and volume_stats) and the range of
+// timesteps set in its section (timestep_start and timestep_end, see
+// util.TimestepFilter), its output is synced following SyncEvery (sync_every)
+// and written in FileOutFormat (file_out_format) if it implements Formatter,
+// and the output files without name are placed in OutputDir. step and rtn are
+// the position of the calculation in the batch. The warnings of the
+// calculation are written in log. The headline result of the calculation is
+// recorded for the report if it implements Summarizer.
+// The calculations implementing Canceler are interrupted when ctx is done.
+func (c Cfg) launch(ctx context.Context, log *log.Logger, step, rtn int) error {
+	name, path := c.Types[step][rtn], c.Files[step][rtn]
+	cal, tree, err := c.setup(name, path)
+	if err != nil {
+		return err
+	}
+
+	progressJSON, _ := tree.Get(name + ".progress_json").(string)
+	if progressJSON == "" {
+		progressJSON = c.ProgressJSON
+	}
+
+	progressLog := c.ProgressLog
+	switch every := tree.Get(name + ".progress_log").(type) {
+	case int64:
+		progressLog = float64(every)
+	case float64:
+		progressLog = every
+	}
+
+	if lg, ok := cal.(Logger); ok {
+		lg.SetLog(log)
+	}
+
+	if cl, ok := cal.(Canceler); ok {
+		cl.SetContext(ctx)
+	}
+
+	if rep, ok := cal.(Reporter); ok && (progressJSON != "" || progressLog > 0) {
+		progress, err := util.NewProgress(progressJSON, name, step, rtn)
+		if err != nil {
+			return fmt.Errorf("%s: NewProgress: %w", name, err)
+		}
+		defer progress.Close()
+		if progressLog > 0 {
+			progress.SetLog(log, time.Duration(progressLog*float64(time.Second)))
+		}
+		rep.SetProgress(progress)
+	}
+
+	err = cal.Start()
+	if err != nil {
+		return fmt.Errorf("%s: Start: %w", name, err)
+	}
+
+	if sum, ok := cal.(Summarizer); ok {
+		c.summaries.add(summary{step: step, rtn: rtn, name: name, path: path,
+			text: sum.Summary()})
+	}
+
+	return nil
+}
+
+// setup returns an instance of the calculation name whose parameters are in
+// the file path, and the content of this file. The reading of the trajectory,
+// the syncing, and the format of the output files are set like in launch, but
+// the trajectory isn't read.
+func (c Cfg) setup(name, path string) (Calculation, *toml.Tree, error) {
+	cal, err := newCalculation(name, path, c.OutputDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: LoadFile: %w", name, err)
+	}
+
+	input := util.Input{ReadLimit: c.ReadLimit, SkipDuplicateFrames: c.SkipDuplicateFrames,
+		VolumeStats: c.VolumeStats}
+	if readLimit, ok := tree.Get(name + ".read_limit").(int64); ok {
+		input.ReadLimit = readLimit
+	}
+	if skip, ok := tree.Get(name + ".skip_duplicate_frames").(bool); ok {
+		input.SkipDuplicateFrames = skip
+	}
+	if stats, ok := tree.Get(name + ".volume_stats").(bool); ok {
+		input.VolumeStats = stats
+	}
+
+	start, okStart := tree.Get(name + ".timestep_start").(int64)
+	end, okEnd := tree.Get(name + ".timestep_end").(int64)
+	if okStart || okEnd {
+		if !okEnd {
+			end = math.MaxInt64
+		}
+		if start >= end {
+			return nil, nil, fmt.Errorf("%s: timestep_start is greater or equal than timestep_end", name)
+		}
+		input.Timesteps = &util.TimestepRange{Start: start, End: end}
+	}
+
+	if inp, ok := cal.(Inputter); ok {
+		inp.SetInput(input)
+	}
+
+	syncEvery := c.SyncEvery
+	if every, ok := tree.Get(name + ".sync_every").(int64); ok {
+		syncEvery = int(every)
+	}
+	if sy, ok := cal.(Syncer); ok {
+		sy.SetSyncEvery(syncEvery)
+	}
+
+	format, ok := tree.Get(name + ".file_out_format").(string)
+	if !ok {
+		format = c.FileOutFormat
+	}
+	err = util.CheckFormat(format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: CheckFormat: %w", name, err)
+	}
+	if fo, ok := cal.(Formatter); ok { // the others are written in util.FormatText
+		fo.SetOutputFormat(format)
+	}
+
+	return cal, tree, nil
+}
+
+// newCalculation returns an instance of a specific calculation. The output
+// files without name are placed in dir.
+func newCalculation(name string, path string, dir string) (Calculation, error) {
 	var (
 		err error
 		cal Calculation
@@ -36,18 +267,67 @@ func Launch(name string, path string) error {
 		cal, err = gr.New(path)
 	case volume.Type:
 		cal, err = volume.New(path)
+	case bondcorr.Type:
+		cal, err = bondcorr.New(path)
+	case sq3d.Type:
+		cal, err = sq3d.New(path)
+	case occupancy.Type:
+		cal, err = occupancy.New(path)
+	case orientation.Type:
+		cal, err = orientation.New(path)
+	case coordination.Type:
+		cal, err = coordination.New(path)
+	case extract.Type:
+		cal, err = extract.New(path)
+	case tetrahedral.Type:
+		cal, err = tetrahedral.New(path)
+	case fluctuation.Type:
+		cal, err = fluctuation.New(path)
+	case prefsolvation.Type:
+		cal, err = prefsolvation.New(path)
+	case bondlength.Type:
+		cal, err = bondlength.New(path)
+	case pressure.Type:
+		cal, err = pressure.New(path)
+	case velprofile.Type:
+		cal, err = velprofile.New(path)
+	case shellreorient.Type:
+		cal, err = shellreorient.New(path)
+	case channel.Type:
+		cal, err = channel.New(path)
+	case displacement.Type:
+		cal, err = displacement.New(path)
+	case mindist.Type:
+		cal, err = mindist.New(path)
+	case msd.Type:
+		cal, err = msd.New(path)
+	case surfacedist.Type:
+		cal, err = surfacedist.New(path)
+	case pairentropy.Type:
+		cal, err = pairentropy.New(path)
+	case dielectric.Type:
+		cal, err = dielectric.New(path)
+	case sqslab.Type:
+		cal, err = sqslab.New(path)
+	case tempprofile.Type:
+		cal, err = tempprofile.New(path)
+	case persistence.Type:
+		cal, err = persistence.New(path)
+	case densityprofile.Type:
+		cal, err = densityprofile.New(path)
+	case vacf.Type:
+		cal, err = vacf.New(path)
 	default:
-		return fmt.Errorf("calculation `%s` doesn't exist", name)
+		return nil, fmt.Errorf("calculation `%s` doesn't exist", name)
 	}
 
 	if err != nil {
-		return fmt.Errorf("%s: New: %w", name, err)
+		return nil, fmt.Errorf("%s: New: %w", name, err)
 	}
 
-	err = cal.Start()
-	if err != nil {
-		return fmt.Errorf("%s: Start: %w", name, err)
+	if out, ok := cal.(Outputter); ok {
+		out.SetOutputDir(dir)
 	}
 
-	return nil
+	return cal, nil
 }
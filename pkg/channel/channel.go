@@ -0,0 +1,285 @@
+// Package channel counts the atoms inside a cylinder (e.g. an ion channel or a
+// nanopore) over time, and the permeation events, i.e. the atoms going through
+// the cylinder from one end to the other.
+package channel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "channel"
+
+// The positions of an atom relative to the cylinder.
+const (
+	below   = -1 // below the lower end
+	inside  = 0
+	lateral = 2 // between the ends but farther than the radius from the axis
+	above   = 1 // above the upper end
+)
+
+// Channel is a structure containing the parameters that can be parsed from a
+// TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the state of each atom.
+//
+// The axis of the cylinder is parallel to Axis (x, y, or z) and goes through
+// Center. The cylinder goes from Range[0] to Range[1] along the axis, and its
+// radius is Radius. The distance to the axis uses the minimum image
+// convention, but not the position along the axis: the cylinder must not
+// cross the box boundaries along the axis.
+// Only the atoms whose type is in Atoms are counted. An atom permeates the
+// cylinder when it leaves the cylinder through the opposite end of the one
+// through which it entered. The atoms going through the cylinder between two
+// configurations are not seen. The atoms are identified by the id column.
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd, the
+// configurations read are used and a warning is logged.
+type Channel struct {
+	FileIn  string `toml:"channel.file_in"`
+	FileOut string `toml:"channel.file_out"`
+
+	CfgStart int `toml:"channel.cfg_start"`
+	CfgEnd   int `toml:"channel.cfg_end"`
+
+	Atoms []string `toml:"channel.atoms"`
+
+	Axis   string    `toml:"channel.axis"`
+	Center []float64 `toml:"channel.center"`
+	Radius float64   `toml:"channel.radius"`
+	Range  []float64 `toml:"channel.range"`
+
+	Dt float64 `toml:"channel.dt"`
+
+	types  map[string]bool
+	axis   int
+	center [3]float64
+
+	// entry is the end through which each atom inside the cylinder entered it
+	// (below, above, or lateral), last is the position of each atom at the
+	// previous configuration.
+	entry map[string]int
+	last  map[string]int
+
+	up, down int
+
+	atoms   int
+	cols    [5]int
+	colsLen int
+
+	syncEvery int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Channel structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Channel, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var channel Channel
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&channel)
+	if err != nil {
+		return nil, err
+	}
+
+	if channel.CfgStart >= channel.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(channel.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	switch channel.Axis {
+	case "x":
+		channel.axis = 0
+	case "y":
+		channel.axis = 1
+	case "z", "":
+		channel.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", channel.Axis)
+	}
+
+	if len(channel.Center) != 3 {
+		return nil, errors.New("length of Center is not equal to 3")
+	}
+	copy(channel.center[:], channel.Center)
+
+	if channel.Radius <= 0 {
+		return nil, errors.New("Radius must be strictly positive")
+	}
+
+	if len(channel.Range) != 2 || channel.Range[0] >= channel.Range[1] {
+		return nil, errors.New("Range must contain two increasing positions")
+	}
+
+	channel.types = make(map[string]bool, len(channel.Atoms))
+	for _, v := range channel.Atoms {
+		channel.types[v] = true
+	}
+
+	channel.entry = make(map[string]int)
+	channel.last = make(map[string]int)
+
+	return &channel, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (c *Channel) SetOutputDir(dir string) {
+	c.FileOut = util.FileOut(c.FileOut, dir, c.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (c *Channel) SetOutputFormat(format string) {
+	c.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (c *Channel) SetProgress(p *util.Progress) {
+	c.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (c *Channel) SetInput(in util.Input) {
+	c.input = in
+}
+
+// SetSyncEvery sets the number of configurations between two syncs of the
+// output file (see util.Syncer).
+func (c *Channel) SetSyncEvery(every int) {
+	c.syncEvery = every
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (c *Channel) SetLog(log *log.Logger) {
+	c.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (c *Channel) Start() error {
+	f, traj, err := util.OpenTrajectory(c.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(c.input.Reader(traj))
+
+	out, err := util.WriteFormat(c.FileOut, c, c.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	syncer := util.NewSyncer(out, c.syncEvery)
+	out.WriteString("cfg t count up down\n")
+
+	err = c.input.SkipTo(f, r, 0, c.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, ids, xyz, err := c.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	c.calc(out, 0, box, ids, xyz)
+
+	for i := 1; i < (c.CfgEnd - c.CfgStart); i++ {
+		err = c.input.SkipTo(f, r, c.CfgStart+i, c.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(c.log, Type, c.CfgStart+i, c.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, ids, xyz, err := c.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		c.calc(out, i, box, ids, xyz)
+		c.progress.Update(i+1, c.CfgEnd-c.CfgStart)
+		err = syncer.Frame()
+		if err != nil {
+			return fmt.Errorf("Sync (step %d): %w", i, err)
+		}
+	}
+
+	fmt.Fprintf(out, "\npermeations_up permeations_down permeations\n%d %d %d\n",
+		c.up, c.down, c.up+c.down)
+
+	return nil
+}
+
+// calc counts the atoms inside the cylinder, updates the permeation events,
+// and writes the results into a file. The up and down columns are the number
+// of permeation events (along and against the axis) since the first
+// configuration.
+func (c *Channel) calc(w io.Writer, cfg int, box [3]float64, ids []string, xyz [][3]float64) {
+	var count int
+	for i, id := range ids {
+		pos := c.position(box, xyz[i])
+		if pos == inside {
+			count++
+		}
+
+		last, ok := c.last[id]
+		c.last[id] = pos
+		if !ok || last == pos {
+			continue
+		}
+
+		switch {
+		case pos == inside:
+			c.entry[id] = last
+		case last == inside:
+			if c.entry[id] == below && pos == above {
+				c.up++
+			} else if c.entry[id] == above && pos == below {
+				c.down++
+			}
+			delete(c.entry, id)
+		}
+	}
+
+	fmt.Fprintf(w, "%d %g %d %d %d\n", (cfg + c.CfgStart),
+		(float64(cfg+c.CfgStart) * c.Dt), count, c.up, c.down)
+}
+
+// position returns the position of an atom relative to the cylinder.
+func (c *Channel) position(box [3]float64, xyz [3]float64) int {
+	switch {
+	case xyz[c.axis] < c.Range[0]:
+		return below
+	case xyz[c.axis] > c.Range[1]:
+		return above
+	}
+
+	d := util.MinImage(xyz, c.center, box)
+	d[c.axis] = 0
+	dist := d[0]*d[0] + d[1]*d[1] + d[2]*d[2]
+
+	if dist > c.Radius*c.Radius {
+		return lateral
+	}
+	return inside
+}
@@ -0,0 +1,114 @@
+package channel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newChannel writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [channel]) into a temporary directory,
+// and returns the calculation read from this file by New.
+func newChannel(t *testing.T, params, traj string) *Channel {
+	dir, err := ioutil.TempDir("", "channel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "channel.toml")
+	cfg := fmt.Sprintf("[channel]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "channel.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// configuration returns a configuration of a cubic box of length 10 containing
+// the atoms xyz of type 1.
+func configuration(step int, xyz [][3]float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", step, len(xyz))
+	b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+	for i, v := range xyz {
+		fmt.Fprintf(&b, "%d 1 %g %g %g\n", i+1, v[0], v[1], v[2])
+	}
+	return b.String()
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations: the atom goes through the cylinder
+	// along z.
+	var traj strings.Builder
+	for i, z := range []float64{1, 5, 9} {
+		traj.WriteString(configuration(i, [][3]float64{{5, 5, z}}))
+	}
+
+	c := newChannel(t, "cfg_end = 10\natoms = [\"1\"]\ncenter = [5.0, 5.0, 0.0]\nradius = 2.0\nrange = [3.0, 7.0]\ndt = 1.0\n",
+		traj.String())
+	var logs strings.Builder
+	c.SetLog(log.New(&logs, "", 0))
+	err := c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "channel: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(c.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if !strings.Contains(out, "cfg t count up down\n0 0 0 0 0\n1 1 1 0 0\n2 2 0 1 0\n\n") {
+		t.Errorf("wrong counts:\n%s", out)
+	}
+	if !strings.Contains(out, "\npermeations_up permeations_down permeations\n1 0 1\n") {
+		t.Errorf("wrong permeations:\n%s", out)
+	}
+}
+
+func TestPosition(t *testing.T) {
+	// The cylinder is centered on a corner of the box: the atoms are inside it
+	// through the boundaries.
+	c := newChannel(t, "cfg_end = 1\natoms = [\"1\"]\ncenter = [0.5, 9.5, 0.0]\nradius = 1.0\nrange = [3.0, 7.0]\n", "")
+	box := [3]float64{10, 10, 10}
+
+	tests := []struct {
+		xyz  [3]float64
+		want int
+	}{
+		{[3]float64{0.5, 9.5, 5}, inside},
+		{[3]float64{9.8, 9.5, 5}, inside},
+		{[3]float64{0.5, 0.2, 5}, inside},
+		{[3]float64{9.8, 0.2, 5}, inside},
+		{[3]float64{8.8, 9.5, 5}, lateral},
+		{[3]float64{5, 5, 5}, lateral},
+		{[3]float64{9.8, 0.2, 1}, below},
+		{[3]float64{9.8, 0.2, 9}, above},
+	}
+
+	for _, tt := range tests {
+		if got := c.position(box, tt.xyz); got != tt.want {
+			t.Errorf("position(%v) = %d, want %d", tt.xyz, got, tt.want)
+		}
+	}
+}
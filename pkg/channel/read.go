@@ -0,0 +1,121 @@
+package channel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (c *Channel) readCfgFirst(r *bufio.Reader) (box [3]float64, ids []string, xyz [][3]float64, err error) {
+	c.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	c.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			c.cols[0] = k
+		case "y":
+			c.cols[1] = k
+		case "z":
+			c.cols[2] = k
+		case "type":
+			c.cols[3] = k
+		case "id":
+			c.cols[4] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(c.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, z, type, and id")
+		return
+	}
+
+	ids, xyz, err = c.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (c *Channel) readCfg(r *bufio.Reader) (box [3]float64, ids []string, xyz [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	ids, xyz, err = c.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the identifiers and the coordinates of the atoms whose type
+// is in Atoms. An identifier must not appear more than once.
+func (c *Channel) fetchXYZ(r *bufio.Reader) (ids []string, xyz [][3]float64, err error) {
+	seen := make(map[string]bool, len(c.last))
+	for i := 0; i < c.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != c.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), c.colsLen)
+			return
+		}
+
+		if !c.types[fields[c.cols[3]]] {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[c.cols[k]], 64)
+		}
+
+		id := fields[c.cols[4]]
+		if seen[id] {
+			err = fmt.Errorf("id %s appears more than once", id)
+			return
+		}
+		seen[id] = true
+
+		ids = append(ids, id)
+		xyz = append(xyz, xyzTmp)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
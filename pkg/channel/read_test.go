@@ -0,0 +1,41 @@
+package channel
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestFetchXYZIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		atoms string // columns id type x y z
+		ids   []string
+		err   string // empty if no error is expected
+	}{
+		{"valid", "1 1 0 0 0\n2 1 1 0 0\n3 2 2 0 0\n", []string{"1", "2"}, ""},
+		{"out of order", "2 1 0 0 0\n3 2 1 0 0\n1 1 2 0 0\n", []string{"2", "1"}, ""},
+		{"duplicated other type", "1 1 0 0 0\n3 2 1 0 0\n3 2 2 0 0\n", []string{"1"}, ""},
+		{"duplicated", "1 1 0 0 0\n2 1 1 0 0\n1 1 2 0 0\n", nil, "id 1 appears more than once"},
+	}
+
+	for _, tt := range tests {
+		c := &Channel{types: map[string]bool{"1": true}, atoms: 3, cols: [5]int{2, 3, 4, 1, 0}, colsLen: 5,
+			last: make(map[string]int)}
+		ids, _, err := c.fetchXYZ(bufio.NewReader(strings.NewReader(tt.atoms)))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if strings.Join(ids, " ") != strings.Join(tt.ids, " ") {
+			t.Errorf("%s: ids %v, want %v", tt.name, ids, tt.ids)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package coordination calculates the average coordination number of an atom
+// type over time, and optionally its autocorrelation.
+package coordination
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "coordination"
+
+// XYZ is a type that represents the coordinates for each atom.
+type XYZ map[string][][3]float64
+
+// Coordination is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, and the number of columns.
+// The coordination number of an atom of type Center is the number of atoms of
+// type Neighbor whose distance is lower or equal than Cutoff. CfgStart must be
+// lower than CfgEnd. If Frames is set, only these configurations are processed
+// and CfgStart and CfgEnd are ignored (see util.NewFrames). If the trajectory
+// ends before the last configuration, the configurations read are used (the
+// autocorrelation stops at the last one) and a warning is logged.
+// If FileOutFrames is set, the index and the timestep of each processed
+// configuration are written into this file (see util.FrameMap).
+// If LagMax is set, the normalized autocorrelation of the coordination number
+// C(t) = <δn(t0)δn(t0+t)>/<δn²>, δn being the deviation of the coordination
+// number of an atom from the average over every atom and configuration, is
+// written after the time series up to LagMax (averaged over the atoms and the
+// time origins). The lags are counted in processed configurations, and the
+// atoms of type Center must be in the same order in every configuration
+// (dump_modify sort id).
+type Coordination struct {
+	FileIn  string `toml:"coordination.file_in"`
+	FileOut string `toml:"coordination.file_out"`
+
+	FileOutFrames string `toml:"coordination.file_out_frames"`
+
+	CfgStart int   `toml:"coordination.cfg_start"`
+	CfgEnd   int   `toml:"coordination.cfg_end"`
+	Frames   []int `toml:"coordination.frames"`
+
+	Center   string  `toml:"coordination.center"`
+	Neighbor string  `toml:"coordination.neighbor"`
+	Cutoff   float64 `toml:"coordination.cutoff"`
+
+	LagMax int `toml:"coordination.lag_max"`
+
+	Dt float64 `toml:"coordination.dt"`
+
+	cutoff2 float64
+	n       [][]float64 // coordination number of each atom and configuration
+	frames  util.Frames
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+	frameMap *util.FrameMap
+	timestep string
+}
+
+// New returns an instance of the Coordination structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Coordination, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var coordination Coordination
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&coordination)
+	if err != nil {
+		return nil, err
+	}
+
+	coordination.frames, err = util.NewFrames(coordination.Frames,
+		coordination.CfgStart, coordination.CfgEnd)
+	if err != nil {
+		return nil, fmt.Errorf("NewFrames: %w", err)
+	}
+
+	if coordination.Cutoff <= 0 {
+		return nil, errors.New("Cutoff must be strictly positive")
+	}
+
+	if coordination.LagMax < 0 || coordination.LagMax >= len(coordination.frames) {
+		return nil, errors.New("LagMax must be positive and lower than the number of configurations")
+	}
+
+	if coordination.FileOutFrames != "" {
+		coordination.frameMap = util.NewFrameMap()
+	}
+
+	coordination.cutoff2 = util.Pow(coordination.Cutoff, 2)
+	return &coordination, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (c *Coordination) SetOutputDir(dir string) {
+	c.FileOut = util.FileOut(c.FileOut, dir, c.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (c *Coordination) SetOutputFormat(format string) {
+	c.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (c *Coordination) SetProgress(p *util.Progress) {
+	c.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (c *Coordination) SetInput(in util.Input) {
+	c.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (c *Coordination) SetLog(log *log.Logger) {
+	c.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (c *Coordination) Start() error {
+	f, traj, err := util.OpenTrajectory(c.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(c.input.Reader(traj))
+
+	out, err := util.WriteFormat(c.FileOut, c, c.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	out.WriteString("cfg t mean_coordination std_coordination\n")
+
+	err = c.input.SkipTo(f, r, 0, c.frames[0])
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := c.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	err = c.calc(out, c.frames[0], box, xyz)
+	if err != nil {
+		return fmt.Errorf("calc: %w", err)
+	}
+	c.frameMap.Add(c.frames[0], c.timestep)
+
+	for i := 1; i < len(c.frames); i++ {
+		err = c.input.SkipTo(f, r, c.frames.From(i), c.frames[i])
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(c.log, Type, c.frames[i], c.frames[len(c.frames)-1], i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", c.frames[i], err)
+		}
+
+		box, xyz, err := c.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", c.frames[i], err)
+		}
+		err = c.calc(out, c.frames[i], box, xyz)
+		if err != nil {
+			return fmt.Errorf("calc (step %d): %w", c.frames[i], err)
+		}
+		c.frameMap.Add(c.frames[i], c.timestep)
+		c.progress.Update(i+1, len(c.frames))
+	}
+
+	if c.LagMax > 0 {
+		c.writeACF(out)
+	}
+
+	err = c.frameMap.Write(c.FileOutFrames)
+	if err != nil {
+		return fmt.Errorf("FrameMap: %w", err)
+	}
+
+	return nil
+}
+
+// calc calculates the coordination number of each atom of type Center and
+// writes the average and the standard deviation into a file. The coordination
+// numbers are saved if LagMax is set.
+func (c *Coordination) calc(w io.Writer, cfg int, box [3]float64, xyz XYZ) error {
+	var (
+		sum, sum2 float64
+		ns        []float64
+	)
+	if c.LagMax > 0 {
+		if len(c.n) > 0 && len(xyz[c.Center]) != len(c.n[0]) {
+			return fmt.Errorf("number of center atoms don't match: %d (expected %d)",
+				len(xyz[c.Center]), len(c.n[0]))
+		}
+		ns = make([]float64, 0, len(xyz[c.Center]))
+	}
+
+	for id1, xyzAt1 := range xyz[c.Center] {
+		var n float64
+		for id2, xyzAt2 := range xyz[c.Neighbor] {
+			if c.Center == c.Neighbor && id1 == id2 {
+				continue
+			}
+
+			dist := util.MinImageDist2(xyzAt1, xyzAt2, box)
+
+			if dist <= c.cutoff2 {
+				n++
+			}
+		}
+
+		sum += n
+		sum2 += n * n
+		if c.LagMax > 0 {
+			ns = append(ns, n)
+		}
+	}
+
+	if c.LagMax > 0 {
+		c.n = append(c.n, ns)
+	}
+
+	var mean, std float64
+	if nb := float64(len(xyz[c.Center])); nb > 0 {
+		mean = sum / nb
+		std = math.Sqrt(math.Max(sum2/nb-mean*mean, 0))
+	}
+
+	fmt.Fprintf(w, "%d %g %g %g\n", cfg, (float64(cfg) * c.Dt), mean, std)
+	return nil
+}
+
+// writeACF calculates the normalized autocorrelation of the coordination
+// number using every configuration as a time origin and writes it into a file.
+func (c *Coordination) writeACF(w io.Writer) {
+	var mean, nb float64
+	for _, ns := range c.n {
+		for _, n := range ns {
+			mean += n
+			nb++
+		}
+	}
+	if nb > 0 {
+		mean /= nb
+	}
+
+	lagMax := c.LagMax
+	if lagMax >= len(c.n) {
+		lagMax = len(c.n) - 1
+	}
+
+	acf := make([]float64, lagMax+1)
+	norm := make([]float64, lagMax+1)
+	for t0, ns0 := range c.n {
+		for at, n0 := range ns0 {
+			for lag := 0; lag <= lagMax && (t0+lag) < len(c.n); lag++ {
+				acf[lag] += (n0 - mean) * (c.n[t0+lag][at] - mean)
+				norm[lag]++
+			}
+		}
+	}
+
+	fmt.Fprint(w, "\nlag t C_n\n")
+	var var0 float64 // <δn²>
+	for lag := 0; lag <= lagMax; lag++ {
+		if norm[lag] > 0 {
+			acf[lag] /= norm[lag]
+		}
+		if lag == 0 {
+			var0 = acf[0]
+		}
+		if var0 != 0 {
+			acf[lag] /= var0
+		}
+		fmt.Fprintf(w, "%d %g %g\n", lag, float64(lag)*c.Dt, acf[lag])
+	}
+}
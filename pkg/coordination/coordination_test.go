@@ -0,0 +1,149 @@
+package coordination
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// trajectory returns a LAMMPS trajectory of n configurations with an atom of
+// type 1 and 20 atoms of type 2. In the configuration i, whose timestep is
+// 100·i, i%20 atoms of type 2 are at a distance of 1 from the atom of type 1
+// and the others are far from it.
+func trajectory(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n21\n", 100*i)
+		b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 30\n0 30\n0 30\nITEM: ATOMS id type x y z\n")
+		b.WriteString("1 1 5 5 5\n")
+		for j := 0; j < 20; j++ {
+			if j < i%20 {
+				fmt.Fprintf(&b, "%d 2 6 5 5\n", j+2)
+			} else {
+				fmt.Fprintf(&b, "%d 2 20 20 %d\n", j+2, j)
+			}
+		}
+	}
+	return b.String()
+}
+
+// newCoordination writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [coordination]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newCoordination(t *testing.T, params, traj string) (*Coordination, error) {
+	dir, err := ioutil.TempDir("", "coordination")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "coordination.toml")
+	cfg := fmt.Sprintf("[coordination]\nfile_in = %q\nfile_out = %q\nfile_out_frames = %q\n"+
+		"center = \"1\"\nneighbor = \"2\"\ncutoff = 1.5\ndt = 0.5\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "coordination.dat"),
+		filepath.Join(dir, "frames.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(path)
+}
+
+// run runs the calculation of newCoordination. It returns the output file and
+// the file of the processed configurations.
+func run(t *testing.T, params, traj string) (string, string, error) {
+	c, err := newCoordination(t, params, traj)
+	if err != nil {
+		return "", "", fmt.Errorf("New: %w", err)
+	}
+
+	err = c.Start()
+	if err != nil {
+		return "", "", err
+	}
+
+	out, err := ioutil.ReadFile(c.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := ioutil.ReadFile(c.FileOutFrames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := string(out)
+	return s[strings.Index(s, "cfg t "):], string(frames), nil
+}
+
+func TestFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		cfgs   []int // processed configurations
+	}{
+		{"range", "cfg_start = 2\ncfg_end = 6\n", []int{2, 3, 4, 5}},
+		{"sparse", "frames = [3, 12, 17]\n", []int{3, 12, 17}},
+		{"unordered", "frames = [17, 0, 12, 3, 8]\n", []int{0, 3, 8, 12, 17}},
+		{"consecutive", "frames = [9, 7, 8]\n", []int{7, 8, 9}},
+		{"last", "frames = [19]\n", []int{19}},
+		{"frames and range", "cfg_start = 0\ncfg_end = 2\nframes = [5, 1]\n", []int{1, 5}},
+	}
+
+	for _, tt := range tests {
+		out, frames, err := run(t, tt.params, trajectory(20))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		want := "cfg t mean_coordination std_coordination\n"
+		wantFrames := "cfg timestep\n"
+		for _, cfg := range tt.cfgs {
+			want += fmt.Sprintf("%d %g %d 0\n", cfg, 0.5*float64(cfg), cfg)
+			wantFrames += fmt.Sprintf("%d %d\n", cfg, 100*cfg)
+		}
+
+		if out != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, out, want)
+		}
+		if frames != wantFrames {
+			t.Errorf("%s: got the configurations\n%s\nwant\n%s", tt.name, frames, wantFrames)
+		}
+	}
+}
+
+func TestFramesBeyond(t *testing.T) {
+	c, err := newCoordination(t, "frames = [3, 25]\nlag_max = 1\n", trajectory(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	c.SetLog(log.New(&logs, "", 0))
+	err = c.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "coordination: the trajectory ends before the configuration 25 (requested up to 25), 1 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	// The autocorrelation stops at the lag 0, the only configuration read.
+	out, err := ioutil.ReadFile(c.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(out), "cfg t mean_coordination std_coordination\n3 1.5 3 0\n\nlag t C_n\n0 0 0\n") {
+		t.Errorf("wrong output:\n%s", out)
+	}
+}
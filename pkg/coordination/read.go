@@ -0,0 +1,119 @@
+package coordination
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (c *Coordination) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	var header bytes.Buffer
+	c.atoms, box, err = util.Header(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+	c.timestep = util.Timestep(header.Bytes())
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	c.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			c.cols[0] = k
+		case "y":
+			c.cols[1] = k
+		case "z":
+			c.cols[2] = k
+		case "type":
+			c.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(c.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = c.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (c *Coordination) readCfg(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	var header bytes.Buffer
+	box, err = util.HeaderWOutAtoms(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+	c.timestep = util.Timestep(header.Bytes())
+
+	r.ReadSlice('\n')
+
+	xyz, err = c.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms of type Center and Neighbor.
+func (c *Coordination) fetchXYZ(r *bufio.Reader) (XYZ, error) {
+	xyz := XYZ{c.Center: nil, c.Neighbor: nil}
+	for i := 0; i < c.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != c.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), c.colsLen)
+		}
+
+		typ := fields[c.cols[3]]
+		xyzTyp, ok := xyz[typ]
+		if !ok {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[c.cols[k]], 64)
+		}
+
+		xyz[typ] = append(xyzTyp, xyzTmp)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
+	return b
+}
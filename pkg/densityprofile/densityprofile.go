@@ -0,0 +1,253 @@
+// Package densityprofile calculates the number density of atom types along an
+// axis of the box, e.g. across an interface.
+//
+// The box is cut into slabs of width Dr perpendicular to the axis, starting at
+// 0. The number of atoms of each type in a slab is divided by the volume of the
+// slab in each configuration, and the densities are averaged over the
+// configurations.
+package densityprofile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "density_profile"
+
+// DensityProfile is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the accumulated densities.
+// The atoms of each type of Atoms are assigned to a slab according to their
+// wrapped position (x, y, or z column) along Axis (z by default), brought back
+// into the box. The slabs have a width of Dr and cover the length of the box
+// along Axis in the first configuration; the last slab is narrower if the
+// length isn't a multiple of Dr. If the box shrinks, the volume of the slabs
+// follows it; if it grows, the atoms beyond the last slab are not taken into
+// account. CfgStart must be lower than CfgEnd. If the trajectory ends before
+// CfgEnd, the densities are averaged over the configurations read and a warning
+// is logged.
+type DensityProfile struct {
+	FileIn  string `toml:"density_profile.file_in"`
+	FileOut string `toml:"density_profile.file_out"`
+
+	CfgStart int `toml:"density_profile.cfg_start"`
+	CfgEnd   int `toml:"density_profile.cfg_end"`
+
+	Atoms []string `toml:"density_profile.atoms"`
+
+	Axis string  `toml:"density_profile.axis"`
+	Dr   float64 `toml:"density_profile.dr"`
+
+	types  map[string]int // index of each atom type in Atoms
+	axis   int
+	nb     int     // number of slabs
+	length float64 // length of the box along the axis in the first configuration
+
+	density [][]float64 // sum of the densities of each type in each slab
+	nbCfg   int
+
+	atoms   int
+	cols    [2]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the DensityProfile structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*DensityProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var densityProfile DensityProfile
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&densityProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if densityProfile.CfgStart >= densityProfile.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(densityProfile.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	densityProfile.types = make(map[string]int, len(densityProfile.Atoms))
+	for k, v := range densityProfile.Atoms {
+		if _, ok := densityProfile.types[v]; ok {
+			return nil, fmt.Errorf("atom type `%s` is selected twice", v)
+		}
+		densityProfile.types[v] = k
+	}
+
+	switch densityProfile.Axis {
+	case "x":
+		densityProfile.axis = 0
+	case "y":
+		densityProfile.axis = 1
+	case "z", "":
+		densityProfile.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", densityProfile.Axis)
+	}
+
+	if densityProfile.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	return &densityProfile, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (d *DensityProfile) SetOutputDir(dir string) {
+	d.FileOut = util.FileOut(d.FileOut, dir, d.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (d *DensityProfile) SetOutputFormat(format string) {
+	d.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (d *DensityProfile) SetProgress(p *util.Progress) {
+	d.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (d *DensityProfile) SetInput(in util.Input) {
+	d.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (d *DensityProfile) SetLog(log *log.Logger) {
+	d.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (d *DensityProfile) Start() error {
+	f, traj, err := util.OpenTrajectory(d.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(d.input.Reader(traj))
+
+	err = d.input.SkipTo(f, r, 0, d.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, pos, types, err := d.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	d.length = box[d.axis]
+	d.nb = int(math.Ceil(d.length / d.Dr))
+	d.density = make([][]float64, len(d.Atoms))
+	for k := range d.density {
+		d.density[k] = make([]float64, d.nb)
+	}
+	d.calc(box, pos, types)
+
+	for i := 1; i < (d.CfgEnd - d.CfgStart); i++ {
+		err = d.input.SkipTo(f, r, d.CfgStart+i, d.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(d.log, Type, d.CfgStart+i, d.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, pos, types, err := d.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		d.calc(box, pos, types)
+		d.progress.Update(i+1, d.CfgEnd-d.CfgStart)
+	}
+
+	out, err := util.WriteFormat(d.FileOut, d, d.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	d.write(out)
+
+	return nil
+}
+
+// calc adds the number of atoms of each type in each slab divided by the
+// volume of the slab. pos are the positions along the axis and types the
+// indices of the types of the atoms in Atoms.
+func (d *DensityProfile) calc(box [3]float64, pos []float64, types []int) {
+	length := box[d.axis]
+	area := box[0] * box[1] * box[2] / length
+
+	count := make([][]float64, len(d.Atoms))
+	for k := range count {
+		count[k] = make([]float64, d.nb)
+	}
+
+	for i, v := range pos {
+		v -= length * math.Floor(v/length)
+		slab := int(v / d.Dr)
+		if slab >= d.nb {
+			continue
+		}
+		count[types[i]][slab]++
+	}
+
+	for slab := 0; slab < d.nb; slab++ {
+		width := math.Min(d.Dr, length-float64(slab)*d.Dr)
+		if width <= 0 {
+			break
+		}
+
+		for k := range count {
+			d.density[k][slab] += count[k][slab] / (width * area)
+		}
+	}
+	d.nbCfg++
+}
+
+// write writes the middle of each slab along the axis in the first
+// configuration and the average density of each atom type (pos rho_type...).
+func (d *DensityProfile) write(w io.Writer) {
+	nbCfg := float64(d.nbCfg)
+	fmt.Fprint(w, "pos")
+	for _, v := range d.Atoms {
+		fmt.Fprint(w, " rho_", v)
+	}
+	fmt.Fprint(w, "\n")
+
+	for slab := 0; slab < d.nb; slab++ {
+		lo := float64(slab) * d.Dr
+		fmt.Fprint(w, (lo+math.Min(lo+d.Dr, d.length))/2.)
+		for k := range d.density {
+			fmt.Fprint(w, " ", d.density[k][slab]/nbCfg)
+		}
+		fmt.Fprint(w, "\n")
+	}
+}
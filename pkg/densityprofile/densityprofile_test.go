@@ -0,0 +1,72 @@
+package densityprofile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newDensityProfile writes the trajectory traj and the configuration file made
+// of the parameters params (without the table [density_profile]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newDensityProfile(t *testing.T, params, traj string) *DensityProfile {
+	dir, err := ioutil.TempDir("", "densityprofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "densityprofile.toml")
+	cfg := fmt.Sprintf("[density_profile]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "densityprofile.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations with an atom in the first slab, of
+	// volume 500.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&traj, "1 1 %d 0 2.5\n", i)
+	}
+
+	d := newDensityProfile(t, "cfg_end = 10\natoms = [\"1\"]\ndr = 5.0\n", traj.String())
+	var logs strings.Builder
+	d.SetLog(log.New(&logs, "", 0))
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "density_profile: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(d.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "pos rho_1\n2.5 0.002\n7.5 0\n") {
+		t.Errorf("the densities aren't averaged over the 3 configurations read:\n%s", b)
+	}
+}
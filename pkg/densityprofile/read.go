@@ -0,0 +1,106 @@
+package densityprofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (d *DensityProfile) readCfgFirst(r *bufio.Reader) (box [3]float64, pos []float64, types []int, err error) {
+	d.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	coord := [3]string{"x", "y", "z"}[d.axis]
+
+	var found int
+	d.colsLen = len(fields)
+	for k, name := range fields {
+		switch name {
+		case coord:
+			d.cols[0] = k
+		case "type":
+			d.cols[1] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(d.cols) {
+		err = fmt.Errorf("cannot find the columns %s and type", coord)
+		return
+	}
+
+	pos, types, err = d.fetchPos(r)
+	if err != nil {
+		err = fmt.Errorf("fetchPos: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchPos to fetch the positions of the atoms along the axis.
+func (d *DensityProfile) readCfg(r *bufio.Reader) (box [3]float64, pos []float64, types []int, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	pos, types, err = d.fetchPos(r)
+	if err != nil {
+		err = fmt.Errorf("fetchPos: %w", err)
+	}
+
+	return
+}
+
+// fetchPos fetches the positions along the axis of the atoms whose type is in
+// Atoms, and the indices of their types in Atoms.
+func (d *DensityProfile) fetchPos(r *bufio.Reader) (pos []float64, types []int, err error) {
+	for i := 0; i < d.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != d.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), d.colsLen)
+			return
+		}
+
+		typ, ok := d.types[fields[d.cols[1]]]
+		if !ok {
+			continue
+		}
+
+		v, _ := strconv.ParseFloat(fields[d.cols[0]], 64)
+		pos = append(pos, v)
+		types = append(types, typ)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,253 @@
+// Package dielectric calculates the static dielectric constant of a system from
+// the fluctuations of its total dipole moment.
+//
+// The total dipole moment of a configuration is M = Σ qi ri, qi being the
+// charge of the atom i and ri its unwrapped coordinates. With conducting
+// (tin-foil) boundary conditions, like the Ewald sums of LAMMPS, the dielectric
+// constant is ε = 1 + 4πke/(3 <V> kB T) (<M²> - <M>²), ke being the Coulomb
+// constant and V the volume of the box. The molecules must be neutral and the
+// dipole moment must not jump when an atom crosses the boundaries of the box,
+// hence the unwrapped coordinates.
+// The convergence is slow: <M²> is written for each configuration so that it
+// can be checked.
+package dielectric
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "dielectric"
+
+// BoltzmannReal is the Boltzmann constant in the real units of LAMMPS
+// (kcal/mol/K).
+const BoltzmannReal = 0.0019872067
+
+// CoulombReal is the Coulomb constant in the real units of LAMMPS
+// (kcal/mol Å/e²).
+const CoulombReal = 332.06371
+
+// Dielectric is a structure containing the parameters that can be parsed from a
+// TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the accumulated dipole moment.
+// The charges are read from ChargeColumn (q by default) and only the atoms
+// whose type is in Atoms are summed (all the atoms if empty).
+// CoordinateColumns is the set of coordinates read (util.Unwrapped by default,
+// see util.CoordColumns). Temperature is required. Boltzmann is the Boltzmann
+// constant and Coulomb the Coulomb constant in the units of the trajectory
+// (BoltzmannReal and CoulombReal if 0). CfgStart must be lower than CfgEnd. If
+// the trajectory ends before CfgEnd, the averages are over the configurations
+// read and a warning is logged.
+type Dielectric struct {
+	FileIn  string `toml:"dielectric.file_in"`
+	FileOut string `toml:"dielectric.file_out"`
+
+	CfgStart int `toml:"dielectric.cfg_start"`
+	CfgEnd   int `toml:"dielectric.cfg_end"`
+
+	CoordinateColumns string   `toml:"dielectric.coordinate_columns"`
+	ChargeColumn      string   `toml:"dielectric.charge_column"`
+	Atoms             []string `toml:"dielectric.atoms"`
+
+	Temperature float64 `toml:"dielectric.temperature"`
+	Boltzmann   float64 `toml:"dielectric.boltzmann"`
+	Coulomb     float64 `toml:"dielectric.coulomb"`
+
+	Dt float64 `toml:"dielectric.dt"`
+
+	coords [3]string
+	types  map[string]bool
+
+	sumM  [3]float64
+	sumM2 float64
+	sumV  float64
+	nbCfg int
+
+	atoms   int
+	cols    [4]int
+	colType int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Dielectric structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Dielectric, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dielectric Dielectric
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&dielectric)
+	if err != nil {
+		return nil, err
+	}
+
+	if dielectric.CfgStart >= dielectric.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	dielectric.coords, err = util.CoordColumns(dielectric.CoordinateColumns, util.Unwrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	if dielectric.ChargeColumn == "" {
+		dielectric.ChargeColumn = "q"
+	}
+
+	if len(dielectric.Atoms) > 0 {
+		dielectric.types = make(map[string]bool, len(dielectric.Atoms))
+		for _, v := range dielectric.Atoms {
+			dielectric.types[v] = true
+		}
+	}
+
+	if dielectric.Temperature <= 0 {
+		return nil, errors.New("Temperature must be strictly positive")
+	}
+
+	if dielectric.Boltzmann == 0 {
+		dielectric.Boltzmann = BoltzmannReal
+	}
+
+	if dielectric.Coulomb == 0 {
+		dielectric.Coulomb = CoulombReal
+	}
+
+	return &dielectric, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (d *Dielectric) SetOutputDir(dir string) {
+	d.FileOut = util.FileOut(d.FileOut, dir, d.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (d *Dielectric) SetOutputFormat(format string) {
+	d.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (d *Dielectric) SetProgress(p *util.Progress) {
+	d.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (d *Dielectric) SetInput(in util.Input) {
+	d.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (d *Dielectric) SetLog(log *log.Logger) {
+	d.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (d *Dielectric) Start() error {
+	f, traj, err := util.OpenTrajectory(d.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(d.input.Reader(traj))
+
+	out, err := util.WriteFormat(d.FileOut, d, d.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	out.WriteString("cfg t Mx My Mz M2 mean_M2 epsilon\n")
+
+	err = d.input.SkipTo(f, r, 0, d.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, m, err := d.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	d.calc(out, 0, box, m)
+
+	for i := 1; i < (d.CfgEnd - d.CfgStart); i++ {
+		err = d.input.SkipTo(f, r, d.CfgStart+i, d.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(d.log, Type, d.CfgStart+i, d.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, m, err := d.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		d.calc(out, i, box, m)
+		d.progress.Update(i+1, d.CfgEnd-d.CfgStart)
+	}
+
+	d.write(out)
+	return nil
+}
+
+// calc accumulates the dipole moment of a configuration and writes it into a
+// file with the running averages <M²> and ε.
+func (d *Dielectric) calc(w io.Writer, cfg int, box [3]float64, m [3]float64) {
+	var m2 float64
+	for k := 0; k < 3; k++ {
+		d.sumM[k] += m[k]
+		m2 += m[k] * m[k]
+	}
+	d.sumM2 += m2
+	d.sumV += box[0] * box[1] * box[2]
+	d.nbCfg++
+
+	meanM2, eps := d.epsilon(float64(d.nbCfg))
+	fmt.Fprintf(w, "%d %g %g %g %g %g %g %g\n", (cfg + d.CfgStart),
+		(float64(cfg+d.CfgStart) * d.Dt), m[0], m[1], m[2], m2, meanM2, eps)
+}
+
+// epsilon returns <M²> and the dielectric constant over the first nbCfg
+// configurations.
+func (d *Dielectric) epsilon(nbCfg float64) (meanM2, eps float64) {
+	meanM2 = d.sumM2 / nbCfg
+	fluct := meanM2
+	for k := 0; k < 3; k++ {
+		fluct -= util.Pow(d.sumM[k]/nbCfg, 2)
+	}
+
+	kT := d.Boltzmann * d.Temperature
+	eps = 1. + 4.*math.Pi*d.Coulomb*fluct/(3.*(d.sumV/nbCfg)*kT)
+	return
+}
+
+// write writes the time averages of the dipole moment, of its square, and of
+// the volume, and the dielectric constant.
+func (d *Dielectric) write(w io.Writer) {
+	nbCfg := float64(d.nbCfg)
+	meanM2, eps := d.epsilon(nbCfg)
+	fmt.Fprint(w, "\nmean_Mx mean_My mean_Mz mean_M2 mean_V epsilon\n")
+	fmt.Fprintf(w, "%g %g %g %g %g %g\n", d.sumM[0]/nbCfg, d.sumM[1]/nbCfg,
+		d.sumM[2]/nbCfg, meanM2, d.sumV/nbCfg, eps)
+}
@@ -0,0 +1,87 @@
+package dielectric
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newDielectric writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [dielectric]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newDielectric(t *testing.T, params, traj string) *Dielectric {
+	dir, err := ioutil.TempDir("", "dielectric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "dielectric.toml")
+	cfg := fmt.Sprintf("[dielectric]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "dielectric.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a unit charge at x = 0, 1, and 2:
+	// <M> = (1, 0, 0), <M²> = 5/3, and ε = 1 + 4π (2/3) / (3 V).
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type q xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 1 %d 0 0\n", i)
+	}
+
+	d := newDielectric(t, "cfg_end = 10\ntemperature = 1.0\nboltzmann = 1.0\ncoulomb = 1.0\ndt = 1.0\n", traj.String())
+	var logs strings.Builder
+	d.SetLog(log.New(&logs, "", 0))
+	err := d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "dielectric: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(d.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	fields := strings.Fields(strings.Split(out[strings.Index(out, "mean_Mx "):], "\n")[1])
+	means := []float64{1, 0, 0, 5. / 3, 1000, 1 + 4*math.Pi*(2./3)/3000}
+	if len(fields) != len(means) {
+		t.Fatalf("means %q, want %v", fields, means)
+	}
+	for k, v := range fields {
+		got, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-means[k]) > 1e-5*math.Abs(means[k]) {
+			t.Errorf("means %q, want %v", fields, means)
+			break
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package dielectric
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (d *Dielectric) readCfgFirst(r *bufio.Reader) (box [3]float64, m [3]float64, err error) {
+	d.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	d.colsLen = len(fields)
+	d.colType = -1
+	for k, v := range fields {
+		switch v {
+		case d.coords[0]:
+			d.cols[0] = k
+		case d.coords[1]:
+			d.cols[1] = k
+		case d.coords[2]:
+			d.cols[2] = k
+		case d.ChargeColumn:
+			d.cols[3] = k
+		case "type":
+			d.colType = k
+			continue
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(d.cols) {
+		err = fmt.Errorf("cannot find the columns %s, %s, %s, and %s", d.coords[0], d.coords[1], d.coords[2], d.ChargeColumn)
+		return
+	}
+
+	if d.types != nil && d.colType < 0 {
+		err = fmt.Errorf("cannot find the column type")
+		return
+	}
+
+	m, err = d.fetchDipole(r)
+	if err != nil {
+		err = fmt.Errorf("fetchDipole: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchDipole to sum the dipole moments of the atoms.
+func (d *Dielectric) readCfg(r *bufio.Reader) (box [3]float64, m [3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	m, err = d.fetchDipole(r)
+	if err != nil {
+		err = fmt.Errorf("fetchDipole: %w", err)
+	}
+
+	return
+}
+
+// fetchDipole returns the total dipole moment of the atoms whose type is in
+// Atoms (all the atoms if Atoms is empty).
+func (d *Dielectric) fetchDipole(r *bufio.Reader) (m [3]float64, err error) {
+	for i := 0; i < d.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != d.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), d.colsLen)
+			return
+		}
+
+		if d.types != nil && !d.types[fields[d.colType]] {
+			continue
+		}
+
+		var q float64
+		q, err = strconv.ParseFloat(fields[d.cols[3]], 64)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", d.ChargeColumn, err)
+			return
+		}
+
+		for k := 0; k < 3; k++ {
+			var x float64
+			x, err = strconv.ParseFloat(fields[d.cols[k]], 64)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", d.coords[k], err)
+				return
+			}
+			m[k] += q * x
+		}
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
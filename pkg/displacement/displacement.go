@@ -0,0 +1,197 @@
+// Package displacement writes the displacement of each atom over a lag as
+// extra columns of a LAMMPS trajectory, e.g. to draw the displacement field
+// with VMD.
+package displacement
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "displacement"
+
+// frame is a configuration. header contains the lines preceding the atoms
+// (including the columns).
+type frame struct {
+	header []byte
+	fields [][]string
+	xyz    [][3]float64
+}
+
+// Displacement is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the last configurations.
+//
+// The configurations are written as they are read, with the columns dx, dy, and
+// dz added: the displacement of each atom since Lag configurations before
+// (1 by default). The displacements of the first Lag configurations are 0. The
+// unwrapped coordinates (xu, yu, and zu) are used, and the atoms must be in the
+// same order in every configuration (dump_modify sort id). CfgStart must be
+// lower than CfgEnd. If the trajectory ends before CfgEnd, the configurations
+// read are written and a warning is logged.
+type Displacement struct {
+	FileIn  string `toml:"displacement.file_in"`
+	FileOut string `toml:"displacement.file_out"`
+
+	CfgStart int `toml:"displacement.cfg_start"`
+	CfgEnd   int `toml:"displacement.cfg_end"`
+
+	Lag int `toml:"displacement.lag"`
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	last [][][3]float64 // ring buffer of the last Lag configurations
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+}
+
+// New returns an instance of the Displacement structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Displacement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var displacement Displacement
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&displacement)
+	if err != nil {
+		return nil, err
+	}
+
+	if displacement.CfgStart >= displacement.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if displacement.Lag < 0 {
+		return nil, errors.New("Lag must be positive")
+	}
+
+	if displacement.Lag == 0 {
+		displacement.Lag = 1
+	}
+
+	displacement.last = make([][][3]float64, displacement.Lag)
+
+	return &displacement, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (d *Displacement) SetOutputDir(dir string) {
+	d.FileOut = util.FileOut(d.FileOut, dir, d.FileIn, Type, ".lammpstrj")
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (d *Displacement) SetProgress(p *util.Progress) {
+	d.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (d *Displacement) SetInput(in util.Input) {
+	d.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (d *Displacement) SetLog(log *log.Logger) {
+	d.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (d *Displacement) Start() error {
+	f, traj, err := util.OpenTrajectory(d.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(d.input.Reader(traj))
+
+	out, err := os.Create(d.FileOut)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	err = d.input.SkipTo(f, r, 0, d.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	fr, err := d.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	d.write(w, 0, fr)
+
+	for i := 1; i < (d.CfgEnd - d.CfgStart); i++ {
+		err = d.input.SkipTo(f, r, d.CfgStart+i, d.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(d.log, Type, d.CfgStart+i, d.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		fr, err := d.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		d.write(w, i, fr)
+		d.progress.Update(i+1, d.CfgEnd-d.CfgStart)
+	}
+
+	return nil
+}
+
+// write writes the configuration cfg with the displacements of the atoms and
+// saves its coordinates.
+func (d *Displacement) write(w io.Writer, cfg int, fr frame) {
+	ref := d.last[cfg%d.Lag]
+
+	w.Write(fr.header)
+	var b []byte
+	for i, fields := range fr.fields {
+		b = b[:0]
+		for _, v := range fields {
+			b = append(b, v...)
+			b = append(b, ' ')
+		}
+
+		for k := 0; k < 3; k++ {
+			var dist float64
+			if ref != nil {
+				dist = fr.xyz[i][k] - ref[i][k]
+			}
+
+			if k > 0 {
+				b = append(b, ' ')
+			}
+			b = strconv.AppendFloat(b, dist, 'g', -1, 64)
+		}
+
+		b = append(b, '\n')
+		w.Write(b)
+	}
+
+	d.last[cfg%d.Lag] = fr.xyz
+}
@@ -0,0 +1,180 @@
+package displacement
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newDisplacement writes the configuration file with params and the trajectory
+// traj into a temporary directory, and returns the calculation read from this
+// file by New.
+func newDisplacement(t *testing.T, params, traj string) (*Displacement, error) {
+	dir, err := ioutil.TempDir("", "displacement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "displacement.toml")
+	cfg := fmt.Sprintf("[displacement]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "out.lammpstrj"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(path)
+}
+
+// run runs the calculation returned by newDisplacement and returns its output.
+func run(t *testing.T, params, traj string) (string, error) {
+	d, err := newDisplacement(t, params, traj)
+	if err != nil {
+		return "", fmt.Errorf("New: %w", err)
+	}
+
+	err = d.Start()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(d.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+func TestTranslation(t *testing.T) {
+	// Every atom moves by v at each configuration, across the box.
+	v := [3]float64{0.5, -0.25, 3}
+	start := [][3]float64{{1, 2, 3}, {4, 5, 6}, {7, 8, 9.5}, {0, 0, 0}}
+	const cfgs = 8
+
+	var traj strings.Builder
+	for i := 0; i < cfgs; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", 10*i, len(start))
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		for j, p := range start {
+			fmt.Fprintf(&traj, "%d 1 %g %g %g\n", j+1,
+				p[0]+float64(i)*v[0], p[1]+float64(i)*v[1], p[2]+float64(i)*v[2])
+		}
+	}
+
+	tests := []struct {
+		params string
+		lag    int
+	}{
+		{"", 1},
+		{"lag = 1\n", 1},
+		{"lag = 2\n", 2},
+		{"lag = 5\n", 5},
+	}
+
+	for _, tt := range tests {
+		out, err := run(t, fmt.Sprintf("cfg_end = %d\n%s", cfgs, tt.params), traj.String())
+		if err != nil {
+			t.Fatalf("lag %d: %v", tt.lag, err)
+		}
+
+		frames := strings.Split(out, "ITEM: ATOMS ")[1:]
+		if len(frames) != cfgs {
+			t.Fatalf("lag %d: %d configurations, want %d", tt.lag, len(frames), cfgs)
+		}
+
+		for i, fr := range frames {
+			lines := strings.Split(fr, "\n")
+			if lines[0] != "id type xu yu zu dx dy dz" {
+				t.Errorf("lag %d: configuration %d: columns %q", tt.lag, i, lines[0])
+			}
+
+			for j := range start {
+				fields := strings.Fields(lines[j+1])
+				if len(fields) != 8 {
+					t.Fatalf("lag %d: configuration %d: atom %q", tt.lag, i, lines[j+1])
+				}
+
+				for k := 0; k < 3; k++ {
+					want := float64(tt.lag) * v[k]
+					if i < tt.lag {
+						want = 0
+					}
+
+					got, err := strconv.ParseFloat(fields[5+k], 64)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if math.Abs(got-want) > 1e-12 {
+						t.Errorf("lag %d: configuration %d: atom %d: displacement %v, want %g along %d",
+							tt.lag, i, j+1, fields[5:], want, k)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		params string
+		err    string
+	}{
+		{"cfg_start = 2\ncfg_end = 2\n", "CfgStart is greater or equal than CfgEnd"},
+		{"cfg_end = 2\nlag = -1\n", "Lag must be positive"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(t, tt.params, "")
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.params, err, tt.err)
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations instead of 10.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 %d 0 0\n", i)
+	}
+
+	d, err := newDisplacement(t, "cfg_end = 10\n", traj.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	d.SetLog(log.New(&logs, "", 0))
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "displacement: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(d.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "ITEM: ATOMS id type xu yu zu dx dy dz\n1 1 2 0 0 1 0 0\n") {
+		t.Errorf("the last configuration read isn't written:\n%s", b)
+	}
+	if n := strings.Count(string(b), "ITEM: ATOMS "); n != 3 {
+		t.Errorf("%d configurations, want 3", n)
+	}
+}
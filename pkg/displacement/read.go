@@ -0,0 +1,112 @@
+package displacement
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (d *Displacement) readCfgFirst(r *bufio.Reader) (fr frame, err error) {
+	var header bytes.Buffer
+	d.atoms, _, err = util.Header(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	d.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "xu":
+			d.cols[0] = k
+		case "yu":
+			d.cols[1] = k
+		case "zu":
+			d.cols[2] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(d.cols) {
+		err = fmt.Errorf("cannot find the columns xu, yu, and zu")
+		return
+	}
+
+	fr, err = d.fetchFrame(r, header.Bytes(), b)
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchFrame to fetch the atoms.
+func (d *Displacement) readCfg(r *bufio.Reader) (fr frame, err error) {
+	var header bytes.Buffer
+	_, err = util.HeaderWOutAtoms(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+
+	fr, err = d.fetchFrame(r, header.Bytes(), b)
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// fetchFrame fetches the atoms. header contains the lines read by util.Header
+// or util.HeaderWOutAtoms and cols the line of the columns, to which dx, dy,
+// and dz are added.
+func (d *Displacement) fetchFrame(r *bufio.Reader, header, cols []byte) (fr frame, err error) {
+	fr.header = append(header, util.Line(cols)...)
+	fr.header = append(fr.header, " dx dy dz\n"...)
+
+	fr.fields = make([][]string, d.atoms)
+	fr.xyz = make([][3]float64, d.atoms)
+	for i := 0; i < d.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != d.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), d.colsLen)
+			return
+		}
+
+		for k := 0; k < 3; k++ {
+			fr.xyz[i][k], _ = strconv.ParseFloat(fields[d.cols[k]], 64)
+		}
+		fr.fields[i] = fields
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
+	return b
+}
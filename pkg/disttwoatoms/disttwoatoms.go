@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"os"
 
@@ -21,7 +22,32 @@ var Type = "dist_two_atoms"
 // a TOML configuration file. This structure can be instanced through the New
 // method. It also contains other unexported informations like the number of
 // atoms, and the number of columns.
-// Atom1 must be lower than Atom2. Same for CfgStart and CfgEnd.
+// Atom1 must be lower than Atom2. Same for CfgStart and CfgEnd. If the
+// trajectory ends before CfgEnd, the configurations read are used and a warning
+// is logged. If the trajectory has an id column, Atom1, Atom2, and the atoms of Condition are
+// the ids of the atoms, which don't need to be sorted in the trajectory.
+// Otherwise, they are the positions of the atoms in each configuration,
+// starting at 0.
+// CoordinateColumns is the set of coordinates read (util.Unwrapped by default,
+// see util.CoordColumns). With util.Wrapped, the distance doesn't use the
+// minimum image convention. If Smooth is set, the distances are kept in memory
+// and a smoothed column is written at the end of the calculation. If
+// Convergence is true, a block averaging of the distance is written at the end
+// of the output file (see util.BlockAverage).
+//
+// If Condition contains two atoms, the histogram of the distance between Atom1
+// and Atom2 is calculated over the configurations where the distance between
+// the atoms of Condition is within ConditionRange (bounds included). The bins
+// have a width of Dr. The histogram and the fraction of the configurations
+// satisfying the condition are written at the end of the output file.
+//
+// If Threshold is set, the first-passage time from every origin (every
+// OriginSpacing-th configuration) to the other side of Threshold is calculated:
+// it is the time until the distance first crosses Threshold, from below if it
+// starts below and from above otherwise. The mean first-passage time over the
+// origins that cross Threshold before CfgEnd, the number of origins and of
+// crossings, and the distribution of the first-passage times are written at the
+// end of the output file.
 type DistTwoAtoms struct {
 	FileIn  string `toml:"dist_two_atoms.file_in"`
 	FileOut string `toml:"dist_two_atoms.file_out"`
@@ -29,15 +55,44 @@ type DistTwoAtoms struct {
 	CfgStart int `toml:"dist_two_atoms.cfg_start"`
 	CfgEnd   int `toml:"dist_two_atoms.cfg_end"`
 
+	CoordinateColumns string `toml:"dist_two_atoms.coordinate_columns"`
+
 	Atom1 int `toml:"dist_two_atoms.atom_1"`
 	Atom2 int `toml:"dist_two_atoms.atom_2"`
 
 	Dt float64 `toml:"dist_two_atoms.dt"`
 
+	Smooth      util.Smooth `toml:"dist_two_atoms.smooth"`
+	Convergence bool        `toml:"dist_two_atoms.convergence"`
+
+	Condition      []int     `toml:"dist_two_atoms.condition"`
+	ConditionRange []float64 `toml:"dist_two_atoms.condition_range"`
+	Dr             float64   `toml:"dist_two_atoms.dr"`
+
+	Threshold     float64 `toml:"dist_two_atoms.threshold"`
+	OriginSpacing int     `toml:"dist_two_atoms.origin_spacing"`
+
+	sel   []int
+	slots map[int][]int
+
+	hstg   []float64
+	nbCond int
+	nbCfg  int
+
 	atoms   int
 	cols    [3]int
+	colID   int // column of the ids (-1 if none)
+	coords  [3]string
 	colsLen int
-	dist    [][3]float64
+	vec     [][3]float64
+	dist    []float64
+
+	syncEvery int
+
+	progress *util.Progress
+	input    util.Input
+	format   string
+	log      *log.Logger
 }
 
 // New returns an instance of the DistTwoAtoms structure. It reads and parses
@@ -64,63 +119,319 @@ func New(path string) (*DistTwoAtoms, error) {
 		return nil, errors.New("Atom1 is greater or equal than Atom2")
 	}
 
+	distTwoAtoms.coords, err = util.CoordColumns(distTwoAtoms.CoordinateColumns, util.Unwrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	err = distTwoAtoms.Smooth.Check()
+	if err != nil {
+		return nil, fmt.Errorf("Smooth: %w", err)
+	}
+
+	distTwoAtoms.sel = []int{distTwoAtoms.Atom1, distTwoAtoms.Atom2}
+	if distTwoAtoms.conditional() {
+		if len(distTwoAtoms.Condition) != 2 {
+			return nil, errors.New("Condition must contain 2 atoms")
+		}
+
+		if len(distTwoAtoms.ConditionRange) != 2 ||
+			distTwoAtoms.ConditionRange[0] > distTwoAtoms.ConditionRange[1] {
+			return nil, errors.New("ConditionRange must contain a lower and an upper bound")
+		}
+
+		if distTwoAtoms.Dr <= 0 {
+			return nil, errors.New("Dr must be strictly positive")
+		}
+
+		distTwoAtoms.sel = append(distTwoAtoms.sel, distTwoAtoms.Condition...)
+	}
+
+	if distTwoAtoms.Threshold < 0 {
+		return nil, errors.New("Threshold must be positive")
+	}
+
+	if distTwoAtoms.OriginSpacing < 0 {
+		return nil, errors.New("OriginSpacing must be positive")
+	}
+
+	if distTwoAtoms.OriginSpacing == 0 {
+		distTwoAtoms.OriginSpacing = 1
+	}
+
+	distTwoAtoms.slots = make(map[int][]int, len(distTwoAtoms.sel))
+	for k, v := range distTwoAtoms.sel {
+		if v < 0 {
+			return nil, fmt.Errorf("atom %d doesn't exist", v)
+		}
+		distTwoAtoms.slots[v] = append(distTwoAtoms.slots[v], k)
+	}
+
 	return &distTwoAtoms, nil
 }
 
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (d *DistTwoAtoms) SetOutputDir(dir string) {
+	d.FileOut = util.FileOut(d.FileOut, dir, d.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (d *DistTwoAtoms) SetOutputFormat(format string) {
+	d.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (d *DistTwoAtoms) SetProgress(p *util.Progress) {
+	d.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (d *DistTwoAtoms) SetInput(in util.Input) {
+	d.input = in
+}
+
+// SetSyncEvery sets the number of configurations between two syncs of the
+// output file (see util.Syncer).
+func (d *DistTwoAtoms) SetSyncEvery(every int) {
+	d.syncEvery = every
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (d *DistTwoAtoms) SetLog(log *log.Logger) {
+	d.log = log
+}
+
 // Start performs the calculation. It is a thread blocking method. It is a very
 // fast calculation. This calculation only use one thread.
 func (d *DistTwoAtoms) Start() error {
-	f, err := os.Open(d.FileIn)
+	f, traj, err := util.OpenTrajectory(d.FileIn)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
+	r := bufio.NewReader(d.input.Reader(traj))
 
-	out, err := util.Write(d.FileOut, d)
+	out, err := util.WriteFormat(d.FileOut, d, d.format)
 	if err != nil {
 		return fmt.Errorf("Write: %w", err)
 	}
 	defer out.Close()
-	out.WriteString("cfg t x y z dist\n")
+	syncer := util.NewSyncer(out, d.syncEvery)
+	if d.Smooth.Enabled() {
+		out.WriteString("cfg t x y z dist dist_smooth\n")
+	} else {
+		out.WriteString("cfg t x y z dist\n")
+	}
 
-	err = util.ReadCfgNonCvg(r, d.CfgStart)
+	err = d.input.SkipTo(f, r, 0, d.CfgStart)
 	if err != nil {
-		return fmt.Errorf("ReadCfgNonCvg: %w", err)
+		return fmt.Errorf("SkipTo: %w", err)
 	}
 
-	xyz1, xyz2, err := d.readCfgFirst(r)
+	xyz, err := d.readCfgFirst(r)
 	if err != nil {
 		return fmt.Errorf("readCfgFirst: %w", err)
 	}
-	d.result(out, 0, xyz1, xyz2)
+	d.result(out, 0, xyz)
+	d.nbCfg = 1
 
 	for i := 1; i <= (d.CfgEnd - d.CfgStart - 1); i++ {
-		xyz1, xyz2, err := d.readCfg(r)
+		err = d.input.SkipTo(f, r, d.CfgStart+i, d.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(d.log, Type, d.CfgStart+i, d.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		xyz, err := d.readCfg(r)
 		if err != nil {
 			return fmt.Errorf("readCfg (step %d): %w", i, err)
 		}
-		d.result(out, i, xyz1, xyz2)
+		d.result(out, i, xyz)
+		d.nbCfg++
+		d.progress.Update(i+1, d.CfgEnd-d.CfgStart)
+		err = syncer.Frame()
+		if err != nil {
+			return fmt.Errorf("Sync (step %d): %w", i, err)
+		}
+	}
+
+	if d.buffered() {
+		err = d.writeSeries(out)
+		if err != nil {
+			return fmt.Errorf("writeSeries: %w", err)
+		}
+	}
+
+	if d.Convergence {
+		util.WriteBlocks(out, d.dist)
+	}
+
+	if d.conditional() {
+		d.writeConditional(out)
+	}
+
+	if d.passage() {
+		d.writePassage(out)
 	}
 
 	return nil
 }
 
-// append calculates the distance between two set of coordinates and writes it
-// into a file.
-func (d *DistTwoAtoms) result(w io.Writer, cfg int, xyz1, xyz2 [3]float64) {
-	var (
-		vec  [3]float64
-		dist float64
-	)
+// conditional returns true if the conditional histogram must be calculated.
+func (d *DistTwoAtoms) conditional() bool {
+	return len(d.Condition) != 0
+}
+
+// result calculates the distance between Atom1 and Atom2 and writes it into a
+// file. If the series must be buffered, the distance is saved instead. If
+// Condition is set, the distance is added to the histogram when the condition
+// holds.
+func (d *DistTwoAtoms) result(w io.Writer, cfg int, xyz [][3]float64) {
+	vec, dist := distance(xyz[0], xyz[1])
+
+	if d.conditional() {
+		_, distCond := distance(xyz[2], xyz[3])
+		if distCond >= d.ConditionRange[0] && distCond <= d.ConditionRange[1] {
+			bin := int(dist / d.Dr)
+			for len(d.hstg) <= bin {
+				d.hstg = append(d.hstg, 0)
+			}
+			d.hstg[bin]++
+			d.nbCond++
+		}
+	}
+
+	if d.buffered() {
+		d.vec = append(d.vec, vec)
+		d.dist = append(d.dist, dist)
+		return
+	}
+
+	fmt.Fprintf(w, "%d %g %g %g %g %g\n",
+		(cfg + d.CfgStart), (float64(cfg+d.CfgStart) * d.Dt),
+		vec[0], vec[1], vec[2], dist)
+}
 
+// distance returns the vector going from xyz2 to xyz1 and its norm.
+func distance(xyz1, xyz2 [3]float64) (vec [3]float64, dist float64) {
 	for k := 0; k < 3; k++ {
 		vec[k] = (xyz1[k] - xyz2[k])
 		dist += util.Pow(vec[k], 2)
 	}
 	dist = math.Sqrt(dist)
+	return
+}
 
-	fmt.Fprintf(w, "%d %g %g %g %g %g\n",
-		(cfg + d.CfgStart), (float64(cfg+d.CfgStart) * d.Dt),
-		vec[0], vec[1], vec[2], dist)
+// writeConditional writes the fraction of the configurations read satisfying
+// the condition and the histogram of the distance between Atom1 and Atom2 over
+// these configurations.
+func (d *DistTwoAtoms) writeConditional(w io.Writer) {
+	fmt.Fprintf(w, "\nfraction_condition\n%g\n",
+		float64(d.nbCond)/float64(d.nbCfg))
+
+	fmt.Fprint(w, "\ndist count\n")
+	for bin, count := range d.hstg {
+		fmt.Fprintf(w, "%g %g\n", (float64(bin)+0.5)*d.Dr, count)
+	}
+}
+
+// passage returns true if the first-passage times must be calculated.
+func (d *DistTwoAtoms) passage() bool {
+	return d.Threshold > 0
+}
+
+// writePassage writes the mean first-passage time to Threshold and the
+// distribution of the first-passage times (one bin per configuration).
+func (d *DistTwoAtoms) writePassage(w io.Writer) {
+	// next[s][j] is the first configuration from j whose side of Threshold is
+	// s (1 if the distance is greater or equal than Threshold). It is equal to
+	// len(d.dist) if there is none.
+	n := len(d.dist)
+	var next [2][]int
+	for s := range next {
+		next[s] = make([]int, n+1)
+		next[s][n] = n
+	}
+	for j := n - 1; j >= 0; j-- {
+		side := 0
+		if d.dist[j] >= d.Threshold {
+			side = 1
+		}
+		next[side][j] = j
+		next[1-side][j] = next[1-side][j+1]
+	}
+
+	var (
+		origins, crossings int
+		sum                float64
+		hstg               []int
+	)
+	for i := 0; i < n; i += d.OriginSpacing {
+		origins++
+		side := 0
+		if d.dist[i] >= d.Threshold {
+			side = 1
+		}
+
+		j := next[1-side][i]
+		if j == n {
+			continue
+		}
+
+		lag := j - i
+		for len(hstg) <= lag {
+			hstg = append(hstg, 0)
+		}
+		hstg[lag]++
+		sum += float64(lag) * d.Dt
+		crossings++
+	}
+
+	var mfpt float64
+	if crossings > 0 {
+		mfpt = sum / float64(crossings)
+	}
+
+	fmt.Fprintf(w, "\nmfpt origins crossings\n%g %d %d\n", mfpt, origins, crossings)
+
+	fmt.Fprint(w, "\nfpt count\n")
+	for lag, count := range hstg {
+		if lag == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%g %d\n", float64(lag)*d.Dt, count)
+	}
+}
+
+// buffered returns true if the distances must be kept in memory.
+func (d *DistTwoAtoms) buffered() bool {
+	return d.Smooth.Enabled() || d.Convergence || d.passage()
+}
+
+// writeSeries writes the saved distances into a file. If Smooth is set, the
+// smoothed distances are written as well.
+func (d *DistTwoAtoms) writeSeries(w io.Writer) error {
+	var smooth []float64
+	if d.Smooth.Enabled() {
+		var err error
+		smooth, err = d.Smooth.Apply(d.dist)
+		if err != nil {
+			return fmt.Errorf("Apply: %w", err)
+		}
+	}
+
+	for cfg, vec := range d.vec {
+		fmt.Fprintf(w, "%d %g %g %g %g %g",
+			(cfg + d.CfgStart), (float64(cfg+d.CfgStart) * d.Dt),
+			vec[0], vec[1], vec[2], d.dist[cfg])
+		if smooth != nil {
+			fmt.Fprintf(w, " %g", smooth[cfg])
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	return nil
 }
@@ -0,0 +1,137 @@
+package disttwoatoms
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPartialOutput(t *testing.T) {
+	// The trajectory is cut in the middle of the configuration 6, as if the
+	// simulation had been killed: the results of the configurations read are
+	// in the output file.
+	var traj strings.Builder
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 0 0 0\n2 1 %d 0 0\n", i)
+	}
+	cut := traj.String()
+	cut = cut[:strings.Index(cut, "2 1 6 0 0")]
+
+	for _, every := range []int{0, 1, 4} {
+		dir, err := ioutil.TempDir("", "disttwoatoms")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "disttwoatoms.toml")
+		cfg := fmt.Sprintf("[dist_two_atoms]\nfile_in = %q\nfile_out = %q\ncfg_end = 10\natom_1 = 1\natom_2 = 2\ndt = 1.0\n",
+			filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "out.dat"))
+		err = ioutil.WriteFile(path, []byte(cfg), 0644)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(cut), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetSyncEvery(every)
+		if err := d.Start(); err == nil {
+			t.Fatalf("sync every %d: no error on the truncated configuration", every)
+		}
+
+		b, err := ioutil.ReadFile(d.FileOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := string(b)
+		i := strings.Index(out, "cfg t x y z dist\n")
+		if i < 0 {
+			t.Fatalf("sync every %d: no header in %q", every, out)
+		}
+
+		rows := strings.Split(strings.TrimSuffix(out[i:], "\n"), "\n")[1:]
+		if len(rows) != 6 {
+			t.Fatalf("sync every %d: %d rows, want 6:\n%s", every, len(rows), out)
+		}
+		for cfg, row := range rows {
+			fields := strings.Fields(row)
+			if len(fields) != 6 {
+				t.Fatalf("sync every %d: incomplete row %q", every, row)
+			}
+			if dist, err := strconv.ParseFloat(fields[5], 64); err != nil || dist != float64(cfg) {
+				t.Errorf("sync every %d: configuration %d: distance %s, want %d", every, cfg, fields[5], cfg)
+			}
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 4 configurations instead of 10. The distance between
+	// the atoms 3 and 4 is within the range of the condition in 3 of them.
+	var traj strings.Builder
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n4\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 0 0 0\n2 1 %d 0 0\n3 1 0 5 0\n4 1 %d 5 0\n", i, 1+i/3*2)
+	}
+
+	dir, err := ioutil.TempDir("", "disttwoatoms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "disttwoatoms.toml")
+	cfg := fmt.Sprintf("[dist_two_atoms]\nfile_in = %q\nfile_out = %q\ncfg_end = 10\natom_1 = 1\natom_2 = 2\ndt = 1.0\n"+
+		"condition = [3, 4]\ncondition_range = [0.5, 1.5]\ndr = 1.0\n",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "out.dat"))
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj.String()), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs strings.Builder
+	d.SetLog(log.New(&logs, "", 0))
+	err = d.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "dist_two_atoms: the trajectory ends before the configuration 4 (requested up to 9), 4 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(d.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	series := out[strings.Index(out, "cfg t x y z dist\n"):]
+	rows := strings.Split(series[:strings.Index(series, "\n\n")], "\n")[1:]
+	if len(rows) != 4 {
+		t.Errorf("%d rows, want 4:\n%s", len(rows), out)
+	}
+	if !strings.Contains(out, "\nfraction_condition\n0.75\n") {
+		t.Errorf("fraction of the configurations satisfying the condition isn't 3/4:\n%s", out)
+	}
+}
@@ -2,10 +2,12 @@ package disttwoatoms
 
 import (
 	"bufio"
-	"errors"
+	"bytes"
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
 )
 
 // readCfgFirst reads the first configuration. It reads the number of atoms, the
@@ -13,13 +15,13 @@ import (
 // saves a lot of runtime because it saves the number of columns. It is
 // therefore non essential to re-read the number of columns and detect where the
 // interesting columns are located.
-func (d *DistTwoAtoms) readCfgFirst(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]float64, err error) {
+func (d *DistTwoAtoms) readCfgFirst(r *bufio.Reader) (xyz [][3]float64, err error) {
 	for i := 0; i < 3; i++ {
 		r.ReadSlice('\n')
 	}
 
 	b, _ := r.ReadSlice('\n')
-	d.atoms, err = strconv.Atoi(string(b)[:len(b)-1])
+	d.atoms, err = strconv.Atoi(strings.TrimSpace(string(b)))
 	if err != nil {
 		return
 	}
@@ -39,13 +41,17 @@ func (d *DistTwoAtoms) readCfgFirst(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]f
 
 	var found int
 	d.colsLen = len(fields)
+	d.colID = -1
 	for k, v := range fields {
 		switch v {
-		case "xu":
+		case "id":
+			d.colID = k
+			continue
+		case d.coords[0]:
 			d.cols[0] = k
-		case "yu":
+		case d.coords[1]:
 			d.cols[1] = k
-		case "zu":
+		case d.coords[2]:
 			d.cols[2] = k
 		default:
 			continue
@@ -54,11 +60,20 @@ func (d *DistTwoAtoms) readCfgFirst(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]f
 	}
 
 	if found < len(d.cols) {
-		err = errors.New("cannot find the columns xu, yu, and zu")
+		err = fmt.Errorf("cannot find the columns %s, %s, and %s", d.coords[0], d.coords[1], d.coords[2])
 		return
 	}
 
-	xyz1, xyz2, err = d.fetchXYZ(r)
+	if d.colID < 0 {
+		for _, v := range d.sel {
+			if v >= d.atoms {
+				err = fmt.Errorf("atom %d doesn't exist (%d atoms)", v, d.atoms)
+				return
+			}
+		}
+	}
+
+	xyz, err = d.fetchXYZ(r)
 	if err != nil {
 		err = fmt.Errorf("fetchXYZ: %w", err)
 		return
@@ -68,15 +83,15 @@ func (d *DistTwoAtoms) readCfgFirst(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]f
 }
 
 // readCfg reads a configuration of the LAMMPS trajectory. This method will call
-// fetchXYZ to fetch the coordinates of the two atoms. readCfgFirst must be
+// fetchXYZ to fetch the coordinates of the selected atoms. readCfgFirst must be
 // called before using this method as it doesn't read the number of atoms nor
 // it analyzes the columns.
-func (d *DistTwoAtoms) readCfg(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]float64, err error) {
+func (d *DistTwoAtoms) readCfg(r *bufio.Reader) (xyz [][3]float64, err error) {
 	for i := 0; i < 9; i++ {
 		r.ReadSlice('\n')
 	}
 
-	xyz1, xyz2, err = d.fetchXYZ(r)
+	xyz, err = d.fetchXYZ(r)
 	if err != nil {
 		err = fmt.Errorf("fetchXYZ: %w", err)
 	}
@@ -84,34 +99,83 @@ func (d *DistTwoAtoms) readCfg(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]float6
 	return
 }
 
-// fetchXYZ fetches the coordinates of the two atoms by calling readXYZ two
-// times (one for the first atom, and the other for the second atom).
-func (d *DistTwoAtoms) fetchXYZ(r *bufio.Reader) (xyz1 [3]float64, xyz2 [3]float64, err error) {
-	for i := 0; i < d.Atom1; i++ {
-		r.ReadSlice('\n')
-	}
+// fetchXYZ fetches the coordinates of the selected atoms (Atom1, Atom2, and
+// the atoms of Condition if it is set) in this order. The other atoms are
+// skipped. If the trajectory has an id column, the atoms are selected by their
+// id wherever they are in the configuration (see fetchXYZByID). Otherwise,
+// they are selected by their position.
+func (d *DistTwoAtoms) fetchXYZ(r *bufio.Reader) ([][3]float64, error) {
+	if d.colID >= 0 {
+		return d.fetchXYZByID(r)
+	}
+
+	xyz := make([][3]float64, len(d.sel))
+	for i := 0; i < d.atoms; i++ {
+		slots, ok := d.slots[i]
+		if !ok {
+			r.ReadSlice('\n')
+			continue
+		}
 
-	xyz1, err = d.readXYZ(r)
-	if err != nil {
-		err = fmt.Errorf("readXYZ: %w", err)
-		return
-	}
+		xyzAt, err := d.readXYZ(r)
+		if err != nil {
+			return nil, fmt.Errorf("readXYZ (atom %d, line %d): %w", i, util.AtomLine(i), err)
+		}
 
-	for i := 0; i < (d.Atom2 - d.Atom1 - 1); i++ {
-		r.ReadSlice('\n')
+		for _, v := range slots {
+			xyz[v] = xyzAt
+		}
 	}
 
-	xyz2, err = d.readXYZ(r)
-	if err != nil {
-		err = fmt.Errorf("readXYZ: %w", err)
-		return
+	return xyz, nil
+}
+
+// fetchXYZByID is like fetchXYZ but the selected atoms are the ones whose id
+// is equal to Atom1, Atom2, and the atoms of Condition, so that the atoms
+// don't need to be sorted by id in the trajectory. Every selected atom must be
+// found in the configuration.
+func (d *DistTwoAtoms) fetchXYZByID(r *bufio.Reader) ([][3]float64, error) {
+	var (
+		xyz   = make([][3]float64, len(d.sel))
+		found = make(map[int]bool, len(d.slots))
+	)
+
+	for i := 0; i < d.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := bytes.Fields(b)
+		if len(fields) != d.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), d.colsLen)
+		}
+
+		id, err := strconv.Atoi(string(fields[d.colID]))
+		if err != nil {
+			return nil, fmt.Errorf("id: %w", err)
+		}
+
+		slots, ok := d.slots[id]
+		if !ok {
+			continue
+		}
+		found[id] = true
+
+		coords := []string{string(fields[d.cols[0]]), string(fields[d.cols[1]]), string(fields[d.cols[2]])}
+		xyzAt, err := util.ParseXYZ(coords, []int{0, 1, 2}, d.coords)
+		if err != nil {
+			return nil, fmt.Errorf("atom %d (line %d): %w", i, util.AtomLine(i), err)
+		}
+
+		for _, v := range slots {
+			xyz[v] = xyzAt
+		}
 	}
 
-	for i := 0; i < (d.atoms - d.Atom2 - 1); i++ {
-		r.ReadSlice('\n')
+	for _, id := range d.sel {
+		if !found[id] {
+			return nil, fmt.Errorf("atom %d doesn't exist (no atom with this id)", id)
+		}
 	}
 
-	return
+	return xyz, nil
 }
 
 func (d *DistTwoAtoms) readXYZ(r *bufio.Reader) (xyz [3]float64, err error) {
@@ -122,9 +186,5 @@ func (d *DistTwoAtoms) readXYZ(r *bufio.Reader) (xyz [3]float64, err error) {
 		return
 	}
 
-	for k := 0; k < 3; k++ {
-		xyz[k], _ = strconv.ParseFloat(fields[d.cols[k]], 64)
-	}
-
-	return
+	return util.ParseXYZ(fields, d.cols[:3], d.coords)
 }
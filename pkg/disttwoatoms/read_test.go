@@ -0,0 +1,103 @@
+package disttwoatoms
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// newTest returns a DistTwoAtoms selecting the atoms 0 and 1 as New does.
+func newTest() *DistTwoAtoms {
+	return &DistTwoAtoms{
+		sel:    []int{0, 1},
+		slots:  map[int][]int{0: {0}, 1: {1}},
+		coords: [3]string{"xu", "yu", "zu"},
+	}
+}
+
+func TestReadCfgFirst(t *testing.T) {
+	tests := []struct {
+		name   string
+		atom   string
+		errMsg string // empty if no error is expected
+	}{
+		{"valid", "1 2.5 0 1", ""},
+		{"nan", "1 NaN 0 1", "column xu: NaN isn't a finite number"},
+		{"inf", "1 1 -Inf 1", "column yu: -Inf isn't a finite number"},
+		{"non-numeric", "1 1 0 abc", `column zu: strconv.ParseFloat: parsing "abc": invalid syntax`},
+	}
+
+	for _, tt := range tests {
+		cfg := "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\n" +
+			"ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\n" +
+			"ITEM: ATOMS type xu yu zu\n1 0 0 0\n" + tt.atom + "\n"
+
+		xyz, err := newTest().readCfgFirst(bufio.NewReader(strings.NewReader(cfg)))
+		if tt.errMsg == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if xyz[1] != [3]float64{2.5, 0, 1} {
+				t.Errorf("%s: got %v, want [2.5 0 1]", tt.name, xyz[1])
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tt.name, tt.errMsg)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.errMsg) || !strings.Contains(err.Error(), "atom 1, line 11") {
+			t.Errorf("%s: got error %q, want %q for atom 1, line 11", tt.name, err, tt.errMsg)
+		}
+	}
+}
+
+func TestReadCfgFirstCRLF(t *testing.T) {
+	cfg := "ITEM: TIMESTEP\r\n0\r\nITEM: NUMBER OF ATOMS\r\n 2 \r\n" +
+		"ITEM: BOX BOUNDS pp pp pp\r\n0 10\r\n0 10\r\n0 10\r\n" +
+		"ITEM: ATOMS type xu yu zu\r\n1 0 0.5 1\r\n1 2.5 0 1.25\r\n"
+
+	xyz, err := newTest().readCfgFirst(bufio.NewReader(strings.NewReader(cfg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xyz[0] != [3]float64{0, 0.5, 1} || xyz[1] != [3]float64{2.5, 0, 1.25} {
+		t.Errorf("got %v, want [[0 0.5 1] [2.5 0 1.25]]", xyz)
+	}
+}
+
+func TestCoordinateColumns(t *testing.T) {
+	// The trajectory contains both sets, with different values.
+	cfg := "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\n" +
+		"ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\n" +
+		"ITEM: ATOMS type x y z xu yu zu\n1 0 0 0 0 0 0\n1 1 2 3 11 -8 23\n"
+
+	tests := []struct {
+		set  string
+		want [3]float64
+	}{
+		{"", [3]float64{11, -8, 23}},
+		{"unwrapped", [3]float64{11, -8, 23}},
+		{"wrapped", [3]float64{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		d := newTest()
+		var err error
+		d.coords, err = util.CoordColumns(tt.set, util.Unwrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		xyz, err := d.readCfgFirst(bufio.NewReader(strings.NewReader(cfg)))
+		if err != nil {
+			t.Errorf("%q: %v", tt.set, err)
+			continue
+		}
+		if xyz[1] != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.set, xyz[1], tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package extract extracts a range of configurations and a selection of atoms
+// from a LAMMPS trajectory. The configurations are aligned to the first one to
+// remove the translation and the rotation of the selection, which is useful
+// to make movies.
+package extract
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "extract"
+
+// Extract is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the reference configuration.
+// Only the atoms whose type is in Atoms are extracted (all the atoms if Atoms
+// is empty). If Align is true, each configuration is translated and rotated
+// to minimize its RMSD with the first one (see util.Rotation). If Unwrapped
+// is true, the columns xu, yu, and zu are used instead of x, y, and z, which
+// is recommended when aligning molecules crossing the box. CfgStart must be
+// lower than CfgEnd. If the trajectory ends before CfgEnd, the configurations
+// read are extracted and a warning is logged.
+type Extract struct {
+	FileIn  string `toml:"extract.file_in"`
+	FileOut string `toml:"extract.file_out"`
+
+	CfgStart int `toml:"extract.cfg_start"`
+	CfgEnd   int `toml:"extract.cfg_end"`
+
+	Atoms     []string `toml:"extract.atoms"`
+	Align     bool     `toml:"extract.align"`
+	Unwrapped bool     `toml:"extract.unwrapped"`
+
+	atoms   int
+	cols    [5]int
+	colsLen int
+
+	types map[string]bool
+	ref   [][3]float64
+	refC  [3]float64
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+}
+
+// New returns an instance of the Extract structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Extract, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var extract Extract
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&extract)
+	if err != nil {
+		return nil, err
+	}
+
+	if extract.CfgStart >= extract.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(extract.Atoms) > 0 {
+		extract.types = make(map[string]bool)
+		for _, v := range extract.Atoms {
+			extract.types[v] = true
+		}
+	}
+
+	return &extract, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (e *Extract) SetOutputDir(dir string) {
+	e.FileOut = util.FileOut(e.FileOut, dir, e.FileIn, Type, ".lammpstrj")
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (e *Extract) SetProgress(p *util.Progress) {
+	e.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (e *Extract) SetInput(in util.Input) {
+	e.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (e *Extract) SetLog(log *log.Logger) {
+	e.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (e *Extract) Start() error {
+	f, traj, err := util.OpenTrajectory(e.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(e.input.Reader(traj))
+
+	out, err := os.Create(e.FileOut)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	err = e.input.SkipTo(f, r, 0, e.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	fr, err := e.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	if len(fr.xyz) == 0 {
+		return errors.New("no atom selected")
+	}
+	e.ref = fr.xyz
+	e.refC = util.Center(fr.xyz, nil)
+	for i := range e.ref {
+		for k := 0; k < 3; k++ {
+			e.ref[i][k] -= e.refC[k]
+		}
+	}
+	e.write(w, fr)
+
+	for i := 1; i < (e.CfgEnd - e.CfgStart); i++ {
+		err = e.input.SkipTo(f, r, e.CfgStart+i, e.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(e.log, Type, e.CfgStart+i, e.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		fr, err := e.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		e.write(w, fr)
+		e.progress.Update(i+1, e.CfgEnd-e.CfgStart)
+	}
+
+	return nil
+}
+
+// write aligns the configuration if Align is true and writes it into a file.
+// The reference is centered on its center of geometry.
+func (e *Extract) write(w io.Writer, fr frame) {
+	xyz := fr.xyz
+	if e.Align {
+		center := util.Center(xyz, nil)
+		for i := range xyz {
+			for k := 0; k < 3; k++ {
+				xyz[i][k] -= center[k]
+			}
+		}
+
+		rot := util.Rotation(e.ref, xyz)
+		for i := range xyz {
+			xyz[i] = util.Rotate(rot, xyz[i])
+			for k := 0; k < 3; k++ {
+				xyz[i][k] += e.refC[k]
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "ITEM: TIMESTEP\n%s\nITEM: NUMBER OF ATOMS\n%d\n", fr.timestep, len(xyz))
+	w.Write(fr.box)
+	fmt.Fprint(w, "ITEM: ATOMS id type x y z\n")
+	for i, v := range xyz {
+		fmt.Fprintf(w, "%s %s %g %g %g\n", fr.ids[i], fr.types[i], v[0], v[1], v[2])
+	}
+}
@@ -0,0 +1,78 @@
+package extract
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newExtract writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [extract]) into a temporary directory,
+// and returns the calculation read from this file by New.
+func newExtract(t *testing.T, params, traj string) *Extract {
+	dir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "extract.toml")
+	cfg := fmt.Sprintf("[extract]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "extract.lammpstrj"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of 2 atoms, one of type 1 and one of
+	// type 2.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", 100*i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&traj, "1 1 %d 0 0\n2 2 0 %d 0\n", i, i)
+	}
+
+	e := newExtract(t, "cfg_end = 10\natoms = [\"1\"]\n", traj.String())
+	var logs strings.Builder
+	e.SetLog(log.New(&logs, "", 0))
+	err := e.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "extract: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(e.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extracted strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&extracted, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", 100*i)
+		extracted.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&extracted, "1 1 %d 0 0\n", i)
+	}
+	if string(b) != extracted.String() {
+		t.Errorf("extracted\n%s\nwant\n%s", b, extracted.String())
+	}
+}
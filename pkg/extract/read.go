@@ -0,0 +1,152 @@
+package extract
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// frame contains a configuration restricted to the selected atoms. box
+// contains the lines of the header describing the box.
+type frame struct {
+	timestep string
+	box      []byte
+	ids      []string
+	types    []string
+	xyz      [][3]float64
+}
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (e *Extract) readCfgFirst(r *bufio.Reader) (fr frame, err error) {
+	var header bytes.Buffer
+	e.atoms, _, err = util.Header(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	names := [3]string{"x", "y", "z"}
+	if e.Unwrapped {
+		names = [3]string{"xu", "yu", "zu"}
+	}
+
+	var found int
+	e.colsLen = len(fields)
+	e.cols[4] = -1
+	for k, v := range fields {
+		switch v {
+		case names[0]:
+			e.cols[0] = k
+		case names[1]:
+			e.cols[1] = k
+		case names[2]:
+			e.cols[2] = k
+		case "type":
+			e.cols[3] = k
+		case "id":
+			e.cols[4] = k
+			continue
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(e.cols)-1 {
+		err = fmt.Errorf("cannot find the columns %s, %s, %s, and type", names[0], names[1], names[2])
+		return
+	}
+
+	fr, err = e.fetchFrame(r, header.Bytes())
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchFrame to fetch the selected atoms.
+func (e *Extract) readCfg(r *bufio.Reader) (fr frame, err error) {
+	var header bytes.Buffer
+	_, err = util.HeaderWOutAtoms(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	fr, err = e.fetchFrame(r, header.Bytes())
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// fetchFrame fetches the selected atoms. header contains the lines read by
+// util.Header or util.HeaderWOutAtoms.
+func (e *Extract) fetchFrame(r *bufio.Reader, header []byte) (fr frame, err error) {
+	lines := bytes.SplitAfter(header, []byte{'\n'})
+	if len(lines) < 9 {
+		err = fmt.Errorf("incomplete header")
+		return
+	}
+	fr.timestep = util.Line(lines[1])
+	fr.box = bytes.Join(lines[4:], nil)
+
+	for i := 0; i < e.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != e.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), e.colsLen)
+			return
+		}
+
+		typ := fields[e.cols[3]]
+		if e.types != nil && !e.types[typ] {
+			continue
+		}
+
+		var xyz [3]float64
+		for k := 0; k < 3; k++ {
+			xyz[k], _ = strconv.ParseFloat(fields[e.cols[k]], 64)
+		}
+
+		id := strconv.Itoa(i + 1)
+		if e.cols[4] >= 0 {
+			id = fields[e.cols[4]]
+		}
+
+		fr.ids = append(fr.ids, id)
+		fr.types = append(fr.types, typ)
+		fr.xyz = append(fr.xyz, xyz)
+	}
+
+	if e.ref != nil && len(fr.xyz) != len(e.ref) {
+		err = fmt.Errorf("number of selected atoms don't match: %d (expected %d)", len(fr.xyz), len(e.ref))
+	}
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
+	return b
+}
@@ -0,0 +1,236 @@
+// Package fluctuation calculates the fluctuation of the number of particles in
+// subvolumes of the box as a function of their size.
+//
+// For each size, the box is divided into cells like the blocs of the volume
+// calculation: the number of cells along each dimension is the size of the box
+// divided by the size of the cells, rounded to the nearest integer, so that the
+// cells fill the box. The particles are counted in each cell of each
+// configuration and <δN²>/<N> is calculated over all the cells and all the
+// configurations. Extrapolated to an infinite subvolume, it gives ρkTκT, κT
+// being the isothermal compressibility (small-system method).
+package fluctuation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "fluctuation"
+
+// Fluctuation is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the accumulated counts.
+// The particles are the atoms whose type is in Atoms. Sizes contains the sizes
+// of the cells. CfgStart must be lower than CfgEnd. If the trajectory ends
+// before CfgEnd, the configurations read are used and a warning is logged.
+type Fluctuation struct {
+	FileIn  string `toml:"fluctuation.file_in"`
+	FileOut string `toml:"fluctuation.file_out"`
+
+	CfgStart int `toml:"fluctuation.cfg_start"`
+	CfgEnd   int `toml:"fluctuation.cfg_end"`
+
+	Atoms []string  `toml:"fluctuation.atoms"`
+	Sizes []float64 `toml:"fluctuation.sizes"`
+
+	types map[string]bool
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	sumN   []float64
+	sumN2  []float64
+	sumVol []float64
+	cells  []float64
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Fluctuation structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Fluctuation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var fluctuation Fluctuation
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&fluctuation)
+	if err != nil {
+		return nil, err
+	}
+
+	if fluctuation.CfgStart >= fluctuation.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(fluctuation.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	if len(fluctuation.Sizes) == 0 {
+		return nil, errors.New("no size of cells")
+	}
+
+	for _, v := range fluctuation.Sizes {
+		if v <= 0 {
+			return nil, errors.New("Sizes must be strictly positive")
+		}
+	}
+
+	fluctuation.types = make(map[string]bool, len(fluctuation.Atoms))
+	for _, v := range fluctuation.Atoms {
+		fluctuation.types[v] = true
+	}
+
+	fluctuation.sumN = make([]float64, len(fluctuation.Sizes))
+	fluctuation.sumN2 = make([]float64, len(fluctuation.Sizes))
+	fluctuation.sumVol = make([]float64, len(fluctuation.Sizes))
+	fluctuation.cells = make([]float64, len(fluctuation.Sizes))
+
+	return &fluctuation, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (f *Fluctuation) SetOutputDir(dir string) {
+	f.FileOut = util.FileOut(f.FileOut, dir, f.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (f *Fluctuation) SetOutputFormat(format string) {
+	f.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (f *Fluctuation) SetProgress(p *util.Progress) {
+	f.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (f *Fluctuation) SetInput(in util.Input) {
+	f.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (f *Fluctuation) SetLog(log *log.Logger) {
+	f.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (f *Fluctuation) Start() error {
+	file, traj, err := util.OpenTrajectory(f.FileIn)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(f.input.Reader(traj))
+
+	err = f.input.SkipTo(file, r, 0, f.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := f.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	f.calc(box, xyz)
+
+	for i := 1; i < (f.CfgEnd - f.CfgStart); i++ {
+		err = f.input.SkipTo(file, r, f.CfgStart+i, f.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(f.log, Type, f.CfgStart+i, f.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := f.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		f.calc(box, xyz)
+		f.progress.Update(i+1, f.CfgEnd-f.CfgStart)
+	}
+
+	out, err := util.WriteFormat(f.FileOut, f, f.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	f.write(out)
+
+	return nil
+}
+
+// calc counts the particles in the cells of each size.
+func (f *Fluctuation) calc(box [3]float64, xyz [][3]float64) {
+	for s, size := range f.Sizes {
+		var (
+			cells [3]int
+			bloc  [3]float64
+		)
+		vol := 1.
+		for k := 0; k < 3; k++ {
+			cells[k] = int(math.Max(math.Round(box[k]/size), 1))
+			bloc[k] = box[k] / float64(cells[k])
+			vol *= bloc[k]
+		}
+
+		count := make([]float64, cells[0]*cells[1]*cells[2])
+		for _, v := range xyz {
+			var idx [3]int
+			for k := 0; k < 3; k++ {
+				pos := v[k] - box[k]*math.Floor(v[k]/box[k])
+				idx[k] = int(pos / bloc[k])
+				if idx[k] >= cells[k] {
+					idx[k] = cells[k] - 1
+				}
+			}
+			count[(idx[0]*cells[1]+idx[1])*cells[2]+idx[2]]++
+		}
+
+		for _, n := range count {
+			f.sumN[s] += n
+			f.sumN2[s] += n * n
+		}
+		f.sumVol[s] += vol * float64(len(count))
+		f.cells[s] += float64(len(count))
+	}
+}
+
+// write writes the average volume of the cells, the average number of
+// particles, and <δN²>/<N> for each size.
+func (f *Fluctuation) write(w io.Writer) {
+	fmt.Fprint(w, "subvolume N dN2/N\n")
+	for s := range f.Sizes {
+		vol := f.sumVol[s] / f.cells[s]
+		mean := f.sumN[s] / f.cells[s]
+
+		var ratio float64
+		if mean > 0 {
+			ratio = (f.sumN2[s]/f.cells[s] - mean*mean) / mean
+		}
+
+		fmt.Fprintf(w, "%g %g %g\n", vol, mean, ratio)
+	}
+}
@@ -0,0 +1,81 @@
+package fluctuation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFluctuation writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [fluctuation]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newFluctuation(t *testing.T, params, traj string) *Fluctuation {
+	dir, err := ioutil.TempDir("", "fluctuation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "fluctuation.toml")
+	cfg := fmt.Sprintf("[fluctuation]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "fluctuation.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations, the configuration i containing i+1
+	// particles: in a single cell, N is equal to 1, 2, and 3, so that <N> = 2
+	// and <δN²>/<N> = 1/3.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n3\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		for j := 0; j < 3; j++ {
+			typ := 2
+			if j <= i {
+				typ = 1
+			}
+			fmt.Fprintf(&traj, "%d %d %d 5 5\n", j+1, typ, 2*j+1)
+		}
+	}
+
+	f := newFluctuation(t, "cfg_end = 10\natoms = [\"1\"]\nsizes = [10.0]\n", traj.String())
+	var logs strings.Builder
+	f.SetLog(log.New(&logs, "", 0))
+	err := f.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "fluctuation: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(f.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	row := strings.Fields(strings.Split(out[strings.Index(out, "subvolume N dN2/N\n"):], "\n")[1])
+	if len(row) != 3 || row[0] != "1000" || row[1] != "2" || !strings.HasPrefix(row[2], "0.333333") {
+		t.Errorf("row %q, want [1000 2 0.333333...]", row)
+	}
+}
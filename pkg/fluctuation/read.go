@@ -0,0 +1,109 @@
+package fluctuation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (f *Fluctuation) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	f.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	f.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			f.cols[0] = k
+		case "y":
+			f.cols[1] = k
+		case "z":
+			f.cols[2] = k
+		case "type":
+			f.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(f.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = f.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (f *Fluctuation) readCfg(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = f.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms whose type is in Atoms.
+func (f *Fluctuation) fetchXYZ(r *bufio.Reader) ([][3]float64, error) {
+	var xyz [][3]float64
+	for i := 0; i < f.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != f.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), f.colsLen)
+		}
+
+		if !f.types[fields[f.cols[3]]] {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[f.cols[k]], 64)
+		}
+
+		xyz = append(xyz, xyzTmp)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
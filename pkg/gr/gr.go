@@ -3,13 +3,20 @@ package gr
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
+	"math/rand"
 	"os"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/kpotier/molsolvent/pkg/util"
 
@@ -19,46 +26,269 @@ import (
 // Type is the type of calculation.
 var Type = "gr"
 
+// Values of Format. With FormatColumns, the results of every pair are written
+// side by side (dist, then intg, hstg, and N for each pair). With
+// FormatGnuplot, the results of each pair are written in a block (r g N)
+// preceded by a comment naming the pair. The blocks are separated by two blank
+// lines so that a pair can be selected with the index keyword of gnuplot. The
+// output files in the JSON format (see SetOutputFormat) always use the blocks
+// of FormatGnuplot, so that each pair is a table of its own.
+const (
+	FormatColumns = "columns"
+	FormatGnuplot = "gnuplot"
+)
+
 // XYZ is a type that represents the coordinates for each atom.
 type XYZ map[string][][3]float64
 
+// IDs is a type that represents the identifiers (id column) for each atom. It
+// has the same layout as XYZ.
+type IDs map[string][]int
+
 // GR is a structure containing the parameters that can be parsed from
 // a TOML configuration file. This structure can be instanced through the New
 // method. It also contains other unexported informations like the number of
 // atoms, the number of columns, the size of the box, the average size of the
 // box, ...
-// CfgStart must be lower than CfgEnd.
+// CfgStart must be lower than CfgEnd. If Frames is set, only these
+// configurations are processed and CfgStart and CfgEnd are ignored (see
+// util.NewFrames). If the trajectory ends before the last configuration, the
+// configurations read are used and a warning is logged.
+// The number of atoms of each type may differ from one type to another.
+// Without Select, the center atoms (first atom type of the pairs) and the
+// densities are the ones of the first configuration: the atoms of a type
+// beyond its number of atoms in the first configuration are not centers. A
+// type without atom in the first configuration has therefore no histogram as
+// a center, and g(r) of the pairs whose second type has none is NaN.
+// CoordinateColumns is the set of coordinates read (util.Wrapped by default,
+// see util.CoordColumnsScaled), e.g. when the trajectory contains both. The
+// scaled coordinates are converted with the size of the box; they are read by
+// default if the trajectory has no wrapped coordinates (see util.DetectScaled).
+// The box may be triclinic, e.g. in a NPT simulation with a deformable box:
+// the distances follow the minimum image convention of the triclinic box (see
+// util.MinImageTilt) and the smallest side of the box below is its smallest
+// width (see util.Widths).
+//
+// AtomStride and AtomFraction select a subset of the atoms of each type (see
+// util.Sampler) for quick previews. g(r) is normalized with the density of the
+// selected atoms and is therefore not biased, but it is noisier. N(r) is
+// normalized with the density of all the atoms so it remains the coordination
+// number of the whole system.
+//
+// Exclusions and ExclusionsFile contain pairs of atom identifiers (id column)
+// that don't contribute to the histogram, e.g. bonded neighbors. The file
+// contains one pair per line. Empty lines and lines starting with # are
+// ignored.
+//
+// BulkDensity contains the number density of some atom types (atoms per unit
+// of volume). It replaces the average density of the box in the normalization
+// of g(r) and N(r) when the second atom type of a pair has one. It is meant for
+// inhomogeneous or open systems where the density of the box differs from the
+// bulk: g(r) then tends to 1 where the local density reaches the bulk one, and
+// it is no longer the usual pair correlation of the box.
+//
+// If FileOutFrames is set, the index and the timestep of each processed
+// configuration are written into this file (see util.FrameMap).
+//
+// If FileOutKB is set, the running Kirkwood-Buff integral of each pair
+// G(R) = ∫4πr²(g(r)-1)dr, from 0 to R, is written into this file with the same
+// integral of g(r) corrected for the finite size of the box (Ganguly and van
+// der Vegt, J. Chem. Theory Comput. 9, 1347 (2013)):
+// g(r)·N(1-V(r)/V) / (N(1-V(r)/V) - ΔN(r) - δ), with N the number of atoms of
+// the second type, V(r) the volume of the sphere of radius r, V the average
+// volume of the box, ΔN(r) the excess number of atoms of the second type
+// within r, and δ 1 if both types are the same. It is meant to check the
+// convergence of G with R. The columns are named like the ones of
+// FormatColumns.
+//
+// If FileOutSq is set, the static structure factor of each pair
+// S(q) = 1 + 4πρ∫(g(r)-1)r·sin(qr)/q dr is written into this file for q from
+// QSpacing to QMax every QSpacing, with ρ the density of the second atom type
+// used for N(r). When both atom types are the same, the distance 0 of each
+// atom with itself, counted in the first bin of g(r), is removed. The integral
+// stops at half the smallest side of the box over the configurations, where
+// g(r) is still sampled in every direction and in every configuration, so S(q)
+// has truncation ripples below about 2π over this distance. The columns are
+// named like the ones of FormatColumns.
+//
+// If Select is set, only the atoms satisfying this expression are used in each
+// configuration (see util.Selection), e.g. "z > 30" for a region of the box.
+// The densities are then averaged over the configurations and the histogram of
+// each atom is normalized by the number of configurations where it is
+// selected.
+//
+// If Reference is set, only the center atoms (first atom type of the pairs)
+// satisfying this expression in the first configuration contribute to the
+// histograms, in every configuration (see util.Selection), e.g. "mol == 3 ||
+// mol == 7" for the molecules that are in a given state at the start. The
+// center atoms are identified by their position among the atoms of their type.
+//
+// ReferenceFraction and MaxReferences sample the center atoms at the first
+// configuration: each of them is kept with a probability ReferenceFraction,
+// then at most MaxReferences of them are kept for each atom type (randomly,
+// with Seed). The atoms of the second type of the pairs are not sampled, so
+// the cost is proportional to the number of center atoms kept, and g(r) of
+// each kept center atom is unchanged. They apply after Reference.
+//
+// If LogBins is true, the bins are logarithmically spaced instead of having a
+// width Dr: the first bin goes from 0 to RMin, then each decade from RMin to
+// RMax is divided in BinsPerDecade bins (the last one ends at RMax). The
+// distance of each bin is its middle and g(r) is normalized by the exact
+// volume of its shell.
+//
+// If MissingValue is set, it is written instead of the results of the bins
+// that are never sampled, i.e. whose outer radius is greater than half the
+// smallest length of the box in every configuration: the minimum image
+// convention doesn't cover their whole shell. A bin that is sampled but
+// without any pair stays 0. Since these bins are at the end of the histogram,
+// the cumulative intg and N are not affected.
+//
+// If Bootstrap is set, the confidence interval of g(r) at the level
+// Confidence (0.95 by default) is written after N(r) (g_lo g_hi). The
+// configurations are grouped in blocks of BootstrapBlock configurations (1 by
+// default), whose histograms are kept in memory, and Bootstrap samples of the
+// blocks are drawn with replacement (with Seed). The bounds are the
+// percentiles of g(r) over the samples, normalized like the full g(r): the
+// fluctuations of the volume and of the number of atoms are not resampled.
+// Longer blocks take the correlation between successive configurations into
+// account and use less memory.
+//
+// If ConvergenceTol is set, the calculation stops before the end of the
+// configurations once g(r) has converged. Every ConvergenceEvery
+// configurations (10 by default), g(r) of each pair averaged over the center
+// atoms is normalized with the configurations accumulated so far and compared
+// to the previous check: the calculation stops after ConvergenceChecks
+// consecutive checks (3 by default) whose largest change over the bins is
+// lower than ConvergenceTol. The configuration at which it stopped is logged
+// and written at the top of FileOut.
+//
+// Threads is the number of threads used by the calculation (all the threads
+// available if 0). With one thread, the configurations are read and
+// accumulated strictly in order: two runs on the same input give the same
+// output, apart from the date.
 type GR struct {
 	FileIn  string `toml:"gr.file_in"`
 	FileOut string `toml:"gr.file_out"`
 
-	CfgStart int `toml:"gr.cfg_start"`
-	CfgEnd   int `toml:"gr.cfg_end"`
+	FileOutFrames string `toml:"gr.file_out_frames"`
+	FileOutKB     string `toml:"gr.file_out_kb"`
+	FileOutSq     string `toml:"gr.file_out_sq"`
+	Format        string `toml:"gr.format"`
+
+	QMax     float64 `toml:"gr.qmax"`
+	QSpacing float64 `toml:"gr.qspacing"`
+
+	CfgStart int   `toml:"gr.cfg_start"`
+	CfgEnd   int   `toml:"gr.cfg_end"`
+	Frames   []int `toml:"gr.frames"`
+
+	CoordinateColumns string `toml:"gr.coordinate_columns"`
 
 	Atoms map[string][]string `toml:"gr.atoms"`
 
 	RMax float64 `toml:"gr.rmax"`
 	Dr   float64 `toml:"gr.dr"`
 
-	bins  int
-	rmax2 float64
+	LogBins       bool    `toml:"gr.log_bins"`
+	RMin          float64 `toml:"gr.rmin"`
+	BinsPerDecade int     `toml:"gr.bins_per_decade"`
+
+	AtomStride   int     `toml:"gr.atom_stride"`
+	AtomFraction float64 `toml:"gr.atom_fraction"`
+	Seed         int64   `toml:"gr.seed"`
+
+	Exclusions     [][]int `toml:"gr.exclusions"`
+	ExclusionsFile string  `toml:"gr.exclusions_file"`
+
+	BulkDensity map[string]float64 `toml:"gr.bulk_density"`
+
+	Select    string `toml:"gr.select"`
+	Reference string `toml:"gr.reference"`
+
+	ReferenceFraction float64 `toml:"gr.reference_fraction"`
+	MaxReferences     int     `toml:"gr.max_references"`
+
+	Bootstrap      int     `toml:"gr.bootstrap"`
+	BootstrapBlock int     `toml:"gr.bootstrap_block"`
+	Confidence     float64 `toml:"gr.confidence"`
+
+	ConvergenceTol    float64 `toml:"gr.convergence_tol"`
+	ConvergenceEvery  int     `toml:"gr.convergence_every"`
+	ConvergenceChecks int     `toml:"gr.convergence_checks"`
+
+	Threads      int    `toml:"gr.threads"`
+	MissingValue string `toml:"gr.missing_value"`
+
+	bins   int
+	edges  []float64
+	rmax2  float64
+	frames util.Frames
 
 	atomsTyp []string
 	atoms    int
-	vol      float64
+	vol      float64   // average volume of the box
+	boxVol   []float64 // volume of the box of each configuration
+	half     float64   // largest half of the smallest width of the box
+	halfMin  float64   // smallest one, where g(r) is sampled in every configuration
 
-	hstg  map[[2]string][][]float64
+	hstg  map[[2]string][][]uint64
 	order []string
 
+	// boot contains the histograms of each block of configurations (see
+	// Bootstrap). They are flattened: the histogram of the center atom slot of
+	// the pair key starts at bootOff[key] + slot*bins.
+	boot    [][]uint32
+	bootOff map[[2]string]int
+	bootLen int
+
+	convPrev    map[[2]string][]float64 // g(r) of the previous check
+	convHits    int                     // consecutive checks below the tolerance
+	convergedAt int                     // index in frames (-1 if not converged)
+
+	// workers contains the histograms of each thread, merged into hstg at the
+	// end (see merge). done is the number of configurations added, and
+	// convMux is held during a convergence check.
+	workers []*worker
+	done    int64
+	convMux sync.Mutex
+
 	cols    [4]int
+	coords  [3]string
+	scaled  bool // see util.DetectScaled
+	colID   int
 	colsLen int
 
-	xyzLen map[string]float64
+	excl map[[2]int]bool
+
+	xyzLen    map[string]float64
+	xyzLenAll map[string]float64
+	sampler   *util.Sampler
+
+	sel       *util.Selection
+	slotsLen  map[string]int
+	present   map[string][]float64
+	sumLen    map[string]float64
+	sumLenAll map[string]float64
 
-	cfg int
-	err error
-	mux sync.Mutex
-	wg  sync.WaitGroup
+	ref    *util.Selection
+	refIdx map[string][]int // index of the histogram of each center atom
+	refLen map[string]int
+
+	progress *util.Progress
+	input    util.Input
+	format   string
+	log      *log.Logger
+	summary  *util.Summary
+	headline string // see Summary
+	ctx      context.Context
+	frameMap *util.FrameMap
+	timestep string
+	cfg      int
+	nbCfg    int // number of configurations read
+	partial  bool
+	err      error
+	mux      sync.Mutex
+	wg       sync.WaitGroup
 }
 
 // New returns an instance of the GR structure. It reads and parses
@@ -77,16 +307,54 @@ func New(path string) (*GR, error) {
 		return nil, err
 	}
 
-	if gr.CfgStart >= gr.CfgEnd {
-		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	return NewWithParams(&gr)
+}
+
+// NewWithParams returns an instance of the GR structure whose parameters are
+// the exported fields of gr, like New without configuration file. It checks
+// and completes gr, which is returned. It allows to drive the calculation from
+// another program, e.g. with RunReader:
+//
+//	g, err := gr.NewWithParams(&gr.GR{CfgStart: 0, CfgEnd: 100,
+//		Atoms: map[string][]string{"1": {"2"}}, RMax: 10, Dr: 0.1})
+//	if err != nil {
+//		return err
+//	}
+//	err = g.RunReader(conn, &buf)
+func NewWithParams(gr *GR) (*GR, error) {
+	var err error
+	gr.frames, err = util.NewFrames(gr.Frames, gr.CfgStart, gr.CfgEnd)
+	if err != nil {
+		return nil, fmt.Errorf("NewFrames: %w", err)
 	}
 
-	gr.bins = int(gr.RMax / gr.Dr)
+	gr.coords, err = util.CoordColumnsScaled(gr.CoordinateColumns, util.Wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	if gr.LogBins {
+		if gr.RMin <= 0 || gr.RMin >= gr.RMax {
+			return nil, errors.New("RMin must be strictly positive and lower than RMax")
+		}
+		if gr.BinsPerDecade <= 0 {
+			return nil, errors.New("BinsPerDecade must be strictly positive")
+		}
+		decades := math.Log10(gr.RMax / gr.RMin)
+		gr.bins = 1 + int(math.Ceil(decades*float64(gr.BinsPerDecade)-1e-9))
+	} else {
+		gr.bins = int(gr.RMax / gr.Dr)
+	}
 
 	if gr.bins <= 1 {
 		return nil, errors.New("the number of bins must be greater than 1")
 	}
 
+	gr.edges = make([]float64, gr.bins+1)
+	for i := range gr.edges {
+		gr.edges[i] = gr.edge(i)
+	}
+
 	gr.rmax2 = util.Pow(gr.RMax, 2)
 
 	var combinaisons int
@@ -109,121 +377,647 @@ func New(path string) (*GR, error) {
 		}
 	}
 
-	gr.hstg = make(map[[2]string][][]float64, combinaisons)
+	gr.hstg = make(map[[2]string][][]uint64, combinaisons)
 	gr.xyzLen = make(map[string]float64, len(gr.atomsTyp))
+	gr.xyzLenAll = make(map[string]float64, len(gr.atomsTyp))
+
+	gr.sampler, err = util.NewSampler(gr.AtomStride, gr.AtomFraction, gr.Seed)
+	if err != nil {
+		return nil, fmt.Errorf("NewSampler: %w", err)
+	}
+
+	err = gr.exclusions()
+	if err != nil {
+		return nil, fmt.Errorf("exclusions: %w", err)
+	}
+
+	if gr.FileOutFrames != "" {
+		gr.frameMap = util.NewFrameMap()
+	}
+
+	if gr.Select != "" {
+		gr.sel, err = util.NewSelection(gr.Select)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection: %w", err)
+		}
+
+		gr.slotsLen = make(map[string]int, len(gr.atomsTyp))
+		gr.present = make(map[string][]float64, len(gr.atomsTyp))
+		gr.sumLen = make(map[string]float64, len(gr.atomsTyp))
+		gr.sumLenAll = make(map[string]float64, len(gr.atomsTyp))
+	}
+
+	if gr.Reference != "" {
+		gr.ref, err = util.NewSelection(gr.Reference)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection (Reference): %w", err)
+		}
+	}
+
+	if gr.ReferenceFraction < 0 || gr.ReferenceFraction > 1 {
+		return nil, errors.New("ReferenceFraction must be between 0 and 1")
+	}
+
+	if gr.MaxReferences < 0 {
+		return nil, errors.New("MaxReferences must be positive")
+	}
+
+	if gr.Bootstrap < 0 || gr.BootstrapBlock < 0 {
+		return nil, errors.New("Bootstrap and BootstrapBlock must be positive")
+	}
+
+	if gr.BootstrapBlock == 0 {
+		gr.BootstrapBlock = 1
+	}
+
+	if gr.Confidence == 0 {
+		gr.Confidence = 0.95
+	}
+
+	if gr.Confidence <= 0 || gr.Confidence >= 1 {
+		return nil, errors.New("Confidence must be between 0 and 1")
+	}
+
+	switch gr.Format {
+	case "":
+		gr.Format = FormatColumns
+	case FormatColumns, FormatGnuplot:
+	default:
+		return nil, fmt.Errorf("format `%s` doesn't exist", gr.Format)
+	}
+
+	if gr.FileOutSq != "" && (gr.QMax <= 0 || gr.QSpacing <= 0) {
+		return nil, errors.New("QMax and QSpacing must be strictly positive")
+	}
+
+	for typ, rho := range gr.BulkDensity {
+		if rho <= 0 {
+			return nil, fmt.Errorf("bulk density of atom type `%s` must be strictly positive", typ)
+		}
+	}
+
+	if gr.ConvergenceTol < 0 || gr.ConvergenceEvery < 0 || gr.ConvergenceChecks < 0 {
+		return nil, errors.New("ConvergenceTol, ConvergenceEvery, and ConvergenceChecks must be positive")
+	}
+
+	if gr.ConvergenceEvery == 0 {
+		gr.ConvergenceEvery = 10
+	}
+
+	if gr.ConvergenceChecks == 0 {
+		gr.ConvergenceChecks = 3
+	}
+	gr.convergedAt = -1
+
+	if gr.Threads < 0 {
+		return nil, errors.New("Threads must be positive")
+	}
+
+	return gr, nil
+}
+
+// exclusions builds the set of excluded pairs from Exclusions and
+// ExclusionsFile. The set stays nil if there is no exclusion.
+func (g *GR) exclusions() error {
+	pairs := g.Exclusions
+	if g.ExclusionsFile != "" {
+		f, err := os.Open(g.ExclusionsFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		sc := bufio.NewScanner(f)
+		for line := 1; sc.Scan(); line++ {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+
+			if len(fields) != 2 {
+				return fmt.Errorf("line %d: a pair must contain 2 identifiers (got %d)", line, len(fields))
+			}
+
+			var pair [2]int
+			for k := 0; k < 2; k++ {
+				pair[k], err = strconv.Atoi(fields[k])
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			pairs = append(pairs, pair[:])
+		}
+
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	g.excl = make(map[[2]int]bool, 2*len(pairs))
+	for _, v := range pairs {
+		if len(v) != 2 {
+			return fmt.Errorf("a pair must contain 2 identifiers (got %d)", len(v))
+		}
+		g.excl[[2]int{v[0], v[1]}] = true
+		g.excl[[2]int{v[1], v[0]}] = true
+	}
+
+	return nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (g *GR) SetOutputDir(dir string) {
+	g.FileOut = util.FileOut(g.FileOut, dir, g.FileIn, Type, ".dat")
+}
 
-	return &gr, nil
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (g *GR) SetOutputFormat(format string) {
+	g.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (g *GR) SetProgress(p *util.Progress) {
+	g.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (g *GR) SetInput(in util.Input) {
+	g.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (g *GR) SetLog(log *log.Logger) {
+	g.log = log
+}
+
+// SetContext sets the context of the calculation. When it is done, no more
+// configuration is read and the results are written with the configurations
+// read so far. The output then starts with a line giving their number.
+func (g *GR) SetContext(ctx context.Context) {
+	g.ctx = ctx
 }
 
 // Start performs the calculation. It is a thread blocking method. This
-// calculation will use all the threads available.
+// calculation will use all the threads available unless Threads is set.
 func (g *GR) Start() error {
-	f, err := os.Open(g.FileIn)
+	f, traj, err := util.OpenTrajectory(g.FileIn)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
 
-	err = util.ReadCfgNonCvg(r, g.CfgStart)
+	return g.run(f, traj, nil)
+}
+
+// RunReader is like Start but the trajectory is read from r instead of FileIn
+// and the results are written into w instead of FileOut, e.g. to process a
+// trajectory received through the network. The trajectory cannot be indexed,
+// so the configurations before CfgStart are read. FileOutFrames, FileOutKB,
+// and FileOutSq are still written if they are set.
+func (g *GR) RunReader(r io.Reader, w io.Writer) error {
+	return g.run(nil, r, w)
+}
+
+// run performs the calculation on the trajectory traj. f is the file of the
+// trajectory (nil if it isn't a file, see util.Input.SkipTo). The results are
+// written into w, or into FileOut if w is nil.
+func (g *GR) run(f *os.File, traj io.Reader, w io.Writer) error {
+	r := bufio.NewReader(g.input.Reader(traj))
+
+	err := g.input.SkipTo(f, r, 0, g.frames[0])
 	if err != nil {
-		return fmt.Errorf("ReadCfgNonCvg: %w", err)
+		return fmt.Errorf("SkipTo: %w", err)
 	}
 
-	box, xyz, err := g.readCfgFirst(r)
+	box, tilt, xyz, ids, slots, err := g.readCfgFirst(r)
 	if err != nil {
 		return fmt.Errorf("readCfgFirst: %w", err)
 	}
+	g.summary.Log(g.log, Type)
+	g.summary = nil
 
 	for at1, arrAt2 := range g.Atoms { // Initialize the histogram map
+		nb := len(xyz[at1])
+		if g.sel != nil {
+			nb = g.slotsLen[at1]
+		}
+		if g.references() {
+			nb = g.refLen[at1]
+		}
+
 		for _, at2 := range arrAt2 {
-			g.hstg[[2]string{at1, at2}] = make([][]float64, len(xyz[at1]))
-			for i := 0; i < len(xyz[at1]); i++ {
-				g.hstg[[2]string{at1, at2}][i] = make([]float64, g.bins)
+			g.hstg[[2]string{at1, at2}] = make([][]uint64, nb)
+			for i := 0; i < nb; i++ {
+				g.hstg[[2]string{at1, at2}][i] = make([]uint64, g.bins)
 			}
 		}
 	}
 
+	if g.Bootstrap > 0 {
+		g.bootOff = make(map[[2]string]int, len(g.hstg))
+		for key, slots := range g.hstg {
+			g.bootOff[key] = g.bootLen
+			g.bootLen += len(slots) * g.bins
+		}
+	}
+
 	for k, v := range xyz {
 		g.xyzLen[k] = float64(len(v))
 	}
 
-	g.calc(box, xyz)
-	g.cfg = g.CfgStart
+	threads := g.Threads
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
 
-	for i := 0; i < (runtime.NumCPU() - 1); i++ {
+	g.workers = make([]*worker, threads)
+	for i := range g.workers {
+		g.workers[i] = g.newWorker()
+	}
+
+	g.frameMap.Add(g.frames[0], g.timestep)
+	g.calc(g.workers[0], box, tilt, xyz, ids, slots, 0)
+	g.cfg = 0
+	g.nbCfg = 1
+
+	for i := 1; i < threads; i++ {
 		g.wg.Add(1)
-		go g.start(r)
+		go g.start(g.workers[i], f, r)
 	}
 
 	g.wg.Add(1)
-	g.start(r)
+	g.start(g.workers[0], f, r)
 	g.wg.Wait()
+	g.merge()
 
 	if g.err != nil {
 		return g.err
 	}
 
-	out, err := util.Write(g.FileOut, g)
+	if g.partial && g.log != nil {
+		g.log.Printf("%s: interrupted, partial results written with %d configurations (requested %d)",
+			Type, g.nbCfg, len(g.frames))
+	} else if g.convergedAt >= 0 && g.log != nil {
+		g.log.Printf("%s: converged at the configuration %d, %d configurations used (requested %d)",
+			Type, g.frames[g.convergedAt], g.nbCfg, len(g.frames))
+	} else if g.nbCfg < len(g.frames) {
+		util.LogEndOfTrajectory(g.log, Type, g.frames[g.nbCfg], g.frames[len(g.frames)-1], g.nbCfg)
+	}
+
+	err = g.volume(f)
+	if err != nil {
+		return fmt.Errorf("volume: %w", err)
+	}
+
+	out, err := g.output(w)
 	if err != nil {
 		return fmt.Errorf("Write: %w", err)
 	}
 	defer out.Close()
-	g.write(out)
+	if g.partial {
+		format := "Partial: interrupted after %d configurations of %d\n\n"
+		if g.blocks() {
+			format = "# Partial: interrupted after %d configurations of %d\n"
+		}
+		fmt.Fprintf(out, format, g.nbCfg, len(g.frames))
+	} else if g.convergedAt >= 0 {
+		format := "Converged: configuration %d, %d configurations of %d\n\n"
+		if g.blocks() {
+			format = "# Converged: configuration %d, %d configurations of %d\n"
+		}
+		fmt.Fprintf(out, format, g.frames[g.convergedAt], g.nbCfg, len(g.frames))
+	}
+	err = g.write(out)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	err = g.frameMap.Write(g.FileOutFrames)
+	if err != nil {
+		return fmt.Errorf("FrameMap: %w", err)
+	}
 
 	return nil
 }
 
-func (g *GR) start(r *bufio.Reader) {
+// start reads the configurations and adds them to the histograms of the
+// worker w until the end of frames.
+func (g *GR) start(w *worker, f *os.File, r *bufio.Reader) {
 	for {
 		g.mux.Lock()
 		g.cfg++
-		if g.cfg >= g.CfgEnd || g.err != nil {
+		if g.cfg >= len(g.frames) || g.err != nil {
+			break
+		}
+
+		if g.ctx != nil && g.ctx.Err() != nil {
+			g.cfg = len(g.frames) // the other threads stop as well
+			g.partial = true
 			break
 		}
 
-		box, xyz, err := g.readCfg(r)
+		err := g.input.SkipTo(f, r, g.frames.From(g.cfg), g.frames[g.cfg])
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			g.cfg = len(g.frames) // the other threads stop as well
+			break
+		} else if err != nil {
+			if g.err == nil {
+				g.err = fmt.Errorf("SkipTo (step %d): %w", g.frames[g.cfg], err)
+			}
+			break
+		}
+
+		box, tilt, xyz, ids, slots, err := g.readCfg(r)
 		if err != nil {
 			if g.err == nil {
-				g.err = fmt.Errorf("readCfg (step %d): %w", g.cfg, err)
+				g.err = fmt.Errorf("readCfg (step %d): %w", g.frames[g.cfg], err)
 			}
 			break
 		}
+		g.frameMap.Add(g.frames[g.cfg], g.timestep)
+		g.nbCfg++
+		g.progress.Update(g.cfg+1, len(g.frames))
+		cfg := g.cfg
 		g.mux.Unlock()
-		g.calc(box, xyz)
+		g.calc(w, box, tilt, xyz, ids, slots, cfg)
 	}
 
 	g.mux.Unlock()
 	g.wg.Done()
 }
 
-// calc increments the histogram.
-func (g *GR) calc(box [3]float64, xyz XYZ) {
+// worker contains what a thread accumulates over the configurations it
+// processes, so that the threads share nothing while they add a configuration.
+type worker struct {
+	mux  sync.Mutex // held while a configuration is added
+	hstg map[[2]string][][]uint64
+	boot map[int][]uint32 // histograms of each block (see Bootstrap)
+
+	boxVol        []float64
+	vol           float64 // sum of boxVol
+	half, halfMin float64
+}
+
+// newWorker returns a worker whose histograms have the shape of hstg.
+func (g *GR) newWorker() *worker {
+	w := worker{hstg: make(map[[2]string][][]uint64, len(g.hstg))}
+	for key, slots := range g.hstg {
+		w.hstg[key] = make([][]uint64, len(slots))
+		for i := range slots {
+			w.hstg[key][i] = make([]uint64, g.bins)
+		}
+	}
+	if g.Bootstrap > 0 {
+		w.boot = make(map[int][]uint32)
+	}
+	return &w
+}
+
+// calc increments the histograms of the worker w with the configuration cfg of
+// frames. The excluded pairs are skipped. If slots is not nil, it gives the
+// histogram of each atom. If Bootstrap is set, the histograms of the block of
+// the configuration are incremented as well.
+func (g *GR) calc(w *worker, box, tilt [3]float64, xyz XYZ, ids, slots IDs, cfg int) {
+	w.mux.Lock()
+	var boot []uint32
+	if g.Bootstrap > 0 {
+		b := cfg / g.BootstrapBlock
+		if w.boot[b] == nil {
+			w.boot[b] = make([]uint32, g.bootLen)
+		}
+		boot = w.boot[b]
+	}
+
 	for at1, arrAt2 := range g.Atoms {
 		for xyz1, xyzAt1 := range xyz[at1] {
+			slot := xyz1
+			if slots != nil {
+				slot = slots[at1][xyz1]
+			}
+
+			slot = g.center(at1, slot)
+			if slot < 0 || (slots != nil && slot >= len(g.present[at1])) {
+				continue
+			}
+
 			for _, at2 := range arrAt2 {
-				for _, xyzAt2 := range xyz[at2] { // For each combinaison
-					var dist float64
-					for k := 0; k < 3; k++ {
-						distatt := xyzAt1[k] - xyzAt2[k]
-						dist += util.Pow((distatt - box[k]*math.Round(distatt/box[k])), 2)
+				key := [2]string{at1, at2}
+				if slot >= len(w.hstg[key]) { // not a center in the first configuration
+					continue
+				}
+
+				hstg := w.hstg[key][slot]
+				var b []uint32
+				if boot != nil {
+					off := g.bootOff[key] + slot*g.bins
+					b = boot[off : off+g.bins]
+				}
+
+				for xyz2, xyzAt2 := range xyz[at2] { // For each combinaison
+					if ids != nil && g.excl[[2]int{ids[at1][xyz1], ids[at2][xyz2]}] {
+						continue
 					}
 
+					dist := util.MinImageDist2Tilt(xyzAt1, xyzAt2, box, tilt)
+
 					if dist <= g.rmax2 {
-						dist = math.Sqrt(dist)
-						index := int(dist / g.Dr)
-						g.mux.Lock()
-						g.hstg[[2]string{at1, at2}][xyz1][index] += 1.
-						g.mux.Unlock()
+						index := g.index(math.Sqrt(dist))
+						if index < g.bins {
+							hstg[index]++
+							if b != nil {
+								b[index]++
+							}
+						}
 					}
 				}
 			}
 		}
 	}
 
-	g.mux.Lock()
-	defer g.mux.Unlock()
-	g.vol += box[0] * box[1] * box[2]
+	vol := box[0] * box[1] * box[2]
+	w.boxVol = append(w.boxVol, vol)
+	w.vol += vol
+	widths := util.Widths(box, tilt)
+	half := math.Min(widths[0], math.Min(widths[1], widths[2])) / 2.
+	w.half = math.Max(w.half, half)
+	if w.halfMin == 0 || half < w.halfMin {
+		w.halfMin = half
+	}
+	w.mux.Unlock()
+
+	done := atomic.AddInt64(&g.done, 1)
+	if g.ConvergenceTol > 0 && done%int64(g.ConvergenceEvery) == 0 {
+		g.converge()
+	}
+}
+
+// merge adds the histograms, the blocks, and the volumes of the workers to the
+// ones of the calculation once the threads are done.
+func (g *GR) merge() {
+	for _, w := range g.workers {
+		for key, slots := range w.hstg {
+			for slot, bins := range slots {
+				for bin, count := range bins {
+					g.hstg[key][slot][bin] += count
+				}
+			}
+		}
+
+		for b, counts := range w.boot {
+			for len(g.boot) <= b {
+				g.boot = append(g.boot, make([]uint32, g.bootLen))
+			}
+			for i, count := range counts {
+				g.boot[b][i] += count
+			}
+		}
+
+		g.boxVol = append(g.boxVol, w.boxVol...)
+		g.half = math.Max(g.half, w.half)
+		if g.halfMin == 0 || (w.halfMin > 0 && w.halfMin < g.halfMin) {
+			g.halfMin = w.halfMin
+		}
+	}
+	g.workers = nil
+}
+
+// converge compares g(r) of the configurations accumulated so far by the
+// workers to the one of the previous check and stops the calculation once it
+// has converged (see ConvergenceTol). The histograms of the workers are summed
+// one worker at a time, so that the other threads keep on running.
+func (g *GR) converge() {
+	g.convMux.Lock()
+	defer g.convMux.Unlock()
+	if g.convergedAt >= 0 {
+		return
+	}
+
+	var nbCfg int
+	var vol float64
+	counts := make(map[[2]string][]uint64, len(g.hstg))
+	for key := range g.hstg {
+		counts[key] = make([]uint64, g.bins)
+	}
+	for _, w := range g.workers {
+		w.mux.Lock()
+		nbCfg += len(w.boxVol)
+		vol += w.vol
+		for key, slots := range w.hstg {
+			for _, hstg := range slots {
+				for bin, count := range hstg {
+					counts[key][bin] += count
+				}
+			}
+		}
+		w.mux.Unlock()
+	}
+	vol /= float64(nbCfg)
+
+	var change float64
+	cur := make(map[[2]string][]float64, len(g.hstg))
+	for key, slots := range g.hstg {
+		cur[key] = make([]float64, g.bins)
+		if len(slots) == 0 {
+			continue
+		}
+
+		norm := float64(nbCfg) * float64(len(slots)) * g.xyzLen[key[1]] / vol
+		for bin := 0; bin < g.bins; bin++ {
+			shell := 4. / 3. * math.Pi * (util.Pow(g.edges[bin+1], 3) - util.Pow(g.edges[bin], 3))
+			cur[key][bin] = float64(counts[key][bin]) / (norm * shell)
+			if g.convPrev != nil {
+				change = math.Max(change, math.Abs(cur[key][bin]-g.convPrev[key][bin]))
+			}
+		}
+	}
+
+	if g.convPrev != nil && change < g.ConvergenceTol {
+		g.convHits++
+	} else {
+		g.convHits = 0
+	}
+	g.convPrev = cur
+
+	if g.convHits >= g.ConvergenceChecks {
+		g.mux.Lock()
+		g.convergedAt = nbCfg - 1
+		g.cfg = len(g.frames) // the threads stop
+		g.mux.Unlock()
+	}
+}
+
+// resample returns the histograms of Bootstrap samples of the blocks. The
+// samples are scaled to the number of configurations read since the last block
+// may be shorter than the others.
+func (g *GR) resample() [][]float64 {
+	rnd := rand.New(rand.NewSource(g.Seed))
+	reps := make([][]float64, g.Bootstrap)
+	for r := range reps {
+		reps[r] = make([]float64, g.bootLen)
+
+		var cfg int
+		for range g.boot {
+			b := rnd.Intn(len(g.boot))
+			if n := g.nbCfg - b*g.BootstrapBlock; n < g.BootstrapBlock {
+				cfg += n
+			} else {
+				cfg += g.BootstrapBlock
+			}
+			for i, count := range g.boot[b] {
+				reps[r][i] += float64(count)
+			}
+		}
+
+		scale := float64(g.nbCfg) / float64(cfg)
+		for i := range reps[r] {
+			reps[r][i] *= scale
+		}
+	}
+	return reps
+}
+
+// bounds returns the confidence interval of g(r) of the histogram starting at
+// off in the samples reps. norm is the normalization of the counts of the full
+// g(r) without the volume of the bins vol.
+func (g *GR) bounds(reps [][]float64, off int, norm float64, vol []float64) (lo, hi []float64) {
+	lo, hi = make([]float64, g.bins), make([]float64, g.bins)
+	q := (1. - g.Confidence) / 2.
+	v := make([]float64, len(reps))
+	for bin := 0; bin < g.bins; bin++ {
+		for r := range reps {
+			v[r] = reps[r][off+bin] / (norm * vol[bin])
+		}
+		sort.Float64s(v)
+		lo[bin], hi[bin] = percentile(v, q), percentile(v, 1.-q)
+	}
+	return
+}
+
+// volume sets the average volume of the box over the configurations read. It
+// is read from the statistics shared by the calculations of the batch if they
+// exist, and they are written otherwise (see util.Input.ReadVolumeStats).
+func (g *GR) volume(f *os.File) error {
+	frames := g.frames[:g.nbCfg]
+	stats, err := g.input.ReadVolumeStats(f, frames)
+	if err != nil {
+		return fmt.Errorf("ReadVolumeStats: %w", err)
+	}
+
+	if stats == nil {
+		stats = util.NewVolumeStats(g.boxVol)
+		err = g.input.WriteVolumeStats(f, frames, stats)
+		if err != nil {
+			return fmt.Errorf("WriteVolumeStats: %w", err)
+		}
+	}
+
+	g.vol = stats.Mean
+	return nil
 }
 
 // write writes the results of this calculation into a file.
@@ -232,36 +1026,100 @@ func (g *GR) write(w io.Writer) error {
 	var vol []float64
 	for i := 0; i < g.bins; i++ {
 		vol = append(vol, (4. / 3. * math.Pi *
-			(util.Pow((float64(i+1)*g.Dr), 3) - util.Pow((float64(i)*g.Dr), 3))))
+			(util.Pow(g.edges[i+1], 3) - util.Pow(g.edges[i], 3))))
 	}
 
-	// Average of the volume
-	g.vol /= float64(g.CfgEnd - g.CfgStart)
-
-	// g(r) and its integral
+	// g(r) and its integral. intg is the cumulative count per configuration and
+	// is kept for backward compatibility. coord is the coordination number
+	// N(r) = ∫4πρr²g(r)dr with ρ the average density of the second atom type
+	// (all the atoms, not only the selected ones). The bulk density replaces the
+	// average density if it is set; the density of the selected atoms is then
+	// scaled by the fraction of selected atoms.
 	intg := make(map[[2]string][][]float64)
-	nbCfg := float64(g.CfgEnd - g.CfgStart)
+	hstg := make(map[[2]string][][]float64)
+	coord := make(map[[2]string][][]float64)
+	rhoAll := make(map[string]float64)
+	lo := make(map[[2]string][][]float64) // confidence interval of hstg
+	hi := make(map[[2]string][][]float64)
+	var reps [][]float64
+	if g.Bootstrap > 0 {
+		reps = g.resample()
+	}
+	nbCfg := float64(g.nbCfg)
+	if g.sel != nil {
+		for k := range g.xyzLen {
+			g.xyzLen[k] = g.sumLen[k] / nbCfg
+			g.xyzLenAll[k] = g.sumLenAll[k] / nbCfg
+		}
+	}
+
 	for at1, arrAt2 := range g.Atoms {
 		for _, at2 := range arrAt2 {
 			key := [2]string{at1, at2}
 			intg[key] = make([][]float64, len(g.hstg[key]))
+			hstg[key] = make([][]float64, len(g.hstg[key]))
+			coord[key] = make([][]float64, len(g.hstg[key]))
+			lo[key] = make([][]float64, len(g.hstg[key]))
+			hi[key] = make([][]float64, len(g.hstg[key]))
+			rho := g.xyzLen[at2] / g.vol
+			rhoAll[at2] = g.xyzLenAll[at2] / g.vol
+			if bulk, ok := g.BulkDensity[at2]; ok {
+				rho = bulk * g.xyzLen[at2] / g.xyzLenAll[at2]
+				rhoAll[at2] = bulk
+			}
 
 			for atomID, bins := range g.hstg[key] {
 				intg[key][atomID] = make([]float64, g.bins)
+				hstg[key][atomID] = make([]float64, g.bins)
+				coord[key][atomID] = make([]float64, g.bins)
+
+				nb := nbCfg
+				if g.sel != nil {
+					nb = math.Max(g.present[at1][atomID], 1)
+				}
 
-				intg[key][atomID][0] = bins[0] / nbCfg
-				g.hstg[key][atomID][0] = intg[key][atomID][0] / (vol[0] * g.xyzLen[at2] / g.vol)
-				for bin, hstg := range bins[1:] {
+				intg[key][atomID][0] = float64(bins[0]) / nb
+				hstg[key][atomID][0] = intg[key][atomID][0] / (vol[0] * rho)
+				coord[key][atomID][0] = rhoAll[at2] * hstg[key][atomID][0] * vol[0]
+				for bin, count := range bins[1:] {
 					bin++
-					intg[key][atomID][bin] = hstg / nbCfg
-					g.hstg[key][atomID][bin] = intg[key][atomID][bin] / (vol[bin] * g.xyzLen[at2] / g.vol)
+					intg[key][atomID][bin] = float64(count) / nb
+					hstg[key][atomID][bin] = intg[key][atomID][bin] / (vol[bin] * rho)
 					intg[key][atomID][bin] += intg[key][atomID][bin-1]
+					coord[key][atomID][bin] = coord[key][atomID][bin-1] +
+						rhoAll[at2]*hstg[key][atomID][bin]*vol[bin]
+				}
+
+				if reps != nil {
+					lo[key][atomID], hi[key][atomID] = g.bounds(reps,
+						g.bootOff[key]+atomID*g.bins, nb*rho, vol)
 				}
 			}
 
 		}
 	}
 
+	g.headline = g.firstShell(hstg, coord)
+
+	if g.FileOutKB != "" {
+		err := g.writeKB(hstg, vol, rhoAll)
+		if err != nil {
+			return fmt.Errorf("writeKB: %w", err)
+		}
+	}
+
+	if g.FileOutSq != "" {
+		err := g.writeSq(hstg, rhoAll)
+		if err != nil {
+			return fmt.Errorf("writeSq: %w", err)
+		}
+	}
+
+	if g.blocks() {
+		g.writeGnuplot(w, hstg, coord, lo, hi)
+		return nil
+	}
+
 	// Write the results
 	// Header
 	fmt.Fprint(w, "dist ")
@@ -278,6 +1136,11 @@ func (g *GR) write(w io.Writer) error {
 
 			fmt.Fprint(w, order, "-", v, "(", orderListIncr[lit], ")-intg ")
 			fmt.Fprint(w, order, "-", v, "(", orderListIncr[lit], ")-hstg ")
+			fmt.Fprint(w, order, "-", v, "(", orderListIncr[lit], ")-N ")
+			if g.Bootstrap > 0 {
+				fmt.Fprint(w, order, "-", v, "(", orderListIncr[lit], ")-g_lo ")
+				fmt.Fprint(w, order, "-", v, "(", orderListIncr[lit], ")-g_hi ")
+			}
 			orderList = append(orderList, lit)
 			orderListIncr[lit]++
 		}
@@ -287,13 +1150,28 @@ func (g *GR) write(w io.Writer) error {
 	// Results for each bin
 	for i := 0; i < g.bins; i++ {
 		orderListIncr := make(map[[2]string]int)
-		fmt.Fprint(w, ((float64(i+1) - 0.5) * g.Dr), " ")
+		fmt.Fprint(w, g.mid(i), " ")
+
+		if g.missing(i) {
+			for range orderList {
+				fmt.Fprint(w, g.MissingValue, " ", g.MissingValue, " ", g.MissingValue, " ")
+				if g.Bootstrap > 0 {
+					fmt.Fprint(w, g.MissingValue, " ", g.MissingValue, " ")
+				}
+			}
+			fmt.Fprint(w, "\n")
+			continue
+		}
 
 		for _, v := range orderList {
 			if _, ok := orderListIncr[v]; !ok {
 				orderListIncr[v] = 0
 			}
-			fmt.Fprint(w, intg[v][orderListIncr[v]][i], " ", g.hstg[v][orderListIncr[v]][i], " ")
+			fmt.Fprint(w, intg[v][orderListIncr[v]][i], " ", hstg[v][orderListIncr[v]][i], " ",
+				coord[v][orderListIncr[v]][i], " ")
+			if g.Bootstrap > 0 {
+				fmt.Fprint(w, lo[v][orderListIncr[v]][i], " ", hi[v][orderListIncr[v]][i], " ")
+			}
 			orderListIncr[v]++
 		}
 		fmt.Fprint(w, "\n")
@@ -301,3 +1179,412 @@ func (g *GR) write(w io.Writer) error {
 
 	return nil
 }
+
+// output returns the output of the results with the parameters in its header:
+// w if it isn't nil (see RunReader), FileOut otherwise.
+func (g *GR) output(w io.Writer) (*util.Output, error) {
+	commented := g.Format == FormatGnuplot && g.format != util.FormatJSON
+	switch {
+	case w != nil && commented:
+		return util.WriteCommentedTo(w, g)
+	case w != nil:
+		return util.WriteFormatTo(w, g, g.format)
+	case commented:
+		return util.WriteCommented(g.FileOut, g)
+	}
+	return util.WriteFormat(g.FileOut, g, g.format)
+}
+
+// blocks returns true if the results of each pair are written in a block (see
+// FormatGnuplot).
+func (g *GR) blocks() bool {
+	return g.Format == FormatGnuplot || g.format == util.FormatJSON
+}
+
+// writeGnuplot writes g(r) and N(r) of each pair in a block (see
+// FormatGnuplot). The pairs are named and ordered like the columns of
+// FormatColumns. lo and hi are the confidence interval of g (see Bootstrap).
+func (g *GR) writeGnuplot(w io.Writer, hstg, coord, lo, hi map[[2]string][][]float64) {
+	orderListIncr := make(map[[2]string]int)
+	var block int
+	for _, order := range g.order {
+		for _, v := range g.Atoms[order] {
+			lit := [2]string{order, v}
+			atomID := orderListIncr[lit]
+			orderListIncr[lit]++
+
+			if block > 0 {
+				fmt.Fprint(w, "\n\n")
+			}
+			block++
+
+			fmt.Fprintf(w, "# pair %s-%s(%d)\n# r g N", order, v, atomID)
+			if g.Bootstrap > 0 {
+				fmt.Fprint(w, " g_lo g_hi")
+			}
+			fmt.Fprint(w, "\n")
+
+			for i := 0; i < g.bins; i++ {
+				if g.missing(i) {
+					fmt.Fprint(w, g.mid(i), " ", g.MissingValue, " ", g.MissingValue)
+					if g.Bootstrap > 0 {
+						fmt.Fprint(w, " ", g.MissingValue, " ", g.MissingValue)
+					}
+					fmt.Fprint(w, "\n")
+					continue
+				}
+
+				fmt.Fprint(w, g.mid(i), " ", hstg[lit][atomID][i], " ",
+					coord[lit][atomID][i])
+				if g.Bootstrap > 0 {
+					fmt.Fprint(w, " ", lo[lit][atomID][i], " ", hi[lit][atomID][i])
+				}
+				fmt.Fprint(w, "\n")
+			}
+		}
+	}
+}
+
+// writeKB writes the running Kirkwood-Buff integral of each pair, without and
+// with the finite size correction, into FileOutKB (see GR). rhoAll is the
+// density of each atom type used for N(r).
+func (g *GR) writeKB(hstg map[[2]string][][]float64, vol []float64, rhoAll map[string]float64) error {
+	out, err := util.WriteFormat(g.FileOutKB, g, g.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+
+	type column struct {
+		kb, kbCorr []float64
+	}
+
+	var cols []column
+	orderListIncr := make(map[[2]string]int)
+	fmt.Fprint(out, "R ")
+	for _, order := range g.order {
+		for _, v := range g.Atoms[order] {
+			lit := [2]string{order, v}
+			atomID := orderListIncr[lit]
+			orderListIncr[lit]++
+
+			fmt.Fprint(out, order, "-", v, "(", atomID, ")-G ")
+			fmt.Fprint(out, order, "-", v, "(", atomID, ")-G_corrected ")
+
+			var col column
+			col.kb, col.kbCorr = kirkwoodBuff(hstg[lit][atomID], vol, g.edges, rhoAll[v],
+				g.vol, order == v)
+			cols = append(cols, col)
+		}
+	}
+	fmt.Fprint(out, "\n")
+
+	for i := 0; i < g.bins; i++ {
+		fmt.Fprint(out, g.edges[i+1], " ")
+		for _, col := range cols {
+			if g.missing(i) {
+				fmt.Fprint(out, g.MissingValue, " ", g.MissingValue, " ")
+				continue
+			}
+			fmt.Fprint(out, col.kb[i], " ", col.kbCorr[i], " ")
+		}
+		fmt.Fprint(out, "\n")
+	}
+
+	return nil
+}
+
+// kirkwoodBuff returns the running Kirkwood-Buff integral of hstg up to the
+// outer radius of each bin, and the same integral with the finite size
+// correction (see GR). edges are the edges of the bins, rho is the density of
+// the second atom type, volBox the average volume of the box, and same is true
+// if both atom types are the same.
+func kirkwoodBuff(hstg, vol, edges []float64, rho, volBox float64, same bool) (kb, kbCorr []float64) {
+	var delta float64
+	if same {
+		delta = 1
+	}
+
+	n := rho * volBox
+	kb = make([]float64, len(hstg))
+	kbCorr = make([]float64, len(hstg))
+	var sum, sumCorr float64
+	for i, v := range hstg {
+		// The correction is evaluated at the middle of the bin, with the excess
+		// number of atoms up to the same radius.
+		r := (edges[i] + edges[i+1]) / 2
+		volIn := 4. / 3. * math.Pi * util.Pow(r, 3)
+		excess := sum + (v-1)*(volIn-4./3.*math.Pi*util.Pow(edges[i], 3))
+		nOut := n * (1 - volIn/volBox)
+		corr := v * nOut / (nOut - rho*excess - delta)
+		sumCorr += (corr - 1) * vol[i]
+		sum += (v - 1) * vol[i]
+
+		kb[i] = sum
+		kbCorr[i] = sumCorr
+	}
+
+	return
+}
+
+// writeSq writes the structure factor of each pair, calculated from g(r), into
+// FileOutSq (see GR). rhoAll is the density of each atom type used for N(r).
+func (g *GR) writeSq(hstg map[[2]string][][]float64, rhoAll map[string]float64) error {
+	out, err := util.WriteFormat(g.FileOutSq, g, g.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+
+	nb := int(math.Floor(g.QMax/g.QSpacing + 1e-9))
+	var cols [][]float64
+	orderListIncr := make(map[[2]string]int)
+	fmt.Fprint(out, "q ")
+	for _, order := range g.order {
+		for _, v := range g.Atoms[order] {
+			lit := [2]string{order, v}
+			atomID := orderListIncr[lit]
+			orderListIncr[lit]++
+
+			fmt.Fprint(out, order, "-", v, "(", atomID, ")-S ")
+			cols = append(cols, structureFactor(hstg[lit][atomID], g.edges, rhoAll[v],
+				g.halfMin, g.QSpacing, nb, order == v))
+		}
+	}
+	fmt.Fprint(out, "\n")
+
+	for i := 0; i < nb; i++ {
+		fmt.Fprint(out, float64(i+1)*g.QSpacing, " ")
+		for _, col := range cols {
+			fmt.Fprint(out, col[i], " ")
+		}
+		fmt.Fprint(out, "\n")
+	}
+
+	return nil
+}
+
+// structureFactor returns the structure factor of hstg for the nb wave vectors
+// q = dq, 2dq, ... (see GR). edges are the edges of the bins, rho is the
+// density of the second atom type, the bins beyond rMax are not integrated,
+// and same is true if both atom types are the same.
+func structureFactor(hstg, edges []float64, rho, rMax, dq float64, nb int, same bool) []float64 {
+	if same && len(hstg) > 0 {
+		// The atom itself is 1 in N(r) = ρ·g(r)·V(r) at the first bin.
+		hstg = append([]float64(nil), hstg...)
+		hstg[0] -= 1 / (rho * 4. / 3. * math.Pi * (util.Pow(edges[1], 3) - util.Pow(edges[0], 3)))
+	}
+
+	sq := make([]float64, nb)
+	for k := range sq {
+		q := float64(k+1) * dq
+
+		var sum float64
+		for i, v := range hstg {
+			if edges[i+1] > rMax {
+				break
+			}
+
+			r := (edges[i] + edges[i+1]) / 2
+			sum += (v - 1) * r * math.Sin(q*r) / q * (edges[i+1] - edges[i])
+		}
+
+		sq[k] = 1 + 4*math.Pi*rho*sum
+	}
+
+	return sq
+}
+
+// references returns true if only some center atoms contribute to the
+// histograms (see Reference, ReferenceFraction, and MaxReferences).
+func (g *GR) references() bool {
+	return g.ref != nil || g.sampleReferences()
+}
+
+// sampleReferences returns true if the center atoms are sampled (see
+// ReferenceFraction and MaxReferences).
+func (g *GR) sampleReferences() bool {
+	return g.MaxReferences > 0 || (g.ReferenceFraction > 0 && g.ReferenceFraction < 1)
+}
+
+// sample samples the references of the first configuration (see
+// ReferenceFraction and MaxReferences). It updates the index of the histogram
+// of each center atom and returns the order of the remaining ones.
+func (g *GR) sample(order []string) []string {
+	rnd := rand.New(rand.NewSource(g.Seed))
+
+	types := make([]string, 0, len(g.Atoms))
+	for typ := range g.Atoms {
+		types = append(types, typ)
+	}
+	sort.Strings(types) // the random numbers don't depend on the map order
+
+	keep := make(map[string][]bool, len(types))
+	for _, typ := range types {
+		var kept []int
+		keep[typ] = make([]bool, g.refLen[typ])
+		for i := range keep[typ] {
+			if g.ReferenceFraction <= 0 || g.ReferenceFraction >= 1 ||
+				rnd.Float64() < g.ReferenceFraction {
+				kept = append(kept, i)
+			}
+		}
+
+		if g.MaxReferences > 0 && len(kept) > g.MaxReferences {
+			rnd.Shuffle(len(kept), func(i, j int) { kept[i], kept[j] = kept[j], kept[i] })
+			kept = kept[:g.MaxReferences]
+		}
+
+		for _, i := range kept {
+			keep[typ][i] = true
+		}
+
+		var n int
+		for slot, idx := range g.refIdx[typ] {
+			if idx < 0 {
+				continue
+			}
+			if !keep[typ][idx] {
+				g.refIdx[typ][slot] = -1
+				continue
+			}
+			g.refIdx[typ][slot] = n
+			n++
+		}
+		g.refLen[typ] = n
+	}
+
+	sampled := order[:0]
+	seen := make(map[string]int, len(types))
+	for _, typ := range order {
+		if keep[typ][seen[typ]] {
+			sampled = append(sampled, typ)
+		}
+		seen[typ]++
+	}
+
+	return sampled
+}
+
+// center returns the index of the histogram of the center atom of type at1
+// whose slot (index among the atoms of its type kept by the sampler) is slot,
+// or -1 if it is not a reference (see Reference).
+func (g *GR) center(at1 string, slot int) int {
+	if g.refIdx == nil {
+		return slot
+	}
+
+	if slot >= len(g.refIdx[at1]) {
+		return -1
+	}
+	return g.refIdx[at1][slot]
+}
+
+// Summary returns the first peak of g(r) of each pair and the coordination
+// number at the first minimum following it (see firstShell).
+func (g *GR) Summary() string {
+	return g.headline
+}
+
+// firstShell returns, for each pair in the order of the columns, the position
+// and the height of the highest peak of g(r) and the coordination number at the
+// first minimum following it. The bins without value (see MissingValue) are
+// ignored.
+func (g *GR) firstShell(hstg, coord map[[2]string][][]float64) string {
+	bins := g.bins
+	for bins > 0 && g.missing(bins-1) {
+		bins--
+	}
+
+	var parts []string
+	incr := make(map[[2]string]int)
+	for _, order := range g.order {
+		for _, v := range g.Atoms[order] {
+			key := [2]string{order, v}
+			name := fmt.Sprintf("%s-%s(%d)", order, v, incr[key])
+			h, n := hstg[key][incr[key]], coord[key][incr[key]]
+			incr[key]++
+
+			peak := -1
+			for i := 0; i < bins; i++ {
+				if peak < 0 || h[i] > h[peak] {
+					peak = i
+				}
+			}
+			if peak < 0 {
+				continue
+			}
+
+			min := -1
+			for i := peak + 1; i+1 < bins; i++ {
+				if h[i] < h[i+1] {
+					min = i
+					break
+				}
+			}
+
+			part := fmt.Sprintf("%s: peak %g at %g", name, h[peak], g.mid(peak))
+			if min >= 0 {
+				part += fmt.Sprintf(", N %g at the first minimum %g", n[min], g.mid(min))
+			} else {
+				part += ", no minimum before rmax"
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	return fmt.Sprintf("%s (%d configurations)", strings.Join(parts, "; "), g.nbCfg)
+}
+
+// missing returns true if MissingValue is set and the bin i is never sampled
+// (see GR).
+func (g *GR) missing(i int) bool {
+	return g.MissingValue != "" && g.edges[i+1] > g.half
+}
+
+// edge returns the inner edge of the bin i (the outer edge of the bin i-1).
+// The last edge is RMax with logarithmic bins.
+func (g *GR) edge(i int) float64 {
+	if !g.LogBins {
+		return float64(i) * g.Dr
+	}
+
+	switch {
+	case i == 0:
+		return 0
+	case i == g.bins:
+		return g.RMax
+	}
+	return g.RMin * math.Pow(10, float64(i-1)/float64(g.BinsPerDecade))
+}
+
+// index returns the bin of the distance dist.
+func (g *GR) index(dist float64) int {
+	if !g.LogBins {
+		return int(dist / g.Dr)
+	}
+
+	if dist < g.RMin {
+		return 0
+	}
+	return 1 + int(math.Log10(dist/g.RMin)*float64(g.BinsPerDecade))
+}
+
+// mid returns the middle of the bin i.
+func (g *GR) mid(i int) float64 {
+	if !g.LogBins {
+		return (float64(i+1) - 0.5) * g.Dr
+	}
+	return (g.edges[i] + g.edges[i+1]) / 2
+}
+
+// percentile returns the percentile q (between 0 and 1) of the sorted values v
+// with a linear interpolation between the closest ranks.
+func percentile(v []float64, q float64) float64 {
+	pos := q * float64(len(v)-1)
+	i := int(pos)
+	if i+1 >= len(v) {
+		return v[len(v)-1]
+	}
+	return v[i] + (pos-float64(i))*(v[i+1]-v[i])
+}
@@ -0,0 +1,1576 @@
+package gr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// atom is an atom of a test trajectory.
+type atom struct {
+	typ string
+	xyz [3]float64
+}
+
+// trajectory returns a LAMMPS trajectory with the columns id, type, x, y, and
+// z. Each configuration is in a cubic box of length box.
+func trajectory(box float64, cfgs ...[]atom) string {
+	var b strings.Builder
+	for i, atoms := range cfgs {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", i, len(atoms))
+		fmt.Fprintf(&b, "ITEM: BOX BOUNDS pp pp pp\n0 %g\n0 %g\n0 %g\n", box, box, box)
+		b.WriteString("ITEM: ATOMS id type x y z\n")
+		for j, at := range atoms {
+			fmt.Fprintf(&b, "%d %s %g %g %g\n", j+1, at.typ, at.xyz[0], at.xyz[1], at.xyz[2])
+		}
+	}
+	return b.String()
+}
+
+// run completes g with NewWithParams and runs it on the trajectory traj. It
+// returns the output written.
+func run(g *GR, traj string) (string, error) {
+	g, err := NewWithParams(g)
+	if err != nil {
+		return "", fmt.Errorf("NewWithParams: %w", err)
+	}
+
+	var out bytes.Buffer
+	err = g.RunReader(strings.NewReader(traj), &out)
+	return out.String(), err
+}
+
+func TestAtomsChanged(t *testing.T) {
+	first := []atom{{"1", [3]float64{1, 1, 1}}, {"1", [3]float64{2, 1, 1}}, {"1", [3]float64{3, 1, 1}}}
+	second := append(first, atom{"1", [3]float64{4, 1, 1}})
+
+	tests := []struct {
+		name   string
+		cfgs   [][]atom
+		errMsg string // empty if no error is expected
+	}{
+		{"constant", [][]atom{first, first, first}, ""},
+		{"more atoms", [][]atom{first, first, second}, "number of atoms changed: 4 (3 in the first configuration)"},
+		{"less atoms", [][]atom{second, first}, "number of atoms changed: 3 (4 in the first configuration)"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(&GR{CfgEnd: len(tt.cfgs), Atoms: map[string][]string{"1": {"1"}},
+			RMax: 4, Dr: 0.5, Threads: 1}, trajectory(10, tt.cfgs...))
+
+		switch {
+		case tt.errMsg == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+		}
+	}
+}
+
+// calcMutex is like calc without the options (exclusions, selection,
+// references, and bootstrap), but the threads share the histogram and the bins
+// are incremented under the lock.
+func (g *GR) calcMutex(box [3]float64, xyz XYZ) {
+	for at1, arrAt2 := range g.Atoms {
+		for xyz1, xyzAt1 := range xyz[at1] {
+			for _, at2 := range arrAt2 {
+				key := [2]string{at1, at2}
+				for _, xyzAt2 := range xyz[at2] {
+					dist := util.MinImageDist2(xyzAt1, xyzAt2, box)
+					if dist <= g.rmax2 {
+						index := g.index(math.Sqrt(dist))
+						if index < g.bins {
+							g.mux.Lock()
+							g.hstg[key][xyz1][index]++
+							g.mux.Unlock()
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkCalc compares the histograms of each worker of calc with a shared
+// histogram incremented under a lock (calcMutex), the configurations being
+// processed in parallel.
+func BenchmarkCalc(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	box := [3]float64{30, 30, 30}
+	xyz := make(XYZ)
+	for _, typ := range []string{"1", "2"} {
+		for i := 0; i < 500; i++ {
+			xyz[typ] = append(xyz[typ], [3]float64{rnd.Float64() * box[0], rnd.Float64() * box[1], rnd.Float64() * box[2]})
+		}
+	}
+
+	newGR := func() *GR {
+		g, err := NewWithParams(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"1", "2"}}, RMax: 12, Dr: 0.05})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, at2 := range g.Atoms["1"] {
+			slots := make([][]uint64, len(xyz["1"]))
+			for i := range slots {
+				slots[i] = make([]uint64, g.bins)
+			}
+			g.hstg[[2]string{"1", at2}] = slots
+		}
+		return g
+	}
+
+	b.Run("Workers", func(b *testing.B) {
+		g := newGR()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			w := g.newWorker()
+			for pb.Next() {
+				g.calc(w, box, [3]float64{}, xyz, nil, nil, 0)
+			}
+		})
+	})
+
+	b.Run("Mutex", func(b *testing.B) {
+		g := newGR()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				g.calcMutex(box, xyz)
+			}
+		})
+	})
+}
+
+// edges returns the edges of bins bins of width dr.
+func edges(bins int, dr float64) []float64 {
+	e := make([]float64, bins+1)
+	for i := range e {
+		e[i] = float64(i) * dr
+	}
+	return e
+}
+
+func TestStructureFactorIdealGas(t *testing.T) {
+	const (
+		bins = 200
+		dr   = 0.025
+		rho  = 0.8
+	)
+	e := edges(bins, dr)
+
+	for _, same := range []bool{false, true} {
+		hstg := make([]float64, bins)
+		for i := range hstg {
+			hstg[i] = 1
+		}
+		if same { // the distance 0 of each atom with itself (see GR)
+			hstg[0] += 1 / (rho * 4. / 3. * math.Pi * math.Pow(dr, 3))
+		}
+
+		for i, s := range structureFactor(hstg, e, rho, 5, 0.5, 40, same) {
+			if math.Abs(s-1) > 1e-9 {
+				t.Errorf("same %t: S(%g) = %g, want 1", same, float64(i+1)*0.5, s)
+			}
+		}
+	}
+}
+
+func TestStructureFactorStep(t *testing.T) {
+	// g(r) = 0 below sigma and 1 beyond: S(q) = 1 - 4πρ(sin(qσ) - qσcos(qσ))/q³.
+	const (
+		bins  = 4000
+		dr    = 0.001
+		rho   = 0.3
+		sigma = 1.
+	)
+	e := edges(bins, dr)
+	hstg := make([]float64, bins)
+	for i := range hstg {
+		if e[i] >= sigma {
+			hstg[i] = 1
+		}
+	}
+
+	for i, s := range structureFactor(hstg, e, rho, 4, 0.25, 60, false) {
+		q := float64(i+1) * 0.25
+		want := 1 - 4*math.Pi*rho*(math.Sin(q*sigma)-q*sigma*math.Cos(q*sigma))/(q*q*q)
+		if math.Abs(s-want) > 1e-4 {
+			t.Errorf("S(%g) = %g, want %g", q, s, want)
+		}
+	}
+}
+
+func TestStructureFactorRange(t *testing.T) {
+	// The bins beyond rMax don't contribute.
+	e := edges(100, 0.1)
+	hstg := make([]float64, 100)
+	for i := range hstg {
+		hstg[i] = 1
+		if e[i] >= 5 {
+			hstg[i] = 3
+		}
+	}
+
+	for i, s := range structureFactor(hstg, e, 1, 5, 0.5, 10, false) {
+		if math.Abs(s-1) > 1e-9 {
+			t.Errorf("S(%g) = %g, want 1", float64(i+1)*0.5, s)
+		}
+	}
+}
+
+func TestHalfBox(t *testing.T) {
+	// The box shrinks: S(q) is integrated up to half the smallest box, while
+	// the bins are missing beyond half the largest one.
+	var b strings.Builder
+	for i, box := range []float64{10, 8, 9} {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		fmt.Fprintf(&b, "ITEM: BOX BOUNDS pp pp pp\n0 %g\n0 %g\n0 %g\n", box, box+2, box)
+		b.WriteString("ITEM: ATOMS id type x y z\n1 1 1 1 1\n2 1 2 2 2\n")
+	}
+
+	g, err := NewWithParams(&GR{CfgEnd: 3, Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.5, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.RunReader(strings.NewReader(b.String()), new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.halfMin != 4 || g.half != 5 {
+		t.Errorf("got halfMin %g and half %g, want 4 and 5", g.halfMin, g.half)
+	}
+}
+
+func TestTriclinic(t *testing.T) {
+	// The edges of the box have a length of 10. The second atom is 1.8 away
+	// from the first one through the tilted edge only: in the orthogonal box,
+	// their distance is about 5.3, beyond RMax.
+	tests := []struct {
+		name   string
+		bounds string
+		xyz2   [3]float64
+		n      float64 // N(RMax)
+		half   float64 // half the smallest width of the box
+	}{
+		{"orthogonal", "pp pp pp\n0 10\n0 10\n0 10\n", [3]float64{6, 9.2, 1}, 0, 5},
+		{"xy", "xy xz yz pp pp pp\n0 15 5\n0 10 0\n0 10 0\n", [3]float64{6, 9.2, 1}, 1, 5 / math.Sqrt(1.25)},
+		{"yz", "xy xz yz pp pp pp\n0 10 0\n0 15 0\n0 10 5\n", [3]float64{1, 6, 9.2}, 1, 5 / math.Sqrt(1.25)},
+		{"negative xy", "xy xz yz pp pp pp\n-5 10 -5\n0 10 0\n0 10 0\n", [3]float64{-4, 9.2, 1}, 1, 5 / math.Sqrt(1.25)},
+	}
+
+	for _, tt := range tests {
+		traj := "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\nITEM: BOX BOUNDS " + tt.bounds +
+			"ITEM: ATOMS id type x y z\n" +
+			fmt.Sprintf("1 1 1 1 1\n2 2 %g %g %g\n", tt.xyz2[0], tt.xyz2[1], tt.xyz2[2])
+
+		g, err := NewWithParams(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"2"}}, RMax: 4, Dr: 0.5, Threads: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		err = g.RunReader(strings.NewReader(traj), &out)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		n := column(t, out.String(), "1-2(0)-N")
+		if got := n[len(n)-1]; math.Abs(got-tt.n) > 1e-9 {
+			t.Errorf("%s: N(RMax) = %g, want %g", tt.name, got, tt.n)
+		}
+		if tt.n > 0 && (n[2] != 0 || math.Abs(n[3]-1) > 1e-9) { // the pair is in the bin [1.5; 2[
+			t.Errorf("%s: N = %v, want the pair between 1.5 and 2", tt.name, n)
+		}
+
+		if math.Abs(g.halfMin-tt.half) > 1e-12 {
+			t.Errorf("%s: half the smallest width is %g, want %g", tt.name, g.halfMin, tt.half)
+		}
+	}
+}
+
+// column returns the values of the column name of the output out written with
+// FormatColumns.
+func column(t *testing.T, out, name string) []float64 {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "dist ") {
+			continue
+		}
+
+		k := -1
+		for j, f := range strings.Fields(line) {
+			if f == name {
+				k = j
+			}
+		}
+		if k < 0 {
+			t.Fatalf("no column %s in %q", name, line)
+		}
+
+		var col []float64
+		for _, l := range lines[i+1:] {
+			fields := strings.Fields(l)
+			if len(fields) == 0 {
+				break
+			}
+			v, err := strconv.ParseFloat(fields[k], 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			col = append(col, v)
+		}
+		return col
+	}
+
+	t.Fatalf("no header in\n%s", out)
+	return nil
+}
+
+func TestCoordinationNumber(t *testing.T) {
+	// The atoms are gathered at the center of a large box: every atom is within
+	// RMax of every other, so N(RMax) is the number of atoms of the second type
+	// (itself included if both types are the same).
+	var cfgs [][]atom
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 4; i++ {
+		var atoms []atom
+		for j := 0; j < 10; j++ {
+			typ := "1"
+			if j%3 == 0 {
+				typ = "2"
+			}
+			atoms = append(atoms, atom{typ, [3]float64{50 + rnd.Float64()*3, 50 + rnd.Float64()*3, 50 + rnd.Float64()*3}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(100, cfgs...)
+
+	tests := []struct {
+		at1, at2 string
+		centers  int
+		want     float64
+	}{
+		{"1", "2", 6, 4},
+		{"2", "1", 4, 6},
+		{"1", "1", 6, 6},
+		{"2", "2", 4, 4},
+	}
+
+	for _, tt := range tests {
+		out, err := run(&GR{CfgEnd: len(cfgs), Atoms: map[string][]string{tt.at1: {tt.at2}},
+			RMax: 8, Dr: 0.1, Threads: 1}, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := tt.at1 + "-" + tt.at2
+		for i := 0; i < tt.centers; i++ {
+			n := column(t, out, fmt.Sprintf("%s(%d)-N", name, i))
+			if got := n[len(n)-1]; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("%s (%d): N(RMax) = %g, want %g", name, i, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestThreads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	var cfgs [][]atom
+	for i := 0; i < 10; i++ {
+		var atoms []atom
+		for j := 0; j < 50; j++ {
+			atoms = append(atoms, atom{[]string{"1", "2"}[j%2], [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	newGR := func(threads int) *GR {
+		return &GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1", "2"}, "2": {"1"}},
+			RMax: 5, Dr: 0.1, Threads: threads}
+	}
+	// results returns the output from the header of the columns: the date and
+	// the parameters (and therefore Threads) are written before.
+	results := func(out string) string {
+		return out[strings.Index(out, "\ndist ")+1:]
+	}
+
+	first, err := run(newGR(1), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		threads int
+		exact   bool // the whole output is compared, apart from the date
+	}{
+		{"one thread", 1, true},
+		{"one thread again", 1, true},
+		{"two threads", 2, false},
+		{"eight threads", 8, false},
+	}
+
+	for _, tt := range tests {
+		out, err := run(newGR(tt.threads), traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, want := results(out), results(first)
+		if tt.exact {
+			got, want = out[strings.Index(out, "\n"):], first[strings.Index(first, "\n"):]
+		}
+		if got != want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+// meanColumns returns, for each bin, the mean of the columns of the output out
+// whose name ends with suffix, e.g. the mean g(r) of every center with -hstg.
+func meanColumns(t *testing.T, out, suffix string) []float64 {
+	header := out[strings.Index(out, "\ndist ")+1:]
+	var mean []float64
+	var nb float64
+	for _, name := range strings.Fields(header[:strings.Index(header, "\n")]) {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		col := column(t, out, name)
+		if mean == nil {
+			mean = make([]float64, len(col))
+		}
+		for i, v := range col {
+			mean[i] += v
+		}
+		nb++
+	}
+
+	for i := range mean {
+		mean[i] /= nb
+	}
+	return mean
+}
+
+func TestSampling(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	var cfgs [][]atom
+	for i := 0; i < 4; i++ {
+		var atoms []atom
+		for j := 0; j < 400; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	newGR := func(stride int, fraction float64) *GR {
+		return &GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.2,
+			AtomStride: stride, AtomFraction: fraction, Seed: 1, Threads: 1}
+	}
+
+	out, err := run(newGR(0, 0), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := meanColumns(t, out, "-hstg")
+
+	// rms returns the root mean square difference between the g(r) of the
+	// sampled atoms and the full one, from 1 (the first bins are empty).
+	rms := func(g *GR) float64 {
+		out, err := run(g, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sum float64
+		sparse := meanColumns(t, out, "-hstg")
+		for i := 5; i < len(full); i++ {
+			sum += (sparse[i] - full[i]) * (sparse[i] - full[i])
+		}
+		return math.Sqrt(sum / float64(len(full)-5))
+	}
+
+	// The sampled g(r) approaches the full one as the fraction increases.
+	prev := math.Inf(1)
+	for _, fraction := range []float64{0.05, 0.3, 0.7, 1} {
+		d := rms(newGR(0, fraction))
+		if d >= prev {
+			t.Errorf("fraction %g: difference %g with the full g(r), not lower than %g", fraction, d, prev)
+		}
+		prev = d
+	}
+	if prev != 0 {
+		t.Errorf("fraction 1: difference %g with the full g(r)", prev)
+	}
+
+	// Every atom is kept with a stride of 1, every other one with 2.
+	if d := rms(newGR(1, 0)); d != 0 {
+		t.Errorf("stride 1: difference %g with the full g(r)", d)
+	}
+	if d := rms(newGR(2, 0)); d == 0 || d > 0.2 {
+		t.Errorf("stride 2: difference %g with the full g(r)", d)
+	}
+}
+
+func TestExclusions(t *testing.T) {
+	// Four atoms on a line: each pair falls into its own bin.
+	atoms := []atom{{"1", [3]float64{1, 1, 1}}, {"1", [3]float64{2, 1, 1}},
+		{"1", [3]float64{3.5, 1, 1}}, {"1", [3]float64{6, 1, 1}}}
+	traj := trajectory(20, atoms, atoms)
+
+	dir, err := ioutil.TempDir("", "gr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "exclusions.dat")
+	err = ioutil.WriteFile(file, []byte("# bonds\n1 2\n\n3 4\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		pairs    [][]int
+		file     string
+		excluded map[[2]int]bool // pairs of identifiers
+	}{
+		{"none", nil, "", nil},
+		{"one pair", [][]int{{1, 2}}, "", map[[2]int]bool{{1, 2}: true}},
+		{"reversed pair", [][]int{{3, 1}}, "", map[[2]int]bool{{1, 3}: true}},
+		{"file", nil, file, map[[2]int]bool{{1, 2}: true, {3, 4}: true}},
+		{"file and pairs", [][]int{{2, 4}}, file, map[[2]int]bool{{1, 2}: true, {3, 4}: true, {2, 4}: true}},
+	}
+
+	for _, tt := range tests {
+		g, err := NewWithParams(&GR{CfgEnd: 2, Atoms: map[string][]string{"1": {"1"}}, RMax: 8, Dr: 0.5,
+			Exclusions: tt.pairs, ExclusionsFile: tt.file, Threads: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.RunReader(strings.NewReader(traj), new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := range atoms {
+			want := make([]uint64, g.bins)
+			for j := range atoms {
+				if tt.excluded[[2]int{i + 1, j + 1}] || tt.excluded[[2]int{j + 1, i + 1}] {
+					continue
+				}
+				want[g.index(math.Abs(atoms[i].xyz[0]-atoms[j].xyz[0]))] += 2 // two configurations
+			}
+
+			got := g.hstg[[2]string{"1", "1"}][i]
+			for bin := range want {
+				if got[bin] != want[bin] {
+					t.Errorf("%s: atom %d: histogram %v, want %v", tt.name, i+1, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestExclusionsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		content string
+		errMsg  string
+	}{
+		{"1 2\n3\n", "line 2: a pair must contain 2 identifiers (got 1)"},
+		{"1 2 3\n", "line 1: a pair must contain 2 identifiers (got 3)"},
+		{"1 a\n", "line 1: strconv.Atoi"},
+	}
+
+	for i, tt := range tests {
+		file := filepath.Join(dir, fmt.Sprint(i))
+		err := ioutil.WriteFile(file, []byte(tt.content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = NewWithParams(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.5,
+			ExclusionsFile: file})
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%q: got error %v, want %q", tt.content, err, tt.errMsg)
+		}
+	}
+
+	_, err = NewWithParams(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.5,
+		Exclusions: [][]int{{1, 2, 3}}})
+	if err == nil {
+		t.Error("no error with a pair of 3 identifiers")
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	var cfgs [][]atom
+	for i := 0; i < 3; i++ {
+		var atoms []atom
+		for j := 0; j < 30; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	newGR := func() *GR {
+		return &GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1"}}, RMax: 5, Dr: 0.25, Threads: 1}
+	}
+
+	lf, err := run(newGR(), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf, err := run(newGR(), strings.ReplaceAll(traj, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last coordinate (z) of each line is parsed as well.
+	if lf[strings.Index(lf, "\n"):] != crlf[strings.Index(crlf, "\n"):] {
+		t.Errorf("CRLF: got\n%s\nwant\n%s", crlf, lf)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	// In the configuration i, the two atoms are at a distance of 1 + i/4: each
+	// configuration fills its own bin.
+	var cfgs [][]atom
+	for i := 0; i < 10; i++ {
+		cfgs = append(cfgs, []atom{{"1", [3]float64{2, 2, 2}}, {"2", [3]float64{3 + 0.25*float64(i) + 0.1, 2, 2}}})
+	}
+	hstg := func(g *GR, traj string) []uint64 {
+		g, err := NewWithParams(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = g.RunReader(strings.NewReader(traj), new(bytes.Buffer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g.hstg[[2]string{"1", "2"}][0]
+	}
+
+	tests := []struct {
+		frames []int
+		want   []int // processed configurations
+	}{
+		{[]int{2, 5, 7}, []int{2, 5, 7}},
+		{[]int{8, 0, 4, 1}, []int{0, 1, 4, 8}},
+		{[]int{9}, []int{9}},
+	}
+
+	for _, tt := range tests {
+		got := hstg(&GR{Frames: tt.frames, Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.25, Threads: 1},
+			trajectory(20, cfgs...))
+
+		// The same configurations, alone in a trajectory.
+		var only [][]atom
+		for _, i := range tt.want {
+			only = append(only, cfgs[i])
+		}
+		want := hstg(&GR{CfgEnd: len(only), Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.25, Threads: 1},
+			trajectory(20, only...))
+
+		var filled int
+		for bin := range want {
+			if got[bin] != want[bin] {
+				t.Errorf("frames %v: histogram %v, want %v", tt.frames, got, want)
+				break
+			}
+			if got[bin] > 0 {
+				filled++
+			}
+		}
+		if filled != len(tt.want) {
+			t.Errorf("frames %v: %d bins filled, want %d", tt.frames, filled, len(tt.want))
+		}
+	}
+}
+
+func TestBulkDensity(t *testing.T) {
+	// A slab of density 1 fills half of the box along z, the other half is
+	// empty: the average density of the box is 0.5. The centers are in the
+	// middle of the slab, so the spheres of radius RMax stay in it.
+	rnd := rand.New(rand.NewSource(6))
+	var cfgs [][]atom
+	for i := 0; i < 2; i++ {
+		var atoms []atom
+		for j := 0; j < 20; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 20, rnd.Float64() * 20, 4 + 2*rnd.Float64()}})
+		}
+		for j := 0; j < 4000; j++ {
+			atoms = append(atoms, atom{"2", [3]float64{rnd.Float64() * 20, rnd.Float64() * 20, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(20, cfgs...)
+
+	tests := []struct {
+		name string
+		bulk map[string]float64
+		want float64 // plateau of g(r)
+	}{
+		{"box density", nil, 2},
+		{"bulk density", map[string]float64{"2": 1}, 1},
+		{"other type", map[string]float64{"1": 1}, 2},
+	}
+
+	for _, tt := range tests {
+		out, err := run(&GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"2"}}, RMax: 3, Dr: 0.5,
+			BulkDensity: tt.bulk, Threads: 1}, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var plateau float64
+		g := meanColumns(t, out, "-hstg")
+		for _, v := range g[2:] {
+			plateau += v
+		}
+		plateau /= float64(len(g) - 2)
+
+		if math.Abs(plateau-tt.want) > 0.05*tt.want {
+			t.Errorf("%s: g(r) plateaus at %g, want %g", tt.name, plateau, tt.want)
+		}
+	}
+}
+
+func TestFileOutFrames(t *testing.T) {
+	var cfgs [][]atom
+	for i := 0; i < 10; i++ {
+		cfgs = append(cfgs, []atom{{"1", [3]float64{1, 1, 1}}, {"1", [3]float64{2, 2, 2}}})
+	}
+	// The timestep of the configuration i is 1000 + 50·i.
+	var lines []string
+	for _, l := range strings.Split(trajectory(10, cfgs...), "\n") {
+		if len(lines) > 0 && lines[len(lines)-1] == "ITEM: TIMESTEP" {
+			n, _ := strconv.Atoi(l)
+			l = fmt.Sprint(1000 + 50*n)
+		}
+		lines = append(lines, l)
+	}
+	traj := strings.Join(lines, "\n")
+
+	dir, err := ioutil.TempDir("", "gr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		g    *GR
+		want string
+	}{
+		{"range", &GR{CfgStart: 2, CfgEnd: 5}, "cfg timestep\n2 1100\n3 1150\n4 1200\n"},
+		{"frames", &GR{Frames: []int{8, 0, 5}}, "cfg timestep\n0 1000\n5 1250\n8 1400\n"},
+	}
+
+	for i, tt := range tests {
+		g := tt.g
+		g.Atoms = map[string][]string{"1": {"1"}}
+		g.RMax, g.Dr, g.Threads = 4, 0.5, 1
+		g.FileOutFrames = filepath.Join(dir, fmt.Sprint(i))
+		if _, err := run(g, traj); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(g.FileOutFrames)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatGnuplot(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	var cfgs [][]atom
+	for i := 0; i < 2; i++ {
+		var atoms []atom
+		for j := 0; j < 12; j++ {
+			atoms = append(atoms, atom{[]string{"1", "2", "2"}[j%3], [3]float64{rnd.Float64() * 8, rnd.Float64() * 8, rnd.Float64() * 8}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(8, cfgs...)
+	newGR := func(format string, bootstrap int) *GR {
+		return &GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1", "2"}, "2": {"1"}}, RMax: 4, Dr: 0.5,
+			Format: format, Bootstrap: bootstrap, Seed: 1, Threads: 1}
+	}
+
+	for _, bootstrap := range []int{0, 20} {
+		columns, err := run(newGR(FormatColumns, bootstrap), traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gnuplot, err := run(newGR(FormatGnuplot, bootstrap), traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The date and the parameters are commented so that gnuplot skips
+		// them.
+		start := strings.Index(gnuplot, "# pair ")
+		for _, line := range strings.Split(strings.TrimSpace(gnuplot[:start]), "\n") {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				t.Fatalf("bootstrap %d: line %q before the blocks isn't commented", bootstrap, line)
+			}
+		}
+
+		// One block per pair and per center (4 atoms of type 1 with 2 pairs
+		// and 8 atoms of type 2 with 1), separated by two blank lines (index
+		// of gnuplot), in the order of the columns.
+		header := columns[strings.Index(columns, "\ndist ")+1:]
+		var pairs []string
+		for _, name := range strings.Fields(header[:strings.Index(header, "\n")]) {
+			if strings.HasSuffix(name, "-hstg") {
+				pairs = append(pairs, strings.TrimSuffix(name, "-hstg"))
+			}
+		}
+
+		fields := []string{"r", "g", "N"}
+		if bootstrap > 0 {
+			fields = append(fields, "g_lo", "g_hi")
+		}
+
+		blocks := strings.Split(strings.TrimSuffix(gnuplot[start:], "\n"), "\n\n\n")
+		if len(blocks) != len(pairs) || len(pairs) != 16 {
+			t.Fatalf("bootstrap %d: %d blocks, want %d (one per pair and center)", bootstrap, len(blocks), len(pairs))
+		}
+
+		for i, block := range blocks {
+			lines := strings.Split(block, "\n")
+			if lines[0] != "# pair "+pairs[i] || lines[1] != "# "+strings.Join(fields, " ") {
+				t.Errorf("bootstrap %d: block %d starts with %q, want the pair %s and the columns %v",
+					bootstrap, i, lines[:2], pairs[i], fields)
+				continue
+			}
+
+			g, n := column(t, columns, pairs[i]+"-hstg"), column(t, columns, pairs[i]+"-N")
+			if len(lines)-2 != len(g) {
+				t.Errorf("bootstrap %d: block %d has %d rows, want %d", bootstrap, i, len(lines)-2, len(g))
+				continue
+			}
+			for j, line := range lines[2:] {
+				row := strings.Fields(line)
+				if len(row) != len(fields) || row[1] != strconv.FormatFloat(g[j], 'g', -1, 64) ||
+					row[2] != strconv.FormatFloat(n[j], 'g', -1, 64) {
+					t.Errorf("bootstrap %d: block %d: row %q, want g %g and N %g", bootstrap, i, line, g[j], n[j])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestMissingValue(t *testing.T) {
+	// A pair at a distance of 1.2: the bins below 1 are sampled without pair
+	// and stay 0, the bins beyond half the largest box are never sampled.
+	at := []atom{{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{2.2, 1, 1}}}
+	tests := []struct {
+		name    string
+		boxes   []float64
+		missing string
+		first   int // first bin written with the missing value (10 if none)
+	}{
+		{"small box", []float64{6}, "NaN", 6},
+		{"boxes", []float64{6, 8, 7}, "NaN", 8},
+		{"sentinel", []float64{6}, "-1", 6},
+		{"large box", []float64{12}, "NaN", 10},
+		{"no missing value", []float64{6}, "", 10},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		for i, box := range tt.boxes {
+			cfg := trajectory(box, at)
+			b.WriteString(strings.Replace(cfg, "TIMESTEP\n0", "TIMESTEP\n"+fmt.Sprint(i), 1))
+		}
+
+		out, err := run(&GR{CfgEnd: len(tt.boxes), Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.5,
+			MissingValue: tt.missing, Threads: 1}, b.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows := strings.Split(out[strings.Index(out, "\ndist ")+1:], "\n")[1:11]
+		for i, row := range rows {
+			fields := strings.Fields(row)
+			switch {
+			case i >= tt.first:
+				if fields[1] != tt.missing || fields[2] != tt.missing || fields[3] != tt.missing {
+					t.Errorf("%s: bin %d: got %q, want %s", tt.name, i, row, tt.missing)
+				}
+			case i == 2: // the pair
+				if fields[2] == "0" {
+					t.Errorf("%s: bin %d: got %q, want the pair", tt.name, i, row)
+				}
+			case i < 2:
+				if fields[1] != "0" || fields[2] != "0" || fields[3] != "0" {
+					t.Errorf("%s: bin %d: got %q, want 0", tt.name, i, row)
+				}
+			default: // after the pair
+				n, _ := strconv.ParseFloat(fields[3], 64)
+				if fields[2] != "0" || fields[1] != "1" || math.Abs(n-1) > 1e-9 {
+					t.Errorf("%s: bin %d: got %q, want g = 0 and N = 1", tt.name, i, row)
+				}
+			}
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	// A pair at a distance of 1 at the bottom of the box and a pair at a
+	// distance of 2 at the top.
+	at := []atom{
+		{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{2, 1, 1}},
+		{"1", [3]float64{1, 1, 11}}, {"2", [3]float64{3, 1, 11}},
+	}
+	tests := []struct {
+		sel  string
+		want []int // bins with a pair
+	}{
+		{"", []int{2, 4}},
+		{"z < 5", []int{2}},
+		{"z > 5", []int{4}},
+		{"z > 5 || x < 2.5", []int{2, 4}},
+		{"type == 1 || z < 5", []int{2}},
+		{"id >= 2 && id <= 3", nil},
+	}
+
+	for _, tt := range tests {
+		out, err := run(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.5,
+			Select: tt.sel, Threads: 1}, trajectory(20, at))
+		if err != nil {
+			t.Fatalf("%q: %v", tt.sel, err)
+		}
+
+		var got []int
+		for i, v := range meanColumns(t, out, "-hstg") {
+			if v != 0 {
+				got = append(got, i)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: pairs in the bins %v, want %v", tt.sel, got, tt.want)
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	var cfgs [][]atom
+	for i := 0; i < 3; i++ {
+		var atoms []atom
+		for j := 0; j < 60; j++ {
+			typ := "1"
+			if j%3 == 0 {
+				typ = "2"
+			}
+			atoms = append(atoms, atom{typ, [3]float64{10 * rnd.Float64(), 10 * rnd.Float64(), 10 * rnd.Float64()}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+
+	params := func(cfgEnd, threads int) *GR {
+		return &GR{CfgEnd: cfgEnd, Atoms: map[string][]string{"1": {"1", "2"}, "2": {"2"}}, RMax: 5, Dr: 0.1,
+			Threads: threads}
+	}
+
+	want, err := run(params(3, 1), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = want[strings.Index(want, "\ndist "):]
+
+	tests := []struct {
+		cfgEnd, threads int
+		warning         string
+	}{
+		{3, 1, ""},
+		{3, 2, ""},
+		{4, 1, "gr: the trajectory ends before the configuration 3 (requested up to 3), 3 configurations used\n"},
+		{10, 1, "gr: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+		{10, 2, "gr: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+	}
+
+	for _, tt := range tests {
+		var warnings bytes.Buffer
+		g := params(tt.cfgEnd, tt.threads)
+		g.SetLog(log.New(&warnings, "", 0))
+
+		out, err := run(g, traj)
+		if err != nil {
+			t.Errorf("cfg_end %d, %d threads: %v", tt.cfgEnd, tt.threads, err)
+			continue
+		}
+
+		// The configurations read are normalized as if cfg_end were 3.
+		if got := out[strings.Index(out, "\ndist "):]; got != want {
+			t.Errorf("cfg_end %d, %d threads: the results differ from the ones with cfg_end = 3", tt.cfgEnd, tt.threads)
+		}
+		var warning string
+		for _, line := range strings.SplitAfter(warnings.String(), "\n") {
+			if strings.Contains(line, "the trajectory ends") {
+				warning += line
+			}
+		}
+		if warning != tt.warning {
+			t.Errorf("cfg_end %d, %d threads: warning %q, want %q", tt.cfgEnd, tt.threads, warning, tt.warning)
+		}
+	}
+}
+
+func TestReference(t *testing.T) {
+	// The center atom 1 is at the bottom of the box in the first configuration
+	// and at the top in the second one, the center atom 2 the opposite. Their
+	// neighbors are at 1 and 1.5 for the atom 1, 2 and 2.5 for the atom 2.
+	traj := trajectory(20, []atom{
+		{"1", [3]float64{1, 1, 1}}, {"1", [3]float64{1, 1, 11}},
+		{"2", [3]float64{2, 1, 1}}, {"2", [3]float64{3, 1, 11}},
+	}, []atom{
+		{"1", [3]float64{1, 1, 11}}, {"1", [3]float64{1, 1, 1}},
+		{"2", [3]float64{2.5, 1, 11}}, {"2", [3]float64{3.5, 1, 1}},
+	})
+	params := func(ref string) *GR {
+		return &GR{CfgEnd: 2, Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.5, Reference: ref, Threads: 1}
+	}
+
+	all, err := run(params(""), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref    string
+		center int   // center atom (position among the atoms of type 1) kept
+		want   []int // bins with a pair
+	}{
+		{"z < 5", 0, []int{2, 3}},
+		{"id == 1", 0, []int{2, 3}},
+		{"z > 5", 1, []int{4, 5}},
+		{"id == 2 && type == 1", 1, []int{4, 5}},
+	}
+
+	for _, tt := range tests {
+		out, err := run(params(tt.ref), traj)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.ref, err)
+		}
+
+		header := out[strings.Index(out, "\ndist ")+1:]
+		if n := strings.Count(header[:strings.Index(header, "\n")], "-hstg"); n != 1 {
+			t.Fatalf("%q: %d center atoms, want 1", tt.ref, n)
+		}
+
+		var got []int
+		hstg := column(t, out, "1-2(0)-hstg")
+		for i, v := range hstg {
+			if v != 0 {
+				got = append(got, i)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%q: pairs in the bins %v, want %v", tt.ref, got, tt.want)
+		}
+
+		// The tagged center atom is normalized as without Reference.
+		want := column(t, all, fmt.Sprintf("1-2(%d)-hstg", tt.center))
+		for i := range want {
+			if math.Abs(hstg[i]-want[i]) > 1e-9*want[i] {
+				t.Errorf("%q: bin %d: g = %g, want %g", tt.ref, i, hstg[i], want[i])
+			}
+		}
+	}
+}
+
+func TestKirkwoodBuff(t *testing.T) {
+	// An ideal gas of n atoms in a box of volume volBox: g(r) = 1 - 1/n for
+	// atoms of the same type because an atom isn't its own neighbor, and 1
+	// otherwise. The correction cancels the finite size artifact
+	// G(R) = -V(R)/n of the former.
+	const n, volBox, rMax = 200., 1000., 5.
+	var e []float64
+	for i := 0; i <= 500; i++ {
+		e = append(e, rMax*float64(i)/500)
+	}
+	vol := make([]float64, len(e)-1)
+	for i := range vol {
+		vol[i] = 4. / 3. * math.Pi * (util.Pow(e[i+1], 3) - util.Pow(e[i], 3))
+	}
+
+	tests := []struct {
+		name       string
+		g          float64
+		same       bool
+		kb, kbCorr func(r float64) float64
+	}{
+		{"different types", 1, false, func(float64) float64 { return 0 }, func(float64) float64 { return 0 }},
+		{"same type", 1 - 1/n, true, func(r float64) float64 { return -4. / 3. * math.Pi * util.Pow(r, 3) / n },
+			func(float64) float64 { return 0 }},
+	}
+
+	for _, tt := range tests {
+		hstg := make([]float64, len(vol))
+		for i := range hstg {
+			hstg[i] = tt.g
+		}
+
+		kb, kbCorr := kirkwoodBuff(hstg, vol, e, n/volBox, volBox, tt.same)
+		for i := range kb {
+			if want := tt.kb(e[i+1]); math.Abs(kb[i]-want) > 1e-9 {
+				t.Fatalf("%s: G(%g) = %g, want %g", tt.name, e[i+1], kb[i], want)
+			}
+			if want := tt.kbCorr(e[i+1]); math.Abs(kbCorr[i]-want) > 1e-9 {
+				t.Fatalf("%s: corrected G(%g) = %g, want %g", tt.name, e[i+1], kbCorr[i], want)
+			}
+		}
+	}
+
+	// Two bins of width 1, g = 0 then 1, and 10 atoms in a box of 1000. The
+	// first bin isn't corrected (g = 0), the second one is corrected with the
+	// excess -4π/3 of the first one, at r = 1.5.
+	kb, kbCorr := kirkwoodBuff([]float64{0, 1}, []float64{4. / 3. * math.Pi, 28. / 3. * math.Pi},
+		[]float64{0, 1, 2}, 0.01, 1000, false)
+	nOut := 10 * (1 - 4.5*math.Pi/1000)
+	corr := nOut / (nOut + 0.01*4./3.*math.Pi)
+	want := [][2]float64{
+		{-4. / 3. * math.Pi, -4. / 3. * math.Pi},
+		{-4. / 3. * math.Pi, -4./3.*math.Pi + (corr-1)*28./3.*math.Pi},
+	}
+	for i, w := range want {
+		if math.Abs(kb[i]-w[0]) > 1e-12 || math.Abs(kbCorr[i]-w[1]) > 1e-12 {
+			t.Errorf("bin %d: G = %g and %g corrected, want %g and %g", i, kb[i], kbCorr[i], w[0], w[1])
+		}
+	}
+}
+
+func TestLogBins(t *testing.T) {
+	tests := []struct {
+		rMin, rMax float64
+		perDecade  int
+		bins       int
+	}{
+		{1, 10, 5, 6},
+		{0.1, 10, 4, 9},
+		{0.5, 6, 10, 12}, // the last bin is shorter
+		{1, 5, 10, 8},
+	}
+
+	for _, tt := range tests {
+		g, err := NewWithParams(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"1"}}, RMax: tt.rMax,
+			LogBins: true, RMin: tt.rMin, BinsPerDecade: tt.perDecade})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.bins != tt.bins {
+			t.Errorf("RMin %g, RMax %g, %d bins per decade: %d bins, want %d", tt.rMin, tt.rMax, tt.perDecade, g.bins, tt.bins)
+			continue
+		}
+
+		if g.edges[0] != 0 || g.edges[1] != tt.rMin || g.edges[g.bins] != tt.rMax {
+			t.Errorf("RMin %g, RMax %g: edges %v", tt.rMin, tt.rMax, g.edges)
+		}
+		for i := 0; i < g.bins; i++ {
+			if i > 1 && math.Abs(g.edges[i]/g.edges[i-1]-math.Pow(10, 1/float64(tt.perDecade))) > 1e-12 {
+				t.Errorf("RMin %g, RMax %g: edges %g and %g not logarithmically spaced", tt.rMin, tt.rMax, g.edges[i-1], g.edges[i])
+			}
+			for _, r := range []float64{g.edges[i] * (1 + 1e-9), g.mid(i), g.edges[i+1] * (1 - 1e-9)} {
+				if g.index(r) != i {
+					t.Errorf("RMin %g, RMax %g: distance %g in the bin %d, want %d (from %g to %g)",
+						tt.rMin, tt.rMax, r, g.index(r), i, g.edges[i], g.edges[i+1])
+				}
+			}
+		}
+	}
+}
+
+func TestLogBinsIdealGas(t *testing.T) {
+	// Uncorrelated atoms: g(r) = 1 in every bin, however wide, if each one
+	// is normalized by the volume of its shell.
+	rnd := rand.New(rand.NewSource(6))
+	var cfgs [][]atom
+	for i := 0; i < 4; i++ {
+		var atoms []atom
+		for j := 0; j < 2000; j++ {
+			typ := "1"
+			if j%2 == 0 {
+				typ = "2"
+			}
+			atoms = append(atoms, atom{typ, [3]float64{rnd.Float64() * 13, rnd.Float64() * 13, rnd.Float64() * 13}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+
+	out, err := run(&GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"2"}}, RMax: 6.4,
+		LogBins: true, RMin: 0.8, BinsPerDecade: 8, Threads: 1}, trajectory(13, cfgs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dist := column(t, out, "dist")
+	hstg := meanColumns(t, out, "-hstg")
+	coord := meanColumns(t, out, "-N")
+	if len(hstg) != 9 {
+		t.Fatalf("%d bins, want 9", len(hstg))
+	}
+	for i, v := range hstg {
+		if math.Abs(v-1) > 0.05 {
+			t.Errorf("bin %d (%g): g = %g, want 1", i, dist[i], v)
+		}
+	}
+
+	// The coordination number up to RMax is the number of atoms of the
+	// sphere.
+	want := 1000 / util.Pow(13, 3) * 4. / 3. * math.Pi * util.Pow(6.4, 3)
+	if got := coord[len(coord)-1]; math.Abs(got-want) > 0.02*want {
+		t.Errorf("coordination number %g up to 6.4, want %g", got, want)
+	}
+}
+
+func TestSampleReferences(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	var cfgs [][]atom
+	for i := 0; i < 4; i++ {
+		var atoms []atom
+		for j := 0; j < 400; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	newGR := func(fraction float64, max int) *GR {
+		return &GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.2,
+			ReferenceFraction: fraction, MaxReferences: max, Seed: 3, Threads: 1}
+	}
+
+	out, err := run(newGR(0, 0), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := meanColumns(t, out, "-hstg")
+
+	// sampled returns the number of center atoms kept and the root mean
+	// square difference between their g(r) and the full one, from 1 (the
+	// first bins are empty).
+	sampled := func(g *GR) (int, float64) {
+		out, err := run(g, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, "seed = 3\n") {
+			t.Error("the seed isn't written in the parameters")
+		}
+
+		header := out[strings.Index(out, "\ndist ")+1:]
+		n := strings.Count(header[:strings.Index(header, "\n")], "-hstg")
+
+		var sum float64
+		sparse := meanColumns(t, out, "-hstg")
+		for i := 5; i < len(full); i++ {
+			sum += (sparse[i] - full[i]) * (sparse[i] - full[i])
+		}
+		return n, math.Sqrt(sum / float64(len(full)-5))
+	}
+
+	// The sampled g(r) approaches the full one as the fraction increases.
+	prev := math.Inf(1)
+	for _, fraction := range []float64{0.02, 0.1, 0.4, 0.8, 1} {
+		n, d := sampled(newGR(fraction, 0))
+		if math.Abs(float64(n)-400*fraction) > 4*math.Sqrt(400*fraction) {
+			t.Errorf("fraction %g: %d center atoms kept", fraction, n)
+		}
+		if d >= prev {
+			t.Errorf("fraction %g: difference %g with the full g(r), not lower than %g", fraction, d, prev)
+		}
+		prev = d
+	}
+	if prev != 0 {
+		t.Errorf("fraction 1: difference %g with the full g(r)", prev)
+	}
+
+	tests := []struct {
+		fraction float64
+		max      int
+		n        int // center atoms kept
+	}{
+		{0, 10, 10},
+		{0, 100, 100},
+		{0, 1000, 400},
+		{0.5, 20, 20},
+	}
+	for _, tt := range tests {
+		if n, _ := sampled(newGR(tt.fraction, tt.max)); n != tt.n {
+			t.Errorf("fraction %g, at most %d: %d center atoms kept, want %d", tt.fraction, tt.max, n, tt.n)
+		}
+	}
+}
+
+func TestCoordinateColumns(t *testing.T) {
+	// The trajectory contains both sets: the pair is at 1 with the wrapped
+	// coordinates and at 2 with the unwrapped ones.
+	const traj = "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\nITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\n" +
+		"ITEM: ATOMS id type x y z xu yu zu\n1 1 1 1 1 1 1 1\n2 2 2 1 1 23 1 1\n"
+	tests := []struct {
+		set string
+		bin int
+	}{
+		{"", 2},
+		{"wrapped", 2},
+		{"unwrapped", 4},
+	}
+
+	for _, tt := range tests {
+		out, err := run(&GR{CfgEnd: 1, Atoms: map[string][]string{"1": {"2"}}, RMax: 5, Dr: 0.5,
+			CoordinateColumns: tt.set, Threads: 1}, traj)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.set, err)
+		}
+
+		for i, v := range column(t, out, "1-2(0)-hstg") {
+			if (v != 0) != (i == tt.bin) {
+				t.Errorf("%q: bin %d: g = %g, want the pair in the bin %d only", tt.set, i, v, tt.bin)
+			}
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	v := []float64{1, 2, 4, 8, 16}
+	tests := []struct {
+		q, want float64
+	}{
+		{0, 1},
+		{0.25, 2},
+		{0.375, 3},
+		{0.5, 4},
+		{0.9, 12.8},
+		{1, 16},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(v, tt.q); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("percentile %g: got %g, want %g", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(8))
+	var random, same [][]atom
+	for i := 0; i < 20; i++ {
+		var atoms []atom
+		for j := 0; j < 100; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		random = append(random, atoms)
+		same = append(same, random[0])
+	}
+
+	// bootstrap returns, for each center atom, g(r) and its confidence
+	// interval.
+	bootstrap := func(cfgs [][]atom, confidence float64, block int) (g, lo, hi [][]float64) {
+		out, err := run(&GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.4,
+			Bootstrap: 200, BootstrapBlock: block, Confidence: confidence, Seed: 2, Threads: 1}, trajectory(10, cfgs...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header := out[strings.Index(out, "\ndist ")+1:]
+		for _, name := range strings.Fields(header[:strings.Index(header, "\n")]) {
+			if strings.HasSuffix(name, "-hstg") {
+				name = strings.TrimSuffix(name, "-hstg")
+				g = append(g, column(t, out, name+"-hstg"))
+				lo = append(lo, column(t, out, name+"-g_lo"))
+				hi = append(hi, column(t, out, name+"-g_hi"))
+			}
+		}
+		return
+	}
+
+	// Without fluctuation, every sample is the full g(r).
+	g, lo, hi := bootstrap(same, 0.95, 1)
+	for i := range g {
+		for bin := range g[i] {
+			if math.Abs(lo[i][bin]-g[i][bin]) > 1e-9 || math.Abs(hi[i][bin]-g[i][bin]) > 1e-9 {
+				t.Fatalf("same configurations: center %d, bin %d: interval [%g, %g], want g = %g",
+					i, bin, lo[i][bin], hi[i][bin], g[i][bin])
+			}
+		}
+	}
+
+	tests := []struct {
+		confidence float64
+		block      int
+	}{
+		{0.95, 1},
+		{0.5, 1},
+		{0.99, 1},
+		{0.95, 3},
+	}
+
+	var width []float64 // mean width of the interval for each test
+	for _, tt := range tests {
+		g, lo, hi := bootstrap(random, tt.confidence, tt.block)
+		var in, n int
+		var w float64
+		for i := range g {
+			for bin := range g[i] {
+				if lo[i][bin] > hi[i][bin] {
+					t.Fatalf("confidence %g, block %d: center %d, bin %d: lower bound %g greater than %g",
+						tt.confidence, tt.block, i, bin, lo[i][bin], hi[i][bin])
+				}
+				if g[i][bin] >= lo[i][bin] && g[i][bin] <= hi[i][bin] {
+					in++
+				}
+				n++
+				w += hi[i][bin] - lo[i][bin]
+			}
+		}
+		width = append(width, w/float64(n))
+
+		// The bootstrap distribution is centered on the full g(r): it is
+		// within the interval except for a few bins.
+		if frac := float64(in) / float64(n); frac < 0.9 {
+			t.Errorf("confidence %g, block %d: g(r) within the interval in %.0f%% of the bins", tt.confidence, tt.block, 100*frac)
+		}
+	}
+
+	if !(width[1] < width[0] && width[0] < width[2]) {
+		t.Errorf("mean widths %g, %g, and %g at 50%%, 95%%, and 99%%, not increasing", width[1], width[0], width[2])
+	}
+}
+
+func TestBootstrapThreads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(10))
+	var cfgs [][]atom
+	for i := 0; i < 20; i++ {
+		var atoms []atom
+		for j := 0; j < 50; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+
+	// The blocks of the workers are merged: the samples, and therefore the
+	// bounds, don't depend on the threads.
+	var want string
+	for _, threads := range []int{1, 4} {
+		out, err := run(&GR{CfgEnd: len(cfgs), Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.4,
+			Bootstrap: 50, BootstrapBlock: 3, Seed: 2, Threads: threads}, trajectory(10, cfgs...))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := out[strings.Index(out, "\ndist "):]
+		if want == "" {
+			want = got
+		} else if got != want {
+			t.Errorf("%d threads: got\n%s\nwant\n%s", threads, got, want)
+		}
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	rnd := rand.New(rand.NewSource(9))
+	var random, same [][]atom
+	for i := 0; i < 60; i++ {
+		var atoms []atom
+		for j := 0; j < 50; j++ {
+			atoms = append(atoms, atom{"1", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		random = append(random, atoms)
+		same = append(same, random[0])
+	}
+	newGR := func(tol float64, every, checks int) *GR {
+		return &GR{CfgEnd: 60, Atoms: map[string][]string{"1": {"1"}}, RMax: 4, Dr: 0.2,
+			ConvergenceTol: tol, ConvergenceEvery: every, ConvergenceChecks: checks, Threads: 1}
+	}
+
+	full, err := run(newGR(0, 0, 0), trajectory(10, same...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := full[strings.Index(full, "\ndist "):]
+
+	// A stationary trajectory converges at the second check and the next
+	// ones: after every·(checks+1) configurations.
+	tests := []struct {
+		every, checks int
+		cfgs          int
+	}{
+		{0, 0, 40}, // 10 and 3 by default
+		{1, 1, 2},
+		{5, 1, 10},
+		{5, 3, 20},
+		{7, 2, 21},
+		{20, 3, 0}, // more configurations than the trajectory
+	}
+
+	for _, tt := range tests {
+		out, err := run(newGR(1e-9, tt.every, tt.checks), trajectory(10, same...))
+		if err != nil {
+			t.Fatalf("every %d, %d checks: %v", tt.every, tt.checks, err)
+		}
+
+		converged := fmt.Sprintf("\nConverged: configuration %d, %d configurations of 60\n", tt.cfgs-1, tt.cfgs)
+		if got := strings.Contains(out, converged); got != (tt.cfgs > 0) {
+			t.Errorf("every %d, %d checks: converged %v, want after %d configurations:\n%s",
+				tt.every, tt.checks, got, tt.cfgs, out[:strings.Index(out, "\ndist ")])
+		}
+
+		// g(r) is the one of the whole trajectory.
+		if got := out[strings.Index(out, "\ndist "):]; got != want {
+			t.Errorf("every %d, %d checks: g(r) differs from the one of the whole trajectory", tt.every, tt.checks)
+		}
+	}
+
+	// With several threads, the histograms of the workers are merged at each
+	// check: the trajectory converges, after a number of configurations that
+	// depends on the order in which the threads add them.
+	g := newGR(1e-9, 5, 1)
+	g.Threads = 4
+	out, err := run(g, trajectory(10, same...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "\nConverged: ") {
+		t.Errorf("4 threads: not converged:\n%s", out[:strings.Index(out, "\ndist ")])
+	}
+	if got := out[strings.Index(out, "\ndist "):]; got != want {
+		t.Errorf("4 threads: g(r) differs from the one of the whole trajectory")
+	}
+
+	// Uncorrelated configurations don't converge with a low tolerance.
+	out, err = run(newGR(1e-6, 5, 2), trajectory(10, random...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "Converged") {
+		t.Errorf("random configurations converged:\n%s", out[:strings.Index(out, "\ndist ")])
+	}
+}
@@ -2,6 +2,7 @@ package gr
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"strconv"
@@ -12,12 +13,14 @@ import (
 
 // readCfgFirst reads the first configuration. It reads the number of atoms, the
 // columns and performs the usual calculations like in readCfg.
-func (g *GR) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
-	g.atoms, box, err = util.Header(r, nil, readSlice)
+func (g *GR) readCfgFirst(r *bufio.Reader) (box, tilt [3]float64, xyz XYZ, ids, slots IDs, err error) {
+	var header bytes.Buffer
+	g.atoms, box, tilt, err = util.HeaderTilt(r, &header, readSlice)
 	if err != nil {
 		err = fmt.Errorf("Header: %w", err)
 		return
 	}
+	g.timestep = util.Timestep(header.Bytes())
 
 	b, _ := r.ReadSlice('\n')
 	fields := strings.Fields(string(b))
@@ -28,15 +31,21 @@ func (g *GR) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error)
 	}
 	fields = fields[2:]
 
+	g.coords, g.scaled = util.DetectScaled(g.CoordinateColumns, g.coords, fields)
+
 	var found int
 	g.colsLen = len(fields)
+	g.colID = -1
 	for k, v := range fields {
 		switch v {
-		case "x":
+		case "id":
+			g.colID = k
+			continue
+		case g.coords[0]:
 			g.cols[0] = k
-		case "y":
+		case g.coords[1]:
 			g.cols[1] = k
-		case "z":
+		case g.coords[2]:
 			g.cols[2] = k
 		case "type":
 			g.cols[3] = k
@@ -47,84 +56,225 @@ func (g *GR) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error)
 	}
 
 	if found < len(g.cols) {
-		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+		return box, tilt, nil, nil, nil, fmt.Errorf("cannot find the columns %s, %s, %s, and type", g.coords[0], g.coords[1], g.coords[2])
+	}
+
+	if g.excl != nil && g.colID < 0 {
+		return box, tilt, nil, nil, nil, fmt.Errorf("cannot find the column id (required by the exclusions)")
+	}
+
+	g.summary = util.NewSummary(g.atoms, fields, box)
+
+	err = g.sel.Columns(fields)
+	if err != nil {
+		return box, tilt, nil, nil, nil, err
+	}
+
+	err = g.ref.Columns(fields)
+	if err != nil {
+		return box, tilt, nil, nil, nil, err
 	}
 
-	g.order, xyz, err = g.fetchXYZFirst(r)
+	g.order, xyz, ids, slots, err = g.fetchXYZFirst(r)
 	if err != nil {
-		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+		return box, tilt, nil, nil, nil, fmt.Errorf("fetchXYZ: %w", err)
 	}
+	g.scale(box, tilt, xyz)
 
 	return
 }
 
 // readCfg reads a configuration of the LAMMPS trajectory. This method will call
-// fetchXYZ to fetch the coordinates of the two atoms.
-func (g *GR) readCfg(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
-	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+// fetchXYZ to fetch the coordinates of the two atoms. The number of atoms must
+// be the one of the first configuration.
+func (g *GR) readCfg(r *bufio.Reader) (box, tilt [3]float64, xyz XYZ, ids, slots IDs, err error) {
+	var (
+		header bytes.Buffer
+		atoms  int
+	)
+	atoms, box, tilt, err = util.HeaderTilt(r, &header, readSlice)
 	if err != nil {
-		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		err = fmt.Errorf("Header: %w", err)
 		return
 	}
+	if atoms != g.atoms {
+		err = fmt.Errorf("number of atoms changed: %d (%d in the first configuration)", atoms, g.atoms)
+		return
+	}
+	g.timestep = util.Timestep(header.Bytes())
 
 	r.ReadSlice('\n')
 
-	xyz, err = g.fetchXYZ(r)
+	xyz, ids, slots, err = g.fetchXYZ(r)
 	if err != nil {
 		err = fmt.Errorf("fetchXYZ: %w", err)
 		return
 	}
+	g.scale(box, tilt, xyz)
 
 	return
 }
 
+// scale converts the scaled coordinates into coordinates in the box if they
+// are read (see util.ScaleTilt).
+func (g *GR) scale(box, tilt [3]float64, xyz XYZ) {
+	if !g.scaled {
+		return
+	}
+
+	for _, atoms := range xyz {
+		util.ScaleTilt(atoms, box, tilt)
+	}
+}
+
 // fetchXYZ fetches the coordinates of the two atoms by calling readXYZ two
 // times (one for the first atom, and the other for the second atom). This
 // method is like fetchXYZ but it returns the order of the atoms.
-func (g *GR) fetchXYZFirst(r *bufio.Reader) (order []string, xyz XYZ, err error) {
-	xyz = make(XYZ, len(g.atomsTyp))
-	nbat := g.atoms / len(g.atomsTyp)
-	for _, v := range g.atomsTyp {
-		xyz[v] = make([][3]float64, 0, nbat)
+func (g *GR) fetchXYZFirst(r *bufio.Reader) (order []string, xyz XYZ, ids, slots IDs, err error) {
+	xyz, ids, slots = g.alloc()
+
+	c := newCounter(len(g.atomsTyp))
+	if g.references() {
+		g.refIdx = make(map[string][]int, len(g.Atoms))
+		g.refLen = make(map[string]int, len(g.Atoms))
+		c.ref = true
 	}
 
 	for i := 0; i < g.atoms; i++ {
-		var typ string
-		typ, err = g.readXYZ(r, xyz)
+		var (
+			typ  string
+			kept bool
+		)
+		typ, kept, err = g.readXYZ(r, xyz, ids, slots, c)
 		if err != nil {
+			err = fmt.Errorf("atom %d (line %d): %w", i, util.AtomLine(i), err)
 			return
 		}
 
-		if _, ok := g.Atoms[typ]; ok {
+		if _, ok := g.Atoms[typ]; ok && kept {
+			if g.references() && g.refIdx[typ][len(g.refIdx[typ])-1] < 0 {
+				continue
+			}
 			order = append(order, typ)
 		}
 	}
 
+	if g.sampleReferences() {
+		order = g.sample(order)
+	}
+
+	for k, v := range c.all {
+		g.xyzLenAll[k] = float64(v)
+	}
+
+	if g.sel != nil {
+		for k, v := range c.kept {
+			g.slotsLen[k] = v
+			if g.references() {
+				v = g.refLen[k]
+			}
+			g.present[k] = make([]float64, v)
+		}
+		g.count(xyz, slots, c)
+	}
+
 	return
 }
 
 // fetchXYZ fetches the coordinates of the two atoms by calling readXYZ two
 // times (one for the first atom, and the other for the second atom).
-func (g *GR) fetchXYZ(r *bufio.Reader) (xyz XYZ, err error) {
-	xyz = make(map[string][][3]float64, len(g.atomsTyp))
-	nbat := g.atoms / len(g.atomsTyp)
-	for _, v := range g.atomsTyp {
-		xyz[v] = make([][3]float64, 0, nbat)
-	}
+func (g *GR) fetchXYZ(r *bufio.Reader) (xyz XYZ, ids, slots IDs, err error) {
+	xyz, ids, slots = g.alloc()
 
+	c := newCounter(len(g.atomsTyp))
 	for i := 0; i < g.atoms; i++ {
-		_, err = g.readXYZ(r, xyz)
+		_, _, err = g.readXYZ(r, xyz, ids, slots, c)
 		if err != nil {
+			err = fmt.Errorf("atom %d (line %d): %w", i, util.AtomLine(i), err)
 			return
 		}
 	}
 
+	if g.sel != nil {
+		g.count(xyz, slots, c)
+	}
+
+	return
+}
+
+// counter counts the atoms of each type read in a configuration: every atom
+// (the index used by the sampler), the atoms kept by the sampler (the index of
+// the histograms), and the atoms satisfying Select. If ref is true, the center
+// atoms are tested against Reference (first configuration).
+type counter struct {
+	all  map[string]int
+	kept map[string]int
+	sel  map[string]int
+	ref  bool
+}
+
+func newCounter(types int) counter {
+	return counter{
+		all:  make(map[string]int, types),
+		kept: make(map[string]int, types),
+		sel:  make(map[string]int, types),
+	}
+}
+
+// count accumulates the number of selected atoms of each type and the number
+// of configurations where each center atom is selected. It is only used with
+// Select, the selected atoms changing from a configuration to another.
+func (g *GR) count(xyz XYZ, slots IDs, c counter) {
+	for k, v := range xyz {
+		g.sumLen[k] += float64(len(v))
+	}
+
+	for k, v := range c.sel {
+		g.sumLenAll[k] += float64(v)
+	}
+
+	for at1 := range g.Atoms {
+		for _, slot := range slots[at1] {
+			slot = g.center(at1, slot)
+			if slot >= 0 && slot < len(g.present[at1]) {
+				g.present[at1][slot]++
+			}
+		}
+	}
+}
+
+// alloc allocates the maps of the coordinates, of the identifiers, and of the
+// slots. The map of the identifiers is nil if there is no exclusion. The map of
+// the slots is nil if there is no selection. The slices of each type are sized
+// after the number of atoms of the type in the first configuration (none for
+// the first configuration itself).
+func (g *GR) alloc() (xyz XYZ, ids, slots IDs) {
+	xyz = make(XYZ, len(g.atomsTyp))
+	if g.excl != nil {
+		ids = make(IDs, len(g.atomsTyp))
+	}
+	if g.sel != nil {
+		slots = make(IDs, len(g.atomsTyp))
+	}
+
+	for _, v := range g.atomsTyp {
+		nbat := int(g.xyzLenAll[v])
+		xyz[v] = make([][3]float64, 0, nbat)
+		if ids != nil {
+			ids[v] = make([]int, 0, nbat)
+		}
+	}
+
 	return
 }
 
 // readXYZ reads the coordinates for each atom. If the atom type exists in XYZ,
-// it is added to the map. It returns the type of the atom.
-func (g *GR) readXYZ(r *bufio.Reader, xyz XYZ) (typ string, err error) {
+// the atom is kept by the sampler and satisfies Select, it is added to the map
+// (and its identifier to ids if ids is not nil, and its slot, i.e. its index
+// among the atoms of its type kept by the sampler, to slots if slots is not
+// nil). c counts the atoms read for each type. It returns the type of the atom
+// and whether it has been kept by the sampler.
+func (g *GR) readXYZ(r *bufio.Reader, xyz XYZ, ids, slots IDs, c counter) (typ string, kept bool, err error) {
 	b, _ := r.ReadSlice('\n')
 	fields := strings.Fields(string(b))
 	if len(fields) != g.colsLen {
@@ -133,21 +283,77 @@ func (g *GR) readXYZ(r *bufio.Reader, xyz XYZ) (typ string, err error) {
 	}
 
 	typ = fields[g.cols[3]]
+	g.summary.Add(typ)
 	xyzTyp, ok := xyz[typ]
 	if !ok {
 		return
 	}
 
-	var xyzTmp [3]float64
-	for k := 0; k < 3; k++ {
-		xyzTmp[k], _ = strconv.ParseFloat(fields[g.cols[k]], 64)
+	c.all[typ]++
+	match, err := g.sel.Match(fields)
+	if err != nil {
+		return
+	}
+	if match {
+		c.sel[typ]++
+	}
+
+	if !g.sampler.Keep(typ, c.all[typ]-1) {
+		return
+	}
+	c.kept[typ]++
+	kept = true
+
+	if _, ok := g.Atoms[typ]; ok && c.ref {
+		err = g.reference(typ, fields)
+		if err != nil {
+			return
+		}
+	}
+
+	if !match {
+		return
+	}
+
+	xyzTmp, err := util.ParseXYZ(fields, g.cols[:3], g.coords)
+	if err != nil {
+		return
 	}
 
 	xyz[typ] = append(xyzTyp, xyzTmp)
+	if ids != nil {
+		id, _ := strconv.Atoi(fields[g.colID])
+		ids[typ] = append(ids[typ], id)
+	}
+	if slots != nil {
+		slots[typ] = append(slots[typ], c.kept[typ]-1)
+	}
+
 	return
 }
 
+// reference adds the next center atom of type typ to the references if it
+// satisfies Reference. It is only called for the first configuration.
+func (g *GR) reference(typ string, fields []string) error {
+	match, err := g.ref.Match(fields)
+	if err != nil {
+		return err
+	}
+
+	idx := -1
+	if match {
+		idx = g.refLen[typ]
+		g.refLen[typ]++
+	}
+	g.refIdx[typ] = append(g.refIdx[typ], idx)
+
+	return nil
+}
+
 func readSlice(r *bufio.Reader, w io.Writer) []byte {
 	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
 	return b
 }
@@ -0,0 +1,247 @@
+// Package mindist calculates the minimum distance between two groups of atoms
+// (e.g. a ligand and the pocket of a protein) in each configuration, and its
+// distribution.
+package mindist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "min_distance"
+
+// MinDist is a structure containing the parameters that can be parsed from a
+// TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the histogram.
+//
+// GroupA and GroupB are the selections of the atoms of the two groups (see
+// util.Selection), e.g. "mol == 12" and "type == 5 || type == 6". The minimum
+// distance uses the minimum image convention. An atom belonging to both groups
+// is not paired with itself. The distances are binned up to RMax with bins of
+// width Dr; the distances beyond RMax are only written in the time series.
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd, the
+// configurations read are used and a warning is logged.
+type MinDist struct {
+	FileIn  string `toml:"min_distance.file_in"`
+	FileOut string `toml:"min_distance.file_out"`
+
+	CfgStart int `toml:"min_distance.cfg_start"`
+	CfgEnd   int `toml:"min_distance.cfg_end"`
+
+	GroupA string `toml:"min_distance.group_a"`
+	GroupB string `toml:"min_distance.group_b"`
+
+	RMax float64 `toml:"min_distance.rmax"`
+	Dr   float64 `toml:"min_distance.dr"`
+
+	Dt float64 `toml:"min_distance.dt"`
+
+	selA, selB *util.Selection
+
+	bins  int
+	hstg  []float64
+	nbCfg int
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	syncEvery int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the MinDist structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*MinDist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var minDist MinDist
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&minDist)
+	if err != nil {
+		return nil, err
+	}
+
+	if minDist.CfgStart >= minDist.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	minDist.selA, err = util.NewSelection(minDist.GroupA)
+	if err != nil {
+		return nil, fmt.Errorf("GroupA: %w", err)
+	}
+
+	minDist.selB, err = util.NewSelection(minDist.GroupB)
+	if err != nil {
+		return nil, fmt.Errorf("GroupB: %w", err)
+	}
+
+	if minDist.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	minDist.bins = int(minDist.RMax / minDist.Dr)
+	if minDist.bins <= 1 {
+		return nil, errors.New("the number of bins must be greater than 1")
+	}
+	minDist.hstg = make([]float64, minDist.bins)
+
+	return &minDist, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (m *MinDist) SetOutputDir(dir string) {
+	m.FileOut = util.FileOut(m.FileOut, dir, m.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (m *MinDist) SetOutputFormat(format string) {
+	m.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (m *MinDist) SetProgress(p *util.Progress) {
+	m.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (m *MinDist) SetInput(in util.Input) {
+	m.input = in
+}
+
+// SetSyncEvery sets the number of configurations between two syncs of the
+// output file (see util.Syncer).
+func (m *MinDist) SetSyncEvery(every int) {
+	m.syncEvery = every
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (m *MinDist) SetLog(log *log.Logger) {
+	m.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (m *MinDist) Start() error {
+	f, traj, err := util.OpenTrajectory(m.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(m.input.Reader(traj))
+
+	out, err := util.WriteFormat(m.FileOut, m, m.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	syncer := util.NewSyncer(out, m.syncEvery)
+	out.WriteString("cfg t min_dist\n")
+
+	err = m.input.SkipTo(f, r, 0, m.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyzA, xyzB, err := m.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	err = m.calc(out, 0, box, xyzA, xyzB)
+	if err != nil {
+		return fmt.Errorf("calc: %w", err)
+	}
+
+	for i := 1; i < (m.CfgEnd - m.CfgStart); i++ {
+		err = m.input.SkipTo(f, r, m.CfgStart+i, m.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(m.log, Type, m.CfgStart+i, m.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyzA, xyzB, err := m.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		err = m.calc(out, i, box, xyzA, xyzB)
+		if err != nil {
+			return fmt.Errorf("calc (step %d): %w", i, err)
+		}
+		m.progress.Update(i+1, m.CfgEnd-m.CfgStart)
+		err = syncer.Frame()
+		if err != nil {
+			return fmt.Errorf("Sync (step %d): %w", i, err)
+		}
+	}
+
+	m.write(out)
+
+	return nil
+}
+
+// calc calculates the minimum distance between the two groups, adds it to the
+// histogram, and writes it into a file.
+func (m *MinDist) calc(w io.Writer, cfg int, box [3]float64, xyzA, xyzB []atom) error {
+	if len(xyzA) == 0 || len(xyzB) == 0 {
+		return errors.New("a group is empty")
+	}
+
+	dist := math.MaxFloat64
+	for _, a := range xyzA {
+		for _, b := range xyzB {
+			if a.index == b.index {
+				continue
+			}
+
+			d := util.MinImageDist2(a.xyz, b.xyz, box)
+			dist = math.Min(dist, d)
+		}
+	}
+
+	if dist == math.MaxFloat64 {
+		return errors.New("the groups only contain the same atom")
+	}
+	dist = math.Sqrt(dist)
+
+	if bin := int(dist / m.Dr); bin < m.bins {
+		m.hstg[bin]++
+	}
+	m.nbCfg++
+
+	fmt.Fprintf(w, "%d %g %g\n", (cfg + m.CfgStart),
+		(float64(cfg+m.CfgStart) * m.Dt), dist)
+	return nil
+}
+
+// write writes the probability density of the minimum distance. It is
+// normalized by the number of configurations read, including the ones whose
+// distance is beyond RMax.
+func (m *MinDist) write(w io.Writer) {
+	fmt.Fprint(w, "\ndist P\n")
+	nbCfg := float64(m.nbCfg)
+	for i, v := range m.hstg {
+		fmt.Fprintf(w, "%g %g\n", (float64(i)+0.5)*m.Dr, v/(nbCfg*m.Dr))
+	}
+}
@@ -0,0 +1,77 @@
+package mindist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newMinDist writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [min_distance]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newMinDist(t *testing.T, params, traj string) *MinDist {
+	dir, err := ioutil.TempDir("", "mindist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "mindist.toml")
+	cfg := fmt.Sprintf("[min_distance]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "mindist.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations whose minimum distance is 1.5, 1.5,
+	// and 2.5.
+	var traj strings.Builder
+	for i, x := range []float64{6.5, 6.5, 7.5} {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&traj, "1 1 5 5 5\n2 2 %g 5 5\n", x)
+	}
+
+	m := newMinDist(t, "cfg_end = 10\ngroup_a = \"type == 1\"\ngroup_b = \"type == 2\"\nrmax = 2.0\ndr = 1.0\ndt = 1.0\n",
+		traj.String())
+	var logs strings.Builder
+	m.SetLog(log.New(&logs, "", 0))
+	err := m.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "min_distance: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(m.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if !strings.Contains(out, "cfg t min_dist\n0 0 1.5\n1 1 1.5\n2 2 2.5\n\n") {
+		t.Errorf("wrong distances:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "dist P\n0.5 0\n1.5 0.6666666666666666\n") {
+		t.Errorf("the distribution isn't normalized by the configurations read:\n%s", out)
+	}
+}
@@ -0,0 +1,141 @@
+package mindist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// atom is an atom of a group. index is its position in the configuration.
+type atom struct {
+	index int
+	xyz   [3]float64
+}
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (m *MinDist) readCfgFirst(r *bufio.Reader) (box [3]float64, xyzA, xyzB []atom, err error) {
+	m.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	m.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			m.cols[0] = k
+		case "y":
+			m.cols[1] = k
+		case "z":
+			m.cols[2] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(m.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, and z")
+		return
+	}
+
+	err = m.selA.Columns(fields)
+	if err != nil {
+		err = fmt.Errorf("GroupA: %w", err)
+		return
+	}
+
+	err = m.selB.Columns(fields)
+	if err != nil {
+		err = fmt.Errorf("GroupB: %w", err)
+		return
+	}
+
+	xyzA, xyzB, err = m.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (m *MinDist) readCfg(r *bufio.Reader) (box [3]float64, xyzA, xyzB []atom, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyzA, xyzB, err = m.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms of the two groups.
+func (m *MinDist) fetchXYZ(r *bufio.Reader) (xyzA, xyzB []atom, err error) {
+	for i := 0; i < m.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != m.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), m.colsLen)
+			return
+		}
+
+		var inA, inB bool
+		inA, err = m.selA.Match(fields)
+		if err != nil {
+			return
+		}
+
+		inB, err = m.selB.Match(fields)
+		if err != nil {
+			return
+		}
+
+		if !inA && !inB {
+			continue
+		}
+
+		at := atom{index: i}
+		for k := 0; k < 3; k++ {
+			at.xyz[k], _ = strconv.ParseFloat(fields[m.cols[k]], 64)
+		}
+
+		if inA {
+			xyzA = append(xyzA, at)
+		}
+		if inB {
+			xyzB = append(xyzB, at)
+		}
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
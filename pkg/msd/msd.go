@@ -0,0 +1,426 @@
+// Package msd calculates the mean squared displacement of some atom types,
+// optionally resolved by the slab in which the atoms are at the first
+// configuration (e.g. near or far from a surface).
+//
+// The mean squared displacement is MSD(t) = <|r(t0+t) - r(t0)|²>, r being the
+// unwrapped position of an atom. The average runs over the atoms of a slab and
+// over the time origins t0. The non-Gaussian parameter is
+// α2(t) = 3<r⁴(t)>/(5<r²(t)>²) - 1, r being the displacement; it is 0 for a
+// Gaussian distribution of the displacements. The diffusion coefficient is
+// D = MSD(t)/(6t) at long times, i.e. a sixth of the slope of the MSD.
+package msd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "msd"
+
+// MSD is a structure containing the parameters that can be parsed from a TOML
+// configuration file. This structure can be instanced through the New method.
+// It also contains other unexported informations like the number of atoms, the
+// number of columns, and the positions of each configuration.
+//
+// Only the atoms whose type is in Atoms are taken into account. The unwrapped
+// coordinates (xu, yu, and zu) are used, and the atoms must be in the same
+// order in every configuration (dump_modify sort id).
+// If Slabs is set, the atoms are assigned to a slab according to their wrapped
+// position along Axis (x, y, or z) at the first configuration, and they stay
+// in it for the whole calculation. Slabs are the increasing edges of the
+// slabs: the first slab goes from Slabs[0] to Slabs[1], the second from
+// Slabs[1] to Slabs[2], and so on. The atoms outside the slabs are not taken
+// into account. Otherwise, every atom belongs to a single slab.
+// If Components is true, the MSD along x, y, and z of each slab is written
+// after the MSD (msd_x msd_y msd_z), e.g. to detect an anisotropic diffusion.
+// If NonGaussian is true, the non-Gaussian parameter of each slab is written
+// after them (0 at t = 0).
+// If Molecules is true, the centers of mass of the molecules (atoms of the
+// types in Atoms grouped by the mol column, or by AtomsPerMolecule consecutive
+// atoms if there is none) replace the atoms. The masses of the atom types are
+// given by Masses (center of geometry if empty or if UseGeometry is true). A
+// molecule is assigned to the slab of its first atom.
+// The diffusion coefficient of each slab is fitted (least squares) on the lags
+// from FitRange[0] to FitRange[1] (1 to LagMax by default) and written at the
+// end.
+// CfgStart must be lower than CfgEnd. LagMax must be lower than the number of
+// configurations. If the trajectory ends before CfgEnd, the configurations read
+// are used, the lags (and FitRange) stop at the last configuration read, and a
+// warning is logged.
+type MSD struct {
+	FileIn  string `toml:"msd.file_in"`
+	FileOut string `toml:"msd.file_out"`
+
+	CfgStart int `toml:"msd.cfg_start"`
+	CfgEnd   int `toml:"msd.cfg_end"`
+
+	Atoms []string `toml:"msd.atoms"`
+
+	Axis  string    `toml:"msd.axis"`
+	Slabs []float64 `toml:"msd.slabs"`
+
+	LagMax      int   `toml:"msd.lag_max"`
+	Components  bool  `toml:"msd.components"`
+	NonGaussian bool  `toml:"msd.non_gaussian"`
+	FitRange    []int `toml:"msd.fit_range"`
+
+	Molecules        bool               `toml:"msd.molecules"`
+	Masses           map[string]float64 `toml:"msd.masses"`
+	UseGeometry      bool               `toml:"msd.use_geometry"`
+	AtomsPerMolecule int                `toml:"msd.atoms_per_molecule"`
+
+	Dt float64 `toml:"msd.dt"`
+
+	types map[string]bool
+	axis  int
+	nb    int // number of slabs
+
+	atoms   int
+	cols    [6]int
+	colsLen int
+
+	xyz  [][][3]float64
+	slab []int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the MSD structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*MSD, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msd MSD
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&msd)
+	if err != nil {
+		return nil, err
+	}
+
+	if msd.CfgStart >= msd.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if msd.LagMax <= 0 || msd.LagMax >= (msd.CfgEnd-msd.CfgStart) {
+		return nil, errors.New("LagMax must be strictly positive and lower than the number of configurations")
+	}
+
+	if len(msd.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	switch msd.Axis {
+	case "x":
+		msd.axis = 0
+	case "y":
+		msd.axis = 1
+	case "z", "":
+		msd.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", msd.Axis)
+	}
+
+	switch len(msd.Slabs) {
+	case 0:
+		msd.nb = 1
+	case 1:
+		return nil, errors.New("Slabs must contain at least two edges")
+	default:
+		msd.nb = len(msd.Slabs) - 1
+	}
+
+	switch len(msd.FitRange) {
+	case 0:
+		msd.FitRange = []int{1, msd.LagMax}
+	case 2:
+	default:
+		return nil, errors.New("FitRange must contain two lags")
+	}
+
+	if msd.FitRange[0] < 0 || msd.FitRange[0] >= msd.FitRange[1] || msd.FitRange[1] > msd.LagMax {
+		return nil, errors.New("FitRange must contain two increasing lags lower or equal than LagMax")
+	}
+
+	for i := 1; i < len(msd.Slabs); i++ {
+		if msd.Slabs[i] <= msd.Slabs[i-1] {
+			return nil, errors.New("Slabs must be increasing")
+		}
+	}
+
+	msd.types = make(map[string]bool, len(msd.Atoms))
+	for _, v := range msd.Atoms {
+		msd.types[v] = true
+	}
+
+	return &msd, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (m *MSD) SetOutputDir(dir string) {
+	m.FileOut = util.FileOut(m.FileOut, dir, m.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (m *MSD) SetOutputFormat(format string) {
+	m.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (m *MSD) SetProgress(p *util.Progress) {
+	m.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (m *MSD) SetInput(in util.Input) {
+	m.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (m *MSD) SetLog(log *log.Logger) {
+	m.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread. The positions of every configuration are
+// kept in memory.
+func (m *MSD) Start() error {
+	f, traj, err := util.OpenTrajectory(m.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(m.input.Reader(traj))
+
+	err = m.input.SkipTo(f, r, 0, m.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	xyz, pos, err := m.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	m.slab = make([]int, len(xyz))
+	for i, v := range pos {
+		m.slab[i] = m.slabOf(v)
+	}
+
+	m.xyz = make([][][3]float64, 0, m.CfgEnd-m.CfgStart)
+	m.xyz = append(m.xyz, xyz)
+
+	for i := 1; i < (m.CfgEnd - m.CfgStart); i++ {
+		err = m.input.SkipTo(f, r, m.CfgStart+i, m.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(m.log, Type, m.CfgStart+i, m.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		xyz, err := m.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		if len(xyz) != len(m.slab) {
+			return fmt.Errorf("number of atoms don't match (step %d): %d (expected %d)", i, len(xyz), len(m.slab))
+		}
+		m.xyz = append(m.xyz, xyz)
+		m.progress.Update(i+1, m.CfgEnd-m.CfgStart)
+	}
+
+	out, err := util.WriteFormat(m.FileOut, m, m.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	m.write(out)
+
+	return nil
+}
+
+// slabOf returns the slab of an atom from its wrapped position along the axis,
+// or -1 if it is outside the slabs.
+func (m *MSD) slabOf(pos float64) int {
+	for i := 0; i < m.nb; i++ {
+		if pos >= m.Slabs[i] && pos < m.Slabs[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// write calculates the mean squared displacement of each slab (and its
+// components and the mean quartic displacement for the non-Gaussian parameter)
+// using every configuration as a time origin and writes the results into a
+// file.
+func (m *MSD) write(w io.Writer) {
+	lagMax, fit := m.LagMax, [2]int{m.FitRange[0], m.FitRange[1]}
+	if lagMax >= len(m.xyz) {
+		lagMax = len(m.xyz) - 1
+	}
+	if fit[1] > lagMax {
+		fit[1] = lagMax
+	}
+	if fit[0] > fit[1] {
+		fit[0] = fit[1]
+	}
+
+	msd := make([][]float64, m.nb)
+	comp := make([][][3]float64, m.nb)
+	mqd := make([][]float64, m.nb)
+	norm := make([][]float64, m.nb)
+	for i := range msd {
+		msd[i] = make([]float64, m.LagMax+1)
+		comp[i] = make([][3]float64, m.LagMax+1)
+		mqd[i] = make([]float64, m.LagMax+1)
+		norm[i] = make([]float64, m.LagMax+1)
+	}
+
+	for t0, xyz0 := range m.xyz {
+		for at, slab := range m.slab {
+			if slab < 0 {
+				continue
+			}
+
+			for lag := 0; lag <= m.LagMax && (t0+lag) < len(m.xyz); lag++ {
+				xyz := m.xyz[t0+lag][at]
+				var d float64
+				for k := 0; k < 3; k++ {
+					dk := util.Pow(xyz[k]-xyz0[at][k], 2)
+					comp[slab][lag][k] += dk
+					d += dk
+				}
+				msd[slab][lag] += d
+				mqd[slab][lag] += d * d
+				norm[slab][lag]++
+			}
+		}
+	}
+
+	fmt.Fprint(w, "lag t")
+	for _, col := range m.columns() {
+		fmt.Fprint(w, " ", col)
+	}
+	fmt.Fprint(w, "\n")
+
+	d := make([]float64, m.nb)
+	for lag := 0; lag <= lagMax; lag++ {
+		fmt.Fprintf(w, "%d %g", lag, float64(lag)*m.Dt)
+		for i := 0; i < m.nb; i++ {
+			if norm[i][lag] > 0 {
+				msd[i][lag] /= norm[i][lag]
+				mqd[i][lag] /= norm[i][lag]
+				for k := 0; k < 3; k++ {
+					comp[i][lag][k] /= norm[i][lag]
+				}
+			}
+			fmt.Fprintf(w, " %g", msd[i][lag])
+		}
+
+		for k := 0; m.Components && k < 3; k++ {
+			for i := 0; i < m.nb; i++ {
+				fmt.Fprintf(w, " %g", comp[i][lag][k])
+			}
+		}
+
+		for i := 0; m.NonGaussian && i < m.nb; i++ {
+			var alpha2 float64
+			if msd[i][lag] > 0 {
+				alpha2 = 3.*mqd[i][lag]/(5.*msd[i][lag]*msd[i][lag]) - 1.
+			}
+			fmt.Fprintf(w, " %g", alpha2)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	for i := range d {
+		d[i] = slope(msd[i][fit[0]:fit[1]+1], fit[0], m.Dt) / 6.
+	}
+
+	if len(m.Slabs) == 0 {
+		fmt.Fprintf(w, "\nD\n%g\n", d[0])
+		return
+	}
+
+	count := make([]int, m.nb)
+	for _, slab := range m.slab {
+		if slab >= 0 {
+			count[slab]++
+		}
+	}
+
+	name := "atoms"
+	if m.Molecules {
+		name = "molecules"
+	}
+
+	fmt.Fprintf(w, "\nslab min max %s D\n", name)
+	for i := 0; i < m.nb; i++ {
+		fmt.Fprintf(w, "%d %g %g %d %g\n", i, m.Slabs[i], m.Slabs[i+1], count[i], d[i])
+	}
+}
+
+// slope returns the slope of the least squares line of y, the first value
+// being at the lag first and the lags being separated by dt.
+func slope(y []float64, first int, dt float64) float64 {
+	var sx, sy, sxx, sxy float64
+	n := float64(len(y))
+	for i, v := range y {
+		x := float64(first+i) * dt
+		sx += x
+		sy += v
+		sxx += x * x
+		sxy += x * v
+	}
+
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / den
+}
+
+// columns returns the names of the columns following lag and t: the MSD of
+// each slab, then its components and the non-Gaussian parameter of each slab.
+func (m *MSD) columns() []string {
+	names := []string{"msd"}
+	if m.Molecules {
+		names[0] = "msd_com"
+	}
+	if m.Components {
+		names = append(names, names[0]+"_x", names[0]+"_y", names[0]+"_z")
+	}
+	if m.NonGaussian {
+		names = append(names, "alpha2")
+	}
+
+	var cols []string
+	for _, name := range names {
+		if len(m.Slabs) == 0 {
+			cols = append(cols, name)
+			continue
+		}
+		for i := 0; i < m.nb; i++ {
+			cols = append(cols, fmt.Sprintf("%s_%d", name, i))
+		}
+	}
+	return cols
+}
@@ -0,0 +1,258 @@
+package msd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newMSD writes the configuration file with params and the trajectory traj
+// into a temporary directory and returns the calculation.
+func newMSD(t *testing.T, params, traj string) (*MSD, error) {
+	dir, err := ioutil.TempDir("", "msd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "msd.toml")
+	cfg := fmt.Sprintf("[msd]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "msd.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(path)
+}
+
+// run runs the calculation of newMSD and returns its output.
+func run(t *testing.T, params, traj string) (string, error) {
+	m, err := newMSD(t, params, traj)
+	if err != nil {
+		return "", fmt.Errorf("New: %w", err)
+	}
+
+	err = m.Start()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(m.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b), nil
+}
+
+// rows runs write and returns the values of the rows of the MSD (lag, t,
+// then the columns).
+func rows(t *testing.T, m *MSD) [][]float64 {
+	var out bytes.Buffer
+	m.write(&out)
+
+	var rows [][]float64
+	for _, line := range strings.Split(out.String(), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			break
+		}
+
+		row := make([]float64, len(fields))
+		for k, f := range fields {
+			var err error
+			row[k], err = strconv.ParseFloat(f, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestNonGaussian(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const atoms, cfgs, lagMax = 2000, 30, 10
+
+	tests := []struct {
+		name string
+		step func(at int, v [3]float64) [3]float64 // displacement between two configurations
+		init func(at int) [3]float64               // velocity of each atom (v of step)
+		want float64
+		tol  float64
+	}{
+		// A random walk with Gaussian steps.
+		{"gaussian", func(int, [3]float64) [3]float64 {
+			return [3]float64{0.1 * rnd.NormFloat64(), 0.1 * rnd.NormFloat64(), 0.1 * rnd.NormFloat64()}
+		}, nil, 0, 0.05},
+		// Constant velocities of the same norm: <r⁴> = <r²>².
+		{"ballistic", func(_ int, v [3]float64) [3]float64 { return v }, func(int) [3]float64 {
+			theta, phi := math.Acos(2*rnd.Float64()-1), 2*math.Pi*rnd.Float64()
+			return [3]float64{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)}
+		}, -0.4, 1e-9},
+		// Half of the atoms are at rest: α2 = 3/(5·0.5) - 1.
+		{"half at rest", func(_ int, v [3]float64) [3]float64 { return v }, func(at int) [3]float64 {
+			return [3]float64{float64(at % 2), 0, 0}
+		}, 0.2, 1e-9},
+	}
+
+	for _, tt := range tests {
+		v := make([][3]float64, atoms)
+		for at := range v {
+			if tt.init != nil {
+				v[at] = tt.init(at)
+			}
+		}
+
+		m := &MSD{LagMax: lagMax, FitRange: []int{1, lagMax}, NonGaussian: true, Dt: 1, nb: 1}
+		m.slab = make([]int, atoms)
+		m.xyz = [][][3]float64{make([][3]float64, atoms)}
+		for i := 1; i < cfgs; i++ {
+			xyz := make([][3]float64, atoms)
+			for at := range xyz {
+				d := tt.step(at, v[at])
+				for k := 0; k < 3; k++ {
+					xyz[at][k] = m.xyz[i-1][at][k] + d[k]
+				}
+			}
+			m.xyz = append(m.xyz, xyz)
+		}
+
+		rows := rows(t, m)
+		if len(rows) != lagMax+1 {
+			t.Fatalf("%s: %d lags, want %d", tt.name, len(rows), lagMax+1)
+		}
+		if rows[0][2] != 0 || rows[0][3] != 0 {
+			t.Errorf("%s: MSD %g and α2 %g at t = 0, want 0", tt.name, rows[0][2], rows[0][3])
+		}
+		for _, row := range rows[1:] {
+			if math.Abs(row[3]-tt.want) > tt.tol {
+				t.Errorf("%s: lag %g: α2 = %g, want %g", tt.name, row[0], row[3], tt.want)
+			}
+		}
+	}
+}
+
+func TestMoleculesRigid(t *testing.T) {
+	// Rigid water-like molecules translated by a random walk, without
+	// rotation: every atom moves like the center of its molecule.
+	rnd := rand.New(rand.NewSource(2))
+	const mols, cfgs = 20, 15
+	pos := make([][3]float64, mols)
+	for i := range pos {
+		pos[i] = [3]float64{rnd.Float64() * 20, rnd.Float64() * 20, rnd.Float64() * 20}
+	}
+
+	var traj strings.Builder
+	for i := 0; i < cfgs; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", 10*i, 3*mols)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\nITEM: ATOMS id mol type xu yu zu\n")
+		for m, p := range pos {
+			types := []string{"1", "2", "2"}
+			for j, v := range [][3]float64{{0, 0, 0}, {0.8, 0.6, 0}, {-0.8, 0.6, 0}} {
+				fmt.Fprintf(&traj, "%d %d %s %g %g %g\n", 3*m+j+1, m+1, types[j], p[0]+v[0], p[1]+v[1], p[2]+v[2])
+			}
+		}
+		for m := range pos {
+			for k := 0; k < 3; k++ {
+				pos[m][k] += 0.3 * rnd.NormFloat64()
+			}
+		}
+	}
+
+	params := fmt.Sprintf("cfg_end = %d\natoms = [\"1\", \"2\"]\nlag_max = 10\ndt = 0.5\n", cfgs)
+	atoms, err := run(t, params, traj.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{"mass", "molecules = true\nmasses = {1 = 16.0, 2 = 1.0}\n"},
+		{"geometry", "molecules = true\nuse_geometry = true\n"},
+		{"atoms per molecule", "molecules = true\natoms_per_molecule = 3\n"},
+	}
+
+	for _, tt := range tests {
+		com, err := run(t, params+tt.params, traj.String())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !strings.Contains(com, "\nlag t msd_com\n") {
+			t.Errorf("%s: no column msd_com", tt.name)
+		}
+
+		// The results (MSD and D) are the same up to the rounding errors.
+		want := strings.Fields(atoms[strings.Index(atoms, "\nlag t ")+1:])[3:]
+		got := strings.Fields(com[strings.Index(com, "\nlag t ")+1:])[3:]
+		if len(got) != len(want) {
+			t.Fatalf("%s: %d values, want %d", tt.name, len(got), len(want))
+		}
+		for i := range got {
+			g, err1 := strconv.ParseFloat(got[i], 64)
+			w, err2 := strconv.ParseFloat(want[i], 64)
+			if err1 != nil || err2 != nil {
+				if got[i] != want[i] {
+					t.Errorf("%s: %q, want %q", tt.name, got[i], want[i])
+				}
+				continue
+			}
+			if math.Abs(g-w) > 1e-9*math.Max(1, math.Abs(w)) {
+				t.Errorf("%s: %g, want %g as with the atoms", tt.name, g, w)
+			}
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// A single atom moving by 1 along x at each of the 3 configurations, the
+	// calculation asking for 10 configurations and lags up to 5.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type xu yu zu\n")
+		fmt.Fprintf(&traj, "1 1 %d 0 0\n", i)
+	}
+
+	m, err := newMSD(t, "cfg_end = 10\natoms = [\"1\"]\nlag_max = 5\ndt = 1.0\n", traj.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	m.SetLog(log.New(&logs, "", 0))
+
+	err = m.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "msd: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("log %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(m.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	want = "lag t msd\n0 0 0\n1 1 1\n2 2 4\n\nD\n0.5\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("output %q, want the suffix %q", out, want)
+	}
+}
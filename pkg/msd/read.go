@@ -0,0 +1,184 @@
+package msd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// molecule contains the unwrapped coordinates and the masses of the atoms of a
+// molecule, and the wrapped position of its first atom along the axis.
+type molecule struct {
+	xyz    [][3]float64
+	masses []float64
+	pos    float64
+}
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg. pos is the
+// wrapped position of each atom (or molecule) along the axis (only if Slabs is
+// set).
+func (m *MSD) readCfgFirst(r *bufio.Reader) (xyz [][3]float64, pos []float64, err error) {
+	m.atoms, _, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	wrapped := [3]string{"x", "y", "z"}[m.axis]
+	found := make(map[string]bool)
+	m.colsLen = len(fields)
+	m.cols[5] = -1
+	for k, v := range fields {
+		switch v {
+		case "xu":
+			m.cols[0] = k
+		case "yu":
+			m.cols[1] = k
+		case "zu":
+			m.cols[2] = k
+		case "type":
+			m.cols[3] = k
+		case wrapped:
+			m.cols[4] = k
+		case "mol":
+			m.cols[5] = k
+		default:
+			continue
+		}
+		found[v] = true
+	}
+
+	if !found["xu"] || !found["yu"] || !found["zu"] || !found["type"] {
+		err = fmt.Errorf("cannot find the columns xu, yu, zu, and type")
+		return
+	}
+
+	if len(m.Slabs) > 0 && !found[wrapped] {
+		err = fmt.Errorf("cannot find the column %s", wrapped)
+		return
+	}
+
+	if m.Molecules && m.cols[5] < 0 {
+		err = util.CheckAtomsPerMol(m.atoms, m.AtomsPerMolecule)
+		if err != nil {
+			err = fmt.Errorf("cannot find the column mol: CheckAtomsPerMol: %w", err)
+			return
+		}
+	}
+
+	xyz, pos, err = m.fetchXYZ(r, len(m.Slabs) > 0)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (m *MSD) readCfg(r *bufio.Reader) (xyz [][3]float64, err error) {
+	_, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, _, err = m.fetchXYZ(r, false)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the unwrapped coordinates of the selected atoms and, if
+// withPos is true, their wrapped position along the axis. If Molecules is true,
+// the atoms are replaced by the centers of mass of their molecules.
+func (m *MSD) fetchXYZ(r *bufio.Reader, withPos bool) (xyz [][3]float64, pos []float64, err error) {
+	var (
+		mols  []molecule
+		index map[string]int
+	)
+	if m.Molecules {
+		index = make(map[string]int)
+	}
+
+	for i := 0; i < m.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != m.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), m.colsLen)
+			return
+		}
+
+		if !m.types[fields[m.cols[3]]] {
+			continue
+		}
+
+		var at [3]float64
+		for k := 0; k < 3; k++ {
+			at[k], _ = strconv.ParseFloat(fields[m.cols[k]], 64)
+		}
+
+		var p float64
+		if withPos {
+			p, _ = strconv.ParseFloat(fields[m.cols[4]], 64)
+		}
+
+		if !m.Molecules {
+			xyz = append(xyz, at)
+			if withPos {
+				pos = append(pos, p)
+			}
+			continue
+		}
+
+		molID := util.MolID(fields, m.cols[5], i, m.AtomsPerMolecule)
+		k, ok := index[molID]
+		if !ok {
+			k = len(mols)
+			index[molID] = k
+			mols = append(mols, molecule{pos: p})
+		}
+		mols[k].xyz = append(mols[k].xyz, at)
+
+		if len(m.Masses) > 0 && !m.UseGeometry {
+			mass, ok := m.Masses[fields[m.cols[3]]]
+			if !ok {
+				err = fmt.Errorf("mass for atom type `%s` doesn't exist", fields[m.cols[3]])
+				return
+			}
+			mols[k].masses = append(mols[k].masses, mass)
+		}
+	}
+
+	for _, mol := range mols {
+		xyz = append(xyz, util.Center(mol.xyz, mol.masses))
+		if withPos {
+			pos = append(pos, mol.pos)
+		}
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,69 @@
+package msd
+
+import (
+	"bufio"
+	"math"
+	"strings"
+	"testing"
+)
+
+// water is a configuration with two water-like molecules whose oxygens (type
+// 1) are much heavier than their hydrogens (type 2).
+const water = `ITEM: TIMESTEP
+0
+ITEM: NUMBER OF ATOMS
+6
+ITEM: BOX BOUNDS pp pp pp
+0 10
+0 10
+0 10
+ITEM: ATOMS id mol type xu yu zu
+1 1 1 0 0 0
+2 1 2 1 0 0
+3 1 2 0 1 0
+4 2 1 5 5 5
+5 2 2 6 5 5
+6 2 2 5 6 5
+`
+
+func TestReadCfgFirstCenter(t *testing.T) {
+	masses := map[string]float64{"1": 16, "2": 1}
+	tests := []struct {
+		name string
+		m    MSD
+		want [][3]float64
+	}{
+		{"mass", MSD{Masses: masses},
+			[][3]float64{{1. / 18., 1. / 18., 0}, {5 + 1./18., 5 + 1./18., 5}}},
+		{"geometry", MSD{},
+			[][3]float64{{1. / 3., 1. / 3., 0}, {5 + 1./3., 5 + 1./3., 5}}},
+		{"geometry with masses", MSD{Masses: masses, UseGeometry: true},
+			[][3]float64{{1. / 3., 1. / 3., 0}, {5 + 1./3., 5 + 1./3., 5}}},
+	}
+
+	for _, tt := range tests {
+		m := tt.m
+		m.Molecules = true
+		m.axis = 2
+		m.types = map[string]bool{"1": true, "2": true}
+
+		xyz, _, err := m.readCfgFirst(bufio.NewReader(strings.NewReader(water)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if len(xyz) != len(tt.want) {
+			t.Errorf("%s: %d molecules, want %d", tt.name, len(xyz), len(tt.want))
+			continue
+		}
+		for i := range xyz {
+			for k := 0; k < 3; k++ {
+				if math.Abs(xyz[i][k]-tt.want[i][k]) > 1e-12 {
+					t.Errorf("%s: center of molecule %d %v, want %v", tt.name, i, xyz[i], tt.want[i])
+					break
+				}
+			}
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kpotier/molsolvent/pkg/util"
+
 	"github.com/pelletier/go-toml"
 )
 
@@ -18,15 +20,27 @@ var Type = "no_pbc"
 // a TOML configuration file. This structure can be instanced through the New
 // method. It also contains other unexported informations like the number of
 // atoms, the number of columns.
+// In the first configuration, an atom is displaced when its distance to the
+// previous atom of its molecule is greater than the size of the molecule along
+// an axis: Size[molecule] if set, SizeDefault otherwise, or half the box if
+// none of them is set.
+// If the trajectory has no mol column, AtomsPerMolecule is used to group the
+// atoms in molecules (see util.MolID).
 type NoPBC struct {
-	FileIn  string               `toml:"no_pbc.file_in"`
-	FileOut string               `toml:"no_pbc.file_out"`
-	Size    map[string][]float64 `toml:"no_pbc.size"`
+	FileIn      string               `toml:"no_pbc.file_in"`
+	FileOut     string               `toml:"no_pbc.file_out"`
+	Size        map[string][]float64 `toml:"no_pbc.size"`
+	SizeDefault []float64            `toml:"no_pbc.size_default"`
+
+	AtomsPerMolecule int `toml:"no_pbc.atoms_per_molecule"`
 
 	atoms   int
 	cols    [4]int
 	colsBuf []byte
 	colsLen int
+
+	progress *util.Progress
+	input    util.Input
 }
 
 // New returns an instance of the NoPBC structure. It reads and parses
@@ -52,18 +66,41 @@ func New(path string) (*NoPBC, error) {
 		}
 	}
 
+	if noPBC.SizeDefault != nil && len(noPBC.SizeDefault) != 3 {
+		return nil, fmt.Errorf("length of SizeDefault isn't equal to 3 but %d",
+			len(noPBC.SizeDefault))
+	}
+
 	return &noPBC, nil
 }
 
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (n *NoPBC) SetOutputDir(dir string) {
+	n.FileOut = util.FileOut(n.FileOut, dir, n.FileIn, Type, ".lammpstrj")
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (n *NoPBC) SetProgress(p *util.Progress) {
+	n.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (n *NoPBC) SetInput(in util.Input) {
+	n.input = in
+}
+
 // Start performs the calculation. It is a thread blocking method. This
-// calculation only use one thread.
+// calculation uses two threads: one reads and unwraps the configurations, the
+// other one formats and writes them. The unwrapping remains sequential. An
+// error of writing is returned once every configuration has been read.
 func (n *NoPBC) Start() error {
-	f, err := os.Open(n.FileIn)
+	f, traj, err := util.OpenTrajectory(n.FileIn)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
+	r := bufio.NewReader(n.input.Reader(traj))
 
 	out, err := os.Create(n.FileOut)
 	if err != nil {
@@ -71,12 +108,34 @@ func (n *NoPBC) Start() error {
 	}
 	defer out.Close()
 
-	lastXYZ, err := n.readCfgFirst(r, out)
+	frames := make(chan frame, framesBuf)
+	done := make(chan error)
+	go func() {
+		done <- n.writeFrames(out, frames)
+	}()
+
+	err = n.read(r, frames)
+	close(frames)
+	errWrite := <-done
+	if err != nil {
+		return err
+	}
+	if errWrite != nil {
+		return fmt.Errorf("writeFrames: %w", errWrite)
+	}
+
+	return out.Close()
+}
+
+// read reads and unwraps every configuration. The configurations are sent to
+// the writing thread through frames.
+func (n *NoPBC) read(r *bufio.Reader, frames chan<- frame) error {
+	lastXYZ, err := n.readCfgFirst(r, frames)
 	if err != nil {
 		return fmt.Errorf("readCfgFirst: %w", err)
 	}
 
-	err = n.readCfg(r, out, lastXYZ)
+	err = n.readCfg(r, frames, lastXYZ)
 	if err != nil {
 		return fmt.Errorf("readCfg: %w", err)
 	}
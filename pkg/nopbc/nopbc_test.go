@@ -0,0 +1,86 @@
+package nopbc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestStartSerial checks that the pipelined unwrapping writes the same
+// trajectory as the former serial one (testdata/serial.lammpstrj), whose
+// molecules cross the box.
+func TestStartSerial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nopbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := &NoPBC{FileIn: filepath.Join("testdata", "traj.lammpstrj"), FileOut: filepath.Join(dir, "out.lammpstrj")}
+	err = n.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(n.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(filepath.Join("testdata", "serial.lammpstrj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from the serial one:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// failWriter fails once more than n bytes have been written.
+type failWriter struct {
+	n int
+}
+
+var errFail = errors.New("disk full")
+
+func (w *failWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return w.n, errFail
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func TestWriteFramesError(t *testing.T) {
+	n := &NoPBC{cols: [4]int{0, 1, 2, -1}}
+	fr := frame{header: []byte("header\n"), fields: [][]string{{"1", "2", "3"}, {"4", "5", "6"}},
+		xyz: [][3]float64{{1, 2, 3}, {4, 5, 6}}}
+
+	tests := []struct {
+		limit int
+		err   error
+	}{
+		{0, errFail},
+		{10, errFail},
+		{300, errFail},
+		{1 << 20, nil},
+	}
+
+	for _, tt := range tests {
+		frames := make(chan frame)
+		go func() {
+			for i := 0; i < 20; i++ { // blocks if writeFrames stops receiving
+				frames <- fr
+			}
+			close(frames)
+		}()
+
+		err := n.writeFrames(&failWriter{n: tt.limit}, frames)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("limit %d: got error %v, want %v", tt.limit, err, tt.err)
+		}
+	}
+}
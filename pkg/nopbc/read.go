@@ -12,8 +12,11 @@ import (
 	"github.com/kpotier/molsolvent/pkg/util"
 )
 
-func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error) {
-	atoms, box, err := util.Header(r, w, readSlice)
+// readCfgFirst reads and unwraps the first configuration using the sizes of
+// the molecules. It returns the unwrapped coordinates.
+func (n *NoPBC) readCfgFirst(r *bufio.Reader, frames chan<- frame) ([][3]float64, error) {
+	var header bytes.Buffer
+	atoms, box, err := util.Header(r, &header, readSlice)
 	if err != nil {
 		return nil, fmt.Errorf("Header: %w", err)
 	}
@@ -40,6 +43,7 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 	var found int
 	fields = fields[2:] // Omission of ITEM: ATOMS
 	n.colsLen = len(fields)
+	n.cols[3] = -1
 
 	for k, v := range fields {
 		switch v {
@@ -65,9 +69,17 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 	}
 
 	buf.WriteByte('\n')
-	w.Write(buf.Bytes())
+	header.Write(buf.Bytes())
 	n.colsBuf = buf.Bytes()
 
+	if n.cols[3] < 0 && n.AtomsPerMolecule != 0 {
+		err = util.CheckAtomsPerMol(atoms, n.AtomsPerMolecule)
+		if err != nil {
+			return nil, fmt.Errorf("CheckAtomsPerMol: %w", err)
+		}
+		found++
+	}
+
 	if found < len(n.cols) {
 		return nil, fmt.Errorf("cannot find the columns x, y, z, and mol")
 	}
@@ -75,6 +87,7 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 	// Check PBC for each atom in each molecule
 	var (
 		xyz     [][3]float64
+		fieldsA [][]string
 		mol     string
 		lastXYZ [3]float64
 		size    [3]float64
@@ -88,14 +101,18 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 			return nil, fmt.Errorf("number of columns don't match (id %d, got %d, expected %d)", i, len(fields), n.colsLen)
 		}
 
-		if fields[n.cols[3]] != mol {
-			mol = fields[n.cols[3]]
+		molID := util.MolID(fields, n.cols[3], i, n.AtomsPerMolecule)
+		if molID != mol {
+			mol = molID
 			for k := 0; k < 3; k++ {
 				lastXYZ[k], _ = strconv.ParseFloat(fields[n.cols[k]], 64)
 			}
 
 			size = box2
-			sizeMap, ok := n.Size[fields[n.cols[3]]]
+			sizeMap, ok := n.Size[molID]
+			if !ok {
+				sizeMap, ok = n.SizeDefault, n.SizeDefault != nil
+			}
 			if ok {
 				for k := 0; k < 3; k++ {
 					size[k] = sizeMap[k]
@@ -116,7 +133,13 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 		}
 
 		xyz = append(xyz, lastXYZ)
-		n.write(w, fields, lastXYZ)
+		fieldsA = append(fieldsA, fields)
+	}
+
+	frames <- frame{
+		header: header.Bytes(),
+		fields: fieldsA,
+		xyz:    append([][3]float64(nil), xyz...),
 	}
 
 	_, err = r.ReadByte()
@@ -129,11 +152,15 @@ func (n *NoPBC) readCfgFirst(r *bufio.Reader, w io.Writer) ([][3]float64, error)
 	return xyz, nil
 }
 
-func (n *NoPBC) readCfg(r *bufio.Reader, w io.Writer, lastXYZ [][3]float64) error {
+// readCfg reads and unwraps the other configurations. The coordinates are
+// unwrapped according to the previous configuration.
+func (n *NoPBC) readCfg(r *bufio.Reader, frames chan<- frame, lastXYZ [][3]float64) error {
 	corr := make([][3]float64, n.atoms)
 
+	cfg := 1 // The first configuration has been read by readCfgFirst
 	for {
-		box, err := util.HeaderWOutAtoms(r, w, readSlice)
+		var header bytes.Buffer
+		box, err := util.HeaderWOutAtoms(r, &header, readSlice)
 		if err != nil {
 			return fmt.Errorf("HeaderWOutAtoms: %w", err)
 		}
@@ -144,8 +171,9 @@ func (n *NoPBC) readCfg(r *bufio.Reader, w io.Writer, lastXYZ [][3]float64) erro
 		}
 
 		r.ReadSlice('\n')
-		w.Write(n.colsBuf)
+		header.Write(n.colsBuf)
 
+		fieldsA := make([][]string, n.atoms)
 		for i := 0; i < n.atoms; i++ {
 			l, _ := r.ReadSlice('\n')
 
@@ -169,8 +197,16 @@ func (n *NoPBC) readCfg(r *bufio.Reader, w io.Writer, lastXYZ [][3]float64) erro
 				lastXYZ[i][k] = xyz
 			}
 
-			n.write(w, fields, lastXYZ[i])
+			fieldsA[i] = fields
+		}
+
+		frames <- frame{
+			header: header.Bytes(),
+			fields: fieldsA,
+			xyz:    append([][3]float64(nil), lastXYZ...),
 		}
+		cfg++
+		n.progress.Update(cfg, 0)
 
 		_, err = r.ReadByte()
 		if err != nil {
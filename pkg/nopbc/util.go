@@ -6,6 +6,38 @@ import (
 	"strconv"
 )
 
+// framesBuf is the number of configurations that can wait to be written.
+const framesBuf = 4
+
+// frame is a configuration that has been unwrapped but not written yet. header
+// contains the lines preceding the atoms (including the columns).
+type frame struct {
+	header []byte
+	fields [][]string
+	xyz    [][3]float64
+}
+
+// writeFrames formats and writes the configurations until frames is closed. It
+// returns the first error of writing. The next configurations are then
+// received but not written, so that the reading thread isn't blocked.
+func (n *NoPBC) writeFrames(w io.Writer, frames <-chan frame) error {
+	var err error
+	for fr := range frames {
+		if err != nil {
+			continue
+		}
+
+		_, err = w.Write(fr.header)
+		for i, fields := range fr.fields {
+			if err != nil {
+				break
+			}
+			err = n.write(w, fields, fr.xyz[i])
+		}
+	}
+	return err
+}
+
 // readSlice reads until \n and writes it into a file. It also returns the line
 // that have been read.
 func readSlice(r *bufio.Reader, w io.Writer) []byte {
@@ -14,7 +46,7 @@ func readSlice(r *bufio.Reader, w io.Writer) []byte {
 	return b
 }
 
-func (n *NoPBC) write(w io.Writer, fields []string, xyz [3]float64) {
+func (n *NoPBC) write(w io.Writer, fields []string, xyz [3]float64) error {
 	var bytes []byte
 	for k, v := range fields {
 		switch k {
@@ -30,5 +62,6 @@ func (n *NoPBC) write(w io.Writer, fields []string, xyz [3]float64) {
 		bytes = append(bytes, ' ')
 	}
 	bytes = append(bytes, '\n')
-	w.Write(bytes)
+	_, err := w.Write(bytes)
+	return err
 }
@@ -0,0 +1,227 @@
+// Package occupancy calculates the spatial probability distribution of the
+// position of a single atom over time.
+package occupancy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "occupancy"
+
+// bohr is the number of Bohr in one Angstrom.
+const bohr = 1.8897261246
+
+// Occupancy is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the histogram.
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd,
+// the density is normalized by the configurations read and a warning is logged.
+// Size of the Bloc must be equal to 3. If Unwrapped is true, the columns xu,
+// yu, and zu are used instead of x, y, and z.
+type Occupancy struct {
+	FileIn  string `toml:"occupancy.file_in"`
+	FileOut string `toml:"occupancy.file_out"`
+
+	CfgStart int `toml:"occupancy.cfg_start"`
+	CfgEnd   int `toml:"occupancy.cfg_end"`
+
+	Atom      int       `toml:"occupancy.atom"`
+	Bloc      []float64 `toml:"occupancy.bloc"`
+	Unwrapped bool      `toml:"occupancy.unwrapped"`
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	hstg  map[[3]int]float64
+	mean  [3]float64
+	nbCfg int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+}
+
+// New returns an instance of the Occupancy structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Occupancy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var occupancy Occupancy
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&occupancy)
+	if err != nil {
+		return nil, err
+	}
+
+	if occupancy.CfgStart >= occupancy.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(occupancy.Bloc) != 3 {
+		return nil, errors.New("length of Bloc is not equal to 3")
+	}
+
+	for _, v := range occupancy.Bloc {
+		if v <= 0 {
+			return nil, errors.New("Bloc must be strictly positive")
+		}
+	}
+
+	if occupancy.Atom < 0 {
+		return nil, errors.New("Atom must be positive")
+	}
+
+	occupancy.hstg = make(map[[3]int]float64)
+	return &occupancy, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (o *Occupancy) SetOutputDir(dir string) {
+	o.FileOut = util.FileOut(o.FileOut, dir, o.FileIn, Type, ".cube")
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (o *Occupancy) SetProgress(p *util.Progress) {
+	o.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (o *Occupancy) SetInput(in util.Input) {
+	o.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (o *Occupancy) SetLog(log *log.Logger) {
+	o.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. It is a very
+// fast calculation. This calculation only use one thread.
+func (o *Occupancy) Start() error {
+	f, traj, err := util.OpenTrajectory(o.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(o.input.Reader(traj))
+
+	err = o.input.SkipTo(f, r, 0, o.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	xyz, err := o.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	o.calc(xyz)
+
+	for i := 1; i < (o.CfgEnd - o.CfgStart); i++ {
+		err = o.input.SkipTo(f, r, o.CfgStart+i, o.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(o.log, Type, o.CfgStart+i, o.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		xyz, err := o.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		o.calc(xyz)
+		o.progress.Update(i+1, o.CfgEnd-o.CfgStart)
+	}
+
+	out, err := os.Create(o.FileOut)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	o.write(out)
+
+	return nil
+}
+
+// calc adds the position of the atom to the histogram.
+func (o *Occupancy) calc(xyz [3]float64) {
+	var bloc [3]int
+	for k := 0; k < 3; k++ {
+		bloc[k] = int(math.Floor(xyz[k] / o.Bloc[k]))
+		o.mean[k] += xyz[k]
+	}
+	o.hstg[bloc]++
+	o.nbCfg++
+}
+
+// write writes the probability density (in Å⁻³) in a Gaussian cube file. The
+// grid is the smallest one containing every visited bloc. The atom is written
+// at its average position.
+func (o *Occupancy) write(w io.Writer) {
+	min := [3]int{math.MaxInt32, math.MaxInt32, math.MaxInt32}
+	max := [3]int{math.MinInt32, math.MinInt32, math.MinInt32}
+	for bloc := range o.hstg {
+		for k := 0; k < 3; k++ {
+			if bloc[k] < min[k] {
+				min[k] = bloc[k]
+			}
+			if bloc[k] > max[k] {
+				max[k] = bloc[k]
+			}
+		}
+	}
+
+	nbCfg := float64(o.nbCfg)
+	volBloc := o.Bloc[0] * o.Bloc[1] * o.Bloc[2]
+
+	fmt.Fprintf(w, "Occupancy of atom %d (%s)\n", o.Atom, o.FileIn)
+	fmt.Fprintf(w, "Probability density (A^-3), configurations [%d; %d[\n", o.CfgStart, o.CfgStart+o.nbCfg)
+	fmt.Fprintf(w, "%5d %12.6f %12.6f %12.6f\n", 1,
+		(float64(min[0])+0.5)*o.Bloc[0]*bohr,
+		(float64(min[1])+0.5)*o.Bloc[1]*bohr,
+		(float64(min[2])+0.5)*o.Bloc[2]*bohr)
+
+	for k := 0; k < 3; k++ {
+		var axis [3]float64
+		axis[k] = o.Bloc[k] * bohr
+		fmt.Fprintf(w, "%5d %12.6f %12.6f %12.6f\n", (max[k] - min[k] + 1), axis[0], axis[1], axis[2])
+	}
+
+	fmt.Fprintf(w, "%5d %12.6f %12.6f %12.6f %12.6f\n", 0, 0.,
+		o.mean[0]/nbCfg*bohr, o.mean[1]/nbCfg*bohr, o.mean[2]/nbCfg*bohr)
+
+	for x := min[0]; x <= max[0]; x++ {
+		for y := min[1]; y <= max[1]; y++ {
+			var col int
+			for z := min[2]; z <= max[2]; z++ {
+				fmt.Fprintf(w, " %12.5e", o.hstg[[3]int{x, y, z}]/(nbCfg*volBloc))
+				col++
+				if col%6 == 0 {
+					fmt.Fprint(w, "\n")
+				}
+			}
+
+			if col%6 != 0 {
+				fmt.Fprint(w, "\n")
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package occupancy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newOccupancy writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [occupancy]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newOccupancy(t *testing.T, params, traj string) *Occupancy {
+	dir, err := ioutil.TempDir("", "occupancy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "occupancy.toml")
+	cfg := fmt.Sprintf("[occupancy]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "occupancy.cube"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations in which the atom stays in the same
+	// bloc of volume 1: the probability density of this bloc is 1.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		traj.WriteString("1 1 0.5 0.5 0.5\n")
+	}
+
+	o := newOccupancy(t, "cfg_end = 10\natom = 0\nbloc = [1.0, 1.0, 1.0]\n", traj.String())
+	var logs strings.Builder
+	o.SetLog(log.New(&logs, "", 0))
+	err := o.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "occupancy: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(o.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("%d lines, want 9:\n%s", len(lines), b)
+	}
+	if lines[1] != "Probability density (A^-3), configurations [0; 3[" {
+		t.Errorf("comment %q doesn't give the configurations read", lines[1])
+	}
+	if atom := strings.Fields(lines[6]); len(atom) != 5 || atom[2] != "0.944863" {
+		t.Errorf("atom %q isn't at its average position", lines[6])
+	}
+	if lines[7] != "  1.00000e+00" {
+		t.Errorf("density %q, want 1", lines[7])
+	}
+}
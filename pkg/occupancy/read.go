@@ -0,0 +1,108 @@
+package occupancy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (o *Occupancy) readCfgFirst(r *bufio.Reader) (xyz [3]float64, err error) {
+	o.atoms, _, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	if o.Atom >= o.atoms {
+		err = fmt.Errorf("atom %d doesn't exist (%d atoms)", o.Atom, o.atoms)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	names := [3]string{"x", "y", "z"}
+	if o.Unwrapped {
+		names = [3]string{"xu", "yu", "zu"}
+	}
+
+	var found int
+	o.colsLen = len(fields)
+	for k, v := range fields {
+		for c, name := range names {
+			if v == name {
+				o.cols[c] = k
+				found++
+			}
+		}
+	}
+
+	if found < len(o.cols) {
+		err = fmt.Errorf("cannot find the columns %s, %s, and %s", names[0], names[1], names[2])
+		return
+	}
+
+	xyz, err = o.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atom.
+func (o *Occupancy) readCfg(r *bufio.Reader) (xyz [3]float64, err error) {
+	for i := 0; i < 9; i++ {
+		r.ReadSlice('\n')
+	}
+
+	xyz, err = o.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atom and skips the other ones.
+func (o *Occupancy) fetchXYZ(r *bufio.Reader) (xyz [3]float64, err error) {
+	for i := 0; i < o.Atom; i++ {
+		r.ReadSlice('\n')
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+	if len(fields) != o.colsLen {
+		err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), o.colsLen)
+		return
+	}
+
+	for k := 0; k < 3; k++ {
+		xyz[k], _ = strconv.ParseFloat(fields[o.cols[k]], 64)
+	}
+
+	for i := 0; i < (o.atoms - o.Atom - 1); i++ {
+		r.ReadSlice('\n')
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
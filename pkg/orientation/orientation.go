@@ -0,0 +1,268 @@
+// Package orientation calculates the orientational distribution of molecules
+// relative to a fixed axis, resolved by the position along this axis.
+package orientation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "orientation"
+
+// molecule contains the coordinates and the types of the atoms of a molecule.
+type molecule struct {
+	xyz   [][3]float64
+	types []string
+}
+
+// Orientation is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the histograms.
+//
+// The orientation vector of a molecule goes from its atom Offsets[0] to its
+// atom Offsets[1] (the offsets are the positions of the atoms in the molecule,
+// starting at 0). Only the molecules whose atom Offsets[0] has the type
+// AtomType are taken into account. The position of a molecule is the position
+// of this atom along Axis (x, y, or z). The box is divided into Slabs slabs
+// along Axis and cos(θ) into CosBins bins, θ being the angle between the
+// orientation vector and Axis.
+// If the trajectory has no mol column, AtomsPerMolecule is used to group the
+// atoms in molecules (see util.MolID). The atoms of a molecule must be
+// consecutive. CfgStart must be lower than CfgEnd. If the trajectory ends
+// before CfgEnd, the configurations read are used and a warning is logged.
+type Orientation struct {
+	FileIn  string `toml:"orientation.file_in"`
+	FileOut string `toml:"orientation.file_out"`
+
+	CfgStart int `toml:"orientation.cfg_start"`
+	CfgEnd   int `toml:"orientation.cfg_end"`
+
+	AtomType string `toml:"orientation.atom_type"`
+	Offsets  []int  `toml:"orientation.offsets"`
+	Axis     string `toml:"orientation.axis"`
+
+	Slabs   int `toml:"orientation.slabs"`
+	CosBins int `toml:"orientation.cos_bins"`
+
+	AtomsPerMolecule int `toml:"orientation.atoms_per_molecule"`
+
+	axis int
+
+	atoms   int
+	cols    [5]int
+	colsLen int
+
+	hstg   [][]float64
+	sumCos []float64
+	count  []float64
+	box    float64
+	nbCfg  int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Orientation structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Orientation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var orientation Orientation
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&orientation)
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation.CfgStart >= orientation.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(orientation.Offsets) != 2 || orientation.Offsets[0] < 0 ||
+		orientation.Offsets[1] < 0 || orientation.Offsets[0] == orientation.Offsets[1] {
+		return nil, errors.New("Offsets must contain two different positive offsets")
+	}
+
+	switch orientation.Axis {
+	case "x":
+		orientation.axis = 0
+	case "y":
+		orientation.axis = 1
+	case "z", "":
+		orientation.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", orientation.Axis)
+	}
+
+	if orientation.Slabs <= 0 || orientation.CosBins <= 0 {
+		return nil, errors.New("Slabs and CosBins must be strictly positive")
+	}
+
+	orientation.hstg = make([][]float64, orientation.Slabs)
+	for i := range orientation.hstg {
+		orientation.hstg[i] = make([]float64, orientation.CosBins)
+	}
+	orientation.sumCos = make([]float64, orientation.Slabs)
+	orientation.count = make([]float64, orientation.Slabs)
+
+	return &orientation, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (o *Orientation) SetOutputDir(dir string) {
+	o.FileOut = util.FileOut(o.FileOut, dir, o.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (o *Orientation) SetOutputFormat(format string) {
+	o.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (o *Orientation) SetProgress(p *util.Progress) {
+	o.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (o *Orientation) SetInput(in util.Input) {
+	o.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (o *Orientation) SetLog(log *log.Logger) {
+	o.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (o *Orientation) Start() error {
+	f, traj, err := util.OpenTrajectory(o.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(o.input.Reader(traj))
+
+	err = o.input.SkipTo(f, r, 0, o.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, mols, err := o.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	o.calc(box, mols)
+
+	for i := 1; i < (o.CfgEnd - o.CfgStart); i++ {
+		err = o.input.SkipTo(f, r, o.CfgStart+i, o.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(o.log, Type, o.CfgStart+i, o.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, mols, err := o.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		o.calc(box, mols)
+		o.progress.Update(i+1, o.CfgEnd-o.CfgStart)
+	}
+
+	out, err := util.WriteFormat(o.FileOut, o, o.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	o.write(out)
+
+	return nil
+}
+
+// calc adds the orientation of each molecule to the histograms.
+func (o *Orientation) calc(box [3]float64, mols []molecule) {
+	a, b := o.Offsets[0], o.Offsets[1]
+	for _, mol := range mols {
+		if a >= len(mol.xyz) || b >= len(mol.xyz) || mol.types[a] != o.AtomType {
+			continue
+		}
+
+		vec := util.MinImage(mol.xyz[b], mol.xyz[a], box)
+		norm := vec[0]*vec[0] + vec[1]*vec[1] + vec[2]*vec[2]
+
+		if norm == 0 {
+			continue
+		}
+		cos := vec[o.axis] / math.Sqrt(norm)
+
+		pos := mol.xyz[a][o.axis] / box[o.axis]
+		pos -= math.Floor(pos)
+		slab := int(pos * float64(o.Slabs))
+		if slab >= o.Slabs {
+			slab = o.Slabs - 1
+		}
+
+		bin := int((cos + 1.) / 2. * float64(o.CosBins))
+		if bin >= o.CosBins {
+			bin = o.CosBins - 1
+		}
+
+		o.hstg[slab][bin]++
+		o.sumCos[slab] += cos
+		o.count[slab]++
+	}
+
+	o.box += box[o.axis]
+	o.nbCfg++
+}
+
+// write writes the average of cos(θ) for each slab, and the probability
+// density of cos(θ) for each slab. The positions of the slabs use the average
+// size of the box.
+func (o *Orientation) write(w io.Writer) {
+	nbCfg := float64(o.nbCfg)
+	box := o.box / nbCfg
+	dz := box / float64(o.Slabs)
+	dcos := 2. / float64(o.CosBins)
+
+	fmt.Fprint(w, "z mean_cos_theta count\n")
+	for slab := 0; slab < o.Slabs; slab++ {
+		var mean float64
+		if o.count[slab] > 0 {
+			mean = o.sumCos[slab] / o.count[slab]
+		}
+		fmt.Fprintf(w, "%g %g %g\n", (float64(slab)+0.5)*dz, mean,
+			o.count[slab]/nbCfg)
+	}
+
+	fmt.Fprint(w, "\nz cos_theta P\n")
+	for slab := 0; slab < o.Slabs; slab++ {
+		for bin := 0; bin < o.CosBins; bin++ {
+			var p float64
+			if o.count[slab] > 0 {
+				p = o.hstg[slab][bin] / (o.count[slab] * dcos)
+			}
+			fmt.Fprintf(w, "%g %g %g\n", (float64(slab)+0.5)*dz, -1.+(float64(bin)+0.5)*dcos, p)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package orientation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newOrientation writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [orientation]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newOrientation(t *testing.T, params, traj string) *Orientation {
+	dir, err := ioutil.TempDir("", "orientation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "orientation.toml")
+	cfg := fmt.Sprintf("[orientation]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "orientation.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// configuration returns a configuration of a cubic box of length 10 containing
+// the molecules mols, made of an atom of type 1 followed by an atom of type 2.
+func configuration(step int, mols [][2][3]float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", step, 2*len(mols))
+	b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id mol type x y z\n")
+	for i, mol := range mols {
+		for j, v := range mol {
+			fmt.Fprintf(&b, "%d %d %d %g %g %g\n", 2*i+j+1, i+1, j+1, v[0], v[1], v[2])
+		}
+	}
+	return b.String()
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a molecule of the first slab
+	// oriented along z.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		traj.WriteString(configuration(i, [][2][3]float64{{{1, 1, 2}, {1, 1, 3}}}))
+	}
+
+	o := newOrientation(t, "cfg_end = 10\natom_type = \"1\"\noffsets = [0, 1]\nslabs = 2\ncos_bins = 2\n", traj.String())
+	var logs strings.Builder
+	o.SetLog(log.New(&logs, "", 0))
+	err := o.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "orientation: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(o.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "z mean_cos_theta count\n2.5 1 1\n7.5 0 0\n") {
+		t.Errorf("the box and the counts aren't averaged over the configurations read:\n%s", b)
+	}
+}
+
+func TestPeriodicBond(t *testing.T) {
+	// The bond of the molecule crosses the boundary along z: its minimum image
+	// is oriented along +z.
+	traj := configuration(0, [][2][3]float64{{{1, 1, 9.8}, {1, 1, 0.2}}})
+
+	o := newOrientation(t, "cfg_end = 1\natom_type = \"1\"\noffsets = [0, 1]\nslabs = 2\ncos_bins = 2\n", traj)
+	err := o.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(o.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "z mean_cos_theta count\n2.5 0 0\n7.5 1 1\n") {
+		t.Errorf("the bond isn't taken at its minimum image:\n%s", b)
+	}
+}
@@ -0,0 +1,132 @@
+package orientation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (o *Orientation) readCfgFirst(r *bufio.Reader) (box [3]float64, mols []molecule, err error) {
+	o.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	o.colsLen = len(fields)
+	o.cols[4] = -1
+	for k, v := range fields {
+		switch v {
+		case "x":
+			o.cols[0] = k
+		case "y":
+			o.cols[1] = k
+		case "z":
+			o.cols[2] = k
+		case "type":
+			o.cols[3] = k
+		case "mol":
+			o.cols[4] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if o.cols[4] < 0 && o.AtomsPerMolecule != 0 {
+		err = util.CheckAtomsPerMol(o.atoms, o.AtomsPerMolecule)
+		if err != nil {
+			err = fmt.Errorf("CheckAtomsPerMol: %w", err)
+			return
+		}
+		found++
+	}
+
+	if found < len(o.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, z, type, and mol")
+		return
+	}
+
+	mols, err = o.fetchMols(r)
+	if err != nil {
+		err = fmt.Errorf("fetchMols: %w", err)
+		return
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchMols to fetch the molecules.
+func (o *Orientation) readCfg(r *bufio.Reader) (box [3]float64, mols []molecule, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	mols, err = o.fetchMols(r)
+	if err != nil {
+		err = fmt.Errorf("fetchMols: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchMols fetches the coordinates and the types of the atoms and groups them
+// in molecules. A new molecule starts when the molecule identifier changes.
+func (o *Orientation) fetchMols(r *bufio.Reader) ([]molecule, error) {
+	var (
+		mols []molecule
+		mol  string
+	)
+
+	for i := 0; i < o.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != o.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), o.colsLen)
+		}
+
+		molID := util.MolID(fields, o.cols[4], i, o.AtomsPerMolecule)
+		if i == 0 || molID != mol {
+			mol = molID
+			mols = append(mols, molecule{})
+		}
+
+		var xyz [3]float64
+		for k := 0; k < 3; k++ {
+			xyz[k], _ = strconv.ParseFloat(fields[o.cols[k]], 64)
+		}
+
+		last := &mols[len(mols)-1]
+		last.xyz = append(last.xyz, xyz)
+		last.types = append(last.types, fields[o.cols[3]])
+	}
+
+	return mols, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,348 @@
+// Package pairentropy calculates the pair entropy fingerprint of each atom, a
+// local order parameter distinguishing the ordered (e.g. crystalline) regions
+// from the disordered ones (Piaggi and Parrinello, J. Chem. Phys. 147, 114112
+// (2017)).
+//
+// The local radial distribution function of the atom i is
+// gi(r) = 1/(4πρr²) Σj 1/(√(2π)σ) exp(-(r-rij)²/(2σ²)), the sum running over
+// the neighbors j of i and ρ being the number density of the selected atoms.
+// The fingerprint is si = -2πρ ∫[gi(r) ln gi(r) - gi(r) + 1]r²dr from 0 to the
+// cutoff, in units of kB. It is lower in the ordered regions.
+package pairentropy
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "pair_entropy"
+
+// frame is a configuration. header contains the lines preceding the atoms
+// (including the columns).
+type frame struct {
+	header []byte
+	fields [][]string
+	xyz    [][3]float64
+	sel    []bool
+}
+
+// PairEntropy is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the distribution of the fingerprint.
+//
+// The configurations are written into FileOut as they are read, with the
+// column s added: the fingerprint of each atom, or 0 for the atoms that don't
+// satisfy Select (all the atoms are selected if Select is empty, see
+// util.Selection). Only the selected atoms are neighbors. The neighbors are
+// searched up to Cutoff + 3 Sigma with the minimum image convention, which must
+// be lower than half the box, and the integral is calculated from 0 to Cutoff
+// with the trapezoidal rule and a step Dr (Sigma/10 by default).
+// CoordinateColumns is the set of coordinates read (util.Wrapped by default,
+// see util.CoordColumns).
+//
+// The probability density of the fingerprint over the selected atoms of every
+// configuration is written into FileOutDist with bins of width Ds (s P). Only
+// FileOutDist follows the format of the output files (see SetOutputFormat).
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd, the
+// configurations read are used and a warning is logged.
+type PairEntropy struct {
+	FileIn      string `toml:"pair_entropy.file_in"`
+	FileOut     string `toml:"pair_entropy.file_out"`
+	FileOutDist string `toml:"pair_entropy.file_out_dist"`
+
+	CfgStart int `toml:"pair_entropy.cfg_start"`
+	CfgEnd   int `toml:"pair_entropy.cfg_end"`
+
+	CoordinateColumns string `toml:"pair_entropy.coordinate_columns"`
+	Select            string `toml:"pair_entropy.select"`
+
+	Cutoff float64 `toml:"pair_entropy.cutoff"`
+	Sigma  float64 `toml:"pair_entropy.sigma"`
+	Dr     float64 `toml:"pair_entropy.dr"`
+
+	Ds float64 `toml:"pair_entropy.ds"`
+
+	sel    *util.Selection
+	coords [3]string
+	rc     float64 // cutoff of the neighbors
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	hstg  map[int]float64 // bin (floor(s/Ds)) of the distribution
+	count float64
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the PairEntropy structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*PairEntropy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pairEntropy PairEntropy
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&pairEntropy)
+	if err != nil {
+		return nil, err
+	}
+
+	if pairEntropy.CfgStart >= pairEntropy.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	pairEntropy.coords, err = util.CoordColumns(pairEntropy.CoordinateColumns, util.Wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	if pairEntropy.Select != "" {
+		pairEntropy.sel, err = util.NewSelection(pairEntropy.Select)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection: %w", err)
+		}
+	}
+
+	if pairEntropy.Cutoff <= 0 || pairEntropy.Sigma <= 0 {
+		return nil, errors.New("Cutoff and Sigma must be strictly positive")
+	}
+
+	if pairEntropy.Dr < 0 {
+		return nil, errors.New("Dr must be positive")
+	}
+
+	if pairEntropy.Dr == 0 {
+		pairEntropy.Dr = pairEntropy.Sigma / 10.
+	}
+
+	if pairEntropy.Ds <= 0 {
+		return nil, errors.New("Ds must be strictly positive")
+	}
+
+	pairEntropy.rc = pairEntropy.Cutoff + 3.*pairEntropy.Sigma
+	pairEntropy.hstg = make(map[int]float64)
+
+	return &pairEntropy, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut or
+// FileOutDist are empty, they are named after FileIn and the type of
+// calculation (see util.FileOut).
+func (p *PairEntropy) SetOutputDir(dir string) {
+	p.FileOut = util.FileOut(p.FileOut, dir, p.FileIn, Type, ".lammpstrj")
+	p.FileOutDist = util.FileOut(p.FileOutDist, dir, p.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of FileOutDist (see util.WriteFormat).
+// FileOut is always a LAMMPS trajectory.
+func (p *PairEntropy) SetOutputFormat(format string) {
+	p.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (p *PairEntropy) SetProgress(pr *util.Progress) {
+	p.progress = pr
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (p *PairEntropy) SetInput(in util.Input) {
+	p.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (p *PairEntropy) SetLog(log *log.Logger) {
+	p.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (p *PairEntropy) Start() error {
+	f, traj, err := util.OpenTrajectory(p.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(p.input.Reader(traj))
+
+	out, err := os.Create(p.FileOut)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	err = p.input.SkipTo(f, r, 0, p.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, fr, err := p.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	err = p.calc(w, box, fr)
+	if err != nil {
+		return fmt.Errorf("calc: %w", err)
+	}
+
+	for i := 1; i < (p.CfgEnd - p.CfgStart); i++ {
+		err = p.input.SkipTo(f, r, p.CfgStart+i, p.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(p.log, Type, p.CfgStart+i, p.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, fr, err := p.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		err = p.calc(w, box, fr)
+		if err != nil {
+			return fmt.Errorf("calc (step %d): %w", i, err)
+		}
+		p.progress.Update(i+1, p.CfgEnd-p.CfgStart)
+	}
+
+	dist, err := util.WriteFormat(p.FileOutDist, p, p.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer dist.Close()
+	p.write(dist)
+
+	return nil
+}
+
+// calc calculates the fingerprint of the selected atoms, adds them to the
+// distribution, and writes the configuration with the column s.
+func (p *PairEntropy) calc(w io.Writer, box [3]float64, fr frame) error {
+	for k := 0; k < 3; k++ {
+		if p.rc > box[k]/2. {
+			return fmt.Errorf("Cutoff + 3 Sigma (%g) is greater than half the box (%g)", p.rc, box[k]/2.)
+		}
+	}
+
+	var (
+		idx []int // index in the configuration of the selected atoms
+		xyz [][3]float64
+	)
+	for i, ok := range fr.sel {
+		if ok {
+			idx = append(idx, i)
+			xyz = append(xyz, fr.xyz[i])
+		}
+	}
+	rho := float64(len(xyz)) / (box[0] * box[1] * box[2])
+	cells := util.NewCellList(box, xyz, p.rc)
+
+	s := make([]float64, len(fr.xyz))
+	var dist []float64
+	for i, pos := range xyz {
+		dist = dist[:0]
+		cells.Search(pos, func(j int) {
+			if j == i {
+				return
+			}
+
+			d := util.MinImageDist2(pos, xyz[j], box)
+			if d < p.rc*p.rc {
+				dist = append(dist, math.Sqrt(d))
+			}
+		}, func(bound float64) bool {
+			return bound >= p.rc
+		})
+
+		s[idx[i]] = p.entropy(rho, dist)
+		p.hstg[int(math.Floor(s[idx[i]]/p.Ds))]++
+		p.count++
+	}
+
+	w.Write(fr.header)
+	var b []byte
+	for i, fields := range fr.fields {
+		b = b[:0]
+		for _, v := range fields {
+			b = append(b, v...)
+			b = append(b, ' ')
+		}
+		b = strconv.AppendFloat(b, s[i], 'g', -1, 64)
+		b = append(b, '\n')
+		w.Write(b)
+	}
+
+	return nil
+}
+
+// entropy returns the fingerprint of an atom whose neighbors are at the
+// distances dist.
+func (p *PairEntropy) entropy(rho float64, dist []float64) float64 {
+	steps := int(math.Round(p.Cutoff / p.Dr))
+	norm := 1. / (math.Sqrt(2.*math.Pi) * p.Sigma * 4. * math.Pi * rho)
+
+	var intg float64
+	for i := 1; i <= steps; i++ { // the integrand is 0 at r = 0
+		r := float64(i) * p.Dr
+
+		var g float64
+		for _, d := range dist {
+			g += math.Exp(-util.Pow(r-d, 2) / (2. * p.Sigma * p.Sigma))
+		}
+		g *= norm / (r * r)
+
+		f := 1. - g
+		if g > 0 {
+			f += g * math.Log(g)
+		}
+		f *= r * r
+
+		if i == steps {
+			f /= 2.
+		}
+		intg += f
+	}
+
+	return -2. * math.Pi * rho * intg * p.Dr
+}
+
+// write writes the probability density of the fingerprint. s is the middle of
+// the bins.
+func (p *PairEntropy) write(w io.Writer) {
+	bins := make([]int, 0, len(p.hstg))
+	for k := range p.hstg {
+		bins = append(bins, k)
+	}
+	sort.Ints(bins)
+
+	fmt.Fprint(w, "s P\n")
+	if len(bins) == 0 {
+		return
+	}
+
+	for k := bins[0]; k <= bins[len(bins)-1]; k++ {
+		fmt.Fprintf(w, "%g %g\n", (float64(k)+0.5)*p.Ds, p.hstg[k]/(p.count*p.Ds))
+	}
+}
@@ -0,0 +1,118 @@
+package pairentropy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// newPairEntropy writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [pair_entropy]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newPairEntropy(t *testing.T, params, traj string) *PairEntropy {
+	dir, err := ioutil.TempDir("", "pairentropy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "pairentropy.toml")
+	cfg := fmt.Sprintf("[pair_entropy]\nfile_in = %q\nfile_out = %q\nfile_out_dist = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "pairentropy.lammpstrj"),
+		filepath.Join(dir, "pairentropy.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of 2 atoms.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\nITEM: ATOMS id type x y z\n")
+		traj.WriteString("1 1 5 5 5\n2 1 6 5 5\n")
+	}
+
+	p := newPairEntropy(t, "cfg_end = 10\ncutoff = 2.0\nsigma = 0.1\nds = 1000.0\n", traj.String())
+	var logs strings.Builder
+	p.SetLog(log.New(&logs, "", 0))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "pair_entropy: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(p.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "ITEM: ATOMS id type x y z s\n"); n != 3 {
+		t.Errorf("%d configurations, want 3", n)
+	}
+
+	if p.count != 6 {
+		t.Errorf("%g fingerprints in the distribution, want 6", p.count)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	traj := "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\nITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\n" +
+		"ITEM: ATOMS id type x y z\n1 1 5 5 5\n2 1 6 5 5\n"
+
+	p := newPairEntropy(t, "cfg_end = 1\ncutoff = 2.0\nsigma = 0.1\nds = 1000.0\n", traj)
+	p.SetOutputFormat(util.FormatJSON)
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The distribution is written in JSON and the trajectory is unchanged.
+	b, err := ioutil.ReadFile(p.FileOutDist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dist struct {
+		Tables []struct {
+			Columns []string
+			Rows    []map[string]float64
+		}
+	}
+	err = json.Unmarshal(b, &dist)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v\n%s", err, b)
+	}
+	if len(dist.Tables) != 1 || strings.Join(dist.Tables[0].Columns, " ") != "s P" || len(dist.Tables[0].Rows) != 1 {
+		t.Errorf("wrong distribution:\n%s", b)
+	}
+
+	b, err = ioutil.ReadFile(p.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "ITEM: TIMESTEP\n0\n") {
+		t.Errorf("the trajectory isn't a LAMMPS trajectory:\n%s", b)
+	}
+}
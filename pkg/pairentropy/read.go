@@ -0,0 +1,124 @@
+package pairentropy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (p *PairEntropy) readCfgFirst(r *bufio.Reader) (box [3]float64, fr frame, err error) {
+	var header bytes.Buffer
+	p.atoms, box, err = util.Header(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	p.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case p.coords[0]:
+			p.cols[0] = k
+		case p.coords[1]:
+			p.cols[1] = k
+		case p.coords[2]:
+			p.cols[2] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(p.cols) {
+		err = fmt.Errorf("cannot find the columns %s, %s, and %s", p.coords[0], p.coords[1], p.coords[2])
+		return
+	}
+
+	err = p.sel.Columns(fields)
+	if err != nil {
+		err = fmt.Errorf("Select: %w", err)
+		return
+	}
+
+	fr, err = p.fetchFrame(r, header.Bytes(), b)
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchFrame to fetch the atoms.
+func (p *PairEntropy) readCfg(r *bufio.Reader) (box [3]float64, fr frame, err error) {
+	var header bytes.Buffer
+	box, err = util.HeaderWOutAtoms(r, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+
+	fr, err = p.fetchFrame(r, header.Bytes(), b)
+	if err != nil {
+		err = fmt.Errorf("fetchFrame: %w", err)
+	}
+	return
+}
+
+// fetchFrame fetches the atoms. header contains the lines read by util.Header
+// or util.HeaderWOutAtoms and cols the line of the columns, to which s is
+// added.
+func (p *PairEntropy) fetchFrame(r *bufio.Reader, header, cols []byte) (fr frame, err error) {
+	fr.header = append(header, util.Line(cols)...)
+	fr.header = append(fr.header, " s\n"...)
+
+	fr.fields = make([][]string, p.atoms)
+	fr.xyz = make([][3]float64, p.atoms)
+	fr.sel = make([]bool, p.atoms)
+	for i := 0; i < p.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != p.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), p.colsLen)
+			return
+		}
+
+		fr.sel[i], err = p.sel.Match(fields)
+		if err != nil {
+			return
+		}
+
+		for k := 0; k < 3; k++ {
+			fr.xyz[i][k], _ = strconv.ParseFloat(fields[p.cols[k]], 64)
+		}
+		fr.fields[i] = fields
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
+	return b
+}
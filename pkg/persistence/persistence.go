@@ -0,0 +1,294 @@
+// Package persistence calculates the persistence length of polymer chains from
+// the orientational correlation of their bonds along the backbone.
+//
+// The bonds of a chain are the vectors bi = r(i+1) - r(i) between its
+// consecutive backbone atoms. The correlation <cos θ(n)> = <bi·b(i+n) / (|bi|
+// |b(i+n)|)> is averaged over the bonds i, the chains, and the configurations.
+// For a worm-like chain, <cos θ(n)> = exp(-n lb / lp), lb being the average
+// bond length and lp the persistence length. ln <cos θ(n)> is therefore fitted
+// by a straight line going through the origin, whose slope is -lb/lp.
+package persistence
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "persistence_length"
+
+// Persistence is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the accumulated correlations.
+//
+// The backbone of a chain is made of its atoms whose type is in Atoms (all the
+// atoms if empty), in the order of the trajectory. The chains are the
+// molecules (mol column): a new chain starts when the molecule identifier
+// changes. If the trajectory has no mol column, AtomsPerMolecule is used to
+// group the atoms in chains (see util.MolID). CoordinateColumns is the set of
+// coordinates read (util.Unwrapped by default, see util.CoordColumns); the
+// bonds follow the minimum image convention, so the wrapped coordinates can be
+// used as well. NMax is the largest separation along the backbone, in bonds
+// (the number of bonds of the longest chain of the first configuration minus
+// one if 0). The fit is performed on the separations from FitRange[0] to
+// FitRange[1]; by default, it stops before the first separation whose
+// correlation isn't strictly positive. CfgStart must be lower than CfgEnd. If
+// the trajectory ends before CfgEnd, the configurations read are used and a
+// warning is logged.
+type Persistence struct {
+	FileIn  string `toml:"persistence_length.file_in"`
+	FileOut string `toml:"persistence_length.file_out"`
+
+	CfgStart int `toml:"persistence_length.cfg_start"`
+	CfgEnd   int `toml:"persistence_length.cfg_end"`
+
+	CoordinateColumns string   `toml:"persistence_length.coordinate_columns"`
+	Atoms             []string `toml:"persistence_length.atoms"`
+
+	AtomsPerMolecule int `toml:"persistence_length.atoms_per_molecule"`
+
+	NMax     int   `toml:"persistence_length.n_max"`
+	FitRange []int `toml:"persistence_length.fit_range"`
+
+	coords [3]string
+	types  map[string]bool
+
+	cos   []float64 // sum of cos θ(n)
+	count []float64 // number of pairs of bonds at each separation
+	bond  float64   // sum of the bond lengths
+	bonds float64   // number of bonds
+
+	atoms   int
+	cols    [5]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Persistence structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Persistence, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var persistence Persistence
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&persistence)
+	if err != nil {
+		return nil, err
+	}
+
+	if persistence.CfgStart >= persistence.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	persistence.coords, err = util.CoordColumns(persistence.CoordinateColumns, util.Unwrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	if persistence.NMax < 0 {
+		return nil, errors.New("NMax must be positive")
+	}
+
+	switch len(persistence.FitRange) {
+	case 0, 2:
+	default:
+		return nil, errors.New("FitRange must contain two separations")
+	}
+
+	if len(persistence.FitRange) == 2 && (persistence.FitRange[0] < 0 ||
+		persistence.FitRange[0] >= persistence.FitRange[1]) {
+		return nil, errors.New("FitRange must contain two positive and increasing separations")
+	}
+
+	if len(persistence.Atoms) > 0 {
+		persistence.types = make(map[string]bool, len(persistence.Atoms))
+		for _, v := range persistence.Atoms {
+			persistence.types[v] = true
+		}
+	}
+
+	return &persistence, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (p *Persistence) SetOutputDir(dir string) {
+	p.FileOut = util.FileOut(p.FileOut, dir, p.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (p *Persistence) SetOutputFormat(format string) {
+	p.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (p *Persistence) SetProgress(pr *util.Progress) {
+	p.progress = pr
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (p *Persistence) SetInput(in util.Input) {
+	p.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (p *Persistence) SetLog(log *log.Logger) {
+	p.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (p *Persistence) Start() error {
+	f, traj, err := util.OpenTrajectory(p.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(p.input.Reader(traj))
+
+	err = p.input.SkipTo(f, r, 0, p.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, chains, err := p.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	if p.NMax == 0 {
+		for _, v := range chains {
+			if len(v)-2 > p.NMax {
+				p.NMax = len(v) - 2
+			}
+		}
+	}
+	p.cos = make([]float64, p.NMax+1)
+	p.count = make([]float64, p.NMax+1)
+	p.calc(box, chains)
+
+	for i := 1; i < (p.CfgEnd - p.CfgStart); i++ {
+		err = p.input.SkipTo(f, r, p.CfgStart+i, p.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(p.log, Type, p.CfgStart+i, p.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, chains, err := p.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		p.calc(box, chains)
+		p.progress.Update(i+1, p.CfgEnd-p.CfgStart)
+	}
+
+	if p.bonds == 0 {
+		return errors.New("no chain has at least two backbone atoms")
+	}
+
+	out, err := util.WriteFormat(p.FileOut, p, p.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+
+	err = p.write(out)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// calc builds the unit bond vectors of each chain and adds the cosines of the
+// angles between the bonds separated by n bonds, n going from 0 to NMax.
+func (p *Persistence) calc(box [3]float64, chains [][][3]float64) {
+	for _, chain := range chains {
+		if len(chain) < 2 {
+			continue
+		}
+
+		u := make([][3]float64, len(chain)-1)
+		for i := range u {
+			b := util.MinImage(chain[i+1], chain[i], box)
+			norm := math.Sqrt(b[0]*b[0] + b[1]*b[1] + b[2]*b[2])
+			for k := 0; k < 3; k++ {
+				u[i][k] = b[k] / norm
+			}
+			p.bond += norm
+			p.bonds++
+		}
+
+		for i := range u {
+			for n := 0; n <= p.NMax && i+n < len(u); n++ {
+				p.cos[n] += u[i][0]*u[i+n][0] + u[i][1]*u[i+n][1] + u[i][2]*u[i+n][2]
+				p.count[n]++
+			}
+		}
+	}
+}
+
+// write writes <cos θ(n)> for each separation n (n cos_theta), then the
+// average bond length, the separations of the fit, and the persistence length
+// in bonds and in the units of the coordinates.
+func (p *Persistence) write(w io.Writer) error {
+	cos := make([]float64, len(p.cos))
+	fmt.Fprint(w, "n cos_theta\n")
+	for n := range p.cos {
+		if p.count[n] == 0 {
+			break
+		}
+		cos[n] = p.cos[n] / p.count[n]
+		fmt.Fprintf(w, "%d %g\n", n, cos[n])
+	}
+
+	fit := p.FitRange
+	if len(fit) == 0 {
+		fit = []int{0, -1}
+		for n, v := range cos {
+			if v <= 0 || p.count[n] == 0 {
+				break
+			}
+			fit[1] = n
+		}
+	}
+
+	var sxx, sxy float64
+	for n := fit[0]; n <= fit[1]; n++ {
+		if n >= len(cos) || p.count[n] == 0 || cos[n] <= 0 {
+			return fmt.Errorf("the correlation at the separation %d of FitRange isn't strictly positive", n)
+		}
+		sxx += float64(n * n)
+		sxy += float64(n) * math.Log(cos[n])
+	}
+
+	if sxx == 0 || sxy == 0 {
+		return errors.New("not enough separations to fit the correlation")
+	}
+
+	lb := p.bond / p.bonds
+	np := -sxx / sxy
+	fmt.Fprint(w, "\nmean_bond fit_start fit_end persistence_bonds persistence_length\n")
+	fmt.Fprintf(w, "%g %d %d %g %g\n", lb, fit[0], fit[1], np, np*lb)
+	return nil
+}
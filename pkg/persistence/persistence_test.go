@@ -0,0 +1,73 @@
+package persistence
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPersistence writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [persistence_length]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newPersistence(t *testing.T, params, traj string) *Persistence {
+	dir, err := ioutil.TempDir("", "persistence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "persistence.toml")
+	cfg := fmt.Sprintf("[persistence_length]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "persistence.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a chain of 3 atoms whose bonds
+	// make an angle of cosine 0.6.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n3\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type mol xu yu zu\n")
+		traj.WriteString("1 1 1 1 1 1\n2 1 1 2 1 1\n3 1 1 2.6 1.8 1\n")
+	}
+
+	p := newPersistence(t, "cfg_end = 10\n", traj.String())
+	var logs strings.Builder
+	p.SetLog(log.New(&logs, "", 0))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "persistence_length: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(p.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if !strings.Contains(out, "n cos_theta\n0 1\n1 0.6") {
+		t.Errorf("wrong correlations:\n%s", out)
+	}
+}
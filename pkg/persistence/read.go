@@ -0,0 +1,131 @@
+package persistence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (p *Persistence) readCfgFirst(r *bufio.Reader) (box [3]float64, chains [][][3]float64, err error) {
+	p.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	p.colsLen = len(fields)
+	p.cols[4] = -1
+	for k, v := range fields {
+		switch v {
+		case p.coords[0]:
+			p.cols[0] = k
+		case p.coords[1]:
+			p.cols[1] = k
+		case p.coords[2]:
+			p.cols[2] = k
+		case "type":
+			p.cols[3] = k
+		case "mol":
+			p.cols[4] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if p.cols[4] < 0 && p.AtomsPerMolecule != 0 {
+		err = util.CheckAtomsPerMol(p.atoms, p.AtomsPerMolecule)
+		if err != nil {
+			err = fmt.Errorf("CheckAtomsPerMol: %w", err)
+			return
+		}
+		found++
+	}
+
+	if found < len(p.cols) {
+		err = fmt.Errorf("cannot find the columns %s, %s, %s, type, and mol", p.coords[0], p.coords[1], p.coords[2])
+		return
+	}
+
+	chains, err = p.fetchChains(r)
+	if err != nil {
+		err = fmt.Errorf("fetchChains: %w", err)
+	}
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchChains to fetch the backbones.
+func (p *Persistence) readCfg(r *bufio.Reader) (box [3]float64, chains [][][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	chains, err = p.fetchChains(r)
+	if err != nil {
+		err = fmt.Errorf("fetchChains: %w", err)
+	}
+	return
+}
+
+// fetchChains fetches the coordinates of the backbone atoms and groups them in
+// chains. A new chain starts when the molecule identifier changes.
+func (p *Persistence) fetchChains(r *bufio.Reader) ([][][3]float64, error) {
+	var (
+		chains [][][3]float64
+		mol    string
+	)
+
+	for i := 0; i < p.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != p.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), p.colsLen)
+		}
+
+		molID := util.MolID(fields, p.cols[4], i, p.AtomsPerMolecule)
+		if i == 0 || molID != mol {
+			mol = molID
+			chains = append(chains, nil)
+		}
+
+		if p.types != nil && !p.types[fields[p.cols[3]]] {
+			continue
+		}
+
+		var xyz [3]float64
+		for k := 0; k < 3; k++ {
+			xyz[k], _ = strconv.ParseFloat(fields[p.cols[k]], 64)
+		}
+
+		last := len(chains) - 1
+		chains[last] = append(chains[last], xyz)
+	}
+
+	return chains, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
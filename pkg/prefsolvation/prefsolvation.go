@@ -0,0 +1,339 @@
+// Package prefsolvation calculates the preferential solvation of a solute in a
+// mixture of solvents as a function of the distance to the solute.
+//
+// For each solvent type j, Nj(r) is the average number of atoms of type j
+// within r of an atom of the solute (the running coordination number) and
+// ρj the bulk density of j. The excess of j is Nj(r) - ρj 4/3πr³, which
+// tends to ρj Gj, Gj being the Kirkwood-Buff integral between the solute and
+// j. The preferential solvation parameter of j is δj(r) = xj(r) - xj, with
+// xj(r) = Nj(r) / Σ Nk(r) the local mole fraction of j and xj = ρj / Σ ρk its
+// bulk mole fraction. δj is positive if j is preferred over the other
+// solvents. The volume of the solute is not removed from 4/3πr³.
+//
+// The local mole fraction of j in the shell between r and r+dr, nj(r) / Σ
+// nk(r), nj(r) being the number of atoms of type j in the shell, can also be
+// written. Unlike xj(r), it only depends on the neighbors at the distance r and
+// tends to the bulk mole fraction xj at large r.
+package prefsolvation
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "preferential_solvation"
+
+// XYZ is a type that represents the coordinates for each atom.
+type XYZ map[string][][3]float64
+
+// PrefSolvation is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the histograms.
+// The atoms of type Solute are the centers and the atoms whose type is in
+// Solvents are counted up to RMax with bins of width Dr. BulkDensity contains
+// the number density of some solvent types; the average density of the box is
+// used for the others (see gr.GR). If LocalMoleFraction is true, the local mole
+// fraction of each solvent type in each bin is written after the preferential
+// solvation parameters. CfgStart must be lower than CfgEnd. If the trajectory
+// ends before CfgEnd, the configurations read are used and a warning is logged.
+type PrefSolvation struct {
+	FileIn  string `toml:"preferential_solvation.file_in"`
+	FileOut string `toml:"preferential_solvation.file_out"`
+
+	CfgStart int `toml:"preferential_solvation.cfg_start"`
+	CfgEnd   int `toml:"preferential_solvation.cfg_end"`
+
+	Solute   string   `toml:"preferential_solvation.solute"`
+	Solvents []string `toml:"preferential_solvation.solvents"`
+
+	RMax float64 `toml:"preferential_solvation.rmax"`
+	Dr   float64 `toml:"preferential_solvation.dr"`
+
+	BulkDensity map[string]float64 `toml:"preferential_solvation.bulk_density"`
+
+	LocalMoleFraction bool `toml:"preferential_solvation.local_mole_fraction"`
+
+	bins  int
+	rmax2 float64
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	hstg   map[string][]float64
+	count  map[string]float64
+	solute float64
+	vol    float64
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the PrefSolvation structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*PrefSolvation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prefSolvation PrefSolvation
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&prefSolvation)
+	if err != nil {
+		return nil, err
+	}
+
+	if prefSolvation.CfgStart >= prefSolvation.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(prefSolvation.Solvents) == 0 {
+		return nil, errors.New("no solvent type selected")
+	}
+
+	for _, v := range prefSolvation.Solvents {
+		if v == prefSolvation.Solute {
+			return nil, fmt.Errorf("atom type `%s` is both the solute and a solvent", v)
+		}
+	}
+
+	for typ, rho := range prefSolvation.BulkDensity {
+		if rho <= 0 {
+			return nil, fmt.Errorf("bulk density of atom type `%s` must be strictly positive", typ)
+		}
+	}
+
+	if prefSolvation.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	prefSolvation.bins = int(prefSolvation.RMax / prefSolvation.Dr)
+	if prefSolvation.bins <= 1 {
+		return nil, errors.New("the number of bins must be greater than 1")
+	}
+	prefSolvation.rmax2 = util.Pow(prefSolvation.RMax, 2)
+
+	prefSolvation.hstg = make(map[string][]float64, len(prefSolvation.Solvents))
+	prefSolvation.count = make(map[string]float64, len(prefSolvation.Solvents))
+	for _, v := range prefSolvation.Solvents {
+		prefSolvation.hstg[v] = make([]float64, prefSolvation.bins)
+	}
+
+	return &prefSolvation, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (p *PrefSolvation) SetOutputDir(dir string) {
+	p.FileOut = util.FileOut(p.FileOut, dir, p.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (p *PrefSolvation) SetOutputFormat(format string) {
+	p.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (p *PrefSolvation) SetProgress(pr *util.Progress) {
+	p.progress = pr
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (p *PrefSolvation) SetInput(in util.Input) {
+	p.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (p *PrefSolvation) SetLog(log *log.Logger) {
+	p.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (p *PrefSolvation) Start() error {
+	f, traj, err := util.OpenTrajectory(p.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(p.input.Reader(traj))
+
+	err = p.input.SkipTo(f, r, 0, p.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := p.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	p.calc(box, xyz)
+
+	for i := 1; i < (p.CfgEnd - p.CfgStart); i++ {
+		err = p.input.SkipTo(f, r, p.CfgStart+i, p.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(p.log, Type, p.CfgStart+i, p.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := p.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		p.calc(box, xyz)
+		p.progress.Update(i+1, p.CfgEnd-p.CfgStart)
+	}
+
+	if p.solute == 0 {
+		return fmt.Errorf("no atom of type `%s`", p.Solute)
+	}
+
+	out, err := util.WriteFormat(p.FileOut, p, p.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	p.write(out)
+	if p.LocalMoleFraction {
+		p.writeLocal(out)
+	}
+
+	return nil
+}
+
+// calc adds the distances between the atoms of the solute and the atoms of the
+// solvents to the histograms.
+func (p *PrefSolvation) calc(box [3]float64, xyz XYZ) {
+	for _, xyzAt1 := range xyz[p.Solute] {
+		for _, solvent := range p.Solvents {
+			for _, xyzAt2 := range xyz[solvent] {
+				dist := util.MinImageDist2(xyzAt1, xyzAt2, box)
+
+				if dist < p.rmax2 {
+					p.hstg[solvent][int(math.Sqrt(dist)/p.Dr)]++
+				}
+			}
+		}
+	}
+
+	for _, solvent := range p.Solvents {
+		p.count[solvent] += float64(len(xyz[solvent]))
+	}
+	p.solute += float64(len(xyz[p.Solute]))
+	p.vol += box[0] * box[1] * box[2]
+}
+
+// bulk returns the bulk density of each solvent type and their sum.
+func (p *PrefSolvation) bulk() (rho map[string]float64, rhoTot float64) {
+	rho = make(map[string]float64, len(p.Solvents))
+	for _, v := range p.Solvents {
+		rho[v] = p.count[v] / p.vol
+		if bulk, ok := p.BulkDensity[v]; ok {
+			rho[v] = bulk
+		}
+		rhoTot += rho[v]
+	}
+	return
+}
+
+// write writes the excess of each solvent type and its preferential solvation
+// parameter as a function of the distance. r is the upper bound of the bins.
+func (p *PrefSolvation) write(w io.Writer) {
+	rho, rhoTot := p.bulk()
+
+	fmt.Fprint(w, "r")
+	for _, v := range p.Solvents {
+		fmt.Fprintf(w, " excess(%s)", v)
+	}
+	for _, v := range p.Solvents {
+		fmt.Fprintf(w, " delta(%s)", v)
+	}
+	fmt.Fprint(w, "\n")
+
+	n := make(map[string]float64, len(p.Solvents))
+	for i := 0; i < p.bins; i++ {
+		r := float64(i+1) * p.Dr
+		vol := 4. / 3. * math.Pi * util.Pow(r, 3)
+
+		var nTot float64
+		for _, v := range p.Solvents {
+			n[v] += p.hstg[v][i] / p.solute
+			nTot += n[v]
+		}
+
+		fmt.Fprint(w, r)
+		for _, v := range p.Solvents {
+			fmt.Fprint(w, " ", n[v]-rho[v]*vol)
+		}
+		for _, v := range p.Solvents {
+			var delta float64
+			if nTot > 0 && rhoTot > 0 {
+				delta = n[v]/nTot - rho[v]/rhoTot
+			}
+			fmt.Fprint(w, " ", delta)
+		}
+		fmt.Fprint(w, "\n")
+	}
+}
+
+// writeLocal writes the local mole fraction of each solvent type in each bin
+// and their bulk mole fraction (see bulk). r is the middle of the bins. The
+// mole fractions of an empty bin are 0.
+func (p *PrefSolvation) writeLocal(w io.Writer) {
+	fmt.Fprint(w, "\nr")
+	for _, v := range p.Solvents {
+		fmt.Fprintf(w, " x(%s)", v)
+	}
+	fmt.Fprint(w, "\n")
+
+	for i := 0; i < p.bins; i++ {
+		var nTot float64
+		for _, v := range p.Solvents {
+			nTot += p.hstg[v][i]
+		}
+
+		fmt.Fprint(w, (float64(i)+0.5)*p.Dr)
+		for _, v := range p.Solvents {
+			var x float64
+			if nTot > 0 {
+				x = p.hstg[v][i] / nTot
+			}
+			fmt.Fprint(w, " ", x)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	rho, rhoTot := p.bulk()
+	fmt.Fprint(w, "\n")
+	for k, v := range p.Solvents {
+		if k > 0 {
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprintf(w, "x_bulk(%s)", v)
+	}
+	fmt.Fprint(w, "\n")
+	for k, v := range p.Solvents {
+		if k > 0 {
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprint(w, rho[v]/rhoTot)
+	}
+	fmt.Fprint(w, "\n")
+}
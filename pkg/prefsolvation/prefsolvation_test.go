@@ -0,0 +1,71 @@
+package prefsolvation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPrefSolvation writes the trajectory traj and the configuration file made
+// of the parameters params (without the table [preferential_solvation]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newPrefSolvation(t *testing.T, params, traj string) *PrefSolvation {
+	dir, err := ioutil.TempDir("", "prefsolvation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "prefsolvation.toml")
+	cfg := fmt.Sprintf("[preferential_solvation]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "prefsolvation.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a solute and a solvent atom 1.5
+	// apart.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		traj.WriteString("1 1 5 5 5\n2 2 6.5 5 5\n")
+	}
+
+	p := newPrefSolvation(t, "cfg_end = 10\nsolute = \"1\"\nsolvents = [\"2\"]\nrmax = 2.0\ndr = 1.0\n", traj.String())
+	var logs strings.Builder
+	p.SetLog(log.New(&logs, "", 0))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "preferential_solvation: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	if p.solute != 3 || p.count["2"] != 3 || p.vol != 3000 {
+		t.Errorf("%g solutes, %g solvents, and a volume of %g, want 3, 3, and 3000", p.solute, p.count["2"], p.vol)
+	}
+	if h := p.hstg["2"]; len(h) != 2 || h[0] != 0 || h[1] != 3 {
+		t.Errorf("histogram %v, want [0 3]", h)
+	}
+}
@@ -0,0 +1,114 @@
+package prefsolvation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (p *PrefSolvation) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	p.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	p.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			p.cols[0] = k
+		case "y":
+			p.cols[1] = k
+		case "z":
+			p.cols[2] = k
+		case "type":
+			p.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(p.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = p.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (p *PrefSolvation) readCfg(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = p.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms of type Solute and Solvents.
+func (p *PrefSolvation) fetchXYZ(r *bufio.Reader) (XYZ, error) {
+	xyz := XYZ{p.Solute: nil}
+	for _, v := range p.Solvents {
+		xyz[v] = nil
+	}
+	for i := 0; i < p.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != p.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), p.colsLen)
+		}
+
+		typ := fields[p.cols[3]]
+		xyzTyp, ok := xyz[typ]
+		if !ok {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[p.cols[k]], 64)
+		}
+
+		xyz[typ] = append(xyzTyp, xyzTmp)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
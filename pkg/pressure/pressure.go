@@ -0,0 +1,215 @@
+// Package pressure calculates the pressure tensor of a system from the stress
+// of its atoms.
+//
+// The stress of each atom is read from six columns of the trajectory, e.g. the
+// output of the stress/atom compute of LAMMPS. This compute gives the negative
+// of the pressure tensor of the atom multiplied by its volume. The pressure
+// tensor of the selected atoms is therefore Pab = -Σ sab / V, V being the
+// volume of the box, and the pressure is P = (Pxx + Pyy + Pzz) / 3. The
+// pressure has the units of the stress divided by the volume (atm with the
+// real units of LAMMPS). It is the pressure of the whole system only if all the
+// atoms are selected and the stress/atom compute includes every contribution.
+package pressure
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "pressure"
+
+// DefaultColumns are the default columns of the stress (xx, yy, zz, xy, xz,
+// and yz), as written by a dump of the compute stress/atom named stress.
+var DefaultColumns = []string{"c_stress[1]", "c_stress[2]", "c_stress[3]",
+	"c_stress[4]", "c_stress[5]", "c_stress[6]"}
+
+// Pressure is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the accumulated tensor.
+// Columns contains the names of the six columns of the stress in the order xx,
+// yy, zz, xy, xz, and yz (DefaultColumns if empty). Only the atoms whose type
+// is in Atoms are summed (all the atoms if empty). CfgStart must be lower than
+// CfgEnd. If the trajectory ends before CfgEnd, the time averages are over the
+// configurations read and a warning is logged.
+type Pressure struct {
+	FileIn  string `toml:"pressure.file_in"`
+	FileOut string `toml:"pressure.file_out"`
+
+	CfgStart int `toml:"pressure.cfg_start"`
+	CfgEnd   int `toml:"pressure.cfg_end"`
+
+	Columns []string `toml:"pressure.columns"`
+	Atoms   []string `toml:"pressure.atoms"`
+
+	Dt float64 `toml:"pressure.dt"`
+
+	types map[string]bool
+	sum   [7]float64
+	nbCfg int
+
+	atoms   int
+	cols    [6]int
+	colType int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Pressure structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Pressure, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var pressure Pressure
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&pressure)
+	if err != nil {
+		return nil, err
+	}
+
+	if pressure.CfgStart >= pressure.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(pressure.Columns) == 0 {
+		pressure.Columns = DefaultColumns
+	}
+
+	if len(pressure.Columns) != 6 {
+		return nil, fmt.Errorf("length of Columns is not equal to 6 (got %d)", len(pressure.Columns))
+	}
+
+	if len(pressure.Atoms) > 0 {
+		pressure.types = make(map[string]bool, len(pressure.Atoms))
+		for _, v := range pressure.Atoms {
+			pressure.types[v] = true
+		}
+	}
+
+	return &pressure, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (p *Pressure) SetOutputDir(dir string) {
+	p.FileOut = util.FileOut(p.FileOut, dir, p.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (p *Pressure) SetOutputFormat(format string) {
+	p.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (p *Pressure) SetProgress(pr *util.Progress) {
+	p.progress = pr
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (p *Pressure) SetInput(in util.Input) {
+	p.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (p *Pressure) SetLog(log *log.Logger) {
+	p.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (p *Pressure) Start() error {
+	f, traj, err := util.OpenTrajectory(p.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(p.input.Reader(traj))
+
+	out, err := util.WriteFormat(p.FileOut, p, p.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	out.WriteString("cfg t Pxx Pyy Pzz Pxy Pxz Pyz P\n")
+
+	err = p.input.SkipTo(f, r, 0, p.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, stress, err := p.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	p.calc(out, 0, box, stress)
+
+	for i := 1; i < (p.CfgEnd - p.CfgStart); i++ {
+		err = p.input.SkipTo(f, r, p.CfgStart+i, p.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(p.log, Type, p.CfgStart+i, p.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, stress, err := p.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		p.calc(out, i, box, stress)
+		p.progress.Update(i+1, p.CfgEnd-p.CfgStart)
+	}
+
+	p.write(out)
+	return nil
+}
+
+// calc calculates the pressure tensor and the pressure of a configuration and
+// writes them into a file.
+func (p *Pressure) calc(w io.Writer, cfg int, box [3]float64, stress [6]float64) {
+	vol := box[0] * box[1] * box[2]
+
+	var tensor [7]float64
+	for k := 0; k < 6; k++ {
+		tensor[k] = -stress[k] / vol
+	}
+	tensor[6] = (tensor[0] + tensor[1] + tensor[2]) / 3.
+
+	fmt.Fprintf(w, "%d %g", (cfg + p.CfgStart), (float64(cfg+p.CfgStart) * p.Dt))
+	for k, v := range tensor {
+		fmt.Fprintf(w, " %g", v)
+		p.sum[k] += v
+	}
+	fmt.Fprint(w, "\n")
+	p.nbCfg++
+}
+
+// write writes the time averages of the pressure tensor and of the pressure.
+func (p *Pressure) write(w io.Writer) {
+	fmt.Fprint(w, "\nmean_Pxx mean_Pyy mean_Pzz mean_Pxy mean_Pxz mean_Pyz mean_P\n")
+	nbCfg := float64(p.nbCfg)
+	for k, v := range p.sum {
+		if k > 0 {
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprintf(w, "%g", v/nbCfg)
+	}
+	fmt.Fprint(w, "\n")
+}
@@ -0,0 +1,75 @@
+package pressure
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPressure writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [pressure]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newPressure(t *testing.T, params, traj string) *Pressure {
+	dir, err := ioutil.TempDir("", "pressure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "pressure.toml")
+	cfg := fmt.Sprintf("[pressure]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "pressure.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a box of volume 1000 whose
+	// pressure tensor is (i+1) times the identity.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\n")
+		traj.WriteString("ITEM: ATOMS id type c_stress[1] c_stress[2] c_stress[3] c_stress[4] c_stress[5] c_stress[6]\n")
+		s := -1000 * float64(i+1)
+		fmt.Fprintf(&traj, "1 1 %g %g %g 0 0 0\n", s, s, s)
+	}
+
+	p := newPressure(t, "cfg_end = 10\ndt = 1.0\n", traj.String())
+	var logs strings.Builder
+	p.SetLog(log.New(&logs, "", 0))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "pressure: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(p.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if mean := "\nmean_Pxx mean_Pyy mean_Pzz mean_Pxy mean_Pxz mean_Pyz mean_P\n2 2 2 0 0 0 2\n"; !strings.Contains(out, mean) {
+		t.Errorf("the means aren't over the 3 configurations read:\n%s", out)
+	}
+}
@@ -0,0 +1,120 @@
+package pressure
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (p *Pressure) readCfgFirst(r *bufio.Reader) (box [3]float64, stress [6]float64, err error) {
+	p.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	p.colsLen = len(fields)
+	p.colType = -1
+	for k := range p.cols {
+		p.cols[k] = -1
+	}
+
+	for k, v := range fields {
+		if v == "type" {
+			p.colType = k
+		}
+
+		for c, name := range p.Columns {
+			if v == name {
+				p.cols[c] = k
+			}
+		}
+	}
+
+	for c, col := range p.cols {
+		if col < 0 {
+			err = fmt.Errorf("cannot find the column %s", p.Columns[c])
+			return
+		}
+	}
+
+	if p.types != nil && p.colType < 0 {
+		err = fmt.Errorf("cannot find the column type")
+		return
+	}
+
+	stress, err = p.fetchStress(r)
+	if err != nil {
+		err = fmt.Errorf("fetchStress: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchStress to sum the stress of the atoms.
+func (p *Pressure) readCfg(r *bufio.Reader) (box [3]float64, stress [6]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	stress, err = p.fetchStress(r)
+	if err != nil {
+		err = fmt.Errorf("fetchStress: %w", err)
+	}
+
+	return
+}
+
+// fetchStress returns the sum of the six stress components of the atoms whose
+// type is in Atoms (all the atoms if Atoms is empty).
+func (p *Pressure) fetchStress(r *bufio.Reader) (stress [6]float64, err error) {
+	for i := 0; i < p.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != p.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), p.colsLen)
+			return
+		}
+
+		if p.types != nil && !p.types[fields[p.colType]] {
+			continue
+		}
+
+		for c, col := range p.cols {
+			var s float64
+			s, err = strconv.ParseFloat(fields[col], 64)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", p.Columns[c], err)
+				return
+			}
+			stress[c] += s
+		}
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"os"
+	"runtime"
 
 	"github.com/kpotier/molsolvent/pkg/util"
 
@@ -21,7 +23,37 @@ var Type = "radius_gyration"
 // a TOML configuration file. This structure can be instanced through the New
 // method. It also contains other unexported informations like the number of
 // atoms, and the number of columns.
-// AtomStart must be lower than AtomEnd. Same for CfgStart and CfgEnd.
+// AtomStart must be lower than AtomEnd. Same for CfgStart and CfgEnd. If the
+// trajectory ends before CfgEnd, the configurations read are used and a
+// warning is logged.
+// CoordinateColumns is the set of coordinates read (util.Unwrapped by default,
+// see util.CoordColumns). With util.Wrapped, the molecule must not cross the
+// boundaries of the box.
+// If UseGeometry is true, the center of geometry is used instead of the center
+// of mass and Masses is not required. If Smooth is set, the radii are kept in
+// memory and a smoothed column is written at the end of the calculation. If
+// Convergence is true, a block averaging of the radius is written at the end of
+// the output file (see util.BlockAverage).
+//
+// If WeightColumn is set, the values of this column (e.g. q) weight the atoms
+// instead of Masses. The absolute values are used so that a neutral group of
+// charges still has a center: atoms with a weight of 0 don't contribute to the
+// center, and a configuration whose weights are all 0 returns an error.
+//
+// If WriteCom is true, the coordinates of the center used for the radius are
+// written after the radius (com_x com_y com_z), e.g. to follow the drift of
+// the molecule.
+//
+// If ByMol is true, the atoms between AtomStart and AtomEnd are grouped in
+// molecules by the mol column, a new molecule starting when the identifier
+// changes, or by AtomsPerMolecule consecutive atoms if there is none (see
+// util.MolID). The radius of each molecule is calculated around its own
+// center, and the mean and the standard deviation of the radii of the
+// molecules are written (radius radius_std), e.g. for thousands of identical
+// molecules. WriteCom cannot be used with ByMol.
+//
+// Threads is the number of workers calculating the radii (all the threads
+// available if 0). The output doesn't depend on it.
 type RadiusGyration struct {
 	FileIn  string `toml:"radius_gyration.file_in"`
 	FileOut string `toml:"radius_gyration.file_out"`
@@ -29,15 +61,46 @@ type RadiusGyration struct {
 	CfgStart int `toml:"radius_gyration.cfg_start"`
 	CfgEnd   int `toml:"radius_gyration.cfg_end"`
 
+	CoordinateColumns string `toml:"radius_gyration.coordinate_columns"`
+
 	AtomStart int                `toml:"radius_gyration.atom_start"`
 	AtomEnd   int                `toml:"radius_gyration.atom_end"`
 	Masses    map[string]float64 `toml:"radius_gyration.masses"`
 
+	UseGeometry  bool   `toml:"radius_gyration.use_geometry"`
+	WeightColumn string `toml:"radius_gyration.weight_column"`
+	WriteCom     bool   `toml:"radius_gyration.write_com"`
+
+	ByMol            bool `toml:"radius_gyration.by_mol"`
+	AtomsPerMolecule int  `toml:"radius_gyration.atoms_per_molecule"`
+
 	Dt float64 `toml:"radius_gyration.dt"`
 
+	Smooth      util.Smooth `toml:"radius_gyration.smooth"`
+	Convergence bool        `toml:"radius_gyration.convergence"`
+
+	Threads int `toml:"radius_gyration.threads"`
+
 	atoms   int
 	cols    [4]int
+	coords  [3]string
+	colW    int
+	colMol  int
 	colsLen int
+	radius  []float64
+	std     []float64
+	com     [][3]float64
+
+	sum, sum2 float64 // sums of the radii and of their squares
+	nb        int
+
+	syncEvery int
+
+	progress *util.Progress
+	input    util.Input
+	format   string
+	log      *log.Logger
+	summary  *util.Summary
 }
 
 // New returns an instance of the RadiusGyration structure. It reads and parses
@@ -64,73 +127,329 @@ func New(path string) (*RadiusGyration, error) {
 		return nil, errors.New("AtomStart is greater or equal than AtomEnd")
 	}
 
+	radiusgyration.coords, err = util.CoordColumns(radiusgyration.CoordinateColumns, util.Unwrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	err = radiusgyration.Smooth.Check()
+	if err != nil {
+		return nil, fmt.Errorf("Smooth: %w", err)
+	}
+
+	if radiusgyration.UseGeometry && radiusgyration.WeightColumn != "" {
+		return nil, errors.New("UseGeometry and WeightColumn are mutually exclusive")
+	}
+
+	if radiusgyration.ByMol && radiusgyration.WriteCom {
+		return nil, errors.New("ByMol and WriteCom are mutually exclusive")
+	}
+
+	if radiusgyration.Threads < 0 {
+		return nil, errors.New("Threads must be positive")
+	}
+
 	return &radiusgyration, nil
 }
 
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (r *RadiusGyration) SetOutputDir(dir string) {
+	r.FileOut = util.FileOut(r.FileOut, dir, r.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (r *RadiusGyration) SetOutputFormat(format string) {
+	r.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (r *RadiusGyration) SetProgress(p *util.Progress) {
+	r.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (r *RadiusGyration) SetInput(in util.Input) {
+	r.input = in
+}
+
+// SetSyncEvery sets the number of configurations between two syncs of the
+// output file (see util.Syncer).
+func (r *RadiusGyration) SetSyncEvery(every int) {
+	r.syncEvery = every
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (r *RadiusGyration) SetLog(log *log.Logger) {
+	r.log = log
+}
+
 // Start performs the calculation. It is a thread blocking method. It is a very
-// fast calculation. This calculation only use one thread.
+// fast calculation. The configurations are read by one goroutine and their
+// radii are calculated by Threads workers (all the threads available if 0).
+// The results are written in the order of the configurations.
 func (r *RadiusGyration) Start() error {
-	f, err := os.Open(r.FileIn)
+	f, traj, err := util.OpenTrajectory(r.FileIn)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	rd := bufio.NewReader(f)
+	rd := bufio.NewReader(r.input.Reader(traj))
 
-	out, err := util.Write(r.FileOut, r)
+	out, err := util.WriteFormat(r.FileOut, r, r.format)
 	if err != nil {
 		return fmt.Errorf("Write: %w", err)
 	}
 	defer out.Close()
-	out.WriteString("cfg t radius\n")
+	syncer := util.NewSyncer(out, r.syncEvery)
+	out.WriteString("cfg t radius")
+	if r.ByMol {
+		out.WriteString(" radius_std")
+	}
+	if r.Smooth.Enabled() {
+		out.WriteString(" radius_smooth")
+	}
+	if r.WriteCom {
+		out.WriteString(" com_x com_y com_z")
+	}
+	out.WriteString("\n")
 
-	err = util.ReadCfgNonCvg(rd, r.CfgStart)
+	err = r.input.SkipTo(f, rd, 0, r.CfgStart)
 	if err != nil {
-		return fmt.Errorf("ReadCfgNonCvg: %w", err)
+		return fmt.Errorf("SkipTo: %w", err)
 	}
 
-	xyz, types, err := r.readCfgFirst(rd)
+	first, err := r.readCfgFirst(rd)
 	if err != nil {
 		return fmt.Errorf("readCfgFirst: %w", err)
 	}
-	r.calc(out, 0, xyz, types)
+	r.summary.Log(r.log, Type)
+	r.summary = nil
+	res := r.process(first)
+	if res.err != nil {
+		return res.err
+	}
+	r.record(out, res)
 
-	for i := 1; i < (r.CfgEnd - r.CfgStart); i++ {
-		xyz, types, err := r.readCfg(rd)
+	threads := r.Threads
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
+	var (
+		jobs    = make(chan job, threads)
+		results = make(chan result, threads)
+		slots   = make(chan struct{}, 2*threads) // configurations in flight
+		done    = make(chan struct{})
+	)
+	defer close(done)
+
+	go r.read(f, rd, jobs, results, slots, done)
+	for i := 0; i < threads; i++ {
+		go r.work(jobs, results, done)
+	}
+
+	pending := make(map[int]result)
+loop:
+	for i := 1; i < (r.CfgEnd - r.CfgStart); {
+		res := <-results
+		pending[res.cfg] = res
+
+		for res, ok := pending[i]; ok; res, ok = pending[i] {
+			delete(pending, i)
+			if errors.Is(res.err, util.ErrEndOfTrajectory) {
+				util.LogEndOfTrajectory(r.log, Type, r.CfgStart+i, r.CfgEnd-1, i)
+				break loop
+			} else if res.err != nil {
+				return res.err
+			}
+
+			r.record(out, res)
+			<-slots
+			r.progress.Update(i+1, r.CfgEnd-r.CfgStart)
+			err = syncer.Frame()
+			if err != nil {
+				return fmt.Errorf("Sync (step %d): %w", i, err)
+			}
+			i++
+		}
+	}
+
+	if r.buffered() {
+		err = r.writeSeries(out)
 		if err != nil {
-			return fmt.Errorf("readCfg (step %d): %w", i, err)
+			return fmt.Errorf("writeSeries: %w", err)
 		}
-		r.calc(out, i, xyz, types)
+	}
+
+	if r.Convergence {
+		util.WriteBlocks(out, r.radius)
 	}
 
 	return nil
 }
 
-// calc calculates the radius of gyration and writes the result into a file.
-func (r *RadiusGyration) calc(w io.Writer, cfg int, xyz [][3]float64, types []string) error {
-	var (
-		com     [3]float64
-		massTot float64
-	)
+// job is a configuration read by read and processed by work. mols are the
+// indices of the first atom of each molecule if ByMol is true.
+type job struct {
+	cfg     int
+	xyz     [][3]float64
+	types   []string
+	weights []float64
+	mols    []int
+}
+
+// result is the radius of gyration and the center of a configuration, or the
+// error that occurred while reading or processing it. If ByMol is true, radius
+// is the mean radius of the molecules and std their standard deviation.
+type result struct {
+	cfg    int
+	radius float64
+	std    float64
+	com    [3]float64
+	err    error
+}
 
-	for key, v := range xyz {
-		mass, ok := r.Masses[types[key]]
-		if !ok {
-			return fmt.Errorf("mass for atom type `%s` doesn't exist", types[key])
+// read reads the configurations following the first one and sends them to the
+// workers. A slot is taken for each configuration so that the reader doesn't
+// get too far ahead of the writer. A reading error is sent as the result of
+// its configuration, which stops the reading, and so is util.ErrEndOfTrajectory
+// if the trajectory ends. read returns when done is closed.
+func (r *RadiusGyration) read(f *os.File, rd *bufio.Reader, jobs chan<- job, results chan<- result,
+	slots chan<- struct{}, done <-chan struct{}) {
+	defer close(jobs)
+
+	for i := 1; i < (r.CfgEnd - r.CfgStart); i++ {
+		select {
+		case slots <- struct{}{}:
+		case <-done:
+			return
 		}
-		massTot += mass
 
-		for k := 0; k < 3; k++ {
-			com[k] += v[k] * mass
+		err := r.input.SkipTo(f, rd, r.CfgStart+i, r.CfgStart+i)
+		if err != nil {
+			select {
+			case results <- result{cfg: i, err: err}:
+			case <-done:
+			}
+			return
+		}
+
+		j, err := r.readCfg(rd)
+		if err != nil {
+			select {
+			case results <- result{cfg: i, err: fmt.Errorf("readCfg (step %d): %w", i, err)}:
+			case <-done:
+			}
+			return
+		}
+		j.cfg = i
+
+		select {
+		case jobs <- j:
+		case <-done:
+			return
+		}
+	}
+}
+
+// work calculates the radius of gyration of the configurations received until
+// jobs is closed or done is closed.
+func (r *RadiusGyration) work(jobs <-chan job, results chan<- result, done <-chan struct{}) {
+	for j := range jobs {
+		res := r.process(j)
+
+		select {
+		case results <- res:
+		case <-done:
+			return
+		}
+	}
+}
+
+// process calculates the radius of gyration of a configuration, or the mean
+// radius of its molecules if ByMol is true.
+func (r *RadiusGyration) process(j job) (res result) {
+	res.cfg = j.cfg
+	if r.ByMol {
+		res.radius, res.std, res.err = r.calcMols(j.xyz, j.types, j.weights, j.mols)
+		if res.err != nil {
+			res.err = fmt.Errorf("calcMols (step %d): %w", j.cfg, res.err)
 		}
+		return
 	}
 
-	for k := 0; k < 3; k++ {
-		com[k] /= massTot
+	res.radius, res.com, res.err = r.calc(j.xyz, j.types, j.weights)
+	if res.err != nil {
+		res.err = fmt.Errorf("calc (step %d): %w", j.cfg, res.err)
+	}
+	return
+}
+
+// calcMols calculates the radius of gyration of each molecule (see calc) and
+// returns their mean and their standard deviation. mols are the indices of the
+// first atom of each molecule. It returns an error if there is no molecule.
+func (r *RadiusGyration) calcMols(xyz [][3]float64, types []string, weights []float64, mols []int) (mean, std float64, err error) {
+	if len(mols) == 0 {
+		return 0, 0, errors.New("no molecule")
+	}
+
+	for k, start := range mols {
+		end := len(xyz)
+		if k+1 < len(mols) {
+			end = mols[k+1]
+		}
+
+		var w []float64
+		if weights != nil {
+			w = weights[start:end]
+		}
+
+		radius, _, err := r.calc(xyz[start:end], types[start:end], w)
+		if err != nil {
+			return 0, 0, fmt.Errorf("molecule %d: %w", k, err)
+		}
+		mean += radius
+		std += radius * radius
+	}
+
+	nb := float64(len(mols))
+	mean /= nb
+	std = math.Sqrt(math.Max(std/nb-mean*mean, 0))
+	return
+}
+
+// calc calculates the radius of gyration around the center of mass (or of
+// geometry) and returns it with the center. It doesn't modify r, so it can be
+// called by several workers at the same time.
+func (r *RadiusGyration) calc(xyz [][3]float64, types []string, weights []float64) (radius float64, com [3]float64, err error) {
+	var masses []float64
+	if weights != nil {
+		masses = make([]float64, len(xyz))
+		var tot float64
+		for key, weight := range weights {
+			masses[key] = math.Abs(weight)
+			tot += masses[key]
+		}
+
+		if tot == 0 {
+			err = fmt.Errorf("the weights (column %s) are all equal to 0", r.WeightColumn)
+			return
+		}
+	} else if !r.UseGeometry {
+		masses = make([]float64, len(xyz))
+		for key := range xyz {
+			mass, ok := r.Masses[types[key]]
+			if !ok {
+				err = fmt.Errorf("mass for atom type `%s` doesn't exist", types[key])
+				return
+			}
+			masses[key] = mass
+		}
 	}
+	com = util.Center(xyz, masses)
 
 	// MSD between COM & each XYZ
-	var radius float64
 	for _, v := range xyz {
 		for k := 0; k < 3; k++ {
 			mult := v[k] - com[k]
@@ -140,9 +459,83 @@ func (r *RadiusGyration) calc(w io.Writer, cfg int, xyz [][3]float64, types []st
 
 	radius /= float64(len(xyz) * 3)
 	radius = math.Sqrt(radius)
+	return
+}
 
-	fmt.Fprintf(w, "%d %g %g\n",
+// record writes the radius of a configuration into a file. If the series must
+// be buffered, the radius is saved instead.
+func (r *RadiusGyration) record(w io.Writer, res result) {
+	cfg, radius, com := res.cfg, res.radius, res.com
+	r.sum += radius
+	r.sum2 += radius * radius
+	r.nb++
+
+	if r.buffered() {
+		r.radius = append(r.radius, radius)
+		if r.ByMol {
+			r.std = append(r.std, res.std)
+		}
+		if r.WriteCom {
+			r.com = append(r.com, com)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "%d %g %g",
 		(cfg + r.CfgStart), (float64(cfg+r.CfgStart) * r.Dt), radius)
+	if r.ByMol {
+		fmt.Fprintf(w, " %g", res.std)
+	}
+	if r.WriteCom {
+		fmt.Fprintf(w, " %g %g %g", com[0], com[1], com[2])
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// Summary returns the mean radius of gyration and its standard deviation over
+// the processed configurations.
+func (r *RadiusGyration) Summary() string {
+	if r.nb == 0 {
+		return "no configuration processed"
+	}
+
+	mean := r.sum / float64(r.nb)
+	std := math.Sqrt(math.Max(r.sum2/float64(r.nb)-mean*mean, 0))
+	return fmt.Sprintf("mean radius %g (std %g, %d configurations)", mean, std, r.nb)
+}
+
+// buffered returns true if the radii must be kept in memory.
+func (r *RadiusGyration) buffered() bool {
+	return r.Smooth.Enabled() || r.Convergence
+}
+
+// writeSeries writes the saved radii into a file, followed by their standard
+// deviations if ByMol is true. If Smooth is set, the smoothed radii are
+// written as well. If WriteCom is set, the saved centers
+// are written last.
+func (r *RadiusGyration) writeSeries(w io.Writer) error {
+	var smooth []float64
+	if r.Smooth.Enabled() {
+		var err error
+		smooth, err = r.Smooth.Apply(r.radius)
+		if err != nil {
+			return fmt.Errorf("Apply: %w", err)
+		}
+	}
+
+	for cfg, radius := range r.radius {
+		fmt.Fprintf(w, "%d %g %g", (cfg + r.CfgStart), (float64(cfg+r.CfgStart) * r.Dt), radius)
+		if r.ByMol {
+			fmt.Fprintf(w, " %g", r.std[cfg])
+		}
+		if smooth != nil {
+			fmt.Fprintf(w, " %g", smooth[cfg])
+		}
+		if r.WriteCom {
+			fmt.Fprintf(w, " %g %g %g", r.com[cfg][0], r.com[cfg][1], r.com[cfg][2])
+		}
+		fmt.Fprint(w, "\n")
+	}
 
 	return nil
 }
@@ -0,0 +1,531 @@
+package radiusgyration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// water is a water-like molecule whose oxygen (type 1) is much heavier than
+// its hydrogens (type 2).
+var (
+	waterXYZ    = [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+	waterTypes  = []string{"1", "2", "2"}
+	waterMasses = map[string]float64{"1": 16, "2": 1}
+)
+
+// rg returns the radius of gyration of xyz around center as calculated by calc.
+func rg(xyz [][3]float64, center [3]float64) float64 {
+	var sum float64
+	for _, v := range xyz {
+		for k := 0; k < 3; k++ {
+			sum += (v[k] - center[k]) * (v[k] - center[k])
+		}
+	}
+	return math.Sqrt(sum / float64(3*len(xyz)))
+}
+
+func TestCalcCenter(t *testing.T) {
+	tests := []struct {
+		name string
+		r    RadiusGyration
+		com  [3]float64
+	}{
+		{"mass", RadiusGyration{Masses: waterMasses}, [3]float64{1. / 18., 1. / 18., 0}},
+		{"geometry", RadiusGyration{UseGeometry: true}, [3]float64{1. / 3., 1. / 3., 0}},
+		{"geometry with masses", RadiusGyration{Masses: waterMasses, UseGeometry: true}, [3]float64{1. / 3., 1. / 3., 0}},
+	}
+
+	for _, tt := range tests {
+		radius, com, err := tt.r.calc(waterXYZ, waterTypes, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		for k := 0; k < 3; k++ {
+			if math.Abs(com[k]-tt.com[k]) > 1e-12 {
+				t.Errorf("%s: center %v, want %v", tt.name, com, tt.com)
+				break
+			}
+		}
+		if want := rg(waterXYZ, tt.com); math.Abs(radius-want) > 1e-12 {
+			t.Errorf("%s: radius %g, want %g", tt.name, radius, want)
+		}
+	}
+
+	// The center of geometry minimizes the radius.
+	mass, _, _ := (&RadiusGyration{Masses: waterMasses}).calc(waterXYZ, waterTypes, nil)
+	geom, _, _ := (&RadiusGyration{UseGeometry: true}).calc(waterXYZ, waterTypes, nil)
+	if geom >= mass {
+		t.Errorf("radius around the center of geometry %g isn't lower than around the center of mass %g", geom, mass)
+	}
+}
+
+func TestCalcMissingMass(t *testing.T) {
+	r := RadiusGyration{Masses: map[string]float64{"1": 16}}
+	if _, _, err := r.calc(waterXYZ, waterTypes, nil); err == nil {
+		t.Error("no error without the mass of the type 2")
+	}
+}
+
+// newRadiusGyration writes the trajectory traj and the configuration file made
+// of the parameters params (without the table [radius_gyration]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newRadiusGyration(t *testing.T, params, traj string) (*RadiusGyration, error) {
+	dir, err := ioutil.TempDir("", "radiusgyration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "radiusgyration.toml")
+	cfg := fmt.Sprintf("[radius_gyration]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "radiusgyration.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(path)
+}
+
+// run runs the calculation returned by newRadiusGyration. It returns the rows
+// of the output file.
+func run(t *testing.T, params, traj string) ([][]float64, error) {
+	r, err := newRadiusGyration(t, params, traj)
+	if err != nil {
+		return nil, fmt.Errorf("New: %w", err)
+	}
+
+	err = r.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	return rows(t, r.FileOut), nil
+}
+
+// rows returns the rows of the output file path.
+func rows(t *testing.T, path string) [][]float64 {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+
+	var rows [][]float64
+	for _, line := range strings.Split(out[strings.Index(out, "cfg t "):], "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			break
+		}
+
+		row := make([]float64, len(fields))
+		for k, f := range fields {
+			row[k], err = strconv.ParseFloat(f, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// molecules returns a configuration of a LAMMPS trajectory with the columns
+// id, mol, type, xu, yu, and zu. The atoms of each molecule are of type 1.
+func molecules(step int, mols [][][3]float64) string {
+	var b strings.Builder
+	var atoms int
+	for _, mol := range mols {
+		atoms += len(mol)
+	}
+
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", step, atoms)
+	b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\nITEM: ATOMS id mol type xu yu zu\n")
+	id := 1
+	for m, mol := range mols {
+		for _, v := range mol {
+			fmt.Fprintf(&b, "%d %d 1 %g %g %g\n", id, m+1, v[0], v[1], v[2])
+			id++
+		}
+	}
+	return b.String()
+}
+
+func TestByMol(t *testing.T) {
+	// Molecules of different sizes and shapes, translated between the
+	// configurations.
+	shapes := [][][3]float64{
+		{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		{{0, 0, 0}, {2, 0, 0}, {0, 0, 2}},
+		{{0, 0, 0}, {1, 1, 1}, {3, 0, 0}},
+	}
+	cfgs := make([][][][3]float64, 3)
+	for i := range cfgs {
+		for m, shape := range shapes {
+			var mol [][3]float64
+			for _, v := range shape {
+				mol = append(mol, [3]float64{v[0] + float64(5*m+i), v[1], v[2] + float64(i)})
+			}
+			cfgs[i] = append(cfgs[i], mol)
+		}
+	}
+
+	var traj strings.Builder
+	for i, mols := range cfgs {
+		traj.WriteString(molecules(i, mols))
+	}
+
+	var mean, std float64
+	for _, shape := range shapes {
+		radius := rg(shape, util.Center(shape, nil))
+		mean += radius
+		std += radius * radius
+	}
+	mean /= 3
+	std = math.Sqrt(std/3 - mean*mean)
+
+	// The same trajectory without the mol column.
+	var noMol []string
+	for _, l := range strings.Split(traj.String(), "\n") {
+		if f := strings.Fields(l); len(f) == 6 {
+			l = strings.Join(append(f[:1], f[2:]...), " ")
+		}
+		noMol = append(noMol, strings.Replace(l, "id mol type", "id type", 1))
+	}
+
+	tests := []struct {
+		name   string
+		traj   string
+		params string
+	}{
+		{"mol column", traj.String(), ""},
+		{"atoms per molecule", strings.Join(noMol, "\n"), "atoms_per_molecule = 3\n"},
+	}
+
+	for _, tt := range tests {
+
+		rows, err := run(t, "cfg_end = 3\natom_start = 0\natom_end = 9\nuse_geometry = true\n"+
+			"by_mol = true\ndt = 1.0\nthreads = 1\n"+tt.params, tt.traj)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if len(rows) != len(cfgs) {
+			t.Errorf("%s: %d rows, want %d", tt.name, len(rows), len(cfgs))
+			continue
+		}
+		for i, row := range rows {
+			if math.Abs(row[2]-mean) > 1e-5 || math.Abs(row[3]-std) > 1e-5 {
+				t.Errorf("%s: configuration %d: radius %g (std %g), want %g (std %g)", tt.name, i, row[2], row[3], mean, std)
+			}
+		}
+	}
+}
+
+func TestCalcMols(t *testing.T) {
+	r := RadiusGyration{UseGeometry: true}
+	xyz := [][3]float64{{0, 0, 0}, {2, 0, 0}, {5, 5, 5}, {5, 5, 9}}
+	types := []string{"1", "1", "1", "1"}
+
+	tests := []struct {
+		name      string
+		mols      []int
+		mean, std float64
+		errMsg    string
+	}{
+		{"two molecules", []int{0, 2}, (1/math.Sqrt(3) + 2/math.Sqrt(3)) / 2, 0.5 / math.Sqrt(3), ""},
+		{"one molecule", []int{0}, rg(xyz, util.Center(xyz, nil)), 0, ""},
+		{"no molecule", nil, 0, 0, "no molecule"},
+	}
+
+	for _, tt := range tests {
+		mean, std, err := r.calcMols(xyz, types, nil, tt.mols)
+		switch {
+		case tt.errMsg != "":
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case math.Abs(mean-tt.mean) > 1e-12 || math.Abs(std-tt.std) > 1e-12:
+			t.Errorf("%s: mean %g (std %g), want %g (std %g)", tt.name, mean, std, tt.mean, tt.std)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var r RadiusGyration
+	if got := r.Summary(); got != "no configuration processed" {
+		t.Errorf("Summary without configuration = %q", got)
+	}
+
+	for _, radius := range []float64{1, 3} {
+		r.record(ioutil.Discard, result{radius: radius})
+	}
+	if got, want := r.Summary(), "mean radius 2 (std 1, 2 configurations)"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		traj.WriteString(molecules(i, [][][3]float64{{{0, 0, 0}, {1, 0, 0.5 * float64(i)}, {0, 1, 2}}}))
+	}
+	params := "cfg_end = 3\natom_start = 0\natom_end = 3\nuse_geometry = true\ndt = 1.0\n"
+
+	lf, err := run(t, params, traj.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf, err := run(t, params, strings.ReplaceAll(traj.String(), "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(crlf) != len(lf) {
+		t.Fatalf("CRLF: %d rows, want %d", len(crlf), len(lf))
+	}
+	for i := range lf {
+		if crlf[i][2] != lf[i][2] {
+			t.Errorf("CRLF: configuration %d: radius %g, want %g", i, crlf[i][2], lf[i][2])
+		}
+	}
+}
+
+func TestCalcWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64
+		com     [3]float64
+		errMsg  string
+	}{
+		// The masses as a column give the same center as Masses.
+		{"masses", []float64{16, 1, 1}, [3]float64{1. / 18., 1. / 18., 0}, ""},
+		// A neutral group of charges: the absolute values are used.
+		{"charges", []float64{-0.8, 0.4, 0.4}, [3]float64{0.25, 0.25, 0}, ""},
+		{"zero weight", []float64{0, 1, 1}, [3]float64{0.5, 0.5, 0}, ""},
+		{"uniform", []float64{2, 2, 2}, [3]float64{1. / 3., 1. / 3., 0}, ""},
+		{"all zero", []float64{0, 0, 0}, [3]float64{}, "the weights (column q) are all equal to 0"},
+	}
+
+	r := RadiusGyration{WeightColumn: "q"}
+	mass, massCom, err := (&RadiusGyration{Masses: waterMasses}).calc(waterXYZ, waterTypes, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		radius, com, err := r.calc(waterXYZ, waterTypes, tt.weights)
+		if tt.errMsg != "" {
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		for k := 0; k < 3; k++ {
+			if math.Abs(com[k]-tt.com[k]) > 1e-12 {
+				t.Errorf("%s: center %v, want %v", tt.name, com, tt.com)
+				break
+			}
+		}
+		if want := rg(waterXYZ, tt.com); math.Abs(radius-want) > 1e-12 {
+			t.Errorf("%s: radius %g, want %g", tt.name, radius, want)
+		}
+
+		if tt.name == "masses" && (math.Abs(radius-mass) > 1e-12 || com != massCom) {
+			t.Errorf("masses: radius %g around %v, want %g around %v as with Masses", radius, com, mass, massCom)
+		}
+	}
+}
+
+func TestWeightColumn(t *testing.T) {
+	// The column q contains the masses of the atoms (types 1 and 2): the
+	// radius is the one weighted by Masses.
+	const traj = `ITEM: TIMESTEP
+0
+ITEM: NUMBER OF ATOMS
+3
+ITEM: BOX BOUNDS pp pp pp
+0 20
+0 20
+0 20
+ITEM: ATOMS id type xu yu zu q
+1 1 0 0 0 16
+2 2 1 0 0 1
+3 2 0 1 0.5 1
+`
+	params := "cfg_end = 1\natom_start = 0\natom_end = 3\ndt = 1.0\n"
+
+	column, err := run(t, params+"weight_column = \"q\"\n", traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masses, err := run(t, params+"masses = {1 = 16.0, 2 = 1.0}\n", traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geometry, err := run(t, params+"use_geometry = true\n", traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if column[0][2] != masses[0][2] {
+		t.Errorf("radius %g weighted by the column q, want %g as with Masses", column[0][2], masses[0][2])
+	}
+	if column[0][2] == geometry[0][2] {
+		t.Errorf("radius %g weighted by the column q, the same as around the center of geometry", column[0][2])
+	}
+}
+
+func TestWriteCom(t *testing.T) {
+	// The water molecule drifts by (0.5, 1, -0.25) at each configuration.
+	var traj strings.Builder
+	drift := [3]float64{0.5, 1, -0.25}
+	for i := 0; i < 7; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n3\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\nITEM: ATOMS id type xu yu zu\n")
+		for j, v := range waterXYZ {
+			fmt.Fprintf(&traj, "%d %s %g %g %g\n", j+1, waterTypes[j],
+				v[0]+5+float64(i)*drift[0], v[1]+5+float64(i)*drift[1], v[2]+5+float64(i)*drift[2])
+		}
+	}
+	const params = "cfg_end = 7\natom_start = 0\natom_end = 3\ndt = 1.0\nwrite_com = true\n"
+
+	tests := []struct {
+		name   string
+		params string
+		com    [3]float64 // in the first configuration
+		col    int        // column of com_x
+	}{
+		{"mass", "masses = {1 = 16.0, 2 = 1.0}\n", [3]float64{5 + 1./18., 5 + 1./18., 5}, 3},
+		{"geometry", "use_geometry = true\n", [3]float64{5 + 1./3., 5 + 1./3., 5}, 3},
+		{"smoothed", "use_geometry = true\nsmooth = {type = \"savgol\", window = 5, order = 2}\n",
+			[3]float64{5 + 1./3., 5 + 1./3., 5}, 4},
+	}
+
+	for _, tt := range tests {
+		rows, err := run(t, params+tt.params, traj.String())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(rows) != 7 {
+			t.Fatalf("%s: %d rows, want 7", tt.name, len(rows))
+		}
+
+		for i, row := range rows {
+			if len(row) != tt.col+3 {
+				t.Fatalf("%s: %d columns, want %d", tt.name, len(row), tt.col+3)
+			}
+			for k := 0; k < 3; k++ {
+				want := tt.com[k] + float64(i)*drift[k]
+				if math.Abs(row[tt.col+k]-want) > 1e-5 {
+					t.Errorf("%s: configuration %d: center %v, want %g along %d", tt.name, i, row[tt.col:], want, k)
+				}
+			}
+		}
+	}
+
+	if _, err := run(t, params+"by_mol = true\n", traj.String()); err == nil {
+		t.Error("no error with by_mol and write_com")
+	}
+}
+
+func TestCoordinateColumns(t *testing.T) {
+	// The trajectory contains both sets: the molecule crosses the box with the
+	// wrapped coordinates.
+	const traj = "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\nITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\n" +
+		"ITEM: ATOMS id type x y z xu yu zu\n1 1 19.5 1 1 19.5 1 1\n2 1 0.5 1 1 20.5 1 1\n"
+	tests := []struct {
+		set    string
+		radius float64
+	}{
+		{"", rg([][3]float64{{19.5, 1, 1}, {20.5, 1, 1}}, [3]float64{20, 1, 1})},
+		{"unwrapped", rg([][3]float64{{19.5, 1, 1}, {20.5, 1, 1}}, [3]float64{20, 1, 1})},
+		{"wrapped", rg([][3]float64{{19.5, 1, 1}, {0.5, 1, 1}}, [3]float64{10, 1, 1})},
+	}
+
+	for _, tt := range tests {
+		rows, err := run(t, fmt.Sprintf("cfg_end = 1\natom_start = 0\natom_end = 2\ndt = 1.0\nuse_geometry = true\n"+
+			"coordinate_columns = %q\n", tt.set), traj)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.set, err)
+		}
+		if math.Abs(rows[0][2]-tt.radius) > 1e-12 {
+			t.Errorf("%q: radius %g, want %g", tt.set, rows[0][2], tt.radius)
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		traj.WriteString(molecules(i, [][][3]float64{{{0, 0, 0}, {1, 0, 0.5 * float64(i)}, {0, 1, 2}}}))
+	}
+
+	tests := []struct {
+		cfgEnd  int
+		threads int
+		log     string
+	}{
+		{3, 1, ""},
+		{10, 1, "radius_gyration: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+		{10, 4, "radius_gyration: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+	}
+
+	for _, tt := range tests {
+		r, err := newRadiusGyration(t, fmt.Sprintf("cfg_end = %d\natom_start = 0\natom_end = 3\n"+
+			"use_geometry = true\ndt = 1.0\nthreads = %d\nconvergence = true\n", tt.cfgEnd, tt.threads), traj.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var logs strings.Builder
+		r.SetLog(log.New(&logs, "", 0))
+
+		err = r.Start()
+		if err != nil {
+			t.Errorf("cfg_end %d: %v", tt.cfgEnd, err)
+			continue
+		}
+
+		var got string
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if strings.Contains(line, "the trajectory ends") {
+				got += line + "\n"
+			}
+		}
+		if got != tt.log {
+			t.Errorf("cfg_end %d (%d threads): logged %q, want %q", tt.cfgEnd, tt.threads, got, tt.log)
+		}
+
+		rows := rows(t, r.FileOut)
+		if len(rows) != 3 {
+			t.Errorf("cfg_end %d (%d threads): %d rows, want 3", tt.cfgEnd, tt.threads, len(rows))
+		}
+		if want := "3 configurations)"; !strings.HasSuffix(r.Summary(), want) {
+			t.Errorf("cfg_end %d (%d threads): summary %q doesn't end with %q", tt.cfgEnd, tt.threads, r.Summary(), want)
+		}
+	}
+}
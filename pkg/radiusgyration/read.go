@@ -3,25 +3,31 @@ package radiusgyration
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
 )
 
 // readCfgFirst reads the first configuration. It reads the number of atoms, the
 // columns and performs the usual calculations like in readCfg.
-func (r *RadiusGyration) readCfgFirst(rd *bufio.Reader) (xyz [][3]float64, types []string, err error) {
+func (r *RadiusGyration) readCfgFirst(rd *bufio.Reader) (j job, err error) {
 	for i := 0; i < 3; i++ {
 		rd.ReadSlice('\n')
 	}
 
 	b, _ := rd.ReadSlice('\n')
-	r.atoms, err = strconv.Atoi(string(b)[:len(b)-1])
+	r.atoms, err = strconv.Atoi(strings.TrimSpace(string(b)))
 	if err != nil {
 		return
 	}
 
-	for i := 0; i < 4; i++ {
-		rd.ReadSlice('\n')
+	rd.ReadSlice('\n')
+	box, err := util.HeaderBox(rd, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderBox: %w", err)
+		return
 	}
 
 	b, _ = rd.ReadSlice('\n')
@@ -35,13 +41,22 @@ func (r *RadiusGyration) readCfgFirst(rd *bufio.Reader) (xyz [][3]float64, types
 
 	var found int
 	r.colsLen = len(fields)
+	r.colW = -1
+	r.colMol = -1
 	for k, v := range fields {
+		if r.WeightColumn != "" && v == r.WeightColumn {
+			r.colW = k
+		}
+		if v == "mol" {
+			r.colMol = k
+		}
+
 		switch v {
-		case "xu":
+		case r.coords[0]:
 			r.cols[0] = k
-		case "yu":
+		case r.coords[1]:
 			r.cols[1] = k
-		case "zu":
+		case r.coords[2]:
 			r.cols[2] = k
 		case "type":
 			r.cols[3] = k
@@ -52,11 +67,26 @@ func (r *RadiusGyration) readCfgFirst(rd *bufio.Reader) (xyz [][3]float64, types
 	}
 
 	if found < len(r.cols) {
-		err = fmt.Errorf("cannot find the columns xu yu, zu, and type")
+		err = fmt.Errorf("cannot find the columns %s, %s, %s, and type", r.coords[0], r.coords[1], r.coords[2])
+		return
+	}
+
+	if r.WeightColumn != "" && r.colW < 0 {
+		err = fmt.Errorf("cannot find the column %s", r.WeightColumn)
 		return
 	}
 
-	xyz, types, err = r.fetchXYZ(rd)
+	if r.ByMol && r.colMol < 0 {
+		err = util.CheckAtomsPerMol(r.AtomEnd-r.AtomStart, r.AtomsPerMolecule)
+		if err != nil {
+			err = fmt.Errorf("cannot find the column mol: CheckAtomsPerMol: %w", err)
+			return
+		}
+	}
+
+	r.summary = util.NewSummary(r.atoms, fields, box)
+
+	j, err = r.fetchXYZ(rd)
 	if err != nil {
 		err = fmt.Errorf("fetchXYZ: %w", err)
 		return
@@ -67,12 +97,12 @@ func (r *RadiusGyration) readCfgFirst(rd *bufio.Reader) (xyz [][3]float64, types
 
 // readCfg reads a configuration of the LAMMPS trajectory. This method will call
 // fetchXYZ to fetch the coordinates of the two atoms.
-func (r *RadiusGyration) readCfg(rd *bufio.Reader) (xyz [][3]float64, types []string, err error) {
+func (r *RadiusGyration) readCfg(rd *bufio.Reader) (j job, err error) {
 	for i := 0; i < 9; i++ {
 		rd.ReadSlice('\n')
 	}
 
-	xyz, types, err = r.fetchXYZ(rd)
+	j, err = r.fetchXYZ(rd)
 	if err != nil {
 		err = fmt.Errorf("fetchXYZ: %w", err)
 	}
@@ -80,13 +110,15 @@ func (r *RadiusGyration) readCfg(rd *bufio.Reader) (xyz [][3]float64, types []st
 	return
 }
 
-// fetchXYZ fetches the coordinates of the two atoms by calling readXYZ two
-// times (one for the first atom, and the other for the second atom).
-func (r *RadiusGyration) fetchXYZ(rd *bufio.Reader) (xyz [][3]float64, types []string, err error) {
+// fetchXYZ fetches the coordinates and the types of the atoms between
+// AtomStart and AtomEnd, their weights if WeightColumn is set, and the first
+// atom of each molecule if ByMol is true.
+func (r *RadiusGyration) fetchXYZ(rd *bufio.Reader) (j job, err error) {
 	for i := 0; i < r.AtomStart; i++ {
-		rd.ReadSlice('\n')
+		r.skip(rd)
 	}
 
+	var mol string
 	for i := 0; i < (r.AtomEnd - r.AtomStart); i++ {
 		b, _ := rd.ReadSlice('\n')
 		fields := strings.Fields(string(b))
@@ -95,17 +127,58 @@ func (r *RadiusGyration) fetchXYZ(rd *bufio.Reader) (xyz [][3]float64, types []s
 			return
 		}
 
+		if r.ByMol {
+			molID := util.MolID(fields, r.colMol, i, r.AtomsPerMolecule)
+			if i == 0 || molID != mol {
+				mol = molID
+				j.mols = append(j.mols, len(j.xyz))
+			}
+		}
+
+		line := util.AtomLine(r.AtomStart + i)
 		var xyzTmp [3]float64
-		for k := 0; k < 3; k++ {
-			xyzTmp[k], _ = strconv.ParseFloat(fields[r.cols[k]], 64)
+		xyzTmp, err = util.ParseXYZ(fields, r.cols[:3], r.coords)
+		if err != nil {
+			err = fmt.Errorf("atom %d (line %d): %w", r.AtomStart+i, line, err)
+			return
+		}
+		j.types = append(j.types, fields[r.cols[3]])
+		r.summary.Add(fields[r.cols[3]])
+		j.xyz = append(j.xyz, xyzTmp)
+
+		if r.colW >= 0 {
+			var weight float64
+			weight, err = strconv.ParseFloat(fields[r.colW], 64)
+			if err != nil {
+				err = fmt.Errorf("atom %d (line %d): column %s: %w", r.AtomStart+i, line, r.WeightColumn, err)
+				return
+			}
+			j.weights = append(j.weights, weight)
 		}
-		types = append(types, fields[r.cols[3]])
-		xyz = append(xyz, xyzTmp)
 	}
 
 	for i := 0; i < (r.atoms - r.AtomEnd); i++ {
-		rd.ReadSlice('\n')
+		r.skip(rd)
 	}
 
 	return
 }
+
+// skip skips an atom outside AtomStart and AtomEnd. Its type is only read for
+// the summary of the first configuration.
+func (r *RadiusGyration) skip(rd *bufio.Reader) {
+	b, _ := rd.ReadSlice('\n')
+	if r.summary == nil {
+		return
+	}
+
+	fields := strings.Fields(string(b))
+	if len(fields) == r.colsLen {
+		r.summary.Add(fields[r.cols[3]])
+	}
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,43 @@
+package runner_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/runner"
+)
+
+// The average position along z of the atoms of type 2 of every other
+// configuration.
+func ExampleRunner_Run() {
+	var traj strings.Builder
+	for i := 0; i < 4; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n3\n", 100*i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&traj, "1 1 0 0 5\n2 2 1 1 %d\n3 2 2 2 %d\n", i, i+2)
+	}
+
+	run, err := runner.New(0, 0, 2)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	err = run.Run(strings.NewReader(traj.String()), func(frame runner.Frame) error {
+		var sum, nb float64
+		for i, xyz := range frame.XYZ {
+			if frame.Types[i] == "2" {
+				sum += xyz[2]
+				nb++
+			}
+		}
+		fmt.Println(frame.Index, frame.Timestep, sum/nb)
+		return nil
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 0 0 1
+	// 2 200 3
+}
@@ -0,0 +1,112 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfg reads a configuration of the LAMMPS trajectory. The columns are
+// detected for each configuration, so the number of atoms and the columns can
+// change along the trajectory.
+func (r *Runner) readCfg(rd *bufio.Reader) (frame Frame, err error) {
+	var header bytes.Buffer
+	atoms, box, err := util.Header(rd, &header, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+	frame.Box = box
+
+	lines := bytes.SplitN(header.Bytes(), []byte{'\n'}, 3)
+	if len(lines) < 3 {
+		err = fmt.Errorf("incomplete header")
+		return
+	}
+	frame.Timestep, err = strconv.Atoi(strings.TrimSpace(string(lines[1])))
+	if err != nil {
+		err = fmt.Errorf("timestep: %w", err)
+		return
+	}
+
+	b, _ := rd.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	frame.Columns = fields[2:]
+
+	names := [3]string{"x", "y", "z"}
+	if r.Unwrapped {
+		names = [3]string{"xu", "yu", "zu"}
+	}
+
+	cols := [5]int{-1, -1, -1, -1, -1}
+	for k, v := range frame.Columns {
+		switch v {
+		case names[0]:
+			cols[0] = k
+		case names[1]:
+			cols[1] = k
+		case names[2]:
+			cols[2] = k
+		case "type":
+			cols[3] = k
+		case "mol":
+			cols[4] = k
+		}
+	}
+
+	if cols[0] < 0 || cols[1] < 0 || cols[2] < 0 {
+		err = fmt.Errorf("cannot find the columns %s, %s, and %s", names[0], names[1], names[2])
+		return
+	}
+
+	frame.Fields = make([][]string, atoms)
+	frame.XYZ = make([][3]float64, atoms)
+	if cols[3] >= 0 {
+		frame.Types = make([]string, atoms)
+	}
+	if cols[4] >= 0 {
+		frame.Mol = make([]string, atoms)
+	}
+
+	for i := 0; i < atoms; i++ {
+		b, _ := rd.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != len(frame.Columns) {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), len(frame.Columns))
+			return
+		}
+
+		for k := 0; k < 3; k++ {
+			frame.XYZ[i][k], err = strconv.ParseFloat(fields[cols[k]], 64)
+			if err != nil {
+				err = fmt.Errorf("atom %d: %w", i, err)
+				return
+			}
+		}
+
+		if cols[3] >= 0 {
+			frame.Types[i] = fields[cols[3]]
+		}
+		if cols[4] >= 0 {
+			frame.Mol[i] = fields[cols[4]]
+		}
+		frame.Fields[i] = fields
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	w.Write(b)
+	return b
+}
@@ -0,0 +1,206 @@
+// Package runner reads a LAMMPS trajectory and calls a function for each
+// configuration. It handles the parsing of the trajectory, the detection of
+// the columns, and the selection of the configurations so that custom
+// analyses can be written without forking the calculations.
+//
+// For example, the average position along z of the atoms of type 2:
+//
+//	run, err := runner.New(0, 1000, 10)
+//	if err != nil {
+//		return err
+//	}
+//
+//	err = run.RunFile("traj.lammpstrj", func(frame runner.Frame) error {
+//		var sum, nb float64
+//		for i, xyz := range frame.XYZ {
+//			if frame.Types[i] == "2" {
+//				sum += xyz[2]
+//				nb++
+//			}
+//		}
+//		fmt.Println(frame.Index, frame.Timestep, sum/nb)
+//		return nil
+//	})
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// ErrStop can be returned by a Func to stop reading the trajectory. Run then
+// returns nil.
+var ErrStop = errors.New("stop")
+
+// Func is the function called for each selected configuration. The frame is
+// not reused by the runner and can be kept.
+type Func func(frame Frame) error
+
+// Frame is a configuration of a LAMMPS trajectory. Columns contains the names
+// of the columns (without ITEM: ATOMS) and Fields the values of these columns
+// for each atom. XYZ contains the columns x, y, and z (xu, yu, and zu if
+// Unwrapped is true). Types contains the column type, and Mol the column mol.
+// Types and Mol are nil if the columns don't exist.
+type Frame struct {
+	Index    int
+	Timestep int
+	Box      [3]float64
+
+	Columns []string
+	Fields  [][]string
+
+	XYZ   [][3]float64
+	Types []string
+	Mol   []string
+}
+
+// Column returns the values of a column for each atom.
+func (f Frame) Column(name string) ([]float64, error) {
+	col := -1
+	for k, v := range f.Columns {
+		if v == name {
+			col = k
+			break
+		}
+	}
+
+	if col < 0 {
+		return nil, fmt.Errorf("cannot find the column %s", name)
+	}
+
+	values := make([]float64, len(f.Fields))
+	for i, fields := range f.Fields {
+		var err error
+		values[i], err = strconv.ParseFloat(fields[col], 64)
+		if err != nil {
+			return nil, fmt.Errorf("atom %d: %w", i, err)
+		}
+	}
+
+	return values, nil
+}
+
+// Runner selects the configurations to read. The configurations of the range
+// [CfgStart; CfgEnd[ are read every Stride configurations. If CfgEnd is lower
+// or equal to 0, the trajectory is read until the end of the file. If Frames is
+// set, only these configurations (positive) are read and the range is ignored.
+// If Unwrapped is true, XYZ contains the unwrapped coordinates.
+type Runner struct {
+	CfgStart int
+	CfgEnd   int
+	Stride   int
+	Frames   []int
+
+	Unwrapped bool
+}
+
+// New returns an instance of the Runner structure. stride must be strictly
+// positive.
+func New(cfgStart, cfgEnd, stride int) (*Runner, error) {
+	if stride <= 0 {
+		return nil, errors.New("Stride must be strictly positive")
+	}
+
+	if cfgEnd > 0 && cfgStart >= cfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	return &Runner{CfgStart: cfgStart, CfgEnd: cfgEnd, Stride: stride}, nil
+}
+
+// RunFile opens the trajectory and calls Run. The compressed trajectories are
+// decompressed on the fly (see util.OpenTrajectory).
+func (r *Runner) RunFile(path string, fn Func) error {
+	f, traj, err := util.OpenTrajectory(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.Run(traj, fn)
+}
+
+// Run reads the trajectory and calls fn for each selected configuration. It
+// stops at the first error returned by fn. If the trajectory ends before the
+// last selected configuration, the error wraps io.ErrUnexpectedEOF. It is a
+// thread blocking method.
+func (r *Runner) Run(in io.Reader, fn Func) error {
+	for _, v := range r.Frames {
+		if v < 0 {
+			return errors.New("Frames must be positive")
+		}
+	}
+
+	rd := bufio.NewReader(in)
+
+	last, keep := r.selection()
+	for cfg := 0; last < 0 || cfg <= last; cfg++ {
+		_, err := rd.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) && last < 0 {
+				return nil
+			}
+			return fmt.Errorf("configuration %d: %w", cfg, io.ErrUnexpectedEOF)
+		}
+
+		if !keep(cfg) {
+			err = util.ReadCfgNonCvg(rd, 1)
+			if err != nil {
+				return fmt.Errorf("ReadCfgNonCvg (step %d): %w", cfg, err)
+			}
+			continue
+		}
+
+		frame, err := r.readCfg(rd)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", cfg, err)
+		}
+		frame.Index = cfg
+
+		err = fn(frame)
+		if errors.Is(err, ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// selection returns the index of the last configuration to read (-1 if the
+// trajectory must be read until the end) and a function telling whether a
+// configuration is selected.
+func (r *Runner) selection() (int, func(cfg int) bool) {
+	if len(r.Frames) > 0 {
+		frames := make(map[int]bool, len(r.Frames))
+		var last int
+		for _, v := range r.Frames {
+			frames[v] = true
+			if v > last {
+				last = v
+			}
+		}
+		return last, func(cfg int) bool { return frames[cfg] }
+	}
+
+	stride := r.Stride
+	if stride <= 0 {
+		stride = 1
+	}
+
+	keep := func(cfg int) bool {
+		return cfg >= r.CfgStart && (cfg-r.CfgStart)%stride == 0
+	}
+
+	if r.CfgEnd <= 0 {
+		return -1, keep
+	}
+	return r.CfgEnd - 1, keep
+}
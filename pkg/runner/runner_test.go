@@ -0,0 +1,181 @@
+package runner
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// trajectory returns a LAMMPS trajectory of n configurations of an atom. The
+// timestep of the configuration i is 10·i.
+func trajectory(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", 10*i)
+		b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&b, "1 1 %d 0 0\n", i)
+	}
+	return b.String()
+}
+
+// indexes runs r on traj and returns the index of each configuration read.
+func indexes(r *Runner, traj string) ([]int, error) {
+	var got []int
+	err := r.Run(strings.NewReader(traj), func(frame Frame) error {
+		if frame.Timestep != 10*frame.Index || frame.XYZ[0][0] != float64(frame.Index) {
+			return fmt.Errorf("configuration %d: timestep %d and x %g", frame.Index, frame.Timestep, frame.XYZ[0][0])
+		}
+		got = append(got, frame.Index)
+		return nil
+	})
+	return got, err
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		runner Runner
+		want   []int
+	}{
+		{"whole", Runner{Stride: 1}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"stride", Runner{Stride: 3}, []int{0, 3, 6, 9}},
+		{"start", Runner{CfgStart: 7, Stride: 1}, []int{7, 8, 9}},
+		{"range", Runner{CfgStart: 2, CfgEnd: 5, Stride: 1}, []int{2, 3, 4}},
+		{"range and stride", Runner{CfgStart: 1, CfgEnd: 8, Stride: 2}, []int{1, 3, 5, 7}},
+		{"last", Runner{CfgStart: 9, CfgEnd: 10, Stride: 1}, []int{9}},
+		{"frames", Runner{Frames: []int{8, 0, 3}}, []int{0, 3, 8}},
+		{"frames and range", Runner{CfgStart: 0, CfgEnd: 2, Stride: 1, Frames: []int{5}}, []int{5}},
+	}
+
+	for _, tt := range tests {
+		got, err := indexes(&tt.runner, trajectory(10))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		cfgStart, cfgEnd, stride int
+		ok                       bool
+	}{
+		{0, 10, 1, true},
+		{0, 0, 1, true},
+		{5, 0, 1, true},
+		{0, 10, 0, false},
+		{0, 10, -1, false},
+		{5, 5, 1, false},
+		{6, 5, 1, false},
+	}
+
+	for _, tt := range tests {
+		_, err := New(tt.cfgStart, tt.cfgEnd, tt.stride)
+		if (err == nil) != tt.ok {
+			t.Errorf("New(%d, %d, %d): got error %v", tt.cfgStart, tt.cfgEnd, tt.stride, err)
+		}
+	}
+}
+
+func TestNegativeFrames(t *testing.T) {
+	called := false
+	r := Runner{Frames: []int{2, -1}}
+	err := r.Run(strings.NewReader(trajectory(5)), func(Frame) error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("got error %v (function called: %v), want an error before reading", err, called)
+	}
+}
+
+func TestEarlyEOF(t *testing.T) {
+	tests := []struct {
+		name   string
+		runner Runner
+		want   []int // configurations read before the end
+	}{
+		{"range", Runner{CfgEnd: 10, Stride: 1}, []int{0, 1, 2}},
+		{"stride", Runner{CfgEnd: 10, Stride: 2}, []int{0, 2}},
+		{"frames", Runner{Frames: []int{1, 4}}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		got, err := indexes(&tt.runner, trajectory(3))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, io.ErrUnexpectedEOF)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A truncated configuration is an error even if the trajectory is read
+	// until the end.
+	traj := trajectory(3)
+	_, err := indexes(&Runner{Stride: 1}, traj[:len(traj)-10])
+	if err == nil {
+		t.Error("truncated configuration: no error")
+	}
+}
+
+func TestStop(t *testing.T) {
+	var got []int
+	r := Runner{Stride: 1}
+	err := r.Run(strings.NewReader(trajectory(5)), func(frame Frame) error {
+		got = append(got, frame.Index)
+		if frame.Index == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("got %v and error %v, want [0 1 2] and no error", got, err)
+	}
+}
+
+func TestRunFileCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "traj.lammpstrj.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write([]byte(trajectory(4)))
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	r := Runner{Stride: 2}
+	err = r.RunFile(path, func(frame Frame) error {
+		got = append(got, frame.Index)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(got, []int{0, 2}) {
+		t.Errorf("got %v and error %v, want [0 2] and no error", got, err)
+	}
+}
@@ -0,0 +1,138 @@
+package shellreorient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (s *ShellReorient) readCfgFirst(r *bufio.Reader) (box [3]float64, mols []molecule, solute [][3]float64, err error) {
+	s.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	s.colsLen = len(fields)
+	s.cols[4] = -1
+	for k, v := range fields {
+		switch v {
+		case "x":
+			s.cols[0] = k
+		case "y":
+			s.cols[1] = k
+		case "z":
+			s.cols[2] = k
+		case "type":
+			s.cols[3] = k
+		case "mol":
+			s.cols[4] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if s.cols[4] < 0 && s.AtomsPerMolecule != 0 {
+		err = util.CheckAtomsPerMol(s.atoms, s.AtomsPerMolecule)
+		if err != nil {
+			err = fmt.Errorf("CheckAtomsPerMol: %w", err)
+			return
+		}
+		found++
+	}
+
+	if found < len(s.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, z, type, and mol")
+		return
+	}
+
+	mols, solute, err = s.fetchMols(r)
+	if err != nil {
+		err = fmt.Errorf("fetchMols: %w", err)
+		return
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchMols to fetch the molecules.
+func (s *ShellReorient) readCfg(r *bufio.Reader) (box [3]float64, mols []molecule, solute [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	mols, solute, err = s.fetchMols(r)
+	if err != nil {
+		err = fmt.Errorf("fetchMols: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchMols fetches the coordinates and the types of the atoms and groups them
+// in molecules. A new molecule starts when the molecule identifier changes.
+// The coordinates of the solute atoms are returned as well.
+func (s *ShellReorient) fetchMols(r *bufio.Reader) ([]molecule, [][3]float64, error) {
+	var (
+		mols   []molecule
+		solute [][3]float64
+		mol    string
+	)
+
+	for i := 0; i < s.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != s.colsLen {
+			return nil, nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), s.colsLen)
+		}
+
+		molID := util.MolID(fields, s.cols[4], i, s.AtomsPerMolecule)
+		if i == 0 || molID != mol {
+			mol = molID
+			mols = append(mols, molecule{})
+		}
+
+		var xyz [3]float64
+		for k := 0; k < 3; k++ {
+			xyz[k], _ = strconv.ParseFloat(fields[s.cols[k]], 64)
+		}
+
+		last := &mols[len(mols)-1]
+		last.xyz = append(last.xyz, xyz)
+		last.types = append(last.types, fields[s.cols[3]])
+
+		if s.solute[fields[s.cols[3]]] {
+			solute = append(solute, xyz)
+		}
+	}
+
+	return mols, solute, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,340 @@
+// Package shellreorient calculates the reorientational correlation function of
+// a bond vector of the solvent molecules, resolved by the shell around a
+// solute in which the molecules are at the time origin.
+//
+// The correlation function is C2(t) = <P2(u(t0).u(t0+t))>, u being the unit
+// bond vector of a molecule and P2(x) = (3x²-1)/2 the second Legendre
+// polynomial. The average runs over the molecules that are in the shell at t0
+// and over the time origins t0.
+package shellreorient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "shell_reorientation"
+
+// molecule contains the coordinates and the types of the atoms of a molecule.
+type molecule struct {
+	xyz   [][3]float64
+	types []string
+}
+
+// ShellReorient is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the bond vectors of each configuration.
+//
+// The bond vector of a molecule goes from its atom Offsets[0] to its atom
+// Offsets[1] (see orientation). Only the molecules whose atom Offsets[0] has
+// the type AtomType are taken into account, and their number must not change
+// along the trajectory. The distance of a molecule to the solute is the
+// distance between its atom Offsets[0] and the closest atom whose type is in
+// Solute. Shells are the increasing outer radii of the shells: the first shell
+// goes from 0 to Shells[0], the second from Shells[0] to Shells[1], and so on.
+// The molecules beyond the last radius are not taken into account.
+// If the trajectory has no mol column, AtomsPerMolecule is used to group the
+// atoms in molecules (see util.MolID). CfgStart must be lower than CfgEnd.
+// LagMax must be lower than the number of configurations. If the trajectory
+// ends before CfgEnd, the configurations read are used, the lags stop at the
+// last configuration read, and a warning is logged.
+type ShellReorient struct {
+	FileIn  string `toml:"shell_reorientation.file_in"`
+	FileOut string `toml:"shell_reorientation.file_out"`
+
+	CfgStart int `toml:"shell_reorientation.cfg_start"`
+	CfgEnd   int `toml:"shell_reorientation.cfg_end"`
+
+	Solute   []string `toml:"shell_reorientation.solute"`
+	AtomType string   `toml:"shell_reorientation.atom_type"`
+	Offsets  []int    `toml:"shell_reorientation.offsets"`
+
+	Shells []float64 `toml:"shell_reorientation.shells"`
+	LagMax int       `toml:"shell_reorientation.lag_max"`
+
+	AtomsPerMolecule int `toml:"shell_reorientation.atoms_per_molecule"`
+
+	Dt float64 `toml:"shell_reorientation.dt"`
+
+	solute map[string]bool
+
+	atoms   int
+	cols    [5]int
+	colsLen int
+
+	vecs   [][][3]float64
+	shells [][]int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the ShellReorient structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*ShellReorient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var shellReorient ShellReorient
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&shellReorient)
+	if err != nil {
+		return nil, err
+	}
+
+	if shellReorient.CfgStart >= shellReorient.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if shellReorient.LagMax <= 0 || shellReorient.LagMax >= (shellReorient.CfgEnd-shellReorient.CfgStart) {
+		return nil, errors.New("LagMax must be strictly positive and lower than the number of configurations")
+	}
+
+	if len(shellReorient.Offsets) != 2 || shellReorient.Offsets[0] < 0 ||
+		shellReorient.Offsets[1] < 0 || shellReorient.Offsets[0] == shellReorient.Offsets[1] {
+		return nil, errors.New("Offsets must contain two different positive offsets")
+	}
+
+	if len(shellReorient.Solute) == 0 {
+		return nil, errors.New("no solute atom type selected")
+	}
+
+	if len(shellReorient.Shells) == 0 {
+		return nil, errors.New("no shell defined")
+	}
+
+	for i, v := range shellReorient.Shells {
+		if v <= 0 || (i > 0 && v <= shellReorient.Shells[i-1]) {
+			return nil, errors.New("Shells must be strictly positive and increasing")
+		}
+	}
+
+	shellReorient.solute = make(map[string]bool, len(shellReorient.Solute))
+	for _, v := range shellReorient.Solute {
+		shellReorient.solute[v] = true
+	}
+
+	return &shellReorient, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (s *ShellReorient) SetOutputDir(dir string) {
+	s.FileOut = util.FileOut(s.FileOut, dir, s.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (s *ShellReorient) SetOutputFormat(format string) {
+	s.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (s *ShellReorient) SetProgress(p *util.Progress) {
+	s.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (s *ShellReorient) SetInput(in util.Input) {
+	s.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (s *ShellReorient) SetLog(log *log.Logger) {
+	s.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread. The bond vectors and the shells of every
+// configuration are kept in memory.
+func (s *ShellReorient) Start() error {
+	f, traj, err := util.OpenTrajectory(s.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(s.input.Reader(traj))
+
+	err = s.input.SkipTo(f, r, 0, s.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, mols, solute, err := s.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	s.vecs = make([][][3]float64, 0, s.CfgEnd-s.CfgStart)
+	s.shells = make([][]int, 0, s.CfgEnd-s.CfgStart)
+	err = s.calc(box, mols, solute)
+	if err != nil {
+		return fmt.Errorf("calc: %w", err)
+	}
+
+	for i := 1; i < (s.CfgEnd - s.CfgStart); i++ {
+		err = s.input.SkipTo(f, r, s.CfgStart+i, s.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(s.log, Type, s.CfgStart+i, s.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, mols, solute, err := s.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		err = s.calc(box, mols, solute)
+		if err != nil {
+			return fmt.Errorf("calc (step %d): %w", i, err)
+		}
+		s.progress.Update(i+1, s.CfgEnd-s.CfgStart)
+	}
+
+	out, err := util.WriteFormat(s.FileOut, s, s.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	s.write(out)
+
+	return nil
+}
+
+// calc saves the unit bond vector of each molecule and the shell in which it
+// is (-1 if it is beyond the last shell).
+func (s *ShellReorient) calc(box [3]float64, mols []molecule, solute [][3]float64) error {
+	if len(solute) == 0 {
+		return errors.New("no solute atom in the configuration")
+	}
+
+	a, b := s.Offsets[0], s.Offsets[1]
+	var (
+		vecs   [][3]float64
+		shells []int
+	)
+	for _, mol := range mols {
+		if a >= len(mol.xyz) || b >= len(mol.xyz) || mol.types[a] != s.AtomType {
+			continue
+		}
+
+		vec := util.MinImage(mol.xyz[b], mol.xyz[a], box)
+		norm := vec[0]*vec[0] + vec[1]*vec[1] + vec[2]*vec[2]
+
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			return errors.New("bond vector of length 0")
+		}
+		for k := 0; k < 3; k++ {
+			vec[k] /= norm
+		}
+
+		dist := math.MaxFloat64
+		for _, xyzSol := range solute {
+			d := util.MinImageDist2(mol.xyz[a], xyzSol, box)
+			dist = math.Min(dist, d)
+		}
+		dist = math.Sqrt(dist)
+
+		shell := -1
+		for i, v := range s.Shells {
+			if dist < v {
+				shell = i
+				break
+			}
+		}
+
+		vecs = append(vecs, vec)
+		shells = append(shells, shell)
+	}
+
+	if len(s.vecs) > 0 && len(vecs) != len(s.vecs[0]) {
+		return fmt.Errorf("number of molecules don't match: %d (expected %d)", len(vecs), len(s.vecs[0]))
+	}
+
+	s.vecs = append(s.vecs, vecs)
+	s.shells = append(s.shells, shells)
+	return nil
+}
+
+// write calculates the correlation function of each shell using every
+// configuration as a time origin and writes the results into a file. The
+// correlation times are the integrals of the correlation functions
+// (trapezoidal rule).
+func (s *ShellReorient) write(w io.Writer) {
+	lagMax := s.LagMax
+	if lagMax >= len(s.vecs) {
+		lagMax = len(s.vecs) - 1
+	}
+
+	c2 := make([][]float64, len(s.Shells))
+	norm := make([][]float64, len(s.Shells))
+	for i := range c2 {
+		c2[i] = make([]float64, lagMax+1)
+		norm[i] = make([]float64, lagMax+1)
+	}
+
+	for t0, vecs := range s.vecs {
+		for mol, vec0 := range vecs {
+			shell := s.shells[t0][mol]
+			if shell < 0 {
+				continue
+			}
+
+			for lag := 0; lag <= lagMax && (t0+lag) < len(s.vecs); lag++ {
+				vec := s.vecs[t0+lag][mol]
+				cos := vec0[0]*vec[0] + vec0[1]*vec[1] + vec0[2]*vec[2]
+				c2[shell][lag] += (3.*cos*cos - 1.) / 2.
+				norm[shell][lag]++
+			}
+		}
+	}
+
+	fmt.Fprint(w, "lag t")
+	for i := range s.Shells {
+		fmt.Fprintf(w, " C2_%d", i)
+	}
+	fmt.Fprint(w, "\n")
+
+	tau := make([]float64, len(s.Shells))
+	for lag := 0; lag <= lagMax; lag++ {
+		fmt.Fprintf(w, "%d %g", lag, float64(lag)*s.Dt)
+		for i := range s.Shells {
+			if norm[i][lag] > 0 {
+				c2[i][lag] /= norm[i][lag]
+			}
+
+			if lag > 0 {
+				tau[i] += (c2[i][lag] + c2[i][lag-1]) / 2. * s.Dt
+			}
+
+			fmt.Fprintf(w, " %g", c2[i][lag])
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprint(w, "\nshell rmin rmax origins tau\n")
+	for i, v := range s.Shells {
+		var rmin float64
+		if i > 0 {
+			rmin = s.Shells[i-1]
+		}
+		fmt.Fprintf(w, "%d %g %g %g %g\n", i, rmin, v, norm[i][0], tau[i])
+	}
+}
@@ -0,0 +1,120 @@
+package shellreorient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newShellReorient writes the trajectory traj and the configuration file made
+// of the parameters params (without the table [shell_reorientation]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newShellReorient(t *testing.T, params, traj string) *ShellReorient {
+	dir, err := ioutil.TempDir("", "shellreorient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "shellreorient.toml")
+	cfg := fmt.Sprintf("[shell_reorientation]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "shellreorient.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// configuration returns a configuration of a cubic box of length 10 containing
+// a solute atom (type 3) at solute and a molecule whose atoms (types 1 and 2)
+// are at mol.
+func configuration(step int, solute [3]float64, mol [2][3]float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n3\n", step)
+	b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id mol type x y z\n")
+	fmt.Fprintf(&b, "1 1 3 %g %g %g\n", solute[0], solute[1], solute[2])
+	for i, v := range mol {
+		fmt.Fprintf(&b, "%d 2 %d %g %g %g\n", i+2, i+1, v[0], v[1], v[2])
+	}
+	return b.String()
+}
+
+// params are the parameters of the tests: the bond vector goes from the atom
+// of type 1 to the atom of type 2, in a single shell of radius 2.
+const params = "solute = [\"3\"]\natom_type = \"1\"\noffsets = [0, 1]\nshells = [2.0]\ndt = 1.0\n"
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations: the bond vector is along x, x, and
+	// y.
+	solute := [3]float64{5, 5, 5}
+	var traj strings.Builder
+	traj.WriteString(configuration(0, solute, [2][3]float64{{6, 5, 5}, {7, 5, 5}}))
+	traj.WriteString(configuration(1, solute, [2][3]float64{{6, 5, 5}, {7, 5, 5}}))
+	traj.WriteString(configuration(2, solute, [2][3]float64{{6, 5, 5}, {6, 6, 5}}))
+
+	s := newShellReorient(t, params+"cfg_end = 10\nlag_max = 5\n", traj.String())
+	var logs strings.Builder
+	s.SetLog(log.New(&logs, "", 0))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "shell_reorientation: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	// The lags stop at 2, the last configuration read.
+	b, err := ioutil.ReadFile(s.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "lag t C2_0\n0 0 1\n1 1 0.25\n2 2 -0.5\n") {
+		t.Errorf("wrong correlation:\n%s", b)
+	}
+}
+
+func TestPeriodicBond(t *testing.T) {
+	// The bond vector is along (1, 1, 0) in both configurations, but it
+	// crosses the boundary along x in the first one.
+	var traj strings.Builder
+	traj.WriteString(configuration(0, [3]float64{9.5, 4, 5}, [2][3]float64{{9.5, 5, 5}, {0.5, 6, 5}}))
+	traj.WriteString(configuration(1, [3]float64{5, 4, 5}, [2][3]float64{{5, 5, 5}, {6, 6, 5}}))
+
+	s := newShellReorient(t, params+"cfg_end = 2\nlag_max = 1\n", traj.String())
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(s.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	out = out[strings.Index(out, "lag t C2_0\n"):]
+	var lag, time, c2 float64
+	_, err = fmt.Sscanf(strings.Split(out, "\n")[2], "%g %g %g", &lag, &time, &c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(c2-1) > 1e-9 {
+		t.Errorf("C2(1) = %g, want 1 with the bond at its minimum image", c2)
+	}
+}
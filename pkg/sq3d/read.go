@@ -0,0 +1,121 @@
+package sq3d
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (s *SQ3D) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	s.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	s.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			s.cols[0] = k
+		case "y":
+			s.cols[1] = k
+		case "z":
+			s.cols[2] = k
+		case "type":
+			s.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(s.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = s.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	if len(xyz) == 0 {
+		return box, nil, fmt.Errorf("no atom of the selected types")
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (s *SQ3D) readCfg(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = s.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms whose type is in Atoms.
+func (s *SQ3D) fetchXYZ(r *bufio.Reader) ([][3]float64, error) {
+	var xyz [][3]float64
+	for i := 0; i < s.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != s.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), s.colsLen)
+		}
+
+		var ok bool
+		for _, v := range s.Atoms {
+			if v == fields[s.cols[3]] {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		var xyzt [3]float64
+		for k := 0; k < 3; k++ {
+			xyzt[k], _ = strconv.ParseFloat(fields[s.cols[k]], 64)
+		}
+
+		xyz = append(xyz, xyzt)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,321 @@
+// Package sq3d calculates the static structure factor S(q) on a three
+// dimensional grid of wave vectors.
+//
+// The grid is built from the reciprocal lattice of the orthogonal box: a wave
+// vector is q = 2π (nx/Lx, ny/Ly, nz/Lz) where nx, ny, and nz are integers
+// between -NMax and NMax (q = 0 is omitted). The wave vectors are therefore
+// compatible with the periodic boundary conditions. For each configuration,
+// ρ(q) = Σ exp(iq·r) is calculated for the selected atoms and S(q) is the
+// average of |ρ(q)|²/N. The values of q written in the output file use the
+// average size of the box.
+package sq3d
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "sq3d"
+
+// SQ3D is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, the accumulated structure factor, ...
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd,
+// the configurations read are used and a warning is logged. The configurations
+// without atom of the types in Atoms are skipped, S(q) being undefined, and a
+// warning is logged as well. NMax must contain 3 values.
+type SQ3D struct {
+	FileIn  string `toml:"sq3d.file_in"`
+	FileOut string `toml:"sq3d.file_out"`
+
+	CfgStart int `toml:"sq3d.cfg_start"`
+	CfgEnd   int `toml:"sq3d.cfg_end"`
+
+	Atoms []string `toml:"sq3d.atoms"`
+	NMax  []int    `toml:"sq3d.nmax"`
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	grid    [3]int
+	sq      []float64
+	box     [3]float64
+	nbCfg   int
+	skipped int // configurations without selected atom
+
+	progress *util.Progress
+	input    util.Input
+	format   string
+	log      *log.Logger
+	cfg      int
+	end      int // first configuration missing from the trajectory (0 if none)
+	err      error
+	mux      sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// New returns an instance of the SQ3D structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*SQ3D, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sq3d SQ3D
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&sq3d)
+	if err != nil {
+		return nil, err
+	}
+
+	if sq3d.CfgStart >= sq3d.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(sq3d.NMax) != 3 {
+		return nil, errors.New("length of NMax is not equal to 3")
+	}
+
+	if len(sq3d.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	size := 1
+	for k := 0; k < 3; k++ {
+		if sq3d.NMax[k] < 0 {
+			return nil, errors.New("NMax must be positive")
+		}
+		sq3d.grid[k] = 2*sq3d.NMax[k] + 1
+		size *= sq3d.grid[k]
+	}
+	sq3d.sq = make([]float64, size)
+
+	return &sq3d, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (s *SQ3D) SetOutputDir(dir string) {
+	s.FileOut = util.FileOut(s.FileOut, dir, s.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (s *SQ3D) SetOutputFormat(format string) {
+	s.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (s *SQ3D) SetProgress(p *util.Progress) {
+	s.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (s *SQ3D) SetInput(in util.Input) {
+	s.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (s *SQ3D) SetLog(log *log.Logger) {
+	s.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation will use all the threads available.
+func (s *SQ3D) Start() error {
+	f, traj, err := util.OpenTrajectory(s.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(s.input.Reader(traj))
+
+	err = s.input.SkipTo(f, r, 0, s.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := s.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+
+	s.calc(box, xyz)
+	s.cfg = s.CfgStart
+
+	for i := 0; i < (runtime.NumCPU() - 1); i++ {
+		s.wg.Add(1)
+		go s.start(f, r)
+	}
+
+	s.wg.Add(1)
+	s.start(f, r)
+	s.wg.Wait()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.end != 0 {
+		util.LogEndOfTrajectory(s.log, Type, s.end, s.CfgEnd-1, s.end-s.CfgStart)
+	}
+	if s.skipped > 0 && s.log != nil {
+		s.log.Printf("%s: %d configurations without atom of the types in Atoms skipped", Type, s.skipped)
+	}
+	if s.nbCfg == 0 {
+		return errors.New("no atom of the types in Atoms in the configurations read")
+	}
+
+	out, err := util.WriteFormat(s.FileOut, s, s.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	s.write(out)
+
+	return nil
+}
+
+func (s *SQ3D) start(f *os.File, r *bufio.Reader) {
+	for {
+		s.mux.Lock()
+		s.cfg++
+		if s.cfg >= s.CfgEnd || s.err != nil {
+			break
+		}
+
+		err := s.input.SkipTo(f, r, s.cfg, s.cfg)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			s.end = s.cfg
+			s.cfg = s.CfgEnd // the other threads stop as well
+			break
+		} else if err != nil {
+			if s.err == nil {
+				s.err = fmt.Errorf("SkipTo (step %d): %w", s.cfg, err)
+			}
+			break
+		}
+
+		box, xyz, err := s.readCfg(r)
+		if err != nil {
+			if s.err == nil {
+				s.err = fmt.Errorf("readCfg (step %d): %w", s.cfg, err)
+			}
+			break
+		}
+		s.progress.Update(s.cfg-s.CfgStart+1, s.CfgEnd-s.CfgStart)
+		s.mux.Unlock()
+		s.calc(box, xyz)
+	}
+
+	s.mux.Unlock()
+	s.wg.Done()
+}
+
+// calc calculates |ρ(q)|²/N for every wave vector of the grid and adds it to
+// the structure factor. The exponentials are separable: exp(iq·r) is the
+// product of the exponentials along each dimension, which are calculated once
+// per atom. The configurations without atom are skipped.
+func (s *SQ3D) calc(box [3]float64, xyz [][3]float64) {
+	if len(xyz) == 0 {
+		s.mux.Lock()
+		s.skipped++
+		s.mux.Unlock()
+		return
+	}
+
+	sq := make([]float64, len(s.sq))
+	rho := make([]complex128, len(s.sq))
+
+	var exp [3][]complex128
+	for k := 0; k < 3; k++ {
+		exp[k] = make([]complex128, s.grid[k])
+	}
+
+	for _, v := range xyz {
+		for k := 0; k < 3; k++ {
+			for n := 0; n < s.grid[k]; n++ {
+				arg := 2. * math.Pi * float64(n-s.NMax[k]) * v[k] / box[k]
+				exp[k][n] = complex(math.Cos(arg), math.Sin(arg))
+			}
+		}
+
+		var i int
+		for nx := 0; nx < s.grid[0]; nx++ {
+			for ny := 0; ny < s.grid[1]; ny++ {
+				expxy := exp[0][nx] * exp[1][ny]
+				for nz := 0; nz < s.grid[2]; nz++ {
+					rho[i] += expxy * exp[2][nz]
+					i++
+				}
+			}
+		}
+	}
+
+	for i, v := range rho {
+		sq[i] = (real(v)*real(v) + imag(v)*imag(v)) / float64(len(xyz))
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, v := range sq {
+		s.sq[i] += v
+	}
+	for k := 0; k < 3; k++ {
+		s.box[k] += box[k]
+	}
+	s.nbCfg++
+}
+
+// write writes the results of this calculation into a file. The structure
+// factor is averaged over the configurations read.
+func (s *SQ3D) write(w io.Writer) {
+	nbCfg := float64(s.nbCfg)
+
+	var box [3]float64
+	for k := 0; k < 3; k++ {
+		box[k] = s.box[k] / nbCfg
+	}
+
+	fmt.Fprint(w, "nx ny nz qx qy qz q S\n")
+
+	var i int
+	for nx := -s.NMax[0]; nx <= s.NMax[0]; nx++ {
+		for ny := -s.NMax[1]; ny <= s.NMax[1]; ny++ {
+			for nz := -s.NMax[2]; nz <= s.NMax[2]; nz++ {
+				if nx == 0 && ny == 0 && nz == 0 {
+					i++
+					continue
+				}
+
+				var (
+					q     [3]float64
+					qNorm float64
+				)
+				for k, n := range [3]int{nx, ny, nz} {
+					q[k] = 2. * math.Pi * float64(n) / box[k]
+					qNorm += q[k] * q[k]
+				}
+
+				fmt.Fprintf(w, "%d %d %d %g %g %g %g %g\n", nx, ny, nz,
+					q[0], q[1], q[2], math.Sqrt(qNorm), s.sq[i]/nbCfg)
+				i++
+			}
+		}
+	}
+}
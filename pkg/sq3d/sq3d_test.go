@@ -0,0 +1,186 @@
+package sq3d
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newSQ3D writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [sq3d]) into a temporary directory, and
+// returns the calculation read from this file by New.
+func newSQ3D(t *testing.T, params, traj string) *SQ3D {
+	dir, err := ioutil.TempDir("", "sq3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "sq3d.toml")
+	cfg := fmt.Sprintf("[sq3d]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "sq3d.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// structureFactor returns S for each wave vector (nx, ny, nz) of the output
+// file path.
+func structureFactor(t *testing.T, path string) map[[3]int]float64 {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+
+	sq := make(map[[3]int]float64)
+	for _, line := range strings.Split(out[strings.Index(out, "nx ny nz "):], "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			break
+		}
+
+		var n [3]int
+		for k := 0; k < 3; k++ {
+			n[k], err = strconv.Atoi(fields[k])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		sq[n], err = strconv.ParseFloat(fields[7], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sq
+}
+
+// configuration returns a configuration of a cubic box of length l containing
+// the atoms xyz of type 1.
+func configuration(step int, l float64, xyz [][3]float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", step, len(xyz))
+	fmt.Fprintf(&b, "ITEM: BOX BOUNDS pp pp pp\n0 %g\n0 %g\n0 %g\nITEM: ATOMS id type x y z\n", l, l, l)
+	for i, v := range xyz {
+		fmt.Fprintf(&b, "%d 1 %g %g %g\n", i+1, v[0], v[1], v[2])
+	}
+	return b.String()
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// A single atom: |ρ(q)|²/N is equal to 1 for every wave vector, so that S
+	// is equal to 1 if it is averaged over the configurations read.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		traj.WriteString(configuration(i, 10, [][3]float64{{float64(i), 1, 2}}))
+	}
+
+	s := newSQ3D(t, "cfg_end = 10\natoms = [\"1\"]\nnmax = [1, 1, 0]\n", traj.String())
+	var logs strings.Builder
+	s.SetLog(log.New(&logs, "", 0))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "sq3d: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	sq := structureFactor(t, s.FileOut)
+	if len(sq) != 8 {
+		t.Errorf("%d wave vectors, want 8", len(sq))
+	}
+	for n, v := range sq {
+		if v < 1-1e-9 || v > 1+1e-9 {
+			t.Errorf("S%v = %g, want 1", n, v)
+		}
+	}
+}
+
+func TestBraggPeaks(t *testing.T) {
+	// A simple cubic lattice of 3×3×3 atoms with a spacing of 1: ρ(q) is equal
+	// to N on the reciprocal lattice (n multiple of 3) and to 0 elsewhere.
+	var xyz [][3]float64
+	for x := 0; x < 3; x++ {
+		for y := 0; y < 3; y++ {
+			for z := 0; z < 3; z++ {
+				xyz = append(xyz, [3]float64{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5})
+			}
+		}
+	}
+
+	s := newSQ3D(t, "cfg_end = 1\natoms = [\"1\"]\nnmax = [3, 3, 3]\n", configuration(0, 3, xyz))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sq := structureFactor(t, s.FileOut)
+	if len(sq) != 7*7*7-1 {
+		t.Errorf("%d wave vectors, want %d", len(sq), 7*7*7-1)
+	}
+	for n, v := range sq {
+		want := 0.
+		if n[0]%3 == 0 && n[1]%3 == 0 && n[2]%3 == 0 {
+			want = float64(len(xyz))
+		}
+		if math.Abs(v-want) > 1e-9 {
+			t.Errorf("S%v = %g, want %g", n, v, want)
+		}
+	}
+}
+
+func TestNoAtom(t *testing.T) {
+	// The atom has the type 2 in the second configuration, which therefore has
+	// no atom of type 1: it is skipped instead of giving NaN, and S is the one
+	// of the two other configurations.
+	other := strings.Replace(configuration(1, 10, [][3]float64{{0, 1, 2}}), "\n1 1 ", "\n1 2 ", 1)
+	traj := configuration(0, 10, [][3]float64{{0, 1, 2}}) + other + configuration(2, 10, [][3]float64{{1, 1, 2}})
+
+	s := newSQ3D(t, "cfg_end = 3\natoms = [\"1\"]\nnmax = [1, 0, 0]\n", traj)
+	var logs strings.Builder
+	s.SetLog(log.New(&logs, "", 0))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "sq3d: 1 configurations without atom of the types in Atoms skipped\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+	if s.nbCfg != 2 {
+		t.Errorf("%d configurations used, want 2", s.nbCfg)
+	}
+	for n, v := range structureFactor(t, s.FileOut) {
+		if math.Abs(v-1) > 1e-9 {
+			t.Errorf("S%v = %g, want 1", n, v)
+		}
+	}
+
+	// Without any atom of type 1, there is no structure factor.
+	s = newSQ3D(t, "cfg_end = 1\natoms = [\"1\"]\nnmax = [1, 0, 0]\n", other)
+	err = s.Start()
+	if err == nil {
+		t.Error("no atom: no error")
+	}
+}
@@ -0,0 +1,377 @@
+// Package sqslab calculates the in-plane static structure factor S(qxy) of the
+// atoms in slabs perpendicular to an axis, e.g. to follow the ordering of the
+// layers of a liquid near an interface.
+//
+// The wave vectors are parallel to the plane of the slabs. They are built from
+// the reciprocal lattice of the orthogonal box like in sq3d: q = 2π (na/La,
+// nb/Lb), a and b being the two other dimensions and na and nb integers between
+// -NMax and NMax (q = 0 is omitted). For each configuration and each slab,
+// ρ(q) = Σ exp(iq·r) is calculated for the N atoms of the slab and |ρ(q)|²/N is
+// averaged over the configurations where the slab isn't empty. S(qxy) is then
+// averaged over the wave vectors whose norm falls in the same bin.
+package sqslab
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "sq_slab"
+
+// SQSlab is a structure containing the parameters that can be parsed from a
+// TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the accumulated structure factors.
+//
+// If Select is set, only the atoms satisfying this expression are used (see
+// util.Selection). The atoms are assigned to a slab according to their wrapped
+// position (x, y, or z column) along Axis (z by default) in each
+// configuration. Slabs are the increasing edges of the slabs like in msd; the
+// atoms outside the slabs are not taken into account. NMax contains the
+// maximum integers of the two dimensions of the plane, in the order x, y, z
+// without Axis. The norms of the wave vectors are binned with bins of width Dq
+// and the norm written for each bin is the average norm of its wave vectors,
+// calculated with the average size of the box. The bins without any wave
+// vector are not written. CfgStart must be lower than CfgEnd. If the trajectory
+// ends before CfgEnd, the configurations read are used and a warning is logged.
+type SQSlab struct {
+	FileIn  string `toml:"sq_slab.file_in"`
+	FileOut string `toml:"sq_slab.file_out"`
+
+	CfgStart int `toml:"sq_slab.cfg_start"`
+	CfgEnd   int `toml:"sq_slab.cfg_end"`
+
+	Select string `toml:"sq_slab.select"`
+
+	Axis  string    `toml:"sq_slab.axis"`
+	Slabs []float64 `toml:"sq_slab.slabs"`
+
+	NMax []int   `toml:"sq_slab.nmax"`
+	Dq   float64 `toml:"sq_slab.dq"`
+
+	sel   *util.Selection
+	axis  int
+	plane [2]int // dimensions of the plane
+	grid  [2]int
+	nb    int // number of slabs
+
+	sq    [][]float64 // structure factor of each slab and wave vector
+	cfg   []float64   // number of configurations where each slab isn't empty
+	count []float64   // number of atoms in each slab
+	box   [3]float64
+	nbCfg int
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the SQSlab structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*SQSlab, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sqSlab SQSlab
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&sqSlab)
+	if err != nil {
+		return nil, err
+	}
+
+	if sqSlab.CfgStart >= sqSlab.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if sqSlab.Select != "" {
+		sqSlab.sel, err = util.NewSelection(sqSlab.Select)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection: %w", err)
+		}
+	}
+
+	switch sqSlab.Axis {
+	case "x":
+		sqSlab.axis = 0
+	case "y":
+		sqSlab.axis = 1
+	case "z", "":
+		sqSlab.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", sqSlab.Axis)
+	}
+	sqSlab.plane = [2]int{(sqSlab.axis + 1) % 3, (sqSlab.axis + 2) % 3}
+	if sqSlab.plane[0] > sqSlab.plane[1] {
+		sqSlab.plane[0], sqSlab.plane[1] = sqSlab.plane[1], sqSlab.plane[0]
+	}
+
+	if len(sqSlab.Slabs) < 2 {
+		return nil, errors.New("Slabs must contain at least two edges")
+	}
+
+	for i := 1; i < len(sqSlab.Slabs); i++ {
+		if sqSlab.Slabs[i] <= sqSlab.Slabs[i-1] {
+			return nil, errors.New("Slabs must be increasing")
+		}
+	}
+	sqSlab.nb = len(sqSlab.Slabs) - 1
+
+	if len(sqSlab.NMax) != 2 {
+		return nil, errors.New("length of NMax is not equal to 2")
+	}
+
+	size := 1
+	for k := 0; k < 2; k++ {
+		if sqSlab.NMax[k] < 0 {
+			return nil, errors.New("NMax must be positive")
+		}
+		sqSlab.grid[k] = 2*sqSlab.NMax[k] + 1
+		size *= sqSlab.grid[k]
+	}
+
+	if sqSlab.Dq <= 0 {
+		return nil, errors.New("Dq must be strictly positive")
+	}
+
+	sqSlab.sq = make([][]float64, sqSlab.nb)
+	for i := range sqSlab.sq {
+		sqSlab.sq[i] = make([]float64, size)
+	}
+	sqSlab.cfg = make([]float64, sqSlab.nb)
+	sqSlab.count = make([]float64, sqSlab.nb)
+
+	return &sqSlab, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (s *SQSlab) SetOutputDir(dir string) {
+	s.FileOut = util.FileOut(s.FileOut, dir, s.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (s *SQSlab) SetOutputFormat(format string) {
+	s.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (s *SQSlab) SetProgress(p *util.Progress) {
+	s.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (s *SQSlab) SetInput(in util.Input) {
+	s.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (s *SQSlab) SetLog(log *log.Logger) {
+	s.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (s *SQSlab) Start() error {
+	f, traj, err := util.OpenTrajectory(s.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(s.input.Reader(traj))
+
+	err = s.input.SkipTo(f, r, 0, s.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := s.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	s.calc(box, xyz)
+
+	for i := 1; i < (s.CfgEnd - s.CfgStart); i++ {
+		err = s.input.SkipTo(f, r, s.CfgStart+i, s.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(s.log, Type, s.CfgStart+i, s.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := s.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		s.calc(box, xyz)
+		s.progress.Update(i+1, s.CfgEnd-s.CfgStart)
+	}
+
+	out, err := util.WriteFormat(s.FileOut, s, s.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	s.write(out)
+
+	return nil
+}
+
+// slabOf returns the slab of an atom from its wrapped position along the axis,
+// or -1 if it is outside the slabs.
+func (s *SQSlab) slabOf(pos float64) int {
+	for i := 0; i < s.nb; i++ {
+		if pos >= s.Slabs[i] && pos < s.Slabs[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// calc calculates |ρ(q)|²/N for every wave vector of the grid and every slab
+// and adds it to the structure factors. The exponentials are separable like in
+// sq3d.
+func (s *SQSlab) calc(box [3]float64, xyz [][3]float64) {
+	rho := make([][]complex128, s.nb)
+	nb := make([]int, s.nb)
+	for i := range rho {
+		rho[i] = make([]complex128, len(s.sq[i]))
+	}
+
+	var exp [2][]complex128
+	for k := 0; k < 2; k++ {
+		exp[k] = make([]complex128, s.grid[k])
+	}
+
+	for _, v := range xyz {
+		slab := s.slabOf(v[s.axis])
+		if slab < 0 {
+			continue
+		}
+		nb[slab]++
+
+		for k, dim := range s.plane {
+			for n := 0; n < s.grid[k]; n++ {
+				arg := 2. * math.Pi * float64(n-s.NMax[k]) * v[dim] / box[dim]
+				exp[k][n] = complex(math.Cos(arg), math.Sin(arg))
+			}
+		}
+
+		var i int
+		for ia := 0; ia < s.grid[0]; ia++ {
+			for ib := 0; ib < s.grid[1]; ib++ {
+				rho[slab][i] += exp[0][ia] * exp[1][ib]
+				i++
+			}
+		}
+	}
+
+	for slab, n := range nb {
+		if n == 0 {
+			continue
+		}
+
+		for i, v := range rho[slab] {
+			s.sq[slab][i] += (real(v)*real(v) + imag(v)*imag(v)) / float64(n)
+		}
+		s.cfg[slab]++
+		s.count[slab] += float64(n)
+	}
+
+	for k := 0; k < 3; k++ {
+		s.box[k] += box[k]
+	}
+	s.nbCfg++
+}
+
+// write writes the structure factor of each slab (q S_0 S_1 ...), then the
+// average number of atoms of each slab. The structure factor of a slab that is
+// always empty is 0.
+func (s *SQSlab) write(w io.Writer) {
+	nbCfg := float64(s.nbCfg)
+
+	var box [3]float64
+	for k := 0; k < 3; k++ {
+		box[k] = s.box[k] / nbCfg
+	}
+
+	var (
+		qSum []float64
+		sq   = make([][]float64, s.nb)
+		vecs []float64 // number of wave vectors in each bin
+	)
+
+	var i int
+	for na := -s.NMax[0]; na <= s.NMax[0]; na++ {
+		for nb := -s.NMax[1]; nb <= s.NMax[1]; nb++ {
+			if na == 0 && nb == 0 {
+				i++
+				continue
+			}
+
+			qa := 2. * math.Pi * float64(na) / box[s.plane[0]]
+			qb := 2. * math.Pi * float64(nb) / box[s.plane[1]]
+			q := math.Sqrt(qa*qa + qb*qb)
+
+			bin := int(q / s.Dq)
+			for len(qSum) <= bin {
+				qSum = append(qSum, 0)
+				vecs = append(vecs, 0)
+				for slab := range sq {
+					sq[slab] = append(sq[slab], 0)
+				}
+			}
+
+			qSum[bin] += q
+			vecs[bin]++
+			for slab := range sq {
+				if s.cfg[slab] > 0 {
+					sq[slab][bin] += s.sq[slab][i] / s.cfg[slab]
+				}
+			}
+			i++
+		}
+	}
+
+	fmt.Fprint(w, "q")
+	for slab := 0; slab < s.nb; slab++ {
+		fmt.Fprintf(w, " S_%d", slab)
+	}
+	fmt.Fprint(w, "\n")
+
+	for bin, n := range vecs {
+		if n == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "%g", qSum[bin]/n)
+		for slab := range sq {
+			fmt.Fprintf(w, " %g", sq[slab][bin]/n)
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprint(w, "\nslab min max atoms\n")
+	for slab := 0; slab < s.nb; slab++ {
+		fmt.Fprintf(w, "%d %g %g %g\n", slab, s.Slabs[slab], s.Slabs[slab+1],
+			s.count[slab]/nbCfg)
+	}
+}
@@ -0,0 +1,76 @@
+package sqslab
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSQSlab writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [sq_slab]) into a temporary directory,
+// and returns the calculation read from this file by New.
+func newSQSlab(t *testing.T, params, traj string) *SQSlab {
+	dir, err := ioutil.TempDir("", "sqslab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "sqslab.toml")
+	cfg := fmt.Sprintf("[sq_slab]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "sqslab.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations with an atom in the first slab: S is
+	// equal to 1 and the slab contains an atom on average.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		fmt.Fprintf(&traj, "1 1 %d 3 2\n", i)
+	}
+
+	s := newSQSlab(t, "cfg_end = 10\nslabs = [0.0, 5.0, 10.0]\nnmax = [1, 0]\ndq = 1.0\n", traj.String())
+	var logs strings.Builder
+	s.SetLog(log.New(&logs, "", 0))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "sq_slab: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(s.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	if !strings.Contains(out, "q S_0 S_1\n0.6283185307179586 1 0\n") {
+		t.Errorf("wrong structure factors (the box isn't averaged over the configurations read?):\n%s", out)
+	}
+	if !strings.HasSuffix(out, "slab min max atoms\n0 0 5 1\n1 5 10 0\n") {
+		t.Errorf("the atoms of the slabs aren't averaged over the configurations read:\n%s", out)
+	}
+}
@@ -0,0 +1,116 @@
+package surfacedist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (s *SurfaceDist) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	s.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	s.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			s.cols[0] = k
+		case "y":
+			s.cols[1] = k
+		case "z":
+			s.cols[2] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(s.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, and z")
+		return
+	}
+
+	err = s.sel.Columns(fields)
+	if err != nil {
+		err = fmt.Errorf("Select: %w", err)
+		return
+	}
+
+	xyz, err = s.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (s *SurfaceDist) readCfg(r *bufio.Reader) (box [3]float64, xyz [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = s.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the selected atoms.
+func (s *SurfaceDist) fetchXYZ(r *bufio.Reader) (xyz [][3]float64, err error) {
+	for i := 0; i < s.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != s.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), s.colsLen)
+			return
+		}
+
+		var ok bool
+		ok, err = s.sel.Match(fields)
+		if err != nil {
+			return
+		} else if !ok {
+			continue
+		}
+
+		var at [3]float64
+		for k := 0; k < 3; k++ {
+			at[k], _ = strconv.ParseFloat(fields[s.cols[k]], 64)
+		}
+		xyz = append(xyz, at)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
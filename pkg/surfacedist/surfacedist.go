@@ -0,0 +1,290 @@
+// Package surfacedist calculates the density of atoms as a function of their
+// distance to a surface given by a triangulated mesh (e.g. the molecular
+// surface of a solute), i.e. a proximal density profile.
+package surfacedist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "surface_distance"
+
+// face is a triangle of the mesh with its centroid and the distance between
+// the centroid and its farthest vertex.
+type face struct {
+	tri    util.Triangle
+	center [3]float64
+	radius float64
+}
+
+// SurfaceDist is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the histogram.
+//
+// FileMesh is a Wavefront OBJ file containing the triangles of the surface
+// (see util.ReadMesh), in the coordinates of the trajectory. The mesh doesn't
+// move. The distance of an atom to the surface is its distance to the closest
+// triangle, each triangle being taken at the image of the atom closest to its
+// centroid (minimum image convention). It is not signed: the atoms inside a
+// closed surface are counted like the ones outside. If Select is set, only the
+// atoms satisfying this expression are counted (see util.Selection).
+//
+// The distances are binned up to RMax with bins of width Dr. The volume of each
+// shell of the surface is estimated from Samples points (100000 by default)
+// drawn uniformly in the box of the first configuration with the seed Seed. The
+// density is the number of atoms of the shell divided by its volume, averaged
+// over the configurations; the volume of the box of each configuration is used
+// so that the small fluctuations of the box (NPT) are taken into account.
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd, the
+// configurations read are used and a warning is logged.
+type SurfaceDist struct {
+	FileIn   string `toml:"surface_distance.file_in"`
+	FileOut  string `toml:"surface_distance.file_out"`
+	FileMesh string `toml:"surface_distance.file_mesh"`
+
+	CfgStart int `toml:"surface_distance.cfg_start"`
+	CfgEnd   int `toml:"surface_distance.cfg_end"`
+
+	Select string `toml:"surface_distance.select"`
+
+	RMax float64 `toml:"surface_distance.rmax"`
+	Dr   float64 `toml:"surface_distance.dr"`
+
+	Samples int   `toml:"surface_distance.samples"`
+	Seed    int64 `toml:"surface_distance.seed"`
+
+	faces []face
+	sel   *util.Selection
+
+	bins  int
+	hstg  []float64
+	shell []float64 // fraction of the volume of the box in each shell
+	vol   float64   // sum of the volumes of the box
+
+	atoms   int
+	cols    [3]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the SurfaceDist structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file. The
+// mesh is read as well.
+func New(path string) (*SurfaceDist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var surfaceDist SurfaceDist
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&surfaceDist)
+	if err != nil {
+		return nil, err
+	}
+
+	if surfaceDist.CfgStart >= surfaceDist.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if surfaceDist.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	surfaceDist.bins = int(surfaceDist.RMax / surfaceDist.Dr)
+	if surfaceDist.bins <= 1 {
+		return nil, errors.New("the number of bins must be greater than 1")
+	}
+	surfaceDist.hstg = make([]float64, surfaceDist.bins)
+
+	if surfaceDist.Samples < 0 {
+		return nil, errors.New("Samples must be positive")
+	}
+
+	if surfaceDist.Samples == 0 {
+		surfaceDist.Samples = 100000
+	}
+
+	if surfaceDist.Select != "" {
+		surfaceDist.sel, err = util.NewSelection(surfaceDist.Select)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection: %w", err)
+		}
+	}
+
+	triangles, err := util.ReadMesh(surfaceDist.FileMesh)
+	if err != nil {
+		return nil, fmt.Errorf("ReadMesh: %w", err)
+	}
+
+	surfaceDist.faces = make([]face, len(triangles))
+	for i, t := range triangles {
+		c, radius := t.Centroid()
+		surfaceDist.faces[i] = face{tri: t, center: c, radius: radius}
+	}
+
+	return &surfaceDist, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (s *SurfaceDist) SetOutputDir(dir string) {
+	s.FileOut = util.FileOut(s.FileOut, dir, s.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (s *SurfaceDist) SetOutputFormat(format string) {
+	s.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (s *SurfaceDist) SetProgress(p *util.Progress) {
+	s.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (s *SurfaceDist) SetInput(in util.Input) {
+	s.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (s *SurfaceDist) SetLog(log *log.Logger) {
+	s.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (s *SurfaceDist) Start() error {
+	f, traj, err := util.OpenTrajectory(s.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(s.input.Reader(traj))
+
+	err = s.input.SkipTo(f, r, 0, s.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := s.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	s.shells(box)
+	s.calc(box, xyz)
+
+	for i := 1; i < (s.CfgEnd - s.CfgStart); i++ {
+		err = s.input.SkipTo(f, r, s.CfgStart+i, s.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(s.log, Type, s.CfgStart+i, s.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := s.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		s.calc(box, xyz)
+		s.progress.Update(i+1, s.CfgEnd-s.CfgStart)
+	}
+
+	out, err := util.WriteFormat(s.FileOut, s, s.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	s.write(out)
+
+	return nil
+}
+
+// shells estimates the fraction of the volume of the box in each shell of the
+// surface with random points.
+func (s *SurfaceDist) shells(box [3]float64) {
+	rnd := rand.New(rand.NewSource(s.Seed))
+	s.shell = make([]float64, s.bins)
+	for i := 0; i < s.Samples; i++ {
+		var p [3]float64
+		for k := 0; k < 3; k++ {
+			p[k] = rnd.Float64() * box[k]
+		}
+
+		if bin := int(s.dist(box, p) / s.Dr); bin < s.bins {
+			s.shell[bin]++
+		}
+	}
+
+	for i := range s.shell {
+		s.shell[i] /= float64(s.Samples)
+	}
+}
+
+// calc adds the distances between the atoms and the surface to the histogram.
+func (s *SurfaceDist) calc(box [3]float64, xyz [][3]float64) {
+	for _, p := range xyz {
+		if bin := int(s.dist(box, p) / s.Dr); bin < s.bins {
+			s.hstg[bin]++
+		}
+	}
+	s.vol += box[0] * box[1] * box[2]
+}
+
+// dist returns the distance between the point p and the surface, or RMax if it
+// is greater. The triangles whose bounding sphere is farther than the closest
+// triangle found so far are skipped.
+func (s *SurfaceDist) dist(box [3]float64, p [3]float64) float64 {
+	best := s.RMax
+	for _, fc := range s.faces {
+		var (
+			q      [3]float64
+			center float64
+		)
+		d := util.MinImage(p, fc.center, box)
+		for k := 0; k < 3; k++ {
+			q[k] = fc.center[k] + d[k]
+			center += d[k] * d[k]
+		}
+
+		if math.Sqrt(center)-fc.radius >= best {
+			continue
+		}
+		best = math.Min(best, math.Sqrt(fc.tri.Dist2(q)))
+	}
+
+	return best
+}
+
+// write writes the density as a function of the distance to the surface. dist
+// is the middle of the bins. The density of a shell whose volume is zero (no
+// random point) is 0.
+func (s *SurfaceDist) write(w io.Writer) {
+	fmt.Fprint(w, "dist density\n")
+	for i, v := range s.hstg {
+		var rho float64
+		if s.shell[i] > 0 {
+			rho = v / (s.shell[i] * s.vol)
+		}
+		fmt.Fprintf(w, "%g %g\n", (float64(i)+0.5)*s.Dr, rho)
+	}
+}
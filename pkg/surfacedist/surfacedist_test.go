@@ -0,0 +1,76 @@
+package surfacedist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSurfaceDist writes the trajectory traj, the mesh mesh, and the
+// configuration file made of the parameters params (without the table
+// [surface_distance]) into a temporary directory, and returns the calculation
+// read from this file by New.
+func newSurfaceDist(t *testing.T, params, traj, mesh string) *SurfaceDist {
+	dir, err := ioutil.TempDir("", "surfacedist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "surfacedist.toml")
+	cfg := fmt.Sprintf("[surface_distance]\nfile_in = %q\nfile_out = %q\nfile_mesh = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "surfacedist.dat"),
+		filepath.Join(dir, "mesh.obj"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "mesh.obj"), []byte(mesh), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of an atom at 0.5 from a triangle.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		traj.WriteString("1 1 4 4 5.5\n")
+	}
+	mesh := "v 3 3 5\nv 7 3 5\nv 3 7 5\nf 1 2 3\n"
+
+	s := newSurfaceDist(t, "cfg_end = 10\nrmax = 2.0\ndr = 1.0\nsamples = 1000\n", traj.String(), mesh)
+	var logs strings.Builder
+	s.SetLog(log.New(&logs, "", 0))
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "surface_distance: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	if s.hstg[0] != 3 || s.hstg[1] != 0 {
+		t.Errorf("histogram %v, want [3 0]", s.hstg)
+	}
+	if s.vol != 3000 {
+		t.Errorf("sum of the volumes %g, want 3000", s.vol)
+	}
+}
@@ -0,0 +1,126 @@
+package tempprofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (t *TempProfile) readCfgFirst(r *bufio.Reader) (pos, mv2 []float64, err error) {
+	t.atoms, _, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	t.colsLen = len(fields)
+	for k, name := range fields {
+		switch name {
+		case "x":
+			t.cols[0] = k
+		case "y":
+			t.cols[1] = k
+		case "z":
+			t.cols[2] = k
+		case "vx":
+			t.cols[3] = k
+		case "vy":
+			t.cols[4] = k
+		case "vz":
+			t.cols[5] = k
+		case "type":
+			t.cols[6] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(t.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, z, vx, vy, vz, and type")
+		return
+	}
+
+	pos, mv2, err = t.fetchAtoms(r)
+	if err != nil {
+		err = fmt.Errorf("fetchAtoms: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchAtoms to fetch the positions and the kinetic energies of the atoms.
+func (t *TempProfile) readCfg(r *bufio.Reader) (pos, mv2 []float64, err error) {
+	_, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	pos, mv2, err = t.fetchAtoms(r)
+	if err != nil {
+		err = fmt.Errorf("fetchAtoms: %w", err)
+	}
+
+	return
+}
+
+// fetchAtoms fetches the position along the axis and m v² of the atoms whose
+// type is in Atoms (all the atoms if Atoms is empty).
+func (t *TempProfile) fetchAtoms(r *bufio.Reader) (pos, mv2 []float64, err error) {
+	for i := 0; i < t.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != t.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), t.colsLen)
+			return
+		}
+
+		typ := fields[t.cols[6]]
+		if t.types != nil && !t.types[typ] {
+			continue
+		}
+
+		mass, ok := t.Masses[typ]
+		if !ok {
+			err = fmt.Errorf("mass for atom type `%s` doesn't exist", typ)
+			return
+		}
+
+		var p, v2 float64
+		p, _ = strconv.ParseFloat(fields[t.cols[t.axis]], 64)
+		for k := 0; k < 3; k++ {
+			v, _ := strconv.ParseFloat(fields[t.cols[k+3]], 64)
+			v2 += v * v
+		}
+
+		pos = append(pos, p)
+		mv2 = append(mv2, mass*v2)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
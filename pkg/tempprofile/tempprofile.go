@@ -0,0 +1,264 @@
+// Package tempprofile calculates the kinetic temperature of the atoms in slabs
+// perpendicular to an axis, e.g. to check that a thermostat doesn't create a
+// temperature gradient.
+//
+// The kinetic temperature of the N atoms of a slab is T = Σ m v²/(3 N kB). The
+// sums of m v² and the numbers of atoms are accumulated over the
+// configurations, so that T is the average over every atom that has been in the
+// slab. The 3N degrees of freedom are not corrected for the constraints (e.g.
+// SHAKE) nor for the momentum of the center of mass.
+package tempprofile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "temperature_profile"
+
+// BoltzmannReal is the Boltzmann constant in the real units of LAMMPS
+// (kcal/mol/K).
+const BoltzmannReal = 0.0019872067
+
+// MVV2EReal converts a mass multiplied by a squared velocity into an energy in
+// the real units of LAMMPS (g/mol Å²/fs² to kcal/mol).
+const MVV2EReal = 2390.0573615334906
+
+// TempProfile is a structure containing the parameters that can be parsed from
+// a TOML configuration file. This structure can be instanced through the New
+// method. It also contains other unexported informations like the number of
+// atoms, the number of columns, and the accumulated kinetic energies.
+// Only the atoms whose type is in Atoms are used (all the atoms if empty) and
+// Masses must contain the mass of each of their types. The atoms are assigned to
+// a slab according to their wrapped position (x, y, or z column) along Axis (z
+// by default) in each configuration. Slabs are the increasing edges of the
+// slabs like in msd; the atoms outside the slabs are not taken into account.
+// Boltzmann is the Boltzmann constant and MVV2E the conversion of m v² into an
+// energy in the units of the trajectory (BoltzmannReal and MVV2EReal if 0).
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd, the
+// configurations read are used and a warning is logged.
+type TempProfile struct {
+	FileIn  string `toml:"temperature_profile.file_in"`
+	FileOut string `toml:"temperature_profile.file_out"`
+
+	CfgStart int `toml:"temperature_profile.cfg_start"`
+	CfgEnd   int `toml:"temperature_profile.cfg_end"`
+
+	Atoms  []string           `toml:"temperature_profile.atoms"`
+	Masses map[string]float64 `toml:"temperature_profile.masses"`
+
+	Axis  string    `toml:"temperature_profile.axis"`
+	Slabs []float64 `toml:"temperature_profile.slabs"`
+
+	Boltzmann float64 `toml:"temperature_profile.boltzmann"`
+	MVV2E     float64 `toml:"temperature_profile.mvv2e"`
+
+	types map[string]bool
+	axis  int
+	nb    int // number of slabs
+
+	sumMV2 []float64
+	count  []float64
+	nbCfg  int
+
+	atoms   int
+	cols    [7]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the TempProfile structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*TempProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tempProfile TempProfile
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&tempProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if tempProfile.CfgStart >= tempProfile.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(tempProfile.Masses) == 0 {
+		return nil, errors.New("no mass given")
+	}
+
+	if len(tempProfile.Atoms) > 0 {
+		tempProfile.types = make(map[string]bool, len(tempProfile.Atoms))
+		for _, v := range tempProfile.Atoms {
+			if _, ok := tempProfile.Masses[v]; !ok {
+				return nil, fmt.Errorf("mass for atom type `%s` doesn't exist", v)
+			}
+			tempProfile.types[v] = true
+		}
+	}
+
+	switch tempProfile.Axis {
+	case "x":
+		tempProfile.axis = 0
+	case "y":
+		tempProfile.axis = 1
+	case "z", "":
+		tempProfile.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", tempProfile.Axis)
+	}
+
+	if len(tempProfile.Slabs) < 2 {
+		return nil, errors.New("Slabs must contain at least two edges")
+	}
+
+	for i := 1; i < len(tempProfile.Slabs); i++ {
+		if tempProfile.Slabs[i] <= tempProfile.Slabs[i-1] {
+			return nil, errors.New("Slabs must be increasing")
+		}
+	}
+	tempProfile.nb = len(tempProfile.Slabs) - 1
+
+	if tempProfile.Boltzmann == 0 {
+		tempProfile.Boltzmann = BoltzmannReal
+	}
+
+	if tempProfile.MVV2E == 0 {
+		tempProfile.MVV2E = MVV2EReal
+	}
+
+	tempProfile.sumMV2 = make([]float64, tempProfile.nb)
+	tempProfile.count = make([]float64, tempProfile.nb)
+
+	return &tempProfile, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (t *TempProfile) SetOutputDir(dir string) {
+	t.FileOut = util.FileOut(t.FileOut, dir, t.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (t *TempProfile) SetOutputFormat(format string) {
+	t.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (t *TempProfile) SetProgress(p *util.Progress) {
+	t.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (t *TempProfile) SetInput(in util.Input) {
+	t.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (t *TempProfile) SetLog(log *log.Logger) {
+	t.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (t *TempProfile) Start() error {
+	f, traj, err := util.OpenTrajectory(t.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(t.input.Reader(traj))
+
+	err = t.input.SkipTo(f, r, 0, t.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	pos, mv2, err := t.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	t.calc(pos, mv2)
+
+	for i := 1; i < (t.CfgEnd - t.CfgStart); i++ {
+		err = t.input.SkipTo(f, r, t.CfgStart+i, t.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(t.log, Type, t.CfgStart+i, t.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		pos, mv2, err := t.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		t.calc(pos, mv2)
+		t.progress.Update(i+1, t.CfgEnd-t.CfgStart)
+	}
+
+	out, err := util.WriteFormat(t.FileOut, t, t.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	t.write(out)
+
+	return nil
+}
+
+// slabOf returns the slab of an atom from its wrapped position along the axis,
+// or -1 if it is outside the slabs.
+func (t *TempProfile) slabOf(pos float64) int {
+	for i := 0; i < t.nb; i++ {
+		if pos >= t.Slabs[i] && pos < t.Slabs[i+1] {
+			return i
+		}
+	}
+	return -1
+}
+
+// calc adds m v² of each atom to the slab of its position along the axis.
+func (t *TempProfile) calc(pos, mv2 []float64) {
+	for i, v := range pos {
+		if slab := t.slabOf(v); slab >= 0 {
+			t.sumMV2[slab] += mv2[i]
+			t.count[slab]++
+		}
+	}
+	t.nbCfg++
+}
+
+// write writes the temperature of each slab, its middle along the axis, and
+// its average number of atoms (pos T atoms). The temperature of a slab that is
+// always empty is 0.
+func (t *TempProfile) write(w io.Writer) {
+	nbCfg := float64(t.nbCfg)
+	fmt.Fprint(w, "pos T atoms\n")
+	for i := 0; i < t.nb; i++ {
+		var temp float64
+		if t.count[i] > 0 {
+			temp = t.sumMV2[i] * t.MVV2E / (3. * t.count[i] * t.Boltzmann)
+		}
+
+		fmt.Fprintf(w, "%g %g %g\n", (t.Slabs[i]+t.Slabs[i+1])/2., temp,
+			t.count[i]/nbCfg)
+	}
+}
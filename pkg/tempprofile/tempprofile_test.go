@@ -0,0 +1,159 @@
+package tempprofile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTempProfile writes the configuration file with params and the trajectory
+// traj into a temporary directory, and returns the calculation read from this
+// file by New.
+func newTempProfile(t *testing.T, params, traj string) *TempProfile {
+	dir, err := ioutil.TempDir("", "tempprofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "tempprofile.toml")
+	cfg := fmt.Sprintf("[temperature_profile]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "out.dat"), params)
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// run runs the calculation returned by newTempProfile and returns the rows of
+// its output (pos T atoms).
+func run(t *testing.T, params, traj string) [][3]float64 {
+	p := newTempProfile(t, params, traj)
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows(t, p.FileOut)
+}
+
+// rows returns the rows of the output file path (pos T atoms).
+func rows(t *testing.T, path string) [][3]float64 {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+
+	var rows [][3]float64
+	for _, line := range strings.Split(out[strings.Index(out, "pos T atoms\n"):], "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			break
+		}
+
+		var row [3]float64
+		for k, f := range fields {
+			row[k], err = strconv.ParseFloat(f, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestTemperature(t *testing.T) {
+	masses := map[string]float64{"1": 2, "2": 1, "3": 5}
+	tests := []struct {
+		name         string
+		params       string
+		kB, mvv2e    float64
+		tempLo, temp float64 // of the slabs from 0 to 5 and from 5 to 10
+	}{
+		{"reduced units", "boltzmann = 1.0\nmvv2e = 1.0\n", 1, 1, 1, 4},
+		{"real units", "", BoltzmannReal, MVV2EReal, 300, 350},
+		{"other units", "boltzmann = 2.0\nmvv2e = 0.5\n", 2, 0.5, 0.5, 0.25},
+	}
+
+	for _, tt := range tests {
+		// v returns a velocity of the atom of type typ along each direction so
+		// that m v² = 3 kB temp, with the signs of sign.
+		v := func(typ string, temp float64, sign [3]float64) string {
+			a := math.Sqrt(tt.kB * temp / (masses[typ] * tt.mvv2e))
+			return fmt.Sprintf("%g %g %g", sign[0]*a, sign[1]*a, sign[2]*a)
+		}
+
+		// Two atoms of the types 1 and 2 in each slab, an atom of type 3 (not
+		// selected), and an atom outside the slabs.
+		var traj strings.Builder
+		for i, sign := range [][3]float64{{1, -1, 1}, {-1, 1, 1}, {1, 1, -1}} {
+			fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n6\n", i)
+			traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 15\n0 15\n0 15\nITEM: ATOMS id type x y z vx vy vz\n")
+			fmt.Fprintf(&traj, "1 1 1 1 %g %s\n", 1+float64(i), v("1", tt.tempLo, sign))
+			fmt.Fprintf(&traj, "2 2 2 2 4.5 %s\n", v("2", tt.tempLo, sign))
+			fmt.Fprintf(&traj, "3 1 3 3 %g %s\n", 5+float64(i), v("1", tt.temp, sign))
+			fmt.Fprintf(&traj, "4 2 4 4 9.9 %s\n", v("2", tt.temp, sign))
+			fmt.Fprintf(&traj, "5 3 5 5 2 %s\n", v("3", 1000, sign))
+			fmt.Fprintf(&traj, "6 1 6 6 12 %s\n", v("1", 1000, sign))
+		}
+
+		rows := run(t, "cfg_end = 3\natoms = [\"1\", \"2\"]\nmasses = {1 = 2.0, 2 = 1.0, 3 = 5.0}\n"+
+			"slabs = [0.0, 5.0, 10.0]\n"+tt.params, traj.String())
+		want := [][3]float64{{2.5, tt.tempLo, 2}, {7.5, tt.temp, 2}}
+		if len(rows) != len(want) {
+			t.Fatalf("%s: %d slabs, want %d", tt.name, len(rows), len(want))
+		}
+		for i := range want {
+			for k := 0; k < 3; k++ {
+				if math.Abs(rows[i][k]-want[i][k]) > 1e-9*want[i][k] {
+					t.Errorf("%s: slab %d: got %v, want %v", tt.name, i, rows[i], want[i])
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations with an atom at rest in each slab.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n2\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 15\n0 15\n0 15\nITEM: ATOMS id type x y z vx vy vz\n")
+		traj.WriteString("1 1 1 1 1 0 0 0\n2 1 2 2 7 0 0 0\n")
+	}
+
+	p := newTempProfile(t, "cfg_end = 10\nmasses = {1 = 1.0}\nslabs = [0.0, 5.0, 10.0]\n", traj.String())
+	var logs strings.Builder
+	p.SetLog(log.New(&logs, "", 0))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "temperature_profile: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	rows := rows(t, p.FileOut)
+	if len(rows) != 2 || rows[0] != [3]float64{2.5, 0, 1} || rows[1] != [3]float64{7.5, 0, 1} {
+		t.Errorf("rows %v, want an atom on average in each slab", rows)
+	}
+}
@@ -0,0 +1,111 @@
+package tetrahedral
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (t *Tetrahedral) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	t.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	t.colsLen = len(fields)
+	for k, v := range fields {
+		switch v {
+		case "x":
+			t.cols[0] = k
+		case "y":
+			t.cols[1] = k
+		case "z":
+			t.cols[2] = k
+		case "type":
+			t.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(t.cols) {
+		return box, nil, fmt.Errorf("cannot find the columns x, y, z, and type")
+	}
+
+	xyz, err = t.fetchXYZ(r)
+	if err != nil {
+		return box, nil, fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates of the atoms.
+func (t *Tetrahedral) readCfg(r *bufio.Reader) (box [3]float64, xyz XYZ, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, err = t.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+		return
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates of the atoms of type Center and Neighbor.
+func (t *Tetrahedral) fetchXYZ(r *bufio.Reader) (XYZ, error) {
+	xyz := XYZ{t.Center: nil, t.Neighbor: nil}
+	for i := 0; i < t.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != t.colsLen {
+			return nil, fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), t.colsLen)
+		}
+
+		typ := fields[t.cols[3]]
+		xyzTyp, ok := xyz[typ]
+		if !ok {
+			continue
+		}
+
+		var xyzTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[t.cols[k]], 64)
+		}
+
+		xyz[typ] = append(xyzTyp, xyzTmp)
+	}
+
+	return xyz, nil
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,286 @@
+// Package tetrahedral calculates the orientational tetrahedral order parameter
+// of an atom type over time.
+//
+// The order parameter of an atom is q = 1 - 3/8 Σ (cos ψjk + 1/3)², the sum
+// running over the 6 pairs of its 4 nearest neighbors and ψjk being the angle
+// between the neighbors j and k seen from the atom. q is equal to 1 for a
+// perfect tetrahedron and to 0 on average for an ideal gas.
+//
+// With the smooth weighting, every neighbor j within Cutoff contributes with a
+// weight wj given by a switching function (see util.Switch) instead of the 4
+// nearest ones: q = 1 - 9/4 Σ wjwk (cos ψjk + 1/3)² / Σ wjwk, the sums running
+// over all the pairs of neighbors. The order parameter no longer jumps when a
+// neighbor crosses the cutoff. If Width is 0 and exactly 4 neighbors are within
+// Cutoff, both definitions give the same value.
+package tetrahedral
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "tetrahedral"
+
+// Values of Weighting.
+const (
+	WeightingNearest = "nearest"
+	WeightingSmooth  = "smooth"
+)
+
+// XYZ is a type that represents the coordinates for each atom.
+type XYZ map[string][][3]float64
+
+// neighbor is a neighbor of an atom: the vector going from the atom to the
+// neighbor, its norm, and its weight.
+type neighbor struct {
+	vec    [3]float64
+	dist   float64
+	weight float64
+}
+
+// Tetrahedral is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, and the number of columns.
+// The order parameter is calculated for the atoms of type Center using the
+// atoms of type Neighbor. Weighting is WeightingNearest (default) or
+// WeightingSmooth. Cutoff and Width are only used by the smooth weighting.
+// The atoms without enough neighbors (4 for WeightingNearest, 2 for
+// WeightingSmooth) are ignored. CfgStart must be lower than CfgEnd. If the
+// trajectory ends before CfgEnd, the configurations read are used and a warning
+// is logged.
+type Tetrahedral struct {
+	FileIn  string `toml:"tetrahedral.file_in"`
+	FileOut string `toml:"tetrahedral.file_out"`
+
+	CfgStart int `toml:"tetrahedral.cfg_start"`
+	CfgEnd   int `toml:"tetrahedral.cfg_end"`
+
+	Center   string `toml:"tetrahedral.center"`
+	Neighbor string `toml:"tetrahedral.neighbor"`
+
+	Weighting string  `toml:"tetrahedral.weighting"`
+	Cutoff    float64 `toml:"tetrahedral.cutoff"`
+	Width     float64 `toml:"tetrahedral.width"`
+
+	Dt float64 `toml:"tetrahedral.dt"`
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the Tetrahedral structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*Tetrahedral, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tetrahedral Tetrahedral
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&tetrahedral)
+	if err != nil {
+		return nil, err
+	}
+
+	if tetrahedral.CfgStart >= tetrahedral.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	switch tetrahedral.Weighting {
+	case "":
+		tetrahedral.Weighting = WeightingNearest
+	case WeightingNearest:
+	case WeightingSmooth:
+		if tetrahedral.Cutoff <= 0 {
+			return nil, errors.New("Cutoff must be strictly positive")
+		}
+
+		if tetrahedral.Width < 0 || tetrahedral.Width > tetrahedral.Cutoff {
+			return nil, errors.New("Width must be between 0 and Cutoff")
+		}
+	default:
+		return nil, fmt.Errorf("weighting `%s` doesn't exist", tetrahedral.Weighting)
+	}
+
+	return &tetrahedral, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (t *Tetrahedral) SetOutputDir(dir string) {
+	t.FileOut = util.FileOut(t.FileOut, dir, t.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (t *Tetrahedral) SetOutputFormat(format string) {
+	t.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (t *Tetrahedral) SetProgress(p *util.Progress) {
+	t.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (t *Tetrahedral) SetInput(in util.Input) {
+	t.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (t *Tetrahedral) SetLog(log *log.Logger) {
+	t.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (t *Tetrahedral) Start() error {
+	f, traj, err := util.OpenTrajectory(t.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(t.input.Reader(traj))
+
+	out, err := util.WriteFormat(t.FileOut, t, t.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	out.WriteString("cfg t mean_q std_q\n")
+
+	err = t.input.SkipTo(f, r, 0, t.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, err := t.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	t.calc(out, 0, box, xyz)
+
+	for i := 1; i < (t.CfgEnd - t.CfgStart); i++ {
+		err = t.input.SkipTo(f, r, t.CfgStart+i, t.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(t.log, Type, t.CfgStart+i, t.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, err := t.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		t.calc(out, i, box, xyz)
+		t.progress.Update(i+1, t.CfgEnd-t.CfgStart)
+	}
+
+	return nil
+}
+
+// calc calculates the order parameter of each atom of type Center and writes
+// the average and the standard deviation into a file.
+func (t *Tetrahedral) calc(w io.Writer, cfg int, box [3]float64, xyz XYZ) {
+	var sum, sum2, nb float64
+	for id1, xyzAt1 := range xyz[t.Center] {
+		var neighbors []neighbor
+		for id2, xyzAt2 := range xyz[t.Neighbor] {
+			if t.Center == t.Neighbor && id1 == id2 {
+				continue
+			}
+
+			var n neighbor
+			n.vec = util.MinImage(xyzAt2, xyzAt1, box)
+			for k := 0; k < 3; k++ {
+				n.dist += util.Pow(n.vec[k], 2)
+			}
+			n.dist = math.Sqrt(n.dist)
+
+			n.weight = 1
+			if t.Weighting == WeightingSmooth {
+				n.weight = util.Switch(n.dist, t.Cutoff, t.Width)
+				if n.weight == 0 {
+					continue
+				}
+			}
+
+			neighbors = append(neighbors, n)
+		}
+
+		if t.Weighting == WeightingNearest {
+			if len(neighbors) < 4 {
+				continue
+			}
+			sort.Slice(neighbors, func(i, j int) bool {
+				return neighbors[i].dist < neighbors[j].dist
+			})
+			neighbors = neighbors[:4]
+		}
+
+		q, ok := order(neighbors)
+		if !ok {
+			continue
+		}
+
+		sum += q
+		sum2 += q * q
+		nb++
+	}
+
+	var mean, std float64
+	if nb > 0 {
+		mean = sum / nb
+		std = math.Sqrt(math.Max(sum2/nb-mean*mean, 0))
+	}
+
+	fmt.Fprintf(w, "%d %g %g %g\n",
+		(cfg + t.CfgStart), (float64(cfg+t.CfgStart) * t.Dt), mean, std)
+}
+
+// order returns the weighted order parameter of an atom. It returns false if
+// the sum of the weights of the pairs of neighbors is 0.
+func order(neighbors []neighbor) (float64, bool) {
+	var sum, sumW float64
+	for j := 0; j < len(neighbors); j++ {
+		for k := j + 1; k < len(neighbors); k++ {
+			nj, nk := neighbors[j], neighbors[k]
+
+			var dot float64
+			for i := 0; i < 3; i++ {
+				dot += nj.vec[i] * nk.vec[i]
+			}
+			cos := dot / (nj.dist * nk.dist)
+
+			weight := nj.weight * nk.weight
+			sum += weight * util.Pow(cos+1./3., 2)
+			sumW += weight
+		}
+	}
+
+	if sumW == 0 {
+		return 0, false
+	}
+
+	return 1 - 9./4.*sum/sumW, true
+}
@@ -0,0 +1,194 @@
+package tetrahedral
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tetrahedron contains the vertices of a regular tetrahedron centered on 0 at
+// a distance of 1 from it.
+var tetrahedron = [][3]float64{
+	{1 / math.Sqrt(3), 1 / math.Sqrt(3), 1 / math.Sqrt(3)},
+	{1 / math.Sqrt(3), -1 / math.Sqrt(3), -1 / math.Sqrt(3)},
+	{-1 / math.Sqrt(3), 1 / math.Sqrt(3), -1 / math.Sqrt(3)},
+	{-1 / math.Sqrt(3), -1 / math.Sqrt(3), 1 / math.Sqrt(3)},
+}
+
+// configuration returns an atom of type 1 at the center of a box of 20 and its
+// neighbors of type 2 at neighbors (relative to it).
+func configuration(neighbors [][3]float64) XYZ {
+	xyz := XYZ{"1": {{10, 10, 10}}}
+	for _, v := range neighbors {
+		xyz["2"] = append(xyz["2"], [3]float64{10 + v[0], 10 + v[1], 10 + v[2]})
+	}
+	return xyz
+}
+
+// q returns the mean order parameter calculated by calc.
+func q(t *testing.T, tt *Tetrahedral, xyz XYZ) float64 {
+	tt.Center, tt.Neighbor = "1", "2"
+
+	var b bytes.Buffer
+	tt.calc(&b, 0, [3]float64{20, 20, 20}, xyz)
+
+	var cfg, step, mean, std float64
+	_, err := fmt.Sscan(b.String(), &cfg, &step, &mean, &std)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mean
+}
+
+// distorted returns the vertices of the tetrahedron moved and scaled so that
+// the angles differ from the tetrahedral one.
+func distorted() [][3]float64 {
+	v := make([][3]float64, len(tetrahedron))
+	for i, w := range tetrahedron {
+		v[i] = [3]float64{w[0] * (1 + 0.1*float64(i)), w[1] + 0.2, w[2] - 0.1*float64(i)}
+	}
+	return v
+}
+
+func TestOrderTetrahedron(t *testing.T) {
+	for _, w := range []string{WeightingNearest, WeightingSmooth} {
+		got := q(t, &Tetrahedral{Weighting: w, Cutoff: 1.5, Width: 0.3}, configuration(tetrahedron))
+		if math.Abs(got-1) > 1e-12 {
+			t.Errorf("%s: q = %g for a regular tetrahedron, want 1", w, got)
+		}
+	}
+}
+
+func TestHardCutoffLimit(t *testing.T) {
+	// Four neighbors within the cutoff and others beyond it: the smooth
+	// weighting with a vanishing width is the nearest one.
+	far := [][3]float64{{2.5, 0, 0}, {0, -2.2, 0.3}, {-1.8, 1.6, 0}}
+	tests := []struct {
+		name      string
+		neighbors [][3]float64
+	}{
+		{"tetrahedron", append(append([][3]float64{}, tetrahedron...), far...)},
+		{"distorted", append(distorted(), far...)},
+		{"distorted alone", distorted()},
+	}
+
+	for _, tt := range tests {
+		xyz := configuration(tt.neighbors)
+		nearest := q(t, &Tetrahedral{Weighting: WeightingNearest}, xyz)
+
+		for _, width := range []float64{0, 1e-9} {
+			smooth := q(t, &Tetrahedral{Weighting: WeightingSmooth, Cutoff: 1.8, Width: width}, xyz)
+			if math.Abs(smooth-nearest) > 1e-9 {
+				t.Errorf("%s: width %g: q = %g, want %g (nearest)", tt.name, width, smooth, nearest)
+			}
+		}
+
+		// The width doesn't matter as long as every neighbor is below
+		// cutoff-width or beyond cutoff.
+		smooth := q(t, &Tetrahedral{Weighting: WeightingSmooth, Cutoff: 1.8, Width: 0.3}, xyz)
+		if math.Abs(smooth-nearest) > 1e-9 {
+			t.Errorf("%s: width 0.3: q = %g, want %g (nearest)", tt.name, smooth, nearest)
+		}
+	}
+}
+
+func TestSmoothContinuity(t *testing.T) {
+	// A fifth neighbor crosses the cutoff: q jumps with a hard cutoff, but not
+	// with the switching function.
+	const (
+		cutoff = 2.
+		dr     = 1e-6
+	)
+	at := func(width, r float64) float64 {
+		neighbors := append(distorted(), [3]float64{0, 0, -r})
+		return q(t, &Tetrahedral{Weighting: WeightingSmooth, Cutoff: cutoff, Width: width}, configuration(neighbors))
+	}
+
+	if jump := math.Abs(at(0, cutoff-dr) - at(0, cutoff+dr)); jump < 1e-3 {
+		t.Errorf("hard cutoff: jump of %g across the cutoff, want a jump", jump)
+	}
+	if jump := math.Abs(at(0.5, cutoff-dr) - at(0.5, cutoff+dr)); jump > 1e-6 {
+		t.Errorf("smooth cutoff: jump of %g across the cutoff", jump)
+	}
+}
+
+// newTetrahedral writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [tetrahedral]) into a temporary
+// directory, and returns the calculation read from this file by New.
+func newTetrahedral(t *testing.T, params, traj string) *Tetrahedral {
+	dir, err := ioutil.TempDir("", "tetrahedral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "tetrahedral.toml")
+	cfg := fmt.Sprintf("[tetrahedral]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "tetrahedral.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations of a regular tetrahedron.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n5\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 20\n0 20\n0 20\nITEM: ATOMS id type x y z\n")
+		for j, v := range configuration(tetrahedron)["2"] {
+			fmt.Fprintf(&traj, "%d 2 %.15g %.15g %.15g\n", j+1, v[0], v[1], v[2])
+		}
+		traj.WriteString("5 1 10 10 10\n")
+	}
+
+	tt := newTetrahedral(t, "cfg_end = 10\ncenter = \"1\"\nneighbor = \"2\"\ndt = 1.0\n", traj.String())
+	var logs strings.Builder
+	tt.SetLog(log.New(&logs, "", 0))
+	err := tt.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "tetrahedral: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(tt.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	rows := strings.Split(strings.TrimSuffix(out[strings.Index(out, "cfg t mean_q std_q\n"):], "\n"), "\n")[1:]
+	if len(rows) != 3 {
+		t.Fatalf("%d rows, want 3:\n%s", len(rows), out)
+	}
+	for i, row := range rows {
+		var cfg, step, mean, std float64
+		_, err := fmt.Sscan(row, &cfg, &step, &mean, &std)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(cfg) != i || math.Abs(mean-1) > 1e-9 {
+			t.Errorf("row %q, want the configuration %d and q = 1", row, i)
+		}
+	}
+}
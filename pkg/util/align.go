@@ -0,0 +1,111 @@
+package util
+
+import "math"
+
+// Rotation returns the rotation matrix that minimizes the RMSD between xyz and
+// ref (Kabsch problem). Both sets of coordinates must have the same length and
+// be centered on their center of geometry (see Center). The rotation is
+// obtained from the quaternion method of Horn: it is the eigenvector of the
+// largest eigenvalue of a 4x4 symmetric matrix built from the correlation
+// matrix of the coordinates. Unlike the singular value decomposition, this
+// method always returns a proper rotation.
+func Rotation(ref, xyz [][3]float64) (rot [3][3]float64) {
+	var c [3][3]float64
+	for i := range xyz {
+		for a := 0; a < 3; a++ {
+			for b := 0; b < 3; b++ {
+				c[a][b] += xyz[i][a] * ref[i][b]
+			}
+		}
+	}
+
+	n := [4][4]float64{
+		{c[0][0] + c[1][1] + c[2][2], c[1][2] - c[2][1], c[2][0] - c[0][2], c[0][1] - c[1][0]},
+		{c[1][2] - c[2][1], c[0][0] - c[1][1] - c[2][2], c[0][1] + c[1][0], c[2][0] + c[0][2]},
+		{c[2][0] - c[0][2], c[0][1] + c[1][0], -c[0][0] + c[1][1] - c[2][2], c[1][2] + c[2][1]},
+		{c[0][1] - c[1][0], c[2][0] + c[0][2], c[1][2] + c[2][1], -c[0][0] - c[1][1] + c[2][2]},
+	}
+
+	val, vec := jacobi(n)
+	max := 0
+	for i := 1; i < 4; i++ {
+		if val[i] > val[max] {
+			max = i
+		}
+	}
+	q0, q1, q2, q3 := vec[0][max], vec[1][max], vec[2][max], vec[3][max]
+
+	rot = [3][3]float64{
+		{q0*q0 + q1*q1 - q2*q2 - q3*q3, 2 * (q1*q2 - q0*q3), 2 * (q1*q3 + q0*q2)},
+		{2 * (q1*q2 + q0*q3), q0*q0 - q1*q1 + q2*q2 - q3*q3, 2 * (q2*q3 - q0*q1)},
+		{2 * (q1*q3 - q0*q2), 2 * (q2*q3 + q0*q1), q0*q0 - q1*q1 - q2*q2 + q3*q3},
+	}
+	return
+}
+
+// Rotate returns the coordinates v rotated by rot.
+func Rotate(rot [3][3]float64, v [3]float64) (res [3]float64) {
+	for a := 0; a < 3; a++ {
+		for b := 0; b < 3; b++ {
+			res[a] += rot[a][b] * v[b]
+		}
+	}
+	return
+}
+
+// jacobi returns the eigenvalues and the eigenvectors (columns) of a 4x4
+// symmetric matrix using the cyclic Jacobi method.
+func jacobi(a [4][4]float64) (val [4]float64, vec [4][4]float64) {
+	for i := 0; i < 4; i++ {
+		vec[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 50; sweep++ {
+		var off float64
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				off += a[p][q] * a[p][q]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+
+		for p := 0; p < 4; p++ {
+			for q := p + 1; q < 4; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 4; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p] = c*akp - s*akq
+					a[k][q] = s*akp + c*akq
+				}
+				for k := 0; k < 4; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k] = c*apk - s*aqk
+					a[q][k] = s*apk + c*aqk
+				}
+				for k := 0; k < 4; k++ {
+					vkp, vkq := vec[k][p], vec[k][q]
+					vec[k][p] = c*vkp - s*vkq
+					vec[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		val[i] = a[i][i]
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// Block is the result of the block averaging for one size of block.
+type Block struct {
+	Size int
+	Mean float64
+	SEM  float64 // Standard error of the mean
+}
+
+// BlockAverage splits y in blocks of increasing sizes (1, 2, 4, ...) and
+// returns the mean and the standard error of the mean estimated from the
+// averages of the blocks. There are at least two blocks for each size. The
+// points that don't fill a whole block are discarded. The SEM increases with
+// the size of the blocks until the blocks become uncorrelated, the plateau
+// being the actual error of the mean.
+func BlockAverage(y []float64) []Block {
+	var blocks []Block
+	for size := 1; len(y)/size >= 2; size *= 2 {
+		nb := len(y) / size
+		means := make([]float64, nb)
+		var mean float64
+		for b := 0; b < nb; b++ {
+			for _, v := range y[b*size : (b+1)*size] {
+				means[b] += v
+			}
+			means[b] /= float64(size)
+			mean += means[b]
+		}
+		mean /= float64(nb)
+
+		var variance float64
+		for _, v := range means {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(nb * (nb - 1))
+
+		blocks = append(blocks, Block{size, mean, math.Sqrt(variance)})
+	}
+
+	return blocks
+}
+
+// WriteBlocks performs the block averaging of y and writes the results as a
+// table at the end of an output file.
+func WriteBlocks(w io.Writer, y []float64) {
+	fmt.Fprint(w, "\nblock_size mean sem\n")
+	for _, b := range BlockAverage(y) {
+		fmt.Fprintf(w, "%d %g %g\n", b.Size, b.Mean, b.SEM)
+	}
+}
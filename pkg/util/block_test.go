@@ -0,0 +1,71 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockAverage(t *testing.T) {
+	y := []float64{1, 3, 2, 6, 4, 4, 5, 7, 100} // the last point doesn't fill a block
+	want := []Block{
+		{1, 4, math.Sqrt(28. / 56.)},
+		{2, 4, math.Sqrt(8. / 12.)},
+		{4, 4, 1},
+	}
+
+	got := BlockAverage(y[:8])
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Size != want[i].Size || math.Abs(got[i].Mean-want[i].Mean) > 1e-12 ||
+			math.Abs(got[i].SEM-want[i].SEM) > 1e-12 {
+			t.Errorf("size %d: got %+v, want %+v", want[i].Size, got[i], want[i])
+		}
+	}
+
+	// Two blocks at least.
+	if got := BlockAverage(y); len(got) != 3 || got[2].Size != 4 {
+		t.Errorf("9 points: got %v", got)
+	}
+	if got := BlockAverage(y[:1]); len(got) != 0 {
+		t.Errorf("1 point: got %v", got)
+	}
+}
+
+func TestBlockAverageCorrelated(t *testing.T) {
+	// AR(1) series of unit variance: y(i) = φy(i-1) + √(1-φ²)ε. Its statistical
+	// inefficiency is g = (1+φ)/(1-φ), i.e. twice its integrated correlation
+	// time, so the error of the mean is √(g/N) while the uncorrelated
+	// estimate (size 1) is √(1/N).
+	const n = 1 << 17
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, phi := range []float64{0, 0.5, 0.8, 0.9} {
+		y := make([]float64, n)
+		y[0] = rnd.NormFloat64()
+		for i := 1; i < n; i++ {
+			y[i] = phi*y[i-1] + math.Sqrt(1-phi*phi)*rnd.NormFloat64()
+		}
+
+		blocks := BlockAverage(y)
+		if s := blocks[0].SEM * math.Sqrt(n); math.Abs(s-1) > 0.05 {
+			t.Errorf("φ = %g: SEM of the blocks of size 1 %g, want %g", phi, blocks[0].SEM, 1/math.Sqrt(n))
+		}
+
+		// The blocks of 512 points are much longer than the correlation time
+		// and there are still 256 of them.
+		g := (1 + phi) / (1 - phi)
+		plateau := blocks[9]
+		if plateau.Size != 512 {
+			t.Fatalf("size %d, want 512", plateau.Size)
+		}
+		if want := math.Sqrt(g / n); math.Abs(plateau.SEM-want) > 0.15*want {
+			t.Errorf("φ = %g: SEM of the blocks of size 512 %g, want %g", phi, plateau.SEM, want)
+		}
+		if math.Abs(plateau.Mean) > 4*math.Sqrt(g/n) {
+			t.Errorf("φ = %g: mean %g, want 0", phi, plateau.Mean)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Bond is a bond of a topology. Atoms contains the identifiers (id column) of
+// the two bonded atoms.
+type Bond struct {
+	Type  string
+	Atoms [2]int
+}
+
+// ReadBonds returns the bonds listed in the Bonds section of a LAMMPS data file.
+// Each line of the section is "id type atom1 atom2". The comments (after #) are
+// ignored. The section ends at the first non-empty line that is not a bond,
+// i.e. the keyword of the next section, or at the end of the file.
+func ReadBonds(path string) ([]Bond, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		bonds   []Bond
+		section bool
+	)
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+
+		if !section {
+			section = len(fields) == 1 && fields[0] == "Bonds"
+			continue
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 4 {
+			if len(bonds) == 0 {
+				return nil, fmt.Errorf("line %d: a bond must contain 4 fields (got %d)", line, len(fields))
+			}
+			break
+		}
+
+		var b Bond
+		b.Type = fields[1]
+		for k := 0; k < 2; k++ {
+			b.Atoms[k], err = strconv.Atoi(fields[k+2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		bonds = append(bonds, b)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(bonds) == 0 {
+		return nil, errors.New("no bond found (missing Bonds section)")
+	}
+
+	return bonds, nil
+}
@@ -0,0 +1,124 @@
+package util
+
+import "math"
+
+// CellList divides a periodic box into cells to find the atoms close to a
+// position without going through every atom. The cells are boxes of the same
+// size. Their number along each dimension is the length of the box divided by
+// the requested edge, rounded down (at least 1).
+type CellList struct {
+	n     [3]int
+	size  [3]float64
+	min   float64
+	cells [][]int
+	stamp []int
+	query int
+}
+
+// NewCellList returns the cell list of the coordinates xyz in a box of size
+// box. The atoms are identified by their index in xyz.
+func NewCellList(box [3]float64, xyz [][3]float64, edge float64) *CellList {
+	c := CellList{min: math.MaxFloat64}
+	for k := 0; k < 3; k++ {
+		c.n[k] = int(math.Max(math.Floor(box[k]/edge), 1))
+		c.size[k] = box[k] / float64(c.n[k])
+		c.min = math.Min(c.min, c.size[k])
+	}
+
+	c.cells = make([][]int, c.n[0]*c.n[1]*c.n[2])
+	c.stamp = make([]int, len(c.cells))
+	for i, v := range xyz {
+		idx := c.index(c.cell(v), [3]int{})
+		c.cells[idx] = append(c.cells[idx], i)
+	}
+
+	return &c
+}
+
+// cell returns the cell containing pos, wrapped into the box.
+func (c *CellList) cell(pos [3]float64) (cell [3]int) {
+	for k := 0; k < 3; k++ {
+		cell[k] = int(math.Floor(pos[k] / c.size[k]))
+	}
+	return
+}
+
+// index returns the index of the cell cell shifted by offset, wrapped into the
+// box.
+func (c *CellList) index(cell, offset [3]int) int {
+	var idx [3]int
+	for k := 0; k < 3; k++ {
+		idx[k] = (cell[k] + offset[k]) % c.n[k]
+		if idx[k] < 0 {
+			idx[k] += c.n[k]
+		}
+	}
+	return (idx[0]*c.n[1]+idx[1])*c.n[2] + idx[2]
+}
+
+// Search calls fn for the atoms of the cells around pos, shell after shell:
+// the cell containing pos first, then the cells around it, and so on. Each
+// atom is visited once. After each shell, stop is called with a lower bound of
+// the distance (minimum image convention) between pos and the atoms that are
+// not visited yet. The search ends when stop returns true or when every atom
+// has been visited.
+func (c *CellList) Search(pos [3]float64, fn func(i int), stop func(bound float64) bool) {
+	c.query++
+	cell := c.cell(pos)
+
+	var lo, hi [3]int // offsets covering the box once
+	last := 0
+	for k := 0; k < 3; k++ {
+		lo[k], hi[k] = -c.n[k]/2, (c.n[k]-1)/2
+		if c.n[k]/2 > last {
+			last = c.n[k] / 2
+		}
+	}
+
+	for s := 0; ; s++ {
+		for x := max(lo[0], -s); x <= min(hi[0], s); x++ {
+			for y := max(lo[1], -s); y <= min(hi[1], s); y++ {
+				for z := max(lo[2], -s); z <= min(hi[2], s); z++ {
+					if abs(x) != s && abs(y) != s && abs(z) != s {
+						continue
+					}
+
+					idx := c.index(cell, [3]int{x, y, z})
+					if c.stamp[idx] == c.query {
+						continue
+					}
+					c.stamp[idx] = c.query
+
+					for _, i := range c.cells[idx] {
+						fn(i)
+					}
+				}
+			}
+		}
+
+		if s >= last || stop(float64(s)*c.min) {
+			return
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,120 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomXYZ returns n random positions in the box box.
+func randomXYZ(rnd *rand.Rand, n int, box [3]float64) [][3]float64 {
+	xyz := make([][3]float64, n)
+	for i := range xyz {
+		for k := 0; k < 3; k++ {
+			xyz[i][k] = rnd.Float64() * box[k]
+		}
+	}
+	return xyz
+}
+
+// nearestCells returns the index of the atom of xyz nearest to pos found with
+// the cell list c (the lowest index if several atoms are at the same
+// distance).
+func nearestCells(c *CellList, xyz [][3]float64, pos, box [3]float64) (int, float64) {
+	best, dist2 := -1, math.MaxFloat64
+	c.Search(pos, func(i int) {
+		d := MinImageDist2(xyz[i], pos, box)
+		if d < dist2 || (d == dist2 && i < best) {
+			best, dist2 = i, d
+		}
+	}, func(bound float64) bool {
+		return bound*bound > dist2
+	})
+	return best, dist2
+}
+
+// nearestBrute is like nearestCells but every atom is visited.
+func nearestBrute(xyz [][3]float64, pos, box [3]float64) (int, float64) {
+	best, dist2 := -1, math.MaxFloat64
+	for i, v := range xyz {
+		if d := MinImageDist2(v, pos, box); d < dist2 {
+			best, dist2 = i, d
+		}
+	}
+	return best, dist2
+}
+
+func TestCellListNearest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		box   [3]float64
+		atoms int
+		edge  float64
+	}{
+		{[3]float64{10, 10, 10}, 100, 2},
+		{[3]float64{20, 7, 13}, 300, 1.5},
+		{[3]float64{10, 10, 10}, 5, 1},   // mostly empty cells
+		{[3]float64{10, 10, 10}, 50, 20}, // a single cell
+		{[3]float64{9, 9, 9}, 200, 3},    // odd number of cells
+	}
+
+	for _, tt := range tests {
+		xyz := randomXYZ(rnd, tt.atoms, tt.box)
+		c := NewCellList(tt.box, xyz, tt.edge)
+
+		for _, pos := range randomXYZ(rnd, 200, tt.box) {
+			i, d := nearestCells(c, xyz, pos, tt.box)
+			j, e := nearestBrute(xyz, pos, tt.box)
+			if i != j || d != e {
+				t.Fatalf("box %v, %d atoms, edge %g: nearest atom of %v is %d (%g) with the cell list, %d (%g) without",
+					tt.box, tt.atoms, tt.edge, pos, i, d, j, e)
+			}
+		}
+	}
+}
+
+func TestCellListVisitsOnce(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	box := [3]float64{10, 12, 8}
+	xyz := randomXYZ(rnd, 150, box)
+	c := NewCellList(box, xyz, 2)
+
+	for _, pos := range randomXYZ(rnd, 20, box) {
+		seen := make([]int, len(xyz))
+		c.Search(pos, func(i int) { seen[i]++ }, func(float64) bool { return false })
+		for i, n := range seen {
+			if n != 1 {
+				t.Fatalf("atom %d visited %d times from %v", i, n, pos)
+			}
+		}
+	}
+}
+
+// benchmarkNearest finds the nearest atom of 1000 positions among atoms atoms
+// with or without a cell list.
+func benchmarkNearest(b *testing.B, atoms int, cells bool) {
+	rnd := rand.New(rand.NewSource(1))
+	box := [3]float64{30, 30, 30}
+	xyz := randomXYZ(rnd, atoms, box)
+	pos := randomXYZ(rnd, 1000, box)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if !cells {
+			for _, p := range pos {
+				nearestBrute(xyz, p, box)
+			}
+			continue
+		}
+
+		c := NewCellList(box, xyz, math.Cbrt(2.*box[0]*box[1]*box[2]/float64(atoms)))
+		for _, p := range pos {
+			nearestCells(c, xyz, p, box)
+		}
+	}
+}
+
+func BenchmarkNearestCellList1000(b *testing.B)    { benchmarkNearest(b, 1000, true) }
+func BenchmarkNearestBruteForce1000(b *testing.B)  { benchmarkNearest(b, 1000, false) }
+func BenchmarkNearestCellList10000(b *testing.B)   { benchmarkNearest(b, 10000, true) }
+func BenchmarkNearestBruteForce10000(b *testing.B) { benchmarkNearest(b, 10000, false) }
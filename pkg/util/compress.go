@@ -0,0 +1,47 @@
+package util
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Compressed returns true if the trajectory path is compressed, i.e. if its
+// extension is .gz (gzip) or .bz2 (bzip2).
+func Compressed(path string) bool {
+	switch filepath.Ext(path) {
+	case ".gz", ".bz2":
+		return true
+	}
+	return false
+}
+
+// OpenTrajectory opens the trajectory path. The compressed trajectories (see
+// Compressed) are decompressed on the fly; the others are read as is. f is the
+// file itself, which must be closed by the caller and given to SkipTo and
+// VolumeStats, and traj is the content of the trajectory. A compressed
+// trajectory cannot be indexed, so the configurations before CfgStart are
+// always read.
+func OpenTrajectory(path string) (f *os.File, traj io.Reader, err error) {
+	f, err = os.Open(path)
+	if err != nil {
+		return
+	}
+
+	switch filepath.Ext(path) {
+	case ".gz":
+		traj, err = gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+	case ".bz2":
+		traj = bzip2.NewReader(f)
+	default:
+		traj = f
+	}
+
+	return
+}
@@ -0,0 +1,236 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// The formats of the output files.
+const (
+	FormatText = "text" // parameters in the TOML format, then the results
+	FormatJSON = "json" // one JSON object (see WriteFormat)
+)
+
+// CheckFormat returns an error if format isn't FormatText or FormatJSON. An
+// empty format is FormatText.
+func CheckFormat(format string) error {
+	switch format {
+	case "", FormatText, FormatJSON:
+		return nil
+	}
+	return fmt.Errorf("format `%s` doesn't exist (%s or %s)", format, FormatText, FormatJSON)
+}
+
+// WriteFormat is like Write but the output file is written in the format
+// format. With FormatJSON, the results written into the output file are kept
+// in memory and converted when it is closed into a JSON object containing the
+// date, the parameters (structure), and the tables of the results:
+//
+//	{"date": "...", "parameters": {...}, "tables": [...]}
+//
+// Each block of lines separated by an empty line is a table. Its first line
+// contains the names of the columns (columns) and the other lines are the rows
+// (rows), written as records keyed by the names of the columns; each row must
+// contain at least one number. The lines starting with # before the columns
+// are kept in comments; if the columns are missing, the last one is used when
+// it has as many fields as the rows, like the blocks of gr in the gnuplot
+// format. The numbers are converted to JSON numbers (NaN and infinities to
+// null) and the other values are kept as strings. The blocks that aren't
+// tables are kept as lines. Nothing is written by Sync.
+func WriteFormat(path string, structure interface{}, format string) (*Output, error) {
+	if format != FormatJSON {
+		return Write(path, structure)
+	}
+
+	j, err := newJSONOutput(structure)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f.json = j
+	return f, nil
+}
+
+// WriteFormatTo is like WriteFormat but the output file is written into w (see
+// NewOutput).
+func WriteFormatTo(w io.Writer, structure interface{}, format string) (*Output, error) {
+	if format != FormatJSON {
+		return WriteTo(w, structure)
+	}
+
+	j, err := newJSONOutput(structure)
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewOutput(w)
+	f.json = j
+	return f, nil
+}
+
+// newJSONOutput returns the JSON object of an output file whose parameters are
+// structure.
+func newJSONOutput(structure interface{}) (*jsonOutput, error) {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Encode(structure)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := toml.LoadBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonOutput{
+		Date:       time.Now().Format("2006-01-02 15:04:05 -0700 MST"),
+		Parameters: tree.ToMap(),
+	}, nil
+}
+
+// jsonOutput is the content of an output file in the JSON format (see
+// WriteFormat).
+type jsonOutput struct {
+	Date       string                 `json:"date"`
+	Parameters map[string]interface{} `json:"parameters"`
+	Tables     []jsonTable            `json:"tables"`
+
+	buf bytes.Buffer // results written so far
+}
+
+// jsonTable is a block of lines of the results.
+type jsonTable struct {
+	Comments []string                 `json:"comments,omitempty"`
+	Columns  []string                 `json:"columns,omitempty"`
+	Rows     []map[string]interface{} `json:"rows,omitempty"`
+	Lines    []string                 `json:"lines,omitempty"`
+}
+
+// encode converts the results into tables and returns the JSON object.
+func (j *jsonOutput) encode() ([]byte, error) {
+	j.Tables = []jsonTable{}
+
+	var block []string
+	s := bufio.NewScanner(&j.buf)
+	s.Buffer(nil, 1<<30)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" {
+			block = append(block, line)
+			continue
+		}
+
+		if len(block) > 0 {
+			j.Tables = append(j.Tables, newJSONTable(block))
+			block = nil
+		}
+	}
+	if len(block) > 0 {
+		j.Tables = append(j.Tables, newJSONTable(block))
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(j, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// newJSONTable converts a block of lines into a table (see WriteFormat).
+func newJSONTable(block []string) jsonTable {
+	var t jsonTable
+	for len(block) > 0 && strings.HasPrefix(block[0], "#") {
+		t.Comments = append(t.Comments, strings.TrimSpace(strings.TrimPrefix(block[0], "#")))
+		block = block[1:]
+	}
+
+	if len(block) > 1 && !numbers(strings.Fields(block[0])) {
+		t.Columns = strings.Fields(block[0])
+		block = block[1:]
+	} else if len(block) > 0 && len(t.Comments) > 0 {
+		last := strings.Fields(t.Comments[len(t.Comments)-1])
+		if len(last) == len(strings.Fields(block[0])) {
+			t.Columns = last
+			t.Comments = t.Comments[:len(t.Comments)-1]
+		}
+	}
+
+	for _, line := range block {
+		fields := strings.Fields(line)
+		if t.Columns == nil || len(fields) != len(t.Columns) || !anyNumber(fields) {
+			return jsonTable{Comments: t.Comments, Lines: append(columnsLine(t.Columns), block...)}
+		}
+
+		row := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			row[t.Columns[k]] = jsonValue(v)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	if t.Rows == nil {
+		t.Lines = append(columnsLine(t.Columns), block...)
+		t.Columns = nil
+	}
+	return t
+}
+
+// columnsLine returns the line of the columns, or nothing if there is none.
+func columnsLine(columns []string) []string {
+	if columns == nil {
+		return nil
+	}
+	return []string{strings.Join(columns, " ")}
+}
+
+// numbers returns true if every field is a number.
+func numbers(fields []string) bool {
+	for _, v := range fields {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// anyNumber returns true if at least one field is a number.
+func anyNumber(fields []string) bool {
+	for _, v := range fields {
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonValue returns v as a number if it is one (nil for NaN and the
+// infinities), or as a string otherwise.
+func jsonValue(v string) interface{} {
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// FrameMap records the index and the timestep (ITEM: TIMESTEP) of the
+// configurations processed by a calculation so that its results can be traced
+// back to the simulation. Its methods can be called on a nil FrameMap, in which
+// case nothing is recorded.
+type FrameMap struct {
+	cfg      []int
+	timestep []string
+}
+
+// NewFrameMap returns an empty FrameMap.
+func NewFrameMap() *FrameMap {
+	return &FrameMap{}
+}
+
+// Add records a configuration.
+func (m *FrameMap) Add(cfg int, timestep string) {
+	if m == nil {
+		return
+	}
+
+	m.cfg = append(m.cfg, cfg)
+	m.timestep = append(m.timestep, timestep)
+}
+
+// Write writes the index and the timestep of the recorded configurations into
+// a file, one configuration per line.
+func (m *FrameMap) Write(path string) error {
+	if m == nil {
+		return nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprint(w, "cfg timestep\n")
+	for i, cfg := range m.cfg {
+		fmt.Fprintf(w, "%d %s\n", cfg, m.timestep[i])
+	}
+
+	return w.Flush()
+}
+
+// Timestep returns the timestep of a configuration from the lines of its
+// header written by Header or HeaderWOutAtoms.
+func Timestep(header []byte) string {
+	lines := bytes.SplitN(header, []byte{'\n'}, 3)
+	if len(lines) < 2 {
+		return ""
+	}
+	return Line(lines[1])
+}
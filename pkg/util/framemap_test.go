@@ -0,0 +1,73 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFrameMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "framemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		cfgs      []int
+		timesteps []string
+		want      string
+	}{
+		{"none", nil, nil, "cfg timestep\n"},
+		{"range", []int{2, 3, 4}, []string{"200", "300", "400"}, "cfg timestep\n2 200\n3 300\n4 400\n"},
+		{"restart", []int{0, 5}, []string{"1000", "1000"}, "cfg timestep\n0 1000\n5 1000\n"},
+	}
+
+	for i, tt := range tests {
+		m := NewFrameMap()
+		for j, cfg := range tt.cfgs {
+			m.Add(cfg, tt.timesteps[j])
+		}
+
+		path := filepath.Join(dir, string(rune('a'+i)))
+		if err := m.Write(path); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+
+	// A nil map records and writes nothing.
+	var m *FrameMap
+	m.Add(1, "100")
+	if err := m.Write(filepath.Join(dir, "nil")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "nil")); !os.IsNotExist(err) {
+		t.Errorf("a nil FrameMap wrote a file (Stat: %v)", err)
+	}
+}
+
+func TestTimestep(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"ITEM: TIMESTEP\n1500\nITEM: NUMBER OF ATOMS\n3\n", "1500"},
+		{"ITEM: TIMESTEP\r\n1500\r\nITEM: NUMBER OF ATOMS\r\n3\r\n", "1500"},
+		{"ITEM: TIMESTEP\n", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Timestep([]byte(tt.header)); got != tt.want {
+			t.Errorf("Timestep(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
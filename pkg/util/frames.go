@@ -0,0 +1,54 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Frames contains the indices of the configurations to process in increasing
+// order.
+type Frames []int
+
+// NewFrames returns the configurations to process. If frames is empty, they are
+// the configurations of the range [start; end[. Otherwise, they are the
+// configurations of frames, sorted in increasing order because the trajectory
+// is read sequentially. The indices must be positive and unique.
+func NewFrames(frames []int, start, end int) (Frames, error) {
+	if len(frames) == 0 {
+		if start >= end {
+			return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+		}
+
+		f := make(Frames, end-start)
+		for i := range f {
+			f[i] = start + i
+		}
+		return f, nil
+	}
+
+	f := append(Frames(nil), frames...)
+	sort.Ints(f)
+	for i, v := range f {
+		if v < 0 {
+			return nil, fmt.Errorf("configuration %d doesn't exist", v)
+		}
+
+		if i > 0 && v == f[i-1] {
+			return nil, fmt.Errorf("configuration %d is duplicated", v)
+		}
+	}
+
+	return f, nil
+}
+
+// From returns the configuration at which the trajectory is before skipping
+// the configurations preceding the i-th configuration of the list (see
+// Input.SkipTo), i.e. the configuration following the previous one of the
+// list.
+func (f Frames) From(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return f[i-1] + 1
+}
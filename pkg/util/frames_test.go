@@ -0,0 +1,59 @@
+package util
+
+import "testing"
+
+func TestNewFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     []int
+		start, end int
+		want       Frames
+		ok         bool
+	}{
+		{"range", nil, 2, 6, Frames{2, 3, 4, 5}, true},
+		{"empty range", nil, 3, 3, nil, false},
+		{"sorted", []int{1, 5, 9}, 0, 0, Frames{1, 5, 9}, true},
+		{"unordered", []int{200, 10, 55}, 0, 1, Frames{10, 55, 200}, true},
+		{"first", []int{0}, 4, 8, Frames{0}, true},
+		{"duplicated", []int{4, 2, 4}, 0, 0, nil, false},
+		{"negative", []int{3, -1}, 0, 0, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := NewFrames(tt.frames, tt.start, tt.end)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v", tt.name, err)
+			continue
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNewFramesCopy(t *testing.T) {
+	frames := []int{3, 1, 2}
+	if _, err := NewFrames(frames, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if frames[0] != 3 || frames[1] != 1 || frames[2] != 2 {
+		t.Errorf("the frames given were sorted: %v", frames)
+	}
+}
+
+func TestFramesFrom(t *testing.T) {
+	f := Frames{10, 55, 200}
+	for i, want := range []int{0, 11, 56} {
+		if got := f.From(i); got != want {
+			t.Errorf("From(%d) = %d, want %d", i, got, want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
 )
@@ -12,34 +13,71 @@ import (
 // contains the size of the box and the number of atoms. This method returns the
 // number of atoms, the size of the box, the size of the box divided by two.
 func Header(r *bufio.Reader, w io.Writer, readSlice func(r *bufio.Reader, w io.Writer) []byte) (atoms int, box [3]float64, err error) {
+	atoms, box, _, err = HeaderTilt(r, w, readSlice)
+	return
+}
+
+// HeaderTilt is like Header but it also returns the tilt factors of the box
+// (see HeaderBoxTilt).
+func HeaderTilt(r *bufio.Reader, w io.Writer, readSlice func(r *bufio.Reader, w io.Writer) []byte) (atoms int, box, tilt [3]float64, err error) {
 	for l := 0; l < 3; l++ {
 		readSlice(r, w)
 	}
 
 	atomsStr := strings.TrimSpace(string(readSlice(r, w)))
-	atoms, _ = strconv.Atoi(atomsStr)
+	atoms, err = strconv.Atoi(atomsStr)
+	if err != nil {
+		err = fmt.Errorf("number of atoms: %w", err)
+		return
+	}
 
 	readSlice(r, w)
 
-	box, err = HeaderBox(r, w, readSlice)
+	box, tilt, err = HeaderBoxTilt(r, w, readSlice)
 	return
 }
 
-// HeaderBox returns the box size.
+// HeaderBox returns the box size. For a triclinic box, these are the lengths
+// of its edges along x, y, and z and the tilt factors are ignored: the
+// calculations using it apply the minimum image convention of an orthorhombic
+// box (see HeaderBoxTilt and MinImageTilt for the triclinic one).
 func HeaderBox(r *bufio.Reader, w io.Writer, readSlice func(r *bufio.Reader, w io.Writer) []byte) (box [3]float64, err error) {
+	box, _, err = HeaderBoxTilt(r, w, readSlice)
+	return
+}
+
+// HeaderBoxTilt returns the box size and the tilt factors xy, xz, and yz (0 for
+// an orthogonal box). The lines of a triclinic box contain a third column, the
+// tilt factor, and their bounds are the ones of the orthogonal box enclosing the
+// triclinic box: the lengths of the edges of the triclinic box along x and y
+// are therefore obtained by removing the tilt factors from the bounds, as
+// described in the documentation of the dump command of LAMMPS.
+func HeaderBoxTilt(r *bufio.Reader, w io.Writer, readSlice func(r *bufio.Reader, w io.Writer) []byte) (box, tilt [3]float64, err error) {
+	var lo, hi [3]float64
 	for k := 0; k < 3; k++ {
 		b := readSlice(r, w)
 
 		fields := strings.Fields(string(b))
-		if len(fields) != 2 {
+		if len(fields) != 2 && len(fields) != 3 {
 			err = fmt.Errorf("unable to get the size of the box")
 			return
 		}
 
-		lmin, _ := strconv.ParseFloat(fields[0], 64)
-		lmax, _ := strconv.ParseFloat(fields[1], 64)
+		lo[k], _ = strconv.ParseFloat(fields[0], 64)
+		hi[k], _ = strconv.ParseFloat(fields[1], 64)
+		if len(fields) == 3 {
+			tilt[k], _ = strconv.ParseFloat(fields[2], 64)
+		}
+	}
+
+	xy, xz, yz := tilt[0], tilt[1], tilt[2]
+	lo[0] -= math.Min(math.Min(0., xy), math.Min(xz, xy+xz))
+	hi[0] -= math.Max(math.Max(0., xy), math.Max(xz, xy+xz))
+	lo[1] -= math.Min(0., yz)
+	hi[1] -= math.Max(0., yz)
 
-		box[k] = lmax - lmin
+	for k := 0; k < 3; k++ {
+		box[k] = hi[k] - lo[k]
 	}
 
 	return
@@ -54,3 +92,131 @@ func HeaderWOutAtoms(r *bufio.Reader, w io.Writer, readSlice func(r *bufio.Reade
 
 	return HeaderBox(r, w, readSlice)
 }
+
+// The sets of coordinate columns of a LAMMPS trajectory.
+const (
+	Wrapped   = "wrapped"   // x, y, and z
+	Unwrapped = "unwrapped" // xu, yu, and zu
+	Scaled    = "scaled"    // xs, ys, and zs (fractions of the box)
+)
+
+// CoordColumns returns the names of the coordinate columns of the set set
+// (Wrapped or Unwrapped), or of the set def if set is empty. It lets the user
+// choose the set read by a calculation when a trajectory contains both.
+func CoordColumns(set, def string) ([3]string, error) {
+	if set == "" {
+		set = def
+	}
+
+	switch set {
+	case Wrapped:
+		return [3]string{"x", "y", "z"}, nil
+	case Unwrapped:
+		return [3]string{"xu", "yu", "zu"}, nil
+	}
+
+	return [3]string{}, fmt.Errorf("coordinate columns `%s` don't exist (%s or %s)", set, Wrapped, Unwrapped)
+}
+
+// ScaledColumns are the names of the coordinate columns of the set Scaled.
+var ScaledColumns = [3]string{"xs", "ys", "zs"}
+
+// CoordColumnsScaled is like CoordColumns but the set Scaled is accepted as
+// well. It is used by the calculations converting the scaled coordinates (see
+// Scale).
+func CoordColumnsScaled(set, def string) ([3]string, error) {
+	if set == Scaled {
+		return ScaledColumns, nil
+	}
+
+	cols, err := CoordColumns(set, def)
+	if err != nil {
+		return cols, fmt.Errorf("%w (or %s)", err, Scaled)
+	}
+	return cols, nil
+}
+
+// DetectScaled returns the coordinate columns to read among the columns of the
+// atoms fields, and true if they are the scaled ones. coords are the columns
+// of the set set returned by CoordColumnsScaled. If the set wasn't chosen (set is
+// empty) and the columns coords are missing but the scaled ones are present,
+// the scaled columns are returned, so that the trajectories dumped with xs, ys,
+// and zs are read without configuration.
+func DetectScaled(set string, coords [3]string, fields []string) ([3]string, bool) {
+	if set == Scaled {
+		return coords, true
+	}
+
+	if set != "" || hasColumns(fields, coords) || !hasColumns(fields, ScaledColumns) {
+		return coords, false
+	}
+
+	return ScaledColumns, true
+}
+
+// hasColumns returns true if every column of cols is in fields.
+func hasColumns(fields []string, cols [3]string) bool {
+	for _, c := range cols {
+		var ok bool
+		for _, v := range fields {
+			if v == c {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Scale converts the scaled coordinates xyz (fractions of the box, see Scaled)
+// into coordinates in the box [0; box[ in place.
+func Scale(xyz [][3]float64, box [3]float64) {
+	for i := range xyz {
+		for k := 0; k < 3; k++ {
+			xyz[i][k] *= box[k]
+		}
+	}
+}
+
+// ScaleTilt is like Scale in the triclinic box of size box and tilt factors
+// tilt (see HeaderBoxTilt).
+func ScaleTilt(xyz [][3]float64, box, tilt [3]float64) {
+	Scale(xyz, box)
+	if tilt == ([3]float64{}) {
+		return
+	}
+
+	for i := range xyz {
+		xyz[i] = Shear(xyz[i], box, tilt)
+	}
+}
+
+// ParseXYZ parses the coordinates of an atom. fields are the fields of its
+// line, cols the indices of the coordinate columns, and coords their names. A
+// coordinate that isn't a finite number, e.g. in a corrupted trajectory,
+// returns an error naming its column instead of being read as 0.
+func ParseXYZ(fields []string, cols []int, coords [3]string) (xyz [3]float64, err error) {
+	for k := 0; k < 3; k++ {
+		xyz[k], err = strconv.ParseFloat(fields[cols[k]], 64)
+		if err != nil {
+			return xyz, fmt.Errorf("column %s: %w", coords[k], err)
+		}
+
+		if math.IsNaN(xyz[k]) || math.IsInf(xyz[k], 0) {
+			return xyz, fmt.Errorf("column %s: %s isn't a finite number", coords[k], fields[cols[k]])
+		}
+	}
+
+	return xyz, nil
+}
+
+// AtomLine returns the line of the i-th atom of a configuration, counted from
+// the line ITEM: TIMESTEP (1), e.g. to locate a malformed field.
+func AtomLine(i int) int {
+	return i + 10
+}
@@ -0,0 +1,197 @@
+package util
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readSlice reads a line of r and writes it into w if w isn't nil, like the
+// readSlice functions of the calculations.
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
+	return b
+}
+
+// header returns the header of a configuration of the LAMMPS trajectory with
+// the lines of the box box.
+func header(atoms, box string) string {
+	return "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n" + atoms + "\n" + box
+}
+
+func TestHeaderBoxTilt(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		box   [3]float64
+		tilt  [3]float64
+	}{
+		{
+			"orthogonal",
+			"ITEM: BOX BOUNDS pp pp pp\n0 10\n-1 4\n0 2.5\n",
+			[3]float64{10, 5, 2.5},
+			[3]float64{},
+		},
+		{
+			"triclinic",
+			"ITEM: BOX BOUNDS xy xz yz pp pp pp\n-1 12 1\n0 10 -1\n0 8 2\n",
+			[3]float64{11, 8, 8},
+			[3]float64{1, -1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(tt.lines))
+		readSlice(r, nil)
+
+		box, tilt, err := HeaderBoxTilt(r, nil, readSlice)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if box != tt.box || tilt != tt.tilt {
+			t.Errorf("%s: got box %v tilt %v, want box %v tilt %v", tt.name, box, tilt, tt.box, tt.tilt)
+		}
+	}
+}
+
+func TestHeaderTriclinic(t *testing.T) {
+	cfg := header("3", "ITEM: BOX BOUNDS xy xz yz pp pp pp\n-1 12 1\n0 10 -1\n0 8 2\n") + "ITEM: ATOMS id\n"
+
+	// Header returns the lengths of the edges and ignores the tilt factors.
+	r := bufio.NewReader(strings.NewReader(cfg))
+	atoms, box, err := Header(r, nil, readSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atoms != 3 || box != [3]float64{11, 8, 8} {
+		t.Errorf("Header: got %d atoms and box %v, want 3 atoms and box [11 8 8]", atoms, box)
+	}
+	if b := readSlice(r, nil); string(b) != "ITEM: ATOMS id\n" {
+		t.Errorf("Header: got line %q after the header", b)
+	}
+
+	r = bufio.NewReader(strings.NewReader(cfg))
+	atoms, box, tilt, err := HeaderTilt(r, nil, readSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atoms != 3 || box != [3]float64{11, 8, 8} || tilt != [3]float64{1, -1, 2} {
+		t.Errorf("HeaderTilt: got %d atoms, box %v, and tilt %v, want 3 atoms, box [11 8 8], and tilt [1 -1 2]", atoms, box, tilt)
+	}
+}
+
+func TestHeaderOrthogonal(t *testing.T) {
+	cfg := header("3", "ITEM: BOX BOUNDS pp pp pp\n0 10\n0 9\n0 8\n")
+	atoms, box, err := Header(bufio.NewReader(strings.NewReader(cfg)), nil, readSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atoms != 3 || box != [3]float64{10, 9, 8} {
+		t.Errorf("got %d atoms and box %v, want 3 atoms and box [10 9 8]", atoms, box)
+	}
+}
+
+func TestParseXYZ(t *testing.T) {
+	coords := [3]string{"x", "y", "z"}
+	cols := []int{3, 1, 2}
+
+	tests := []struct {
+		fields []string
+		want   [3]float64
+		errMsg string // empty if no error is expected
+	}{
+		{[]string{"1", "2", "-3e1", "0.5"}, [3]float64{0.5, 2, -30}, ""},
+		{[]string{"1", "NaN", "0", "0"}, [3]float64{}, "column y: NaN isn't a finite number"},
+		{[]string{"1", "0", "+Inf", "0"}, [3]float64{}, "column z: +Inf isn't a finite number"},
+		{[]string{"1", "0", "0", "1,5"}, [3]float64{}, `column x: strconv.ParseFloat: parsing "1,5": invalid syntax`},
+	}
+
+	for _, tt := range tests {
+		xyz, err := ParseXYZ(tt.fields, cols, coords)
+		if tt.errMsg != "" {
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("ParseXYZ(%v): got error %v, want %q", tt.fields, err, tt.errMsg)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseXYZ(%v): %v", tt.fields, err)
+		} else if xyz != tt.want {
+			t.Errorf("ParseXYZ(%v) = %v, want %v", tt.fields, xyz, tt.want)
+		}
+	}
+}
+
+func TestHeaderAtoms(t *testing.T) {
+	cfg := header("3x", "ITEM: BOX BOUNDS pp pp pp\n0 10\n0 9\n0 8\n")
+	_, _, err := Header(bufio.NewReader(strings.NewReader(cfg)), nil, readSlice)
+	if err == nil {
+		t.Fatal("no error for a malformed number of atoms")
+	}
+}
+
+func TestCoordColumns(t *testing.T) {
+	tests := []struct {
+		set, def string
+		scaled   bool // CoordColumnsScaled instead of CoordColumns
+		want     [3]string
+		err      bool
+	}{
+		{"", Wrapped, false, [3]string{"x", "y", "z"}, false},
+		{"", Unwrapped, false, [3]string{"xu", "yu", "zu"}, false},
+		{Wrapped, Unwrapped, false, [3]string{"x", "y", "z"}, false},
+		{Unwrapped, Wrapped, false, [3]string{"xu", "yu", "zu"}, false},
+		{Scaled, Wrapped, false, [3]string{}, true},
+		{Scaled, Wrapped, true, ScaledColumns, false},
+		{Unwrapped, Wrapped, true, [3]string{"xu", "yu", "zu"}, false},
+		{"xu", Wrapped, false, [3]string{}, true},
+		{"xu", Wrapped, true, [3]string{}, true},
+	}
+
+	for _, tt := range tests {
+		f := CoordColumns
+		if tt.scaled {
+			f = CoordColumnsScaled
+		}
+
+		got, err := f(tt.set, tt.def)
+		if (err != nil) != tt.err {
+			t.Errorf("%q (default %q, scaled %v): error %v", tt.set, tt.def, tt.scaled, err)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("%q (default %q, scaled %v): got %v, want %v", tt.set, tt.def, tt.scaled, got, tt.want)
+		}
+	}
+}
+
+func TestDetectScaled(t *testing.T) {
+	wrapped := [3]string{"x", "y", "z"}
+	tests := []struct {
+		name   string
+		set    string
+		coords [3]string
+		fields string
+		want   [3]string
+		scaled bool
+	}{
+		{"both", "", wrapped, "id type x y z xu yu zu", wrapped, false},
+		{"default missing", "", wrapped, "id type xs ys zs", ScaledColumns, true},
+		{"default present", "", wrapped, "id type x y z xs ys zs", wrapped, false},
+		{"chosen missing", Wrapped, wrapped, "id type xs ys zs", wrapped, false},
+		{"chosen scaled", Scaled, ScaledColumns, "id type x y z xs ys zs", ScaledColumns, true},
+		{"none", "", wrapped, "id type xu yu zu", wrapped, false},
+	}
+
+	for _, tt := range tests {
+		got, scaled := DetectScaled(tt.set, tt.coords, strings.Fields(tt.fields))
+		if got != tt.want || scaled != tt.scaled {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, got, scaled, tt.want, tt.scaled)
+		}
+	}
+}
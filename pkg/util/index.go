@@ -0,0 +1,262 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Index contains the position (in bytes) of the beginning of each
+// configuration of a LAMMPS trajectory. It allows to go directly to a
+// configuration instead of reading the previous ones.
+type Index struct {
+	Size    int64 // size of the trajectory
+	Offsets []int64
+}
+
+// IndexPath returns the path of the index of the trajectory path (its sidecar
+// file).
+func IndexPath(path string) string {
+	return path + ".idx"
+}
+
+// BuildIndex reads the whole trajectory and returns its index. The boundaries
+// of the configurations are found with the number of atoms of each
+// configuration, like in ReadCfgNonCvg.
+func BuildIndex(r io.Reader) (*Index, error) {
+	var (
+		idx Index
+		rd  = bufio.NewReader(r)
+	)
+
+	for {
+		start := idx.Size
+		var atoms int
+		for l := 0; l < 9; l++ {
+			b, n, err := indexLine(rd)
+			idx.Size += n
+			if err == io.EOF && n == 0 && l == 0 {
+				return &idx, nil
+			} else if err != nil {
+				return nil, fmt.Errorf("configuration %d: %w", len(idx.Offsets), err)
+			}
+
+			// Blank lines between the configurations, e.g. at the end of
+			// the file, are skipped.
+			if l == 0 && strings.TrimSpace(string(b)) == "" {
+				start = idx.Size
+				l--
+				continue
+			}
+
+			if l == 3 {
+				atoms, err = strconv.Atoi(strings.TrimSpace(string(b)))
+				if err != nil {
+					return nil, fmt.Errorf("configuration %d: number of atoms: %w", len(idx.Offsets), err)
+				}
+			}
+		}
+
+		for i := 0; i < atoms; i++ {
+			_, n, err := indexLine(rd)
+			idx.Size += n
+			if err != nil {
+				return nil, fmt.Errorf("configuration %d: %w", len(idx.Offsets), err)
+			}
+		}
+
+		idx.Offsets = append(idx.Offsets, start)
+	}
+}
+
+// indexLine reads a line and returns its beginning and its length. The last
+// line of the file doesn't need an end of line character.
+func indexLine(r *bufio.Reader) (b []byte, n int64, err error) {
+	for {
+		l, err := r.ReadSlice('\n')
+		if b == nil {
+			b = append([]byte(nil), l...)
+		}
+		n += int64(len(l))
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && n > 0:
+			return b, n, nil
+		default:
+			return b, n, err
+		}
+	}
+}
+
+// WriteIndex writes the index in the file path. The first line is the size of
+// the trajectory, the other lines are the positions of the configurations.
+func WriteIndex(path string, idx *Index) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "%d\n", idx.Size)
+	for _, v := range idx.Offsets {
+		fmt.Fprintf(w, "%d\n", v)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// ReadIndex reads the index written by WriteIndex in the file path.
+func ReadIndex(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		idx Index
+		s   = bufio.NewScanner(f)
+	)
+	for i := 0; s.Scan(); i++ {
+		v, err := strconv.ParseInt(strings.TrimSpace(s.Text()), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		if i == 0 {
+			idx.Size = v
+			continue
+		}
+		idx.Offsets = append(idx.Offsets, v)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return &idx, nil
+}
+
+// ErrEndOfTrajectory is returned by SkipTo when the trajectory ends before the
+// requested configuration.
+var ErrEndOfTrajectory = errors.New("end of the trajectory")
+
+// LogEndOfTrajectory writes into log that the trajectory read by the
+// calculation calc ends before the configuration next, the configurations
+// being requested up to last, and that the used configurations read so far are
+// used. Nothing is written if log is nil.
+func LogEndOfTrajectory(log *log.Logger, calc string, next, last, used int) {
+	if log == nil {
+		return
+	}
+
+	log.Printf("%s: the trajectory ends before the configuration %d (requested up to %d), %d configurations used",
+		calc, next, last, used)
+}
+
+// SkipTo moves r to the beginning of the configuration cfg. r must read f
+// through in.Reader and be at the beginning of the configuration cur (lower or
+// equal than cfg). If the trajectory has an index (see IndexPath), f is moved
+// directly to the configuration and r is reset. Otherwise, the configurations
+// between cur and cfg are read (see ReadCfgNonCvg). The index is not used if
+// the duplicated configurations are skipped or if the configurations are
+// selected by timestep, because it refers to every configuration of the
+// trajectory, nor if the trajectory is compressed (see Compressed) or if f is
+// nil (a trajectory that isn't a file). If the configuration doesn't exist,
+// ErrEndOfTrajectory is returned.
+func (in *Input) SkipTo(f *os.File, r *bufio.Reader, cur, cfg int) error {
+	if cfg == cur || AtEOF(r) {
+		return endOfTrajectory(r)
+	}
+
+	idx, err := in.index(f)
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+
+	if idx == nil {
+		err = ReadCfgNonCvg(r, cfg-cur)
+		if err != nil && !AtEOF(r) {
+			return err
+		}
+		return endOfTrajectory(r)
+	}
+
+	if cfg >= len(idx.Offsets) {
+		return ErrEndOfTrajectory
+	}
+
+	_, err = f.Seek(idx.Offsets[cfg], io.SeekStart)
+	if err != nil {
+		return err
+	}
+	r.Reset(in.Reader(f))
+
+	return nil
+}
+
+// AtEOF returns true if every byte of r has been read.
+func AtEOF(r *bufio.Reader) bool {
+	_, err := r.Peek(1)
+	return err == io.EOF
+}
+
+// endOfTrajectory returns ErrEndOfTrajectory if every byte of r has been read.
+func endOfTrajectory(r *bufio.Reader) error {
+	if AtEOF(r) {
+		return ErrEndOfTrajectory
+	}
+	return nil
+}
+
+// index returns the index of the trajectory f, or nil if it doesn't have one.
+// The index is read once.
+func (in *Input) index(f *os.File) (*Index, error) {
+	if f == nil || in.SkipDuplicateFrames || in.Timesteps != nil || Compressed(f.Name()) {
+		return nil, nil
+	}
+
+	if !in.indexRead {
+		in.indexRead = true
+		in.idx, in.idxErr = readIndexOf(f)
+	}
+
+	return in.idx, in.idxErr
+}
+
+// readIndexOf reads the index of the trajectory f and checks that it is up to
+// date. It returns nil if the trajectory doesn't have an index.
+func readIndexOf(f *os.File) (*Index, error) {
+	path := IndexPath(f.Name())
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	idx, err := ReadIndex(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() != idx.Size {
+		return nil, errors.New("the trajectory has changed since the index was built")
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// crlf reads testdata/crlf.lammpstrj: three configurations (2, 3, and 1 atoms)
+// whose lines end with \r\n, whose number of atoms is surrounded by spaces,
+// and followed by blank lines.
+func crlf(t *testing.T) []byte {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "crlf.lammpstrj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBuildIndexCRLF(t *testing.T) {
+	b := crlf(t)
+	idx, err := BuildIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []int64
+	for off := 0; ; {
+		i := bytes.Index(b[off:], []byte("ITEM: TIMESTEP"))
+		if i < 0 {
+			break
+		}
+		want = append(want, int64(off+i))
+		off += i + 1
+	}
+
+	if len(idx.Offsets) != len(want) {
+		t.Fatalf("got %d configurations, want %d", len(idx.Offsets), len(want))
+	}
+	for i := range want {
+		if idx.Offsets[i] != want[i] {
+			t.Errorf("configuration %d at %d, want %d", i, idx.Offsets[i], want[i])
+		}
+	}
+	if idx.Size != int64(len(b)) {
+		t.Errorf("size %d, want %d", idx.Size, len(b))
+	}
+}
+
+func TestHeaderCRLF(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader(crlf(t)))
+
+	for i, want := range []int{2, 3, 1} {
+		atoms, box, err := Header(r, nil, readSlice)
+		if err != nil {
+			t.Fatalf("configuration %d: %v", i, err)
+		}
+		if atoms != want || box != [3]float64{10, 10, 10} {
+			t.Errorf("configuration %d: got %d atoms and box %v, want %d atoms and box [10 10 10]", i, atoms, box, want)
+		}
+
+		for l := 0; l < atoms+1; l++ { // columns and atoms
+			readSlice(r, nil)
+		}
+	}
+}
+
+func TestReadCfgNonCvgCRLF(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader(crlf(t)))
+	if err := ReadCfgNonCvg(r, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	atoms, _, err := Header(r, nil, readSlice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atoms != 1 {
+		t.Fatalf("got %d atoms in the last configuration, want 1", atoms)
+	}
+	readSlice(r, nil)
+
+	fields := strings.Fields(string(readSlice(r, nil)))
+	xyz, err := ParseXYZ(fields, []int{2, 3, 4}, [3]string{"x", "y", "z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xyz != [3]float64{9, 8, 7} {
+		t.Errorf("got %v, want [9 8 7]", xyz)
+	}
+}
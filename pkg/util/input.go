@@ -0,0 +1,180 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Input contains the options applied to the reading of the trajectories. If
+// ReadLimit is strictly positive, the trajectory is read at ReadLimit bytes per
+// second at most (see Throttle). If SkipDuplicateFrames is true, the
+// configurations whose timestep is equal to the one of the previous
+// configuration are removed (see Dedup). The index of the trajectory, if any,
+// is used to skip configurations (see SkipTo). If VolumeStats is true, the
+// statistics of the volume of the box are shared between the calculations
+// through a file next to the trajectory (see VolumeStats). If Timesteps is
+// not nil, only the configurations whose timestep is in this range are read
+// (see TimestepFilter).
+type Input struct {
+	ReadLimit           int64
+	SkipDuplicateFrames bool
+	VolumeStats         bool
+	Timesteps           *TimestepRange
+
+	indexRead bool
+	idx       *Index
+	idxErr    error
+}
+
+// Reader returns r wrapped according to the options.
+func (in Input) Reader(r io.Reader) io.Reader {
+	r = NewThrottle(r, in.ReadLimit)
+	if in.SkipDuplicateFrames {
+		r = NewDedup(r)
+	}
+	if in.Timesteps != nil {
+		r = NewTimestepFilter(r, *in.Timesteps)
+	}
+	return r
+}
+
+// Dedup is an io.Reader that removes the duplicated configurations of a LAMMPS
+// trajectory. A configuration is duplicated if its timestep (ITEM: TIMESTEP) is
+// equal to the one of the previous configuration, which happens when the
+// trajectories of a restarted simulation are concatenated. The indices of the
+// configurations (e.g. CfgStart) then refer to the trajectory without the
+// duplicates.
+type Dedup struct {
+	r    *bufio.Reader
+	buf  bytes.Buffer
+	last string
+	seen bool
+	err  error
+}
+
+// NewDedup returns a reader removing the duplicated configurations of r.
+func NewDedup(r io.Reader) *Dedup {
+	return &Dedup{r: bufio.NewReader(r)}
+}
+
+// Read reads up to len(p) bytes into p. The configurations are read one by one
+// from the underlying reader.
+func (d *Dedup) Read(p []byte) (int, error) {
+	for d.buf.Len() == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+
+	return d.buf.Read(p)
+}
+
+// next reads a configuration and keeps it if it is not duplicated.
+func (d *Dedup) next() error {
+	frame, timestep, err := readFrame(d.r)
+	if err != nil {
+		d.buf.Write(frame)
+		return err
+	}
+
+	if !d.seen || timestep != d.last {
+		d.buf.Write(frame)
+	}
+	d.last = timestep
+	d.seen = true
+
+	return nil
+}
+
+// TimestepRange is a range of timesteps [Start; End[.
+type TimestepRange struct {
+	Start, End int64
+}
+
+// TimestepFilter is an io.Reader that only keeps the configurations of a
+// LAMMPS trajectory whose timestep (ITEM: TIMESTEP) is in a range, e.g. to
+// select the configurations of a trajectory dumped at irregular intervals. The
+// indices of the configurations (e.g. CfgStart) then refer to the kept
+// configurations: the first one is the configuration 0.
+type TimestepFilter struct {
+	r     *bufio.Reader
+	buf   bytes.Buffer
+	steps TimestepRange
+	err   error
+}
+
+// NewTimestepFilter returns a reader keeping the configurations of r whose
+// timestep is in steps.
+func NewTimestepFilter(r io.Reader, steps TimestepRange) *TimestepFilter {
+	return &TimestepFilter{r: bufio.NewReader(r), steps: steps}
+}
+
+// Read reads up to len(p) bytes into p. The configurations are read one by one
+// from the underlying reader.
+func (t *TimestepFilter) Read(p []byte) (int, error) {
+	for t.buf.Len() == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+		t.err = t.next()
+	}
+
+	return t.buf.Read(p)
+}
+
+// next reads a configuration and keeps it if its timestep is in the range.
+func (t *TimestepFilter) next() error {
+	frame, timestep, err := readFrame(t.r)
+	if err != nil {
+		t.buf.Write(frame)
+		return err
+	}
+
+	step, err := strconv.ParseInt(strings.TrimSpace(timestep), 10, 64)
+	if err != nil {
+		return fmt.Errorf("timestep: %w", err)
+	}
+
+	if step >= t.steps.Start && step < t.steps.End {
+		t.buf.Write(frame)
+	}
+
+	return nil
+}
+
+// readFrame reads a configuration of r and returns its lines and its
+// timestep. If an error occurs, the lines read so far are returned.
+func readFrame(r *bufio.Reader) (frame []byte, timestep string, err error) {
+	var (
+		buf   bytes.Buffer
+		lines [4][]byte
+	)
+
+	for l := 0; l < 4; l++ {
+		lines[l], err = r.ReadBytes('\n')
+		buf.Write(lines[l])
+		if err != nil {
+			return buf.Bytes(), "", err
+		}
+	}
+
+	atoms, err := strconv.Atoi(strings.TrimSpace(string(lines[3])))
+	if err != nil {
+		return nil, "", fmt.Errorf("number of atoms: %w", err)
+	}
+
+	for l := 0; l < (5 + atoms); l++ {
+		b, err := r.ReadBytes('\n')
+		buf.Write(b)
+		if err != nil {
+			return buf.Bytes(), "", err
+		}
+	}
+
+	return buf.Bytes(), Line(lines[1]), nil
+}
@@ -0,0 +1,66 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// frame returns a configuration of a LAMMPS trajectory with the timestep step
+// and an atom at x. Its lines end with eol.
+func frame(step, x int, eol string) string {
+	s := fmt.Sprintf("ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n"+
+		"ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n1 1 %d 0 0\n", step, x)
+	return strings.ReplaceAll(s, "\n", eol)
+}
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []int // timestep of each configuration, whose atom is at its index
+		kept  []int // indices of the configurations kept
+	}{
+		{"no duplicate", []int{0, 100, 200}, []int{0, 1, 2}},
+		{"restart", []int{0, 100, 100, 200}, []int{0, 1, 3}},
+		{"several restarts", []int{0, 0, 100, 100, 100, 200, 200}, []int{0, 2, 5}},
+		{"same timestep later", []int{0, 100, 0, 100}, []int{0, 1, 2, 3}},
+	}
+
+	for _, eol := range []string{"\n", "\r\n"} {
+		for _, tt := range tests {
+			var in, want strings.Builder
+			for i, step := range tt.steps {
+				in.WriteString(frame(step, i, eol))
+			}
+			for _, i := range tt.kept {
+				want.WriteString(frame(tt.steps[i], i, eol))
+			}
+
+			got, err := ioutil.ReadAll(NewDedup(strings.NewReader(in.String())))
+			if err != nil {
+				t.Errorf("%s (%q): %v", tt.name, eol, err)
+				continue
+			}
+
+			if string(got) != want.String() {
+				t.Errorf("%s (%q): got\n%s\nwant\n%s", tt.name, eol, got, want.String())
+			}
+		}
+	}
+}
+
+func TestDedupMixedEOL(t *testing.T) {
+	// The timestep of a duplicated configuration is the same whatever the end
+	// of its lines.
+	in := frame(0, 0, "\n") + frame(100, 1, "\r\n") + frame(100, 2, "\n") + frame(200, 3, "\r\n")
+	want := frame(0, 0, "\n") + frame(100, 1, "\r\n") + frame(200, 3, "\r\n")
+
+	got, err := ioutil.ReadAll(NewDedup(strings.NewReader(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Triangle is a triangle of a surface mesh given by the coordinates of its
+// three vertices.
+type Triangle [3][3]float64
+
+// ReadMesh returns the triangles of the surface mesh written in the Wavefront
+// OBJ file path. Only the vertices (v x y z) and the faces (f i j k ...) are
+// read; the other lines and the comments (after #) are ignored. The vertices of
+// a face are 1-based indices, or negative indices relative to the end of the
+// vertices read so far, optionally followed by a texture and a normal index
+// (i/t/n) which are ignored. The faces with more than three vertices are split
+// into triangles sharing their first vertex.
+func ReadMesh(path string) ([]Triangle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		vertices  [][3]float64
+		triangles []Triangle
+	)
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: a vertex must contain 3 coordinates (got %d)", line, len(fields)-1)
+			}
+
+			var v [3]float64
+			for k := 0; k < 3; k++ {
+				v[k], err = strconv.ParseFloat(fields[k+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			vertices = append(vertices, v)
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: a face must contain at least 3 vertices (got %d)", line, len(fields)-1)
+			}
+
+			face := make([][3]float64, len(fields)-1)
+			for k, field := range fields[1:] {
+				if i := strings.IndexByte(field, '/'); i >= 0 {
+					field = field[:i]
+				}
+
+				i, err := strconv.Atoi(field)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+
+				if i < 0 {
+					i += len(vertices) + 1
+				}
+				if i < 1 || i > len(vertices) {
+					return nil, fmt.Errorf("line %d: vertex %s doesn't exist", line, field)
+				}
+				face[k] = vertices[i-1]
+			}
+
+			for k := 1; k < len(face)-1; k++ {
+				triangles = append(triangles, Triangle{face[0], face[k], face[k+1]})
+			}
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(triangles) == 0 {
+		return nil, errors.New("no face found")
+	}
+
+	return triangles, nil
+}
+
+// Centroid returns the centroid of the triangle and the distance between the
+// centroid and the farthest vertex.
+func (t Triangle) Centroid() (c [3]float64, radius float64) {
+	for k := 0; k < 3; k++ {
+		c[k] = (t[0][k] + t[1][k] + t[2][k]) / 3.
+	}
+
+	for _, v := range t {
+		var d float64
+		for k := 0; k < 3; k++ {
+			d += Pow(v[k]-c[k], 2)
+		}
+		if d > radius {
+			radius = d
+		}
+	}
+
+	return c, math.Sqrt(radius)
+}
+
+// Dist2 returns the square of the distance between the point p and the closest
+// point of the triangle (Ericson, Real-Time Collision Detection, 5.1.5). The
+// closest point is found from the Voronoi region of p: a vertex, an edge, or
+// the interior of the triangle.
+func (t Triangle) Dist2(p [3]float64) float64 {
+	a, b, c := t[0], t[1], t[2]
+	ab, ac, ap := vsub(b, a), vsub(c, a), vsub(p, a)
+
+	d1, d2 := vdot(ab, ap), vdot(ac, ap)
+	if d1 <= 0 && d2 <= 0 {
+		return vdot(ap, ap) // vertex a
+	}
+
+	bp := vsub(p, b)
+	d3, d4 := vdot(ab, bp), vdot(ac, bp)
+	if d3 >= 0 && d4 <= d3 {
+		return vdot(bp, bp) // vertex b
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		v := d1 / (d1 - d3) // edge ab
+		return vdist2(p, vadd(a, vscale(ab, v)))
+	}
+
+	cp := vsub(p, c)
+	d5, d6 := vdot(ab, cp), vdot(ac, cp)
+	if d6 >= 0 && d5 <= d6 {
+		return vdot(cp, cp) // vertex c
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		w := d2 / (d2 - d6) // edge ac
+		return vdist2(p, vadd(a, vscale(ac, w)))
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0 && (d4-d3) >= 0 && (d5-d6) >= 0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6)) // edge bc
+		return vdist2(p, vadd(b, vscale(vsub(c, b), w)))
+	}
+
+	denom := 1. / (va + vb + vc) // interior
+	v, w := vb*denom, vc*denom
+	return vdist2(p, vadd(a, vadd(vscale(ab, v), vscale(ac, w))))
+}
+
+func vadd(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func vsub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func vscale(a [3]float64, s float64) [3]float64 {
+	return [3]float64{a[0] * s, a[1] * s, a[2] * s}
+}
+
+func vdot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func vdist2(a, b [3]float64) float64 {
+	d := vsub(a, b)
+	return vdot(d, d)
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MolID returns the molecule identifier of an atom. If col is negative, the
+// trajectory has no mol column and the identifier is synthesized from the index
+// of the atom: molecules are made of atomsPerMol consecutive atoms and their
+// identifiers start at 0.
+func MolID(fields []string, col, index, atomsPerMol int) string {
+	if col >= 0 {
+		return fields[col]
+	}
+	return strconv.Itoa(index / atomsPerMol)
+}
+
+// CheckAtomsPerMol checks that the atoms can be grouped in molecules of
+// atomsPerMol atoms.
+func CheckAtomsPerMol(atoms, atomsPerMol int) error {
+	if atomsPerMol <= 0 {
+		return fmt.Errorf("the number of atoms per molecule must be strictly positive (got %d)", atomsPerMol)
+	}
+
+	if atoms%atomsPerMol != 0 {
+		return fmt.Errorf("the number of atoms (%d) isn't divisible by the number of atoms per molecule (%d)",
+			atoms, atomsPerMol)
+	}
+
+	return nil
+}
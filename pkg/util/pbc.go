@@ -0,0 +1,87 @@
+package util
+
+import "math"
+
+// MinImage returns the vector a - b with the minimum image convention in the
+// orthorhombic box. A component equal to half the box is rounded away from
+// zero, so that a - b and b - a are opposite but both have the same length.
+func MinImage(a, b [3]float64, box [3]float64) (d [3]float64) {
+	for k := 0; k < 3; k++ {
+		distatt := a[k] - b[k]
+		d[k] = distatt - box[k]*math.Round(distatt/box[k])
+	}
+	return
+}
+
+// MinImageDist2 returns the square of the distance between a and b with the
+// minimum image convention (see MinImage).
+func MinImageDist2(a, b [3]float64, box [3]float64) float64 {
+	d := MinImage(a, b, box)
+	return d[0]*d[0] + d[1]*d[1] + d[2]*d[2]
+}
+
+// MinImageTilt is like MinImage in the triclinic box whose edges have the
+// lengths box along x, y, and z and whose tilt factors are tilt (xy, xz, and
+// yz, see HeaderBoxTilt). Like in LAMMPS, the vector is brought back along z,
+// then along y, and then along x, each time moving the other components by the
+// tilt factors of the edge. It is the minimum image for the distances below
+// half the smallest width of the box (see Widths), and MinImage for an
+// orthogonal box.
+func MinImageTilt(a, b, box, tilt [3]float64) (d [3]float64) {
+	for k := 0; k < 3; k++ {
+		d[k] = a[k] - b[k]
+	}
+
+	n := math.Round(d[2] / box[2])
+	d[0] -= n * tilt[1]
+	d[1] -= n * tilt[2]
+	d[2] -= n * box[2]
+
+	n = math.Round(d[1] / box[1])
+	d[0] -= n * tilt[0]
+	d[1] -= n * box[1]
+
+	d[0] -= box[0] * math.Round(d[0]/box[0])
+	return
+}
+
+// MinImageDist2Tilt returns the square of the distance between a and b with
+// the minimum image convention of a triclinic box (see MinImageTilt).
+func MinImageDist2Tilt(a, b, box, tilt [3]float64) float64 {
+	d := MinImageTilt(a, b, box, tilt)
+	return d[0]*d[0] + d[1]*d[1] + d[2]*d[2]
+}
+
+// Widths returns the distances between the opposite faces of the triclinic
+// box of size box and tilt factors tilt (box for an orthogonal box). Half the
+// smallest one is the largest distance below which MinImageTilt always
+// returns the minimum image.
+func Widths(box, tilt [3]float64) [3]float64 {
+	xy, xz, yz := tilt[0], tilt[1], tilt[2]
+	vol := box[0] * box[1] * box[2]
+	return [3]float64{
+		vol / math.Sqrt(Pow(box[1]*box[2], 2)+Pow(xy*box[2], 2)+Pow(xy*yz-box[1]*xz, 2)),
+		box[1] * box[2] / math.Sqrt(Pow(box[2], 2)+Pow(yz, 2)),
+		box[2],
+	}
+}
+
+// Shear returns the position in the triclinic box of size box and tilt
+// factors tilt of the point u given along its edges: u[k] is the fraction of
+// the k-th edge times box[k]. The volumes are kept, so that a grid of boxes
+// along x, y, and z in u becomes a grid of parallelepipeds of the same volume.
+func Shear(u, box, tilt [3]float64) [3]float64 {
+	return [3]float64{
+		u[0] + tilt[0]/box[1]*u[1] + tilt[1]/box[2]*u[2],
+		u[1] + tilt[2]/box[2]*u[2],
+		u[2],
+	}
+}
+
+// Unshear is the inverse of Shear.
+func Unshear(pos, box, tilt [3]float64) (u [3]float64) {
+	u[2] = pos[2]
+	u[1] = pos[1] - tilt[2]/box[2]*u[2]
+	u[0] = pos[0] - tilt[0]/box[1]*u[1] - tilt[1]/box[2]*u[2]
+	return
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMinImage(t *testing.T) {
+	box := [3]float64{10, 20, 8}
+	tests := []struct {
+		name string
+		a, b [3]float64
+		want [3]float64
+	}{
+		{"same image", [3]float64{1, 2, 3}, [3]float64{2, 4, 1}, [3]float64{-1, -2, 2}},
+		{"across the box", [3]float64{9, 19, 7}, [3]float64{1, 1, 1}, [3]float64{-2, -2, -2}},
+		{"other images", [3]float64{31, -37, 17}, [3]float64{0, 0, 0}, [3]float64{1, 3, 1}},
+		{"half the box", [3]float64{5, 10, 4}, [3]float64{0, 0, 0}, [3]float64{-5, -10, -4}},
+		{"minus half the box", [3]float64{0, 0, 0}, [3]float64{5, 10, 4}, [3]float64{5, 10, 4}},
+		{"half the box shifted", [3]float64{7.5, 0, 0}, [3]float64{2.5, 0, 0}, [3]float64{-5, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		got := MinImage(tt.a, tt.b, box)
+		if got != tt.want {
+			t.Errorf("%s: MinImage(%v, %v) = %v, want %v", tt.name, tt.a, tt.b, got, tt.want)
+		}
+
+		// b - a is the opposite of a - b and both have the same length.
+		back := MinImage(tt.b, tt.a, box)
+		for k := 0; k < 3; k++ {
+			if back[k] != -got[k] {
+				t.Errorf("%s: MinImage(%v, %v) = %v isn't the opposite of %v", tt.name, tt.b, tt.a, back, got)
+				break
+			}
+		}
+
+		d2 := got[0]*got[0] + got[1]*got[1] + got[2]*got[2]
+		if MinImageDist2(tt.a, tt.b, box) != d2 || MinImageDist2(tt.b, tt.a, box) != d2 {
+			t.Errorf("%s: MinImageDist2 differs from the square of MinImage (%g)", tt.name, d2)
+		}
+	}
+}
+
+// bruteImage returns the square of the shortest vector between a and b over
+// the images of b in the triclinic box of size box and tilt factors tilt.
+func bruteImage(a, b, box, tilt [3]float64) float64 {
+	best := math.MaxFloat64
+	for i := -6.; i <= 6; i++ {
+		for j := -6.; j <= 6; j++ {
+			for k := -6.; k <= 6; k++ {
+				d := [3]float64{
+					a[0] - b[0] - i*box[0] - j*tilt[0] - k*tilt[1],
+					a[1] - b[1] - j*box[1] - k*tilt[2],
+					a[2] - b[2] - k*box[2],
+				}
+				best = math.Min(best, d[0]*d[0]+d[1]*d[1]+d[2]*d[2])
+			}
+		}
+	}
+	return best
+}
+
+func TestMinImageTilt(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		box, tilt [3]float64
+	}{
+		{[3]float64{10, 20, 8}, [3]float64{}},
+		{[3]float64{10, 10, 10}, [3]float64{3, 0, 0}},
+		{[3]float64{10, 12, 9}, [3]float64{-4, 2.5, 5}},
+		{[3]float64{8, 8, 8}, [3]float64{4, -4, 4}}, // largest tilt factors of LAMMPS
+	}
+
+	for _, tt := range tests {
+		widths := Widths(tt.box, tt.tilt)
+		half := math.Min(widths[0], math.Min(widths[1], widths[2])) / 2.
+
+		for n := 0; n < 1000; n++ {
+			var a, b [3]float64
+			for k := 0; k < 3; k++ {
+				a[k] = (rnd.Float64()*3 - 1) * tt.box[k]
+				b[k] = (rnd.Float64()*3 - 1) * tt.box[k]
+			}
+
+			got := MinImageDist2Tilt(a, b, tt.box, tt.tilt)
+			want := bruteImage(a, b, tt.box, tt.tilt)
+			if got < want-1e-9 {
+				t.Fatalf("box %v tilt %v: MinImageDist2Tilt(%v, %v) = %g is shorter than the shortest image %g",
+					tt.box, tt.tilt, a, b, got, want)
+			}
+			if want < half*half && math.Abs(got-want) > 1e-9 {
+				t.Fatalf("box %v tilt %v: MinImageDist2Tilt(%v, %v) = %g, want %g",
+					tt.box, tt.tilt, a, b, got, want)
+			}
+
+			if tt.tilt == ([3]float64{}) && MinImageTilt(a, b, tt.box, tt.tilt) != MinImage(a, b, tt.box) {
+				t.Fatalf("box %v: MinImageTilt(%v, %v) differs from MinImage", tt.box, a, b)
+			}
+		}
+	}
+}
+
+func TestWidths(t *testing.T) {
+	tests := []struct {
+		box, tilt, want [3]float64
+	}{
+		{[3]float64{10, 20, 8}, [3]float64{}, [3]float64{10, 20, 8}},
+		{[3]float64{10, 10, 10}, [3]float64{10, 0, 0}, [3]float64{10 / math.Sqrt2, 10, 10}},
+		{[3]float64{10, 10, 10}, [3]float64{0, 0, 10}, [3]float64{10, 10 / math.Sqrt2, 10}},
+		{[3]float64{10, 10, 10}, [3]float64{0, 10, 0}, [3]float64{10 / math.Sqrt2, 10, 10}},
+	}
+
+	for _, tt := range tests {
+		got := Widths(tt.box, tt.tilt)
+		for k := 0; k < 3; k++ {
+			if math.Abs(got[k]-tt.want[k]) > 1e-12 {
+				t.Errorf("Widths(%v, %v) = %v, want %v", tt.box, tt.tilt, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestShear(t *testing.T) {
+	box := [3]float64{10, 12, 9}
+	tilt := [3]float64{-4, 2.5, 5}
+
+	// The corners of the box along the edges are the edges of the box.
+	edges := [3][3]float64{{10, 0, 0}, {-4, 12, 0}, {2.5, 5, 9}}
+	for k := 0; k < 3; k++ {
+		var u [3]float64
+		u[k] = box[k]
+		if got := Shear(u, box, tilt); got != edges[k] {
+			t.Errorf("Shear(%v) = %v, want %v", u, got, edges[k])
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 100; n++ {
+		pos := [3]float64{rnd.Float64() * 10, rnd.Float64() * 12, rnd.Float64() * 9}
+		got := Shear(Unshear(pos, box, tilt), box, tilt)
+		for k := 0; k < 3; k++ {
+			if math.Abs(got[k]-pos[k]) > 1e-12 {
+				t.Fatalf("Shear(Unshear(%v)) = %v", pos, got)
+			}
+		}
+	}
+}
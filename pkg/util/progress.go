@@ -0,0 +1,190 @@
+package util
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProgressInterval is the minimum duration between two progress records.
+var ProgressInterval = time.Second
+
+// Progress writes progress records in the JSON format (one record per line) so
+// that another process can monitor the calculations. It can also log a line
+// with the number of processed configurations (see SetLog). A nil Progress does
+// nothing, so the calculations can call its methods unconditionally. It is safe
+// for concurrent use.
+type Progress struct {
+	Type string
+	Step int
+	Rtn  int
+
+	w     io.Writer
+	c     io.Closer
+	start time.Time
+	last  time.Time
+
+	log      *log.Logger
+	logEvery time.Duration
+	logLast  time.Time
+
+	cfg   int
+	total int
+	mux   sync.Mutex
+}
+
+// progressRecord is a progress record. Percent, Rate, and ETA are negative if
+// the number of configurations is unknown.
+type progressRecord struct {
+	Type    string  `json:"type"`
+	Step    int     `json:"step"`
+	Routine int     `json:"routine"`
+	Cfg     int     `json:"cfg"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+	Rate    float64 `json:"rate"`    // configurations per second
+	ETA     float64 `json:"eta"`     // seconds
+	Elapsed float64 `json:"elapsed"` // seconds
+	Done    bool    `json:"done"`
+}
+
+// NewProgress returns an instance of the Progress structure. The records are
+// written in the file path (in append mode, so several calculations can share
+// the same file). path can also be "stdout" or "stderr", or be empty if only
+// the lines of SetLog are wanted. typ is the type of calculation, step and rtn
+// are its position in the batch (see cfg.Cfg).
+func NewProgress(path, typ string, step, rtn int) (*Progress, error) {
+	p := Progress{Type: typ, Step: step, Rtn: rtn, start: time.Now()}
+
+	switch path {
+	case "":
+	case "stdout":
+		p.w = os.Stdout
+	case "stderr":
+		p.w = os.Stderr
+	default:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		p.w, p.c = f, f
+	}
+
+	return &p, nil
+}
+
+// SetLog makes p log a line with the number of processed configurations
+// (processed N/M configurations) in log every interval at most, e.g. to follow
+// a long calculation from its logs. The lines don't depend on the number of
+// configurations processed per second, so they don't flood the logs.
+func (p *Progress) SetLog(log *log.Logger, interval time.Duration) {
+	if p == nil {
+		return
+	}
+
+	p.mux.Lock()
+	p.log, p.logEvery, p.logLast = log, interval, time.Now()
+	p.mux.Unlock()
+}
+
+// Update writes a record if the last one is older than ProgressInterval, and
+// logs a line if the last one is older than the interval of SetLog. cfg is the
+// number of configurations already processed and total the number of
+// configurations to process (0 if unknown).
+func (p *Progress) Update(cfg, total int) {
+	if p == nil {
+		return
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.cfg, p.total = cfg, total
+	now := time.Now()
+	if p.log != nil && now.Sub(p.logLast) >= p.logEvery {
+		p.logLast = now
+		p.writeLog(now, false)
+	}
+
+	if p.w == nil || now.Sub(p.last) < ProgressInterval {
+		return
+	}
+	p.last = now
+	p.write(now, false)
+}
+
+// Close writes a last record with the values of the last update and closes the
+// file.
+func (p *Progress) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	now := time.Now()
+	if p.log != nil {
+		p.writeLog(now, true)
+	}
+	if p.w != nil {
+		p.write(now, true)
+	}
+	if p.c != nil {
+		return p.c.Close()
+	}
+	return nil
+}
+
+func (p *Progress) write(now time.Time, done bool) {
+	cfg, total := p.cfg, p.total
+	elapsed := now.Sub(p.start).Seconds()
+	rec := progressRecord{
+		Type:    p.Type,
+		Step:    p.Step,
+		Routine: p.Rtn,
+		Cfg:     cfg,
+		Total:   total,
+		Percent: -1,
+		Rate:    -1,
+		ETA:     -1,
+		Elapsed: elapsed,
+		Done:    done,
+	}
+
+	if elapsed > 0 {
+		rec.Rate = float64(cfg) / elapsed
+	}
+
+	if total > 0 {
+		rec.Percent = 100. * float64(cfg) / float64(total)
+		if rec.Rate > 0 {
+			rec.ETA = float64(total-cfg) / rec.Rate
+		}
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	p.w.Write(append(b, '\n'))
+}
+
+func (p *Progress) writeLog(now time.Time, done bool) {
+	state := "processed"
+	if done {
+		state = "done:"
+	}
+
+	total := "?"
+	if p.total > 0 {
+		total = strconv.Itoa(p.total)
+	}
+
+	p.log.Printf("%s (step %d, routine %d): %s %d/%s configurations (%s)", p.Type, p.Step, p.Rtn,
+		state, p.cfg, total, now.Sub(p.start).Round(time.Second))
+}
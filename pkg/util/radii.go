@@ -0,0 +1,38 @@
+package util
+
+import "fmt"
+
+// RadiiVdW is the name of the table of the van der Waals radii.
+const RadiiVdW = "vdw"
+
+// VdWRadii contains the van der Waals radii (in Å) of common elements from A.
+// Bondi, J. Phys. Chem. 68, 441 (1964).
+var VdWRadii = map[string]float64{
+	"H": 1.20, "He": 1.40,
+	"Li": 1.82, "C": 1.70, "N": 1.55, "O": 1.52, "F": 1.47, "Ne": 1.54,
+	"Na": 2.27, "Mg": 1.73, "Si": 2.10, "P": 1.80, "S": 1.80, "Cl": 1.75, "Ar": 1.88,
+	"K": 2.75, "Ni": 1.63, "Cu": 1.40, "Zn": 1.39, "Ga": 1.87, "As": 1.85, "Se": 1.90,
+	"Br": 1.85, "Kr": 2.02,
+	"Pd": 1.63, "Ag": 1.72, "Cd": 1.58, "In": 1.93, "Sn": 2.17, "Te": 2.06, "I": 1.98,
+	"Xe": 2.16,
+	"Pt": 1.72, "Au": 1.66, "Hg": 1.55, "Tl": 1.96, "Pb": 2.02, "U": 1.86,
+}
+
+// Radius returns the radius of an element from a table of radii. The only
+// table available is RadiiVdW.
+func Radius(table, element string) (float64, error) {
+	var radii map[string]float64
+	switch table {
+	case RadiiVdW:
+		radii = VdWRadii
+	default:
+		return 0, fmt.Errorf("table of radii `%s` doesn't exist", table)
+	}
+
+	radius, ok := radii[element]
+	if !ok {
+		return 0, fmt.Errorf("no radius for element `%s` in table `%s`", element, table)
+	}
+
+	return radius, nil
+}
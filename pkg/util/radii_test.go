@@ -0,0 +1,32 @@
+package util
+
+import "testing"
+
+func TestRadius(t *testing.T) {
+	tests := []struct {
+		table, element string
+		want           float64
+		ok             bool
+	}{
+		{RadiiVdW, "H", 1.20, true},
+		{RadiiVdW, "C", 1.70, true},
+		{RadiiVdW, "N", 1.55, true},
+		{RadiiVdW, "O", 1.52, true},
+		{RadiiVdW, "Cl", 1.75, true},
+		{RadiiVdW, "Na", 2.27, true},
+		{RadiiVdW, "cl", 0, false}, // the symbols are case sensitive
+		{RadiiVdW, "Xx", 0, false},
+		{"ionic", "O", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := Radius(tt.table, tt.element)
+		if (err == nil) != tt.ok {
+			t.Errorf("Radius(%q, %q): error %v", tt.table, tt.element, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Radius(%q, %q) = %g, want %g", tt.table, tt.element, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// Sampler selects a subset of the atoms of each type. If Stride is greater than
+// 1, every Stride-th atom of each type is kept. If Fraction is between 0 and 1,
+// each atom is kept with a probability equal to Fraction. The random selection
+// is made once (with Seed) so the same atoms are kept for every configuration.
+// It is not safe for concurrent use.
+type Sampler struct {
+	Stride   int
+	Fraction float64
+	Seed     int64
+
+	rnd  *rand.Rand
+	keep map[string][]bool
+}
+
+// NewSampler returns an instance of the Sampler structure. A stride of 0 or 1
+// and a fraction of 0 or 1 keep every atom.
+func NewSampler(stride int, fraction float64, seed int64) (*Sampler, error) {
+	if stride < 0 {
+		return nil, errors.New("the stride must be positive")
+	}
+
+	if fraction < 0 || fraction > 1 {
+		return nil, errors.New("the fraction must be between 0 and 1")
+	}
+
+	if stride > 1 && fraction > 0 && fraction < 1 {
+		return nil, errors.New("the stride and the fraction cannot be used together")
+	}
+
+	return &Sampler{
+		Stride:   stride,
+		Fraction: fraction,
+		Seed:     seed,
+		rnd:      rand.New(rand.NewSource(seed)),
+		keep:     make(map[string][]bool),
+	}, nil
+}
+
+// Keep returns true if the n-th atom (starting at 0) of type typ must be kept.
+func (s *Sampler) Keep(typ string, n int) bool {
+	if s.Stride > 1 {
+		return n%s.Stride == 0
+	}
+
+	if s.Fraction <= 0 || s.Fraction >= 1 {
+		return true
+	}
+
+	keep := s.keep[typ]
+	for len(keep) <= n {
+		keep = append(keep, s.rnd.Float64() < s.Fraction)
+	}
+	s.keep[typ] = keep
+
+	return keep[n]
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSamplerStride(t *testing.T) {
+	tests := []struct {
+		stride int
+		kept   []int // atoms kept among the first 10
+	}{
+		{0, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{1, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{3, []int{0, 3, 6, 9}},
+		{20, []int{0}},
+	}
+
+	for _, tt := range tests {
+		s, err := NewSampler(tt.stride, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var kept []int
+		for n := 0; n < 10; n++ {
+			if s.Keep("1", n) {
+				kept = append(kept, n)
+			}
+		}
+		if len(kept) != len(tt.kept) {
+			t.Errorf("stride %d: kept %v, want %v", tt.stride, kept, tt.kept)
+			continue
+		}
+		for i := range kept {
+			if kept[i] != tt.kept[i] {
+				t.Errorf("stride %d: kept %v, want %v", tt.stride, kept, tt.kept)
+				break
+			}
+		}
+	}
+}
+
+func TestSamplerFraction(t *testing.T) {
+	const n = 20000
+	for _, fraction := range []float64{0.1, 0.5, 0.9} {
+		s, err := NewSampler(0, fraction, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var kept int
+		first := make([]bool, n)
+		for i := 0; i < n; i++ {
+			first[i] = s.Keep("1", i)
+			if first[i] {
+				kept++
+			}
+		}
+		if got := float64(kept) / n; math.Abs(got-fraction) > 0.02 {
+			t.Errorf("fraction %g: %g of the atoms kept", fraction, got)
+		}
+
+		// The same atoms are kept in every configuration, whatever the order.
+		for i := n - 1; i >= 0; i-- {
+			if s.Keep("1", i) != first[i] {
+				t.Fatalf("fraction %g: atom %d not kept the second time", fraction, i)
+			}
+		}
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		stride   int
+		fraction float64
+		ok       bool
+	}{
+		{0, 0, true},
+		{2, 0, true},
+		{2, 1, true},
+		{0, 0.5, true},
+		{-1, 0, false},
+		{0, 1.5, false},
+		{0, -0.1, false},
+		{2, 0.5, false},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewSampler(tt.stride, tt.fraction, 0); (err == nil) != tt.ok {
+			t.Errorf("stride %d, fraction %g: error %v", tt.stride, tt.fraction, err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Selection is a predicate over the columns of the atoms of a trajectory, e.g.
+// "type == 2 && z > 30". The operands are column names (as written in the
+// ITEM: ATOMS line) and numbers. They are compared with ==, !=, <, <=, >, and
+// >=. The comparisons are combined with && and ||, negated with !, and
+// grouped with parentheses. && takes precedence over ||. The values of the
+// columns are compared as numbers.
+//
+// A Selection is created by NewSelection, then bound to the columns of a
+// trajectory with Columns before calling Match. A nil Selection matches every
+// atom.
+type Selection struct {
+	root  expr
+	names []string // referenced columns
+	cols  []int
+	vals  []float64
+}
+
+// NewSelection parses an expression and returns the corresponding Selection.
+func NewSelection(s string) (*Selection, error) {
+	tokens, err := tokenizeSelection(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var sel Selection
+	p := selectionParser{tokens: tokens, sel: &sel}
+	sel.root, err = p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected `%s`", p.tokens[p.pos])
+	}
+
+	sel.vals = make([]float64, len(sel.names))
+	return &sel, nil
+}
+
+// Columns binds the Selection to the columns of a trajectory (the fields of the
+// ITEM: ATOMS line after ITEM: and ATOMS). It returns an error if a referenced
+// column doesn't exist.
+func (s *Selection) Columns(fields []string) error {
+	if s == nil {
+		return nil
+	}
+
+	s.cols = make([]int, len(s.names))
+	for i, name := range s.names {
+		s.cols[i] = -1
+		for k, v := range fields {
+			if v == name {
+				s.cols[i] = k
+				break
+			}
+		}
+
+		if s.cols[i] < 0 {
+			return fmt.Errorf("cannot find the column %s (selection)", name)
+		}
+	}
+
+	return nil
+}
+
+// Match returns true if the atom whose columns are fields satisfies the
+// expression. It is not safe for concurrent use.
+func (s *Selection) Match(fields []string) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+
+	for i, col := range s.cols {
+		var err error
+		s.vals[i], err = strconv.ParseFloat(fields[col], 64)
+		if err != nil {
+			return false, fmt.Errorf("selection: %w", err)
+		}
+	}
+
+	return s.root.eval(s.vals), nil
+}
+
+// expr is a node of the expression.
+type expr interface {
+	eval(vals []float64) bool
+}
+
+type (
+	exprOr  [2]expr
+	exprAnd [2]expr
+	exprNot struct{ e expr }
+	exprCmp struct {
+		op   string
+		l, r exprOperand
+	}
+)
+
+func (e exprOr) eval(vals []float64) bool  { return e[0].eval(vals) || e[1].eval(vals) }
+func (e exprAnd) eval(vals []float64) bool { return e[0].eval(vals) && e[1].eval(vals) }
+func (e exprNot) eval(vals []float64) bool { return !e.e.eval(vals) }
+
+func (e exprCmp) eval(vals []float64) bool {
+	l, r := e.l.value(vals), e.r.value(vals)
+	switch e.op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+// exprOperand is a number (col < 0) or the value of a referenced column.
+type exprOperand struct {
+	col int
+	num float64
+}
+
+func (o exprOperand) value(vals []float64) float64 {
+	if o.col < 0 {
+		return o.num
+	}
+	return vals[o.col]
+}
+
+// selectionParser is a recursive descent parser of the expression.
+type selectionParser struct {
+	tokens []string
+	pos    int
+	sel    *Selection
+}
+
+func (p *selectionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *selectionParser) or() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = exprOr{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *selectionParser) and() (expr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = exprAnd{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *selectionParser) unary() (expr, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{e}, nil
+	case "(":
+		p.pos++
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() != ")" {
+			return nil, errors.New("missing `)`")
+		}
+		p.pos++
+		return e, nil
+	}
+
+	l, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("expected a comparison after `%s`", p.tokens[p.pos-1])
+	}
+	p.pos++
+
+	r, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	return exprCmp{op: op, l: l, r: r}, nil
+}
+
+func (p *selectionParser) operand() (exprOperand, error) {
+	tok := p.peek()
+	if tok == "" || strings.ContainsAny(tok[:1], "()&|=!<>") {
+		return exprOperand{}, fmt.Errorf("expected a column or a number instead of `%s`", tok)
+	}
+	p.pos++
+
+	if num, err := strconv.ParseFloat(tok, 64); err == nil {
+		return exprOperand{col: -1, num: num}, nil
+	}
+
+	for i, v := range p.sel.names {
+		if v == tok {
+			return exprOperand{col: i}, nil
+		}
+	}
+	p.sel.names = append(p.sel.names, tok)
+	return exprOperand{col: len(p.sel.names) - 1}, nil
+}
+
+// tokenizeSelection splits an expression into operators, parentheses, and
+// operands.
+func tokenizeSelection(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"),
+			strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="):
+			tokens = append(tokens, s[i:i+2])
+			i += 2
+		case c == '<' || c == '>' || c == '!':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c == '&' || c == '|' || c == '=':
+			return nil, fmt.Errorf("unknown operator at `%s`", s[i:])
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t()&|=!<>", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,116 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	columns := strings.Fields("id type x y z")
+	atoms := []string{
+		"1 1 0 0 10",
+		"2 2 0 0 25",
+		"3 2 0 0 35",
+		"4 3 5.5 0 40",
+		"5 2 -1e1 0 30",
+	}
+
+	tests := []struct {
+		expr string
+		want []int // ids of the atoms selected
+	}{
+		{"type == 2", []int{2, 3, 5}},
+		{"type == 2 && z > 30", []int{3}},
+		{"type == 2 && z >= 30", []int{3, 5}},
+		{"type != 2", []int{1, 4}},
+		{"z < 25 || x > 5", []int{1, 4}},
+		{"z <= 25 || x>5", []int{1, 2, 4}},
+		{"type == 1 || type == 2 && z > 30", []int{1, 3}}, // && before ||
+		{"(type == 1 || type == 2) && z > 30", []int{3}},
+		{"!(type == 2)", []int{1, 4}},
+		{"!type == 2 && id > 1", []int{4}},
+		{"x == -10", []int{5}},
+		{"z > x", []int{1, 2, 3, 4, 5}},
+		{"1 < 2", []int{1, 2, 3, 4, 5}},
+		{"id > 5", nil},
+	}
+
+	for _, tt := range tests {
+		s, err := NewSelection(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if err := s.Columns(columns); err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+
+		var got []int
+		for i, a := range atoms {
+			ok, err := s.Match(strings.Fields(a))
+			if err != nil {
+				t.Fatalf("%s: %v", tt.expr, err)
+			}
+			if ok {
+				got = append(got, i+1)
+			}
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.expr, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSelectionErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"type",
+		"type = 2",
+		"type == 2 &",
+		"type == 2 &&",
+		"(type == 2",
+		"type == 2)",
+		"type == == 2",
+		"type 2",
+	}
+
+	for _, expr := range tests {
+		if _, err := NewSelection(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestSelectionColumns(t *testing.T) {
+	s, err := NewSelection("type == 2 && q > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Columns(strings.Fields("id type x y z")); err == nil {
+		t.Error("no error for the missing column q")
+	}
+	if err := s.Columns(strings.Fields("id type q")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Match(strings.Fields("1 2 abc")); err == nil {
+		t.Error("no error for a value that isn't a number")
+	}
+
+	// A nil Selection matches every atom.
+	var none *Selection
+	if err := none.Columns(nil); err != nil {
+		t.Error(err)
+	}
+	if ok, err := none.Match(nil); !ok || err != nil {
+		t.Errorf("nil Selection: got %v, %v, want true, nil", ok, err)
+	}
+}
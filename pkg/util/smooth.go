@@ -0,0 +1,161 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SmoothSavGol is the type of the Savitzky-Golay filter.
+const SmoothSavGol = "savgol"
+
+// Smooth contains the parameters of a filter that can be applied on a time
+// series. It can be parsed from a TOML configuration file. If Type is empty,
+// no filter is applied. Window is the number of points of the filter and must
+// be odd. Order is the order of the polynomial and must be lower than Window.
+type Smooth struct {
+	Type   string `toml:"type"`
+	Window int    `toml:"window"`
+	Order  int    `toml:"order"`
+}
+
+// Enabled returns true if a filter must be applied.
+func (s Smooth) Enabled() bool {
+	return s.Type != ""
+}
+
+// Check checks the parameters of the filter.
+func (s Smooth) Check() error {
+	switch s.Type {
+	case "":
+		return nil
+	case SmoothSavGol:
+	default:
+		return fmt.Errorf("smooth type `%s` doesn't exist", s.Type)
+	}
+
+	if s.Window <= 0 || s.Window%2 == 0 {
+		return fmt.Errorf("window must be odd and strictly positive (got %d)", s.Window)
+	}
+
+	if s.Order < 0 || s.Order >= s.Window {
+		return fmt.Errorf("order must be positive and lower than window (got %d)", s.Order)
+	}
+
+	return nil
+}
+
+// Apply applies the filter on y and returns the smoothed series. For the
+// Savitzky-Golay filter, a polynomial is fitted on each window. The first and
+// last points use the polynomial fitted on the first and last windows.
+// Therefore, a polynomial of degree lower or equal than Order is reproduced
+// exactly.
+func (s Smooth) Apply(y []float64) ([]float64, error) {
+	if len(y) < s.Window {
+		return nil, fmt.Errorf("not enough points (%d) for the window (%d)", len(y), s.Window)
+	}
+
+	half := s.Window / 2
+	res := make([]float64, len(y))
+
+	coeffs := make([][]float64, s.Window)
+	for pos := 0; pos < s.Window; pos++ {
+		c, err := savGolCoeffs(s.Window, s.Order, pos)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[pos] = c
+	}
+
+	for i := range y {
+		start, pos := i-half, half
+		if start < 0 {
+			start, pos = 0, i
+		} else if start+s.Window > len(y) {
+			start = len(y) - s.Window
+			pos = i - start
+		}
+
+		for j, c := range coeffs[pos] {
+			res[i] += c * y[start+j]
+		}
+	}
+
+	return res, nil
+}
+
+// savGolCoeffs returns the coefficients that evaluate, at the position pos of
+// the window, the polynomial of degree order fitted by least squares on the
+// window.
+func savGolCoeffs(window, order, pos int) ([]float64, error) {
+	cols := order + 1
+
+	// A is the Vandermonde matrix of the window centered on pos. The value of
+	// the fitted polynomial at pos is its first coefficient, i.e.
+	// e₀ᵀ(AᵀA)⁻¹Aᵀy. The coefficients are therefore A(AᵀA)⁻¹e₀.
+	ata := make([][]float64, cols)
+	for m := range ata {
+		ata[m] = make([]float64, cols)
+		for n := range ata[m] {
+			for j := 0; j < window; j++ {
+				ata[m][n] += math.Pow(float64(j-pos), float64(m+n))
+			}
+		}
+	}
+
+	rhs := make([]float64, cols)
+	rhs[0] = 1.
+
+	x, err := solve(ata, rhs)
+	if err != nil {
+		return nil, err
+	}
+
+	coeffs := make([]float64, window)
+	for j := 0; j < window; j++ {
+		for m := 0; m < cols; m++ {
+			coeffs[j] += x[m] * math.Pow(float64(j-pos), float64(m))
+		}
+	}
+
+	return coeffs, nil
+}
+
+// solve solves the linear system a x = b with the Gaussian elimination and
+// partial pivoting. a and b are modified.
+func solve(a [][]float64, b []float64) ([]float64, error) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+
+		if a[pivot][col] == 0 {
+			return nil, errors.New("singular matrix")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		x[row] = b[row]
+		for k := row + 1; k < n; k++ {
+			x[row] -= a[row][k] * x[k]
+		}
+		x[row] /= a[row][row]
+	}
+
+	return x, nil
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+// poly returns the values of the polynomial of coefficients c (constant
+// first) at x = 0.1·i for i from 0 to n-1.
+func poly(c []float64, n int) []float64 {
+	y := make([]float64, n)
+	for i := range y {
+		x := 0.1 * float64(i)
+		for k := len(c) - 1; k >= 0; k-- {
+			y[i] = y[i]*x + c[k]
+		}
+	}
+	return y
+}
+
+func TestSmoothPolynomial(t *testing.T) {
+	tests := []struct {
+		window, order int
+		c             []float64
+	}{
+		{5, 2, []float64{1, -2, 3}},
+		{5, 2, []float64{4, 0.5}},
+		{7, 3, []float64{-1, 2, -0.5, 0.25}},
+		{11, 4, []float64{0.3, 1, 1, -2, 0.7}},
+		{9, 0, []float64{2.5}},
+		{3, 2, []float64{1, 1, 1}},
+		{21, 5, []float64{1, -1, 1, -1, 1, -1}},
+	}
+
+	for _, tt := range tests {
+		y := poly(tt.c, 40)
+		got, err := Smooth{Type: SmoothSavGol, Window: tt.window, Order: tt.order}.Apply(y)
+		if err != nil {
+			t.Errorf("window %d, order %d: %v", tt.window, tt.order, err)
+			continue
+		}
+
+		for i := range y {
+			if math.Abs(got[i]-y[i]) > 1e-8*math.Max(1, math.Abs(y[i])) {
+				t.Errorf("window %d, order %d, polynomial %v: point %d smoothed to %g, want %g",
+					tt.window, tt.order, tt.c, i, got[i], y[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSavGolCoeffs(t *testing.T) {
+	// Tabulated coefficients of the central point (Savitzky and Golay, Anal.
+	// Chem. 36, 1627 (1964)).
+	tests := []struct {
+		window, order int
+		want          []float64
+		norm          float64
+	}{
+		{5, 2, []float64{-3, 12, 17, 12, -3}, 35},
+		{7, 2, []float64{-2, 3, 6, 7, 6, 3, -2}, 21},
+		{7, 3, []float64{-2, 3, 6, 7, 6, 3, -2}, 21},
+		{9, 4, []float64{15, -55, 30, 135, 179, 135, 30, -55, 15}, 429},
+		{5, 0, []float64{1, 1, 1, 1, 1}, 5},
+	}
+
+	for _, tt := range tests {
+		got, err := savGolCoeffs(tt.window, tt.order, tt.window/2)
+		if err != nil {
+			t.Errorf("window %d, order %d: %v", tt.window, tt.order, err)
+			continue
+		}
+
+		for j := range tt.want {
+			if want := tt.want[j] / tt.norm; math.Abs(got[j]-want) > 1e-12 {
+				t.Errorf("window %d, order %d: coefficients %v, want %v/%g", tt.window, tt.order, got, tt.want, tt.norm)
+				break
+			}
+		}
+	}
+}
+
+func TestSmoothCheck(t *testing.T) {
+	tests := []struct {
+		s  Smooth
+		ok bool
+	}{
+		{Smooth{}, true},
+		{Smooth{Type: SmoothSavGol, Window: 5, Order: 2}, true},
+		{Smooth{Type: SmoothSavGol, Window: 1, Order: 0}, true},
+		{Smooth{Type: SmoothSavGol, Window: 4, Order: 2}, false},
+		{Smooth{Type: SmoothSavGol, Window: 0, Order: 0}, false},
+		{Smooth{Type: SmoothSavGol, Window: 5, Order: 5}, false},
+		{Smooth{Type: SmoothSavGol, Window: 5, Order: -1}, false},
+		{Smooth{Type: "mean", Window: 5, Order: 2}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.s.Check(); (err == nil) != tt.ok {
+			t.Errorf("%+v: Check returned %v", tt.s, err)
+		}
+	}
+}
+
+func TestSmoothShort(t *testing.T) {
+	_, err := Smooth{Type: SmoothSavGol, Window: 7, Order: 2}.Apply(make([]float64, 6))
+	if err == nil {
+		t.Error("no error with less points than the window")
+	}
+}
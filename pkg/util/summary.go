@@ -0,0 +1,67 @@
+package util
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Summary describes the first configuration read by a calculation: the number
+// of atoms, the columns, the size of the box, and the number of atoms of each
+// type. Logged at the start of a calculation, it surfaces the mismatches
+// between the configuration file and the trajectory (wrong column names,
+// unexpected box, missing atom types). Its methods can be called on a nil
+// Summary, in which case nothing is recorded.
+type Summary struct {
+	atoms   int
+	columns []string
+	box     [3]float64
+	types   map[string]int
+}
+
+// NewSummary returns a Summary without any atom type. columns are the columns
+// of the atoms (ITEM: ATOMS excluded).
+func NewSummary(atoms int, columns []string, box [3]float64) *Summary {
+	return &Summary{
+		atoms:   atoms,
+		columns: columns,
+		box:     box,
+		types:   make(map[string]int),
+	}
+}
+
+// Add counts an atom of type typ.
+func (s *Summary) Add(typ string) {
+	if s == nil {
+		return
+	}
+
+	s.types[typ]++
+}
+
+// String returns the summary in one line. The atom types are sorted.
+func (s *Summary) String() string {
+	types := make([]string, 0, len(s.types))
+	for typ := range s.types {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for i, typ := range types {
+		types[i] = fmt.Sprintf("%s (%d)", typ, s.types[typ])
+	}
+
+	return fmt.Sprintf("%d atoms, columns %s, box %g x %g x %g, types %s", s.atoms,
+		strings.Join(s.columns, " "), s.box[0], s.box[1], s.box[2], strings.Join(types, " "))
+}
+
+// Log writes the summary into log, preceded by the type of calculation calc.
+// Nothing is written if log is nil.
+func (s *Summary) Log(log *log.Logger, calc string) {
+	if s == nil || log == nil {
+		return
+	}
+
+	log.Printf("%s: first configuration: %s", calc, s)
+}
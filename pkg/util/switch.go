@@ -0,0 +1,21 @@
+package util
+
+import "math"
+
+// Switch returns the value of a smooth switching function at the distance r.
+// It is equal to 1 below cutoff-width and to 0 above cutoff. In between, it
+// decreases as (1 + cos(πx)) / 2 with x = (r - cutoff + width) / width, so the
+// function and its first derivative are continuous. If width is 0, it is a
+// step function equal to 1 up to cutoff (included).
+func Switch(r, cutoff, width float64) float64 {
+	if r > cutoff {
+		return 0
+	}
+
+	start := cutoff - width
+	if r <= start {
+		return 1
+	}
+
+	return (1 + math.Cos(math.Pi*(r-start)/width)) / 2
+}
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	tests := []struct {
+		r, cutoff, width float64
+		want             float64
+	}{
+		{0, 3, 1, 1},
+		{2, 3, 1, 1},
+		{2.5, 3, 1, 0.5},
+		{2.25, 3, 1, (1 + math.Sqrt2/2) / 2},
+		{3, 3, 1, 0},
+		{3.5, 3, 1, 0},
+		{1.5, 3, 3, 0.5}, // the switching starts at 0
+		{3, 3, 0, 1},     // step function
+		{3.0001, 3, 0, 0},
+		{2.9999, 3, 0, 1},
+	}
+
+	for _, tt := range tests {
+		if got := Switch(tt.r, tt.cutoff, tt.width); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Switch(%g, %g, %g) = %g, want %g", tt.r, tt.cutoff, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestSwitchSmooth(t *testing.T) {
+	// The function decreases without jump from 1 to 0, and its slope vanishes
+	// at both ends of the switching region.
+	const (
+		cutoff = 3.
+		width  = 0.8
+		dr     = 1e-4
+	)
+
+	prev := 1.
+	for r := 0.; r <= cutoff+0.5; r += dr {
+		s := Switch(r, cutoff, width)
+		if s > prev || prev-s > math.Pi/2*dr/width+1e-12 {
+			t.Fatalf("Switch(%g) = %g after %g", r, s, prev)
+		}
+		prev = s
+	}
+
+	for _, r := range []float64{cutoff - width, cutoff} {
+		slope := (Switch(r+dr, cutoff, width) - Switch(r-dr, cutoff, width)) / (2 * dr)
+		if math.Abs(slope) > 1e-3 {
+			t.Errorf("slope %g at %g", slope, r)
+		}
+	}
+}
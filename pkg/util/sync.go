@@ -0,0 +1,44 @@
+package util
+
+import "sync"
+
+// Syncer forces the results written into an output file to be stored on disk
+// every n configurations (see Output.Sync), so that a crash of the machine
+// leaves a valid partial file. The files returned by Write are not buffered:
+// their content already survives the termination of the process. The standard
+// output is buffered and is flushed instead. Its methods can be called on a nil
+// Syncer, in which case nothing is done.
+type Syncer struct {
+	f     *Output
+	every int
+	n     int
+	mux   sync.Mutex
+}
+
+// NewSyncer returns a Syncer of the file f. It returns nil if every is not
+// strictly positive.
+func NewSyncer(f *Output, every int) *Syncer {
+	if every <= 0 {
+		return nil
+	}
+
+	return &Syncer{f: f, every: every}
+}
+
+// Frame records that the results of a configuration have been written. The
+// file is synced every n calls. It is safe for concurrent use.
+func (s *Syncer) Frame() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.n++
+	if s.n < s.every {
+		return nil
+	}
+	s.n = 0
+	return s.f.Sync()
+}
@@ -0,0 +1,58 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSyncer(t *testing.T) {
+	tests := []struct {
+		every  int
+		frames int
+	}{
+		{1, 5},
+		{2, 5},
+		{3, 10},
+		{10, 4},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		out := NewOutput(&buf)
+		syncer := NewSyncer(out, tt.every)
+
+		var want strings.Builder
+		for i := 1; i <= tt.frames; i++ {
+			row := fmt.Sprintf("%d %g\n", i, float64(i)/3)
+			out.WriteString(row)
+			if err := syncer.Frame(); err != nil {
+				t.Fatal(err)
+			}
+
+			// The buffered output contains the rows up to the last sync.
+			if i%tt.every == 0 {
+				want.Reset()
+				for j := 1; j <= i; j++ {
+					fmt.Fprintf(&want, "%d %g\n", j, float64(j)/3)
+				}
+			}
+			if buf.String() != want.String() {
+				t.Errorf("every %d, frame %d: got %q, want %q", tt.every, i, buf.String(), want.String())
+			}
+		}
+	}
+}
+
+func TestSyncerDisabled(t *testing.T) {
+	for _, every := range []int{0, -1} {
+		syncer := NewSyncer(NewOutput(&bytes.Buffer{}), every)
+		if syncer != nil {
+			t.Errorf("every %d: got a Syncer", every)
+		}
+		if err := syncer.Frame(); err != nil {
+			t.Errorf("every %d: %v", every, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"io"
+	"time"
+)
+
+// throttleChunk is the number of chunks read per second by a Throttle. Smaller
+// chunks give a smoother rate.
+const throttleChunk = 10
+
+// Throttle is an io.Reader that limits the rate at which another io.Reader is
+// read. It sleeps as long as the number of bytes read exceeds the number of
+// bytes allowed since the first read. It can be used to spare a shared
+// filesystem at the cost of speed.
+type Throttle struct {
+	r     io.Reader
+	rate  int64
+	n     int64
+	start time.Time
+}
+
+// NewThrottle returns a reader reading r at rate bytes per second at most. If
+// rate is lower or equal to 0, r is returned as is.
+func NewThrottle(r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
+	}
+	return &Throttle{r: r, rate: rate}
+}
+
+// Read reads up to len(p) bytes into p and waits if the rate is exceeded.
+func (t *Throttle) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+
+	if max := t.rate / throttleChunk; max > 0 && int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+
+	allowed := time.Duration(float64(t.n) / float64(t.rate) * float64(time.Second))
+	if wait := allowed - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	return n, err
+}
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestThrottleRate(t *testing.T) {
+	tests := []struct {
+		size int
+		rate int64
+	}{
+		{30000, 100000},
+		{5000, 20000},
+		{100000, 1000000},
+	}
+
+	for _, tt := range tests {
+		data := bytes.Repeat([]byte("0123456789"), tt.size/10)
+
+		start := time.Now()
+		got, err := ioutil.ReadAll(NewThrottle(bytes.NewReader(data), tt.rate))
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Errorf("rate %d: the data read differs from the data", tt.rate)
+		}
+
+		// The rate is an upper bound: the reading can't be faster, and it
+		// shouldn't be much slower.
+		want := time.Duration(float64(tt.size) / float64(tt.rate) * float64(time.Second))
+		if elapsed < want*9/10 || elapsed > want*2 {
+			t.Errorf("%d bytes at %d bytes/s read in %s, want about %s", tt.size, tt.rate, elapsed, want)
+		}
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	r := bytes.NewReader([]byte("abc"))
+	for _, rate := range []int64{0, -1} {
+		if NewThrottle(r, rate) != r {
+			t.Errorf("rate %d: the reader is wrapped", rate)
+		}
+	}
+}
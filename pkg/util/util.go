@@ -3,71 +3,291 @@ package util
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pelletier/go-toml"
 )
 
+// Stdout is the path of the output files that are written on the standard
+// output instead of a file, e.g. to pipe the results of a calculation into
+// another program.
+const Stdout = "-"
+
+// Output is an output file returned by Write and WriteCommented. If its path is
+// Stdout, the results are buffered and written on the standard output, which
+// is not closed by Close. Only one calculation should then write on it. An
+// output file in the JSON format is kept in memory until it is closed (see
+// WriteFormat).
+type Output struct {
+	f    *os.File
+	w    *bufio.Writer // nil if f is a regular file
+	json *jsonOutput   // nil if the format is FormatText
+}
+
+// NewOutput returns an output writing into w instead of a file, e.g. a buffer
+// or a network connection. Like the standard output, the results are buffered
+// and w is not closed by Close.
+func NewOutput(w io.Writer) *Output {
+	return &Output{w: bufio.NewWriter(w)}
+}
+
+// create creates the output file path (see Output).
+func create(path string) (*Output, error) {
+	if path == Stdout {
+		return &Output{f: os.Stdout, w: bufio.NewWriter(os.Stdout)}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{f: f}, nil
+}
+
+// Write writes b into the output file.
+func (o *Output) Write(b []byte) (int, error) {
+	if o.json != nil {
+		return o.json.buf.Write(b)
+	}
+	if o.w != nil {
+		return o.w.Write(b)
+	}
+	return o.f.Write(b)
+}
+
+// WriteString writes s into the output file.
+func (o *Output) WriteString(s string) (int, error) {
+	if o.json != nil {
+		return o.json.buf.WriteString(s)
+	}
+	if o.w != nil {
+		return o.w.WriteString(s)
+	}
+	return o.f.WriteString(s)
+}
+
+// Sync stores the content of the output file on disk (see os.File.Sync). The
+// standard output is flushed instead. Nothing is done in the JSON format.
+func (o *Output) Sync() error {
+	if o.json != nil {
+		return nil
+	}
+	if o.w != nil {
+		return o.w.Flush()
+	}
+	return o.f.Sync()
+}
+
+// Close closes the output file. The standard output is flushed instead. In the
+// JSON format, the JSON object is written first.
+func (o *Output) Close() error {
+	if o.json != nil {
+		b, err := o.json.encode()
+		o.json = nil
+		if err != nil {
+			o.close()
+			return err
+		}
+
+		if o.w != nil {
+			o.w.Write(b)
+		} else if _, err = o.f.Write(b); err != nil {
+			o.f.Close()
+			return err
+		}
+	}
+	return o.close()
+}
+
+// close closes the output file or flushes the standard output.
+func (o *Output) close() error {
+	if o.w != nil {
+		return o.w.Flush()
+	}
+	return o.f.Close()
+}
+
 // Write writes the output file according to a specific scheme. It writes the
 // date, parses the structure in a TOML format and writes it. This method
 // returns the file for further writing. It must be closed at the end of the
-// calculation.
-func Write(path string, structure interface{}) (*os.File, error) {
-	f, err := os.Create(path)
+// calculation. If path is Stdout, the results are written on the standard
+// output (see Output).
+func Write(path string, structure interface{}) (*Output, error) {
+	f, err := create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.header(structure)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteTo is like Write but the output file is written into w (see
+// NewOutput).
+func WriteTo(w io.Writer, structure interface{}) (*Output, error) {
+	f := NewOutput(w)
+	return f, f.header(structure)
+}
+
+// header writes the date and the structure in the TOML format.
+func (o *Output) header(structure interface{}) error {
+	fmt.Fprintf(o, "Date: %v\n", time.Now().Format("2006-01-02 15:04:05 -0700 MST"))
+
+	enc := toml.NewEncoder(o)
+	err := enc.Encode(structure)
+	if err != nil {
+		return err
+	}
+
+	o.Write([]byte{'\n'})
+	return nil
+}
+
+// WriteCommented is like Write but the date and the parameters are written as
+// comments (lines starting with #) so that the output file can be read by
+// plotting tools like gnuplot.
+func WriteCommented(path string, structure interface{}) (*Output, error) {
+	b, err := commentedHeader(structure)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := create(path)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Fprintf(f, "Date: %v\n", time.Now().Format("2006-01-02 15:04:05 -0700 MST"))
+	f.Write(b)
+	return f, nil
+}
 
-	enc := toml.NewEncoder(f)
-	err = enc.Encode(structure)
+// WriteCommentedTo is like WriteCommented but the output file is written into
+// w (see NewOutput).
+func WriteCommentedTo(w io.Writer, structure interface{}) (*Output, error) {
+	b, err := commentedHeader(structure)
 	if err != nil {
 		return nil, err
 	}
 
-	f.Write([]byte{'\n'})
+	f := NewOutput(w)
+	f.Write(b)
 	return f, nil
 }
 
-// ReadCfgNonCvg reads x non converged configurations. These non configurations
-// will be automatically "discarded" and won't be taken into account. It is a
-// very fast method.
-func ReadCfgNonCvg(r *bufio.Reader, x int) error {
-	if x == 0 {
-		return nil
+// commentedHeader returns the date and the structure in the TOML format, as
+// comments.
+func commentedHeader(structure interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Date: %v\n", time.Now().Format("2006-01-02 15:04:05 -0700 MST"))
+
+	enc := toml.NewEncoder(&buf)
+	err := enc.Encode(structure)
+	if err != nil {
+		return nil, err
 	}
 
-	for i := 0; i < 3; i++ {
-		r.ReadSlice('\n')
+	var out bytes.Buffer
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fmt.Fprintf(&out, "# %s\n", line)
 	}
 
-	b, _ := r.ReadSlice('\n')
-	atoms, err := strconv.Atoi(string(b)[:len(b)-1])
-	if err != nil {
-		return err
+	return out.Bytes(), nil
+}
+
+// FileOut returns the path of an output file. If fileOut is empty, the file is
+// named after the input file and the type of calculation (e.g. run1.lammpstrj
+// and gr give run1_gr.dat, like run1.lammpstrj.gz) and is placed in dir.
+// Otherwise, fileOut is returned as is.
+func FileOut(fileOut, dir, fileIn, typ, ext string) string {
+	if fileOut != "" {
+		return fileOut
 	}
 
-	for i := 0; i < (5 + atoms); i++ {
-		r.ReadSlice('\n')
+	base := filepath.Base(fileIn)
+	if Compressed(base) {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
 	}
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return filepath.Join(dir, base+"_"+typ+ext)
+}
+
+// ReadCfgNonCvg reads x non converged configurations. These non configurations
+// will be automatically "discarded" and won't be taken into account. It is a
+// very fast method. The number of atoms of each configuration is read, so that
+// it can change from one configuration to another (e.g. GCMC).
+func ReadCfgNonCvg(r *bufio.Reader, x int) error {
+	for c := 0; c < x; c++ {
+		for i := 0; i < 3; i++ {
+			r.ReadSlice('\n')
+		}
+
+		b, _ := r.ReadSlice('\n')
+		atoms, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil {
+			return fmt.Errorf("number of atoms (configuration %d): %w", c, err)
+		}
 
-	// Other cfg until x
-	for i := 0; i < ((x - 1) * (3 + 6 + atoms)); i++ {
-		r.ReadSlice('\n')
+		for i := 0; i < (5 + atoms); i++ {
+			r.ReadSlice('\n')
+		}
 	}
 
 	return nil
 }
 
-// Pow returns x**y, the base-x exponential of y.
+// Line returns the line without the end of line characters. Both \n and \r\n
+// (Windows) are handled.
+func Line(b []byte) string {
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+// Pow returns x**n, the base-x exponential of n. It returns 1 if n is 0 and
+// 1/x**-n if n is negative.
 func Pow(x float64, n int) float64 {
-	res := x
-	for i := 0; i < (n - 1); i++ {
+	if n < 0 {
+		return 1. / Pow(x, -n)
+	}
+
+	res := 1.
+	for i := 0; i < n; i++ {
 		res *= x
 	}
 	return res
 }
+
+// Center returns the center of the coordinates weighted by weights. If weights
+// is nil, it returns the center of geometry.
+func Center(xyz [][3]float64, weights []float64) (center [3]float64) {
+	var tot float64
+	for key, v := range xyz {
+		weight := 1.
+		if weights != nil {
+			weight = weights[key]
+		}
+		tot += weight
+
+		for k := 0; k < 3; k++ {
+			center[k] += v[k] * weight
+		}
+	}
+
+	for k := 0; k < 3; k++ {
+		center[k] /= tot
+	}
+
+	return
+}
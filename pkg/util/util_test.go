@@ -0,0 +1,118 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPow(t *testing.T) {
+	tests := []struct {
+		x    float64
+		n    int
+		want float64
+	}{
+		{2., 0, 1.},
+		{0., 0, 1.},
+		{2., 1, 2.},
+		{-3., 1, -3.},
+		{2., 2, 4.},
+		{-3., 3, -27.},
+		{2., -1, 0.5},
+		{2., -2, 0.25},
+		{-2., -3, -0.125},
+		{0., -1, math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		if got := Pow(tt.x, tt.n); got != tt.want {
+			t.Errorf("Pow(%g, %d) = %g, want %g", tt.x, tt.n, got, tt.want)
+		}
+	}
+}
+
+// trajectory returns a LAMMPS trajectory whose configuration i has atoms[i]
+// atoms and the timestep i.
+func trajectory(atoms ...int) string {
+	var b strings.Builder
+	for i, n := range atoms {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", i, n)
+		b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z\n")
+		for j := 0; j < n; j++ {
+			fmt.Fprintf(&b, "%d 1 %d 0 0\n", j+1, j)
+		}
+	}
+	return b.String()
+}
+
+func TestReadCfgNonCvg(t *testing.T) {
+	tests := []struct {
+		atoms []int
+		skip  int
+	}{
+		{[]int{3, 3, 3}, 2},
+		{[]int{2, 5, 1, 4}, 3},
+		{[]int{4, 0, 7}, 2},
+	}
+
+	for _, tt := range tests {
+		r := bufio.NewReader(strings.NewReader(trajectory(tt.atoms...)))
+		if err := ReadCfgNonCvg(r, tt.skip); err != nil {
+			t.Errorf("%v: %v", tt.atoms, err)
+			continue
+		}
+
+		b, _ := r.ReadSlice('\n')
+		step, _ := r.ReadSlice('\n')
+		if Line(b) != "ITEM: TIMESTEP" || Line(step) != fmt.Sprint(tt.skip) {
+			t.Errorf("%v: got %q %q after %d configurations, want the timestep %d", tt.atoms, b, step, tt.skip, tt.skip)
+		}
+	}
+}
+
+func TestCenter(t *testing.T) {
+	// A water-like molecule: the oxygen is much heavier than the hydrogens.
+	xyz := [][3]float64{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+
+	tests := []struct {
+		name    string
+		weights []float64
+		want    [3]float64
+	}{
+		{"geometry", nil, [3]float64{1. / 3., 1. / 3., 0}},
+		{"uniform masses", []float64{2, 2, 2}, [3]float64{1. / 3., 1. / 3., 0}},
+		{"mass", []float64{16, 1, 1}, [3]float64{1. / 18., 1. / 18., 0}},
+		{"one weight", []float64{0, 1, 0}, [3]float64{1, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		got := Center(xyz, tt.weights)
+		for k := 0; k < 3; k++ {
+			if math.Abs(got[k]-tt.want[k]) > 1e-12 {
+				t.Errorf("%s: Center = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"12\n", "12"},
+		{"12\r\n", "12"},
+		{"12", "12"},
+		{"1 2 3.5\r\n", "1 2 3.5"},
+		{"\r\n", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Line([]byte(tt.in)); got != tt.want {
+			t.Errorf("Line(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package util
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml"
+)
+
+// VolumeStats contains the statistics of the volume of the box over some
+// configurations of a trajectory. They are written next to the trajectory (see
+// VolumeStatsPath) by a calculation so that the other calculations of a batch
+// processing the same configurations don't have to compute them again (see
+// Input.ReadVolumeStats). Size and ModTime are the size and the modification
+// time of the trajectory when the statistics were computed: the statistics are
+// ignored if the trajectory has been modified since.
+type VolumeStats struct {
+	Size    int64 `toml:"size"`
+	ModTime int64 `toml:"mod_time"` // Unix time in nanoseconds
+
+	Cfg  int     `toml:"cfg"` // number of configurations
+	Mean float64 `toml:"mean"`
+	Std  float64 `toml:"std"`
+	Min  float64 `toml:"min"`
+	Max  float64 `toml:"max"`
+}
+
+// NewVolumeStats returns the statistics of the volumes of the box vols. The
+// mean is the sum of the volumes in the order of vols divided by their number.
+func NewVolumeStats(vols []float64) *VolumeStats {
+	stats := VolumeStats{Cfg: len(vols), Min: math.Inf(1), Max: math.Inf(-1)}
+	if len(vols) == 0 {
+		return &stats
+	}
+
+	var sum float64
+	for _, v := range vols {
+		sum += v
+		stats.Min = math.Min(stats.Min, v)
+		stats.Max = math.Max(stats.Max, v)
+	}
+	stats.Mean = sum / float64(len(vols))
+
+	for _, v := range vols {
+		stats.Std += Pow(v-stats.Mean, 2)
+	}
+	stats.Std = math.Sqrt(stats.Std / float64(len(vols)))
+
+	return &stats
+}
+
+// VolumeStatsPath returns the path of the statistics of the volume of the box
+// of the trajectory path over the configurations frames. The name contains the
+// first and the last configurations, and a hash of all of them and of dedup,
+// which must be true if the duplicated configurations are skipped (see Input).
+func VolumeStatsPath(path string, frames Frames, dedup bool) string {
+	h := fnv.New32a()
+	fmt.Fprint(h, dedup, frames)
+
+	var first, last int
+	if len(frames) > 0 {
+		first, last = frames[0], frames[len(frames)-1]
+	}
+
+	return fmt.Sprintf("%s.%d-%d-%08x.vol", path, first, last, h.Sum32())
+}
+
+// ReadVolumeStats returns the statistics of the volume of the box of the
+// trajectory f over the configurations frames. It returns nil if the option
+// VolumeStats is false, if they have not been written (see WriteVolumeStats),
+// or if the trajectory has been modified since. The statistics are not shared
+// when the configurations are selected by timestep (see Input.Timesteps) or
+// when the trajectory isn't a file (f is nil).
+func (in *Input) ReadVolumeStats(f *os.File, frames Frames) (*VolumeStats, error) {
+	if !in.VolumeStats || in.Timesteps != nil || f == nil {
+		return nil, nil
+	}
+
+	path := VolumeStatsPath(f.Name(), frames, in.SkipDuplicateFrames)
+	tree, err := toml.LoadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var stats VolumeStats
+	err = tree.Unmarshal(&stats)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() != stats.Size || info.ModTime().UnixNano() != stats.ModTime ||
+		stats.Cfg != len(frames) {
+		return nil, nil
+	}
+
+	return &stats, nil
+}
+
+// WriteVolumeStats writes the statistics of the volume of the box of the
+// trajectory f over the configurations frames if the option VolumeStats is
+// true, Timesteps is nil, and f isn't nil. The file is replaced atomically so
+// that the calculations running in parallel never read a partial file.
+func (in *Input) WriteVolumeStats(f *os.File, frames Frames, stats *VolumeStats) error {
+	if !in.VolumeStats || in.Timesteps != nil || f == nil {
+		return nil
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	s := *stats
+	s.Size, s.ModTime = info.Size(), info.ModTime().UnixNano()
+
+	b, err := toml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	path := VolumeStatsPath(f.Name(), frames, in.SkipDuplicateFrames)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
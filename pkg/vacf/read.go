@@ -0,0 +1,109 @@
+package vacf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (v *VACF) readCfgFirst(r *bufio.Reader) (vel [][3]float64, err error) {
+	v.atoms, _, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	v.colsLen = len(fields)
+	for k, name := range fields {
+		switch name {
+		case "vx":
+			v.cols[0] = k
+		case "vy":
+			v.cols[1] = k
+		case "vz":
+			v.cols[2] = k
+		case "type":
+			v.cols[3] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(v.cols) {
+		err = fmt.Errorf("cannot find the columns vx, vy, vz, and type")
+		return
+	}
+
+	vel, err = v.fetchVel(r)
+	if err != nil {
+		err = fmt.Errorf("fetchVel: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchVel to fetch the velocities of the atoms.
+func (v *VACF) readCfg(r *bufio.Reader) (vel [][3]float64, err error) {
+	_, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	vel, err = v.fetchVel(r)
+	if err != nil {
+		err = fmt.Errorf("fetchVel: %w", err)
+	}
+
+	return
+}
+
+// fetchVel fetches the velocities of the atoms whose type is in Atoms.
+func (v *VACF) fetchVel(r *bufio.Reader) (vel [][3]float64, err error) {
+	for i := 0; i < v.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != v.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), v.colsLen)
+			return
+		}
+
+		if !v.types[fields[v.cols[3]]] {
+			continue
+		}
+
+		var velTmp [3]float64
+		for k := 0; k < 3; k++ {
+			velTmp[k], _ = strconv.ParseFloat(fields[v.cols[k]], 64)
+		}
+
+		vel = append(vel, velTmp)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,207 @@
+// Package vacf calculates the normalized velocity autocorrelation function
+// (VACF) of atoms, averaged over the atoms and over the time origins.
+package vacf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "vacf"
+
+// VACF is a structure containing the parameters that can be parsed from a TOML
+// configuration file. This structure can be instanced through the New method.
+// It also contains other unexported informations like the number of atoms, the
+// number of columns, and the velocities of each configuration.
+// Only the atoms whose type is in Atoms are taken into account. Their
+// velocities (vx, vy, and vz) are used, and the atoms must be in the same order
+// in every configuration (dump_modify sort id). Every configuration is used as
+// a time origin. Dt is the time between two configurations. CfgStart must be
+// lower than CfgEnd. LagMax must be lower than the number of configurations.
+// If the trajectory ends before CfgEnd, the configurations read are used, the
+// lags stop at the last configuration read, and a warning is logged.
+type VACF struct {
+	FileIn  string `toml:"vacf.file_in"`
+	FileOut string `toml:"vacf.file_out"`
+
+	CfgStart int `toml:"vacf.cfg_start"`
+	CfgEnd   int `toml:"vacf.cfg_end"`
+
+	Atoms []string `toml:"vacf.atoms"`
+
+	LagMax int     `toml:"vacf.lag_max"`
+	Dt     float64 `toml:"vacf.dt"`
+
+	types map[string]bool
+
+	atoms   int
+	cols    [4]int
+	colsLen int
+
+	vel [][][3]float64 // velocities of the selected atoms in each configuration
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the VACF structure. It reads and parses the
+// configuration file given in argument. The file must be a TOML file.
+func New(path string) (*VACF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var vacf VACF
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&vacf)
+	if err != nil {
+		return nil, err
+	}
+
+	if vacf.CfgStart >= vacf.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if vacf.LagMax <= 0 || vacf.LagMax >= (vacf.CfgEnd-vacf.CfgStart) {
+		return nil, errors.New("LagMax must be strictly positive and lower than the number of configurations")
+	}
+
+	if len(vacf.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	vacf.types = make(map[string]bool, len(vacf.Atoms))
+	for _, v := range vacf.Atoms {
+		vacf.types[v] = true
+	}
+
+	return &vacf, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (v *VACF) SetOutputDir(dir string) {
+	v.FileOut = util.FileOut(v.FileOut, dir, v.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (v *VACF) SetOutputFormat(format string) {
+	v.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (v *VACF) SetProgress(p *util.Progress) {
+	v.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (v *VACF) SetInput(in util.Input) {
+	v.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (v *VACF) SetLog(log *log.Logger) {
+	v.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread. The velocities of every configuration are
+// kept in memory.
+func (v *VACF) Start() error {
+	f, traj, err := util.OpenTrajectory(v.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(v.input.Reader(traj))
+
+	err = v.input.SkipTo(f, r, 0, v.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	vel, err := v.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	if len(vel) == 0 {
+		return errors.New("no atom of the types in Atoms in the first configuration")
+	}
+
+	v.vel = make([][][3]float64, 0, v.CfgEnd-v.CfgStart)
+	v.vel = append(v.vel, vel)
+
+	for i := 1; i < (v.CfgEnd - v.CfgStart); i++ {
+		err = v.input.SkipTo(f, r, v.CfgStart+i, v.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(v.log, Type, v.CfgStart+i, v.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		vel, err := v.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		if len(vel) != len(v.vel[0]) {
+			return fmt.Errorf("number of selected atoms (step %d) don't match: %d (expected %d)", i, len(vel), len(v.vel[0]))
+		}
+		v.vel = append(v.vel, vel)
+		v.progress.Update(i+1, v.CfgEnd-v.CfgStart)
+	}
+
+	out, err := util.WriteFormat(v.FileOut, v, v.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	v.write(out)
+
+	return nil
+}
+
+// write calculates <v(t0).v(t0+lag)> using every configuration as a time
+// origin, normalizes it by its value at lag 0, and writes the results into a
+// file.
+func (v *VACF) write(w io.Writer) {
+	lagMax := v.LagMax
+	if lagMax >= len(v.vel) {
+		lagMax = len(v.vel) - 1
+	}
+
+	corr := make([]float64, lagMax+1)
+	norm := make([]float64, lagMax+1)
+
+	for t0, vel0 := range v.vel {
+		for lag := 0; lag <= lagMax && (t0+lag) < len(v.vel); lag++ {
+			vel := v.vel[t0+lag]
+			for i, v0 := range vel0 {
+				corr[lag] += v0[0]*vel[i][0] + v0[1]*vel[i][1] + v0[2]*vel[i][2]
+			}
+			norm[lag] += float64(len(vel0))
+		}
+	}
+
+	for lag := range corr {
+		corr[lag] /= norm[lag]
+	}
+
+	fmt.Fprint(w, "lag t vacf\n")
+	for lag := 0; lag <= lagMax; lag++ {
+		fmt.Fprintf(w, "%d %g %g\n", lag, float64(lag)*v.Dt, corr[lag]/corr[0])
+	}
+}
@@ -0,0 +1,73 @@
+package vacf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVACF writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [vacf]) into a temporary directory, and
+// returns the calculation read from this file by New.
+func newVACF(t *testing.T, params, traj string) *VACF {
+	dir, err := ioutil.TempDir("", "vacf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "vacf.toml")
+	cfg := fmt.Sprintf("[vacf]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "vacf.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations: the velocity of the atom is 1, 1,
+	// and -1 along x.
+	var traj strings.Builder
+	for i, vx := range []int{1, 1, -1} {
+		fmt.Fprintf(&traj, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n1\n", i)
+		traj.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type vx vy vz\n")
+		fmt.Fprintf(&traj, "1 1 %d 0 0\n", vx)
+	}
+
+	v := newVACF(t, "cfg_end = 10\natoms = [\"1\"]\nlag_max = 5\ndt = 1.0\n", traj.String())
+	var logs strings.Builder
+	v.SetLog(log.New(&logs, "", 0))
+	err := v.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "vacf: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	// The lags stop at 2, the last configuration read.
+	b, err := ioutil.ReadFile(v.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "lag t vacf\n0 0 1\n1 1 0\n2 2 -1\n") {
+		t.Errorf("wrong correlation:\n%s", b)
+	}
+}
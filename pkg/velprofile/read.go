@@ -0,0 +1,118 @@
+package velprofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// readCfgFirst reads the first configuration. It reads the number of atoms, the
+// columns and performs the usual calculations like in readCfg.
+func (v *VelProfile) readCfgFirst(r *bufio.Reader) (box [3]float64, xyz, vel [][3]float64, err error) {
+	v.atoms, box, err = util.Header(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("Header: %w", err)
+		return
+	}
+
+	b, _ := r.ReadSlice('\n')
+	fields := strings.Fields(string(b))
+
+	if len(fields) <= 2 {
+		err = fmt.Errorf("not enough columns (at least 3; got %d)", len(fields))
+		return
+	}
+	fields = fields[2:]
+
+	var found int
+	v.colsLen = len(fields)
+	for k, name := range fields {
+		switch name {
+		case "x":
+			v.cols[0] = k
+		case "y":
+			v.cols[1] = k
+		case "z":
+			v.cols[2] = k
+		case "vx":
+			v.cols[3] = k
+		case "vy":
+			v.cols[4] = k
+		case "vz":
+			v.cols[5] = k
+		case "type":
+			v.cols[6] = k
+		default:
+			continue
+		}
+		found++
+	}
+
+	if found < len(v.cols) {
+		err = fmt.Errorf("cannot find the columns x, y, z, vx, vy, vz, and type")
+		return
+	}
+
+	xyz, vel, err = v.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// readCfg reads a configuration of the LAMMPS trajectory. This method will call
+// fetchXYZ to fetch the coordinates and the velocities of the atoms.
+func (v *VelProfile) readCfg(r *bufio.Reader) (box [3]float64, xyz, vel [][3]float64, err error) {
+	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+	if err != nil {
+		err = fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return
+	}
+
+	r.ReadSlice('\n')
+
+	xyz, vel, err = v.fetchXYZ(r)
+	if err != nil {
+		err = fmt.Errorf("fetchXYZ: %w", err)
+	}
+
+	return
+}
+
+// fetchXYZ fetches the coordinates and the velocities of the atoms whose type is
+// in Atoms.
+func (v *VelProfile) fetchXYZ(r *bufio.Reader) (xyz, vel [][3]float64, err error) {
+	for i := 0; i < v.atoms; i++ {
+		b, _ := r.ReadSlice('\n')
+		fields := strings.Fields(string(b))
+		if len(fields) != v.colsLen {
+			err = fmt.Errorf("number of columns don't match: %d (expected %d)", len(fields), v.colsLen)
+			return
+		}
+
+		if !v.types[fields[v.cols[6]]] {
+			continue
+		}
+
+		var xyzTmp, velTmp [3]float64
+		for k := 0; k < 3; k++ {
+			xyzTmp[k], _ = strconv.ParseFloat(fields[v.cols[k]], 64)
+			velTmp[k], _ = strconv.ParseFloat(fields[v.cols[k+3]], 64)
+		}
+
+		xyz = append(xyz, xyzTmp)
+		vel = append(vel, velTmp)
+	}
+
+	return
+}
+
+func readSlice(r *bufio.Reader, w io.Writer) []byte {
+	b, _ := r.ReadSlice('\n')
+	return b
+}
@@ -0,0 +1,246 @@
+// Package velprofile calculates the radial and the tangential velocities of
+// atoms as a function of their distance to an axis, e.g. for rotating droplets
+// or flows in pipes.
+//
+// The distance of an atom to the axis is measured in the plane perpendicular
+// to the axis, using the minimum image convention. Its velocity is projected
+// onto the unit vector going from the axis to the atom (radial velocity) and
+// onto the unit vector perpendicular to it in the same plane (tangential
+// velocity), oriented so that a positive tangential velocity is a
+// counterclockwise rotation around the axis.
+package velprofile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the type of calculation.
+var Type = "velocity_profile"
+
+// VelProfile is a structure containing the parameters that can be parsed
+// from a TOML configuration file. This structure can be instanced through the
+// New method. It also contains other unexported informations like the number
+// of atoms, the number of columns, and the accumulated velocities.
+// The axis is parallel to Axis (x, y, or z) and goes through Center. Only the
+// atoms whose type is in Atoms are used. The distances are binned up to RMax
+// with bins of width Dr. CfgStart must be lower than CfgEnd. If the trajectory
+// ends before CfgEnd, the configurations read are used and a warning is logged.
+type VelProfile struct {
+	FileIn  string `toml:"velocity_profile.file_in"`
+	FileOut string `toml:"velocity_profile.file_out"`
+
+	CfgStart int `toml:"velocity_profile.cfg_start"`
+	CfgEnd   int `toml:"velocity_profile.cfg_end"`
+
+	Atoms []string `toml:"velocity_profile.atoms"`
+
+	Axis   string    `toml:"velocity_profile.axis"`
+	Center []float64 `toml:"velocity_profile.center"`
+
+	RMax float64 `toml:"velocity_profile.rmax"`
+	Dr   float64 `toml:"velocity_profile.dr"`
+
+	types  map[string]bool
+	axis   int
+	center [3]float64
+	bins   int
+
+	sumRadial     []float64
+	sumTangential []float64
+	count         []float64
+
+	atoms   int
+	cols    [7]int
+	colsLen int
+
+	progress *util.Progress
+	input    util.Input
+	log      *log.Logger
+	format   string
+}
+
+// New returns an instance of the VelProfile structure. It reads and parses
+// the configuration file given in argument. The file must be a TOML file.
+func New(path string) (*VelProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var velProfile VelProfile
+	dec := toml.NewDecoder(f)
+	err = dec.Decode(&velProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	if velProfile.CfgStart >= velProfile.CfgEnd {
+		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
+	}
+
+	if len(velProfile.Atoms) == 0 {
+		return nil, errors.New("no atom type selected")
+	}
+
+	switch velProfile.Axis {
+	case "x":
+		velProfile.axis = 0
+	case "y":
+		velProfile.axis = 1
+	case "z", "":
+		velProfile.axis = 2
+	default:
+		return nil, fmt.Errorf("axis `%s` doesn't exist", velProfile.Axis)
+	}
+
+	if len(velProfile.Center) != 3 {
+		return nil, errors.New("length of Center is not equal to 3")
+	}
+	copy(velProfile.center[:], velProfile.Center)
+
+	if velProfile.Dr <= 0 {
+		return nil, errors.New("Dr must be strictly positive")
+	}
+
+	velProfile.bins = int(velProfile.RMax / velProfile.Dr)
+	if velProfile.bins <= 1 {
+		return nil, errors.New("the number of bins must be greater than 1")
+	}
+
+	velProfile.types = make(map[string]bool, len(velProfile.Atoms))
+	for _, v := range velProfile.Atoms {
+		velProfile.types[v] = true
+	}
+
+	velProfile.sumRadial = make([]float64, velProfile.bins)
+	velProfile.sumTangential = make([]float64, velProfile.bins)
+	velProfile.count = make([]float64, velProfile.bins)
+
+	return &velProfile, nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut is empty, it
+// is named after FileIn and the type of calculation (see util.FileOut).
+func (v *VelProfile) SetOutputDir(dir string) {
+	v.FileOut = util.FileOut(v.FileOut, dir, v.FileIn, Type, ".dat")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (v *VelProfile) SetOutputFormat(format string) {
+	v.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (v *VelProfile) SetProgress(p *util.Progress) {
+	v.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (v *VelProfile) SetInput(in util.Input) {
+	v.input = in
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (v *VelProfile) SetLog(log *log.Logger) {
+	v.log = log
+}
+
+// Start performs the calculation. It is a thread blocking method. This
+// calculation only use one thread.
+func (v *VelProfile) Start() error {
+	f, traj, err := util.OpenTrajectory(v.FileIn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(v.input.Reader(traj))
+
+	err = v.input.SkipTo(f, r, 0, v.CfgStart)
+	if err != nil {
+		return fmt.Errorf("SkipTo: %w", err)
+	}
+
+	box, xyz, vel, err := v.readCfgFirst(r)
+	if err != nil {
+		return fmt.Errorf("readCfgFirst: %w", err)
+	}
+	v.calc(box, xyz, vel)
+
+	for i := 1; i < (v.CfgEnd - v.CfgStart); i++ {
+		err = v.input.SkipTo(f, r, v.CfgStart+i, v.CfgStart+i)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			util.LogEndOfTrajectory(v.log, Type, v.CfgStart+i, v.CfgEnd-1, i)
+			break
+		} else if err != nil {
+			return fmt.Errorf("SkipTo (step %d): %w", i, err)
+		}
+
+		box, xyz, vel, err := v.readCfg(r)
+		if err != nil {
+			return fmt.Errorf("readCfg (step %d): %w", i, err)
+		}
+		v.calc(box, xyz, vel)
+		v.progress.Update(i+1, v.CfgEnd-v.CfgStart)
+	}
+
+	out, err := util.WriteFormat(v.FileOut, v, v.format)
+	if err != nil {
+		return fmt.Errorf("Write: %w", err)
+	}
+	defer out.Close()
+	v.write(out)
+
+	return nil
+}
+
+// calc decomposes the velocity of each atom into its radial and tangential
+// components and adds them to the bin of its distance to the axis.
+func (v *VelProfile) calc(box [3]float64, xyz, vel [][3]float64) {
+	// a and b are the dimensions of the plane perpendicular to the axis, in
+	// this order so that (a, b, axis) is right-handed.
+	a, b := (v.axis+1)%3, (v.axis+2)%3
+
+	for i, xyzAt := range xyz {
+		d := util.MinImage(xyzAt, v.center, box) // d[v.axis] is not used
+
+		dist := math.Sqrt(d[a]*d[a] + d[b]*d[b])
+		if dist == 0 {
+			continue
+		}
+
+		bin := int(dist / v.Dr)
+		if bin >= v.bins {
+			continue
+		}
+
+		v.sumRadial[bin] += (vel[i][a]*d[a] + vel[i][b]*d[b]) / dist
+		v.sumTangential[bin] += (vel[i][b]*d[a] - vel[i][a]*d[b]) / dist
+		v.count[bin]++
+	}
+}
+
+// write writes the average radial and tangential velocities of each bin. The
+// bins without atoms have zero velocities.
+func (v *VelProfile) write(w io.Writer) {
+	fmt.Fprint(w, "r v_radial v_tangential\n")
+	for i := 0; i < v.bins; i++ {
+		var radial, tangential float64
+		if v.count[i] > 0 {
+			radial = v.sumRadial[i] / v.count[i]
+			tangential = v.sumTangential[i] / v.count[i]
+		}
+
+		fmt.Fprintf(w, "%g %g %g\n", (float64(i)+0.5)*v.Dr, radial, tangential)
+	}
+}
@@ -0,0 +1,103 @@
+package velprofile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newVelProfile writes the trajectory traj and the configuration file made of
+// the parameters params (without the table [velocity_profile]) into a
+// temporary directory, and returns the calculation read from this file by New.
+func newVelProfile(t *testing.T, params, traj string) *VelProfile {
+	dir, err := ioutil.TempDir("", "velprofile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "velprofile.toml")
+	cfg := fmt.Sprintf("[velocity_profile]\nfile_in = %q\nfile_out = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "velprofile.dat"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// configuration returns a configuration of a cubic box of length 10 containing
+// the atoms of type 1 at xyz with the velocities vel.
+func configuration(step int, xyz, vel [][3]float64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", step, len(xyz))
+	b.WriteString("ITEM: BOX BOUNDS pp pp pp\n0 10\n0 10\n0 10\nITEM: ATOMS id type x y z vx vy vz\n")
+	for i, v := range xyz {
+		fmt.Fprintf(&b, "%d 1 %g %g %g %g %g %g\n", i+1, v[0], v[1], v[2], vel[i][0], vel[i][1], vel[i][2])
+	}
+	return b.String()
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations: the atom is at 1.5 from the axis
+	// and its radial velocity is 1, 2, and 3.
+	var traj strings.Builder
+	for i := 0; i < 3; i++ {
+		traj.WriteString(configuration(i, [][3]float64{{6.5, 5, 0}}, [][3]float64{{float64(i + 1), 0, 0}}))
+	}
+
+	v := newVelProfile(t, "cfg_end = 10\natoms = [\"1\"]\ncenter = [5.0, 5.0, 0.0]\nrmax = 2.0\ndr = 1.0\n",
+		traj.String())
+	var logs strings.Builder
+	v.SetLog(log.New(&logs, "", 0))
+	err := v.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "velocity_profile: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"
+	if logs.String() != want {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+
+	b, err := ioutil.ReadFile(v.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "r v_radial v_tangential\n0.5 0 0\n1.5 2 0\n") {
+		t.Errorf("wrong profile:\n%s", b)
+	}
+}
+
+func TestPeriodicDistance(t *testing.T) {
+	// The axis is near the boundary along x: the atom is at 1 from it through
+	// the boundary and moves away from it.
+	traj := configuration(0, [][3]float64{{9.5, 5, 0}}, [][3]float64{{-1, 2, 0}})
+
+	v := newVelProfile(t, "cfg_end = 1\natoms = [\"1\"]\ncenter = [0.5, 5.0, 0.0]\nrmax = 2.0\ndr = 1.0\n", traj)
+	err := v.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(v.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(b), "r v_radial v_tangential\n0.5 0 0\n1.5 1 -2\n") {
+		t.Errorf("the distance isn't taken at its minimum image:\n%s", b)
+	}
+}
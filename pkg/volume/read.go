@@ -2,9 +2,10 @@ package volume
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"strconv"
+	"math"
 	"strings"
 
 	"github.com/kpotier/molsolvent/pkg/util"
@@ -12,31 +13,35 @@ import (
 
 // readCfgFirst reads the first configuration. It reads the number of atoms, the
 // columns and performs the usual calculations like in readCfg.
-func (v *Volume) readCfgFirst(r *bufio.Reader) (XYZ, [3]float64, error) {
+func (v *Volume) readCfgFirst(r *bufio.Reader) (XYZ, [3]float64, [3]float64, error) {
 	var err error
-	var box [3]float64
-	v.atoms, box, err = util.Header(r, nil, readSlice)
+	var box, tilt [3]float64
+	var header bytes.Buffer
+	v.atoms, box, tilt, err = util.HeaderTilt(r, &header, readSlice)
 	if err != nil {
-		return nil, box, fmt.Errorf("Header: %w", err)
+		return nil, box, tilt, fmt.Errorf("Header: %w", err)
 	}
+	v.timestep = util.Timestep(header.Bytes())
 
 	b, _ := r.ReadSlice('\n')
 	fields := strings.Fields(string(b))
 
 	if len(fields) <= 2 {
-		return nil, box, fmt.Errorf("not enough columns (at least 3, got %d)", len(fields))
+		return nil, box, tilt, fmt.Errorf("not enough columns (at least 3, got %d)", len(fields))
 	}
 	fields = fields[2:]
 
+	v.coords, v.scaled = util.DetectScaled(v.CoordinateColumns, v.coords, fields)
+
 	var found int
 	v.colsLen = len(fields)
 	for k, val := range fields {
 		switch val {
-		case "x":
+		case v.coords[0]:
 			v.cols[0] = k
-		case "y":
+		case v.coords[1]:
 			v.cols[1] = k
-		case "z":
+		case v.coords[2]:
 			v.cols[2] = k
 		case "type":
 			v.cols[3] = k
@@ -47,43 +52,93 @@ func (v *Volume) readCfgFirst(r *bufio.Reader) (XYZ, [3]float64, error) {
 	}
 
 	if found < len(v.cols) {
-		return nil, box, fmt.Errorf("cannot find the columns x y z, and type")
+		return nil, box, tilt, fmt.Errorf("cannot find the columns %s, %s, %s, and type", v.coords[0], v.coords[1], v.coords[2])
+	}
+
+	v.summary = util.NewSummary(v.atoms, fields, box)
+
+	err = v.sel.Columns(fields)
+	if err != nil {
+		return nil, box, tilt, err
 	}
 
-	xyz, err := v.fetchXYZ(r)
+	xyz, err := v.fetchXYZ(r, true)
 	if err != nil {
-		return nil, box, fmt.Errorf("fetchXYZ: %w", err)
+		return nil, box, tilt, fmt.Errorf("fetchXYZ: %w", err)
 	}
+	v.scale(box, tilt, xyz)
+	v.wrap(box, tilt, xyz)
 
-	return xyz, box, nil
+	return xyz, box, tilt, nil
 }
 
 // readCfg reads a configuration of the LAMMPS trajectory. This method will call
-// fetchXYZ to fetch the coordinates of the two atoms.
-func (v *Volume) readCfg(r *bufio.Reader) (XYZ, [3]float64, error) {
-	var err error
-	var box [3]float64
-	box, err = util.HeaderWOutAtoms(r, nil, readSlice)
+// fetchXYZ to fetch the coordinates of the two atoms. The number of atoms must
+// be the one of the first configuration.
+func (v *Volume) readCfg(r *bufio.Reader) (XYZ, [3]float64, [3]float64, error) {
+	var header bytes.Buffer
+	atoms, box, tilt, err := util.HeaderTilt(r, &header, readSlice)
 	if err != nil {
-		return nil, box, fmt.Errorf("HeaderWOutAtoms: %w", err)
+		return nil, box, tilt, fmt.Errorf("Header: %w", err)
 	}
+	if atoms != v.atoms {
+		return nil, box, tilt, fmt.Errorf("number of atoms changed: %d (%d in the first configuration)", atoms, v.atoms)
+	}
+	v.timestep = util.Timestep(header.Bytes())
 
 	r.ReadSlice('\n')
 
-	xyz, err := v.fetchXYZ(r)
+	xyz, err := v.fetchXYZ(r, false)
 	if err != nil {
-		return nil, box, fmt.Errorf("fetchXYZ: %w", err)
+		return nil, box, tilt, fmt.Errorf("fetchXYZ: %w", err)
+	}
+	v.scale(box, tilt, xyz)
+	v.wrap(box, tilt, xyz)
+
+	return xyz, box, tilt, nil
+}
+
+// scale converts the scaled coordinates into coordinates in the box if they
+// are read (see util.ScaleTilt).
+func (v *Volume) scale(box, tilt [3]float64, xyz XYZ) {
+	if !v.scaled {
+		return
+	}
+
+	for _, atoms := range xyz {
+		util.ScaleTilt(atoms, box, tilt)
+	}
+}
+
+// wrap moves the atoms into the box [0; box[ (along its edges in a triclinic
+// box, see util.Shear) if the unwrapped coordinates are read, because the
+// blocs only cover one image of the box.
+func (v *Volume) wrap(box, tilt [3]float64, xyz XYZ) {
+	if v.CoordinateColumns != util.Unwrapped {
+		return
 	}
 
-	return xyz, box, nil
+	for _, atoms := range xyz {
+		for i := range atoms {
+			u := util.Unshear(atoms[i], box, tilt)
+			for k := 0; k < 3; k++ {
+				u[k] -= box[k] * math.Floor(u[k]/box[k])
+			}
+			atoms[i] = util.Shear(u, box, tilt)
+		}
+	}
 }
 
-// fetchXYZ fetches the coordinates of the two atoms by calling readXYZ two
-// times (one for the first atom, and the other for the second atom).
-func (v *Volume) fetchXYZ(r *bufio.Reader) (XYZ, error) {
-	xyz := make(XYZ, len(v.Sigma))
-	nbat := v.atoms / len(v.Sigma)
-	for k := range v.Sigma {
+// fetchXYZ fetches the coordinates of the atoms having a sigma. If first is
+// true, the unknown atom types are added to the solvent (see OthersRest). The
+// atoms whose type is in Atoms must also satisfy Select.
+func (v *Volume) fetchXYZ(r *bufio.Reader, first bool) (XYZ, error) {
+	xyz := make(XYZ, len(v.sigma2))
+	var nbat int
+	if len(v.sigma2) > 0 {
+		nbat = v.atoms / len(v.sigma2)
+	}
+	for k := range v.sigma2 {
 		xyz[k] = make([][3]float64, 0, nbat)
 	}
 
@@ -95,14 +150,34 @@ func (v *Volume) fetchXYZ(r *bufio.Reader) (XYZ, error) {
 		}
 
 		typ := fields[v.cols[3]]
-		_, ok := v.Sigma[typ]
+		v.summary.Add(typ)
+		_, ok := v.sigma2[typ]
 		if !ok {
-			continue
+			if !first || v.OthersAre != OthersRest {
+				continue
+			}
+
+			err := v.addOther(typ)
+			if err != nil {
+				return nil, fmt.Errorf("addOther: %w", err)
+			}
+			xyz[typ] = nil
+		}
+
+		if v.sel != nil && v.isAtom(typ) {
+			match, err := v.sel.Match(fields)
+			if err != nil {
+				return nil, err
+			}
+
+			if !match {
+				continue
+			}
 		}
 
-		var xyzt [3]float64
-		for k := 0; k < 3; k++ {
-			xyzt[k], _ = strconv.ParseFloat(fields[v.cols[k]], 64)
+		xyzt, err := util.ParseXYZ(fields, v.cols[:3], v.coords)
+		if err != nil {
+			return nil, fmt.Errorf("atom %d (line %d): %w", i, util.AtomLine(i), err)
 		}
 
 		xyz[typ] = append(xyz[typ], xyzt)
@@ -112,5 +187,8 @@ func (v *Volume) fetchXYZ(r *bufio.Reader) (XYZ, error) {
 
 func readSlice(r *bufio.Reader, w io.Writer) []byte {
 	b, _ := r.ReadSlice('\n')
+	if w != nil {
+		w.Write(b)
+	}
 	return b
 }
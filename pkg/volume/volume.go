@@ -3,12 +3,15 @@ package volume
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"math"
 	"os"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -23,40 +26,117 @@ var Type = "volume"
 // XYZ is a type that represents the coordinates for each atom.
 type XYZ map[string][][3]float64
 
+// Values of OthersAre. With OthersSigma, the solvent is made of the types in
+// Sigma that are not in Atoms. With OthersRest, the solvent is made of every
+// type present in the first configuration that is not in Atoms.
+const (
+	OthersSigma = "sigma"
+	OthersRest  = "rest"
+)
+
 // Volume is a structure containing the parameters that can be parsed from
 // a TOML configuration file. This structure can be instanced through the New
 // method. It also contains other unexported informations like the number of
 // atoms, the number of columns, ...
-// CfgStart must be lower than CfgEnd. Size of the Bloc and Blocs must be equal
-// to 3.
+// CfgStart must be lower than CfgEnd. If the trajectory ends before CfgEnd,
+// the configurations read are used and a warning is logged. Size of the Bloc
+// and Blocs must be equal to 3. CoordinateColumns is the set of coordinates
+// read (util.Wrapped by default, see util.CoordColumnsScaled); the unwrapped
+// coordinates are wrapped into the box and the scaled ones are converted with
+// the size of the box (read by default without wrapped coordinates, see
+// util.DetectScaled). The box may be triclinic: the blocs are then
+// parallelepipeds along its edges, of volume Bloc[0]*Bloc[1]*Bloc[2], and the
+// distances follow the minimum image convention of the triclinic box (see
+// util.Shear and util.MinImageTilt). If OthersAre is OthersRest, the types
+// missing in Sigma use SigmaDefault. If Radii is set, the types of
+// TypeToElement missing in Sigma use the diameter of their element found in
+// the table of radii (see util.Radius).
+// If FileOutFrames is set, the index and the timestep of each processed
+// configuration are written into this file (see util.FrameMap).
+// If Select is set, only the atoms of Atoms satisfying this expression are used
+// in each configuration (see util.Selection). The solvent is not filtered.
+// If BoxBins is set, the probability density of the volume of the box over the
+// processed configurations is written at the end of the output file, with
+// BoxBins bins between the smallest and the largest volume, followed by the
+// mean, the standard deviation, and the skewness of the volume. The
+// statistics of the volume of the box are shared with the next calculations
+// of the batch if the option is set (see util.Input.WriteVolumeStats).
+// Threads is the number of threads used by the calculation (all the threads
+// available if 0). With one thread, the configurations are processed strictly
+// in order and the timings are not written: two runs on the same input give
+// the same output, apart from the date.
+// The blocs of the atoms of the first configuration are written in FileOutXYZ
+// in the XYZ format. If WriteXYZEvery is set, a frame is appended every
+// WriteXYZEvery processed configurations as well, so that the cavity can be
+// visualized over time. The frames are written in the order of the
+// configurations whatever the number of threads.
 type Volume struct {
 	FileIn     string `toml:"volume.file_in"`
 	FileOut    string `toml:"volume.file_out"`
 	FileOutXYZ string `toml:"volume.file_out_xyz"`
 
+	FileOutFrames string `toml:"volume.file_out_frames"`
+
 	CfgStart   int `toml:"volume.cfg_start"`
 	CfgEnd     int `toml:"volume.cfg_end"`
 	CfgSpacing int `toml:"volume.cfg_spacing"`
 
+	CoordinateColumns string `toml:"volume.coordinate_columns"`
+
 	Bloc  []float64 `toml:"volume.bloc"`
 	Blocs []int     `toml:"volume.blocs"` // Blocs around each atom
 
-	Atoms []string           `toml:"volume.atoms"`
-	Sigma map[string]float64 `toml:"volume.sigma"`
+	Atoms        []string           `toml:"volume.atoms"`
+	Sigma        map[string]float64 `toml:"volume.sigma"`
+	SigmaDefault float64            `toml:"volume.sigma_default"`
+	OthersAre    string             `toml:"volume.others_are"`
+
+	Radii         string            `toml:"volume.radii"`
+	TypeToElement map[string]string `toml:"volume.type_to_element"`
 
 	Dt float64 `toml:"volume.dt"`
 
+	Select  string `toml:"volume.select"`
+	Threads int    `toml:"volume.threads"`
+
+	BoxBins int `toml:"volume.box_bins"`
+
+	WriteXYZEvery int `toml:"volume.write_xyz_every"`
+
 	atOther []string
+	sigma   map[string]float64
 	sigma2  map[string]float64
+	sel     *util.Selection
 
 	atoms   int
 	cols    [4]int
+	coords  [3]string
+	scaled  bool // see util.DetectScaled
 	colsLen int
 
-	cfg int
-	err error
-	mux sync.Mutex
-	wg  sync.WaitGroup
+	boxVol []float64 // volume of the box of each configuration
+	volAt  float64   // sum of the volumes of the atoms
+
+	syncEvery int
+	syncer    *util.Syncer
+
+	xyzOut     io.Writer
+	xyzNext    int            // next frame of FileOutXYZ to write
+	xyzPending map[int][]byte // frames waiting for the previous ones
+	xyzErr     error
+	xyzMux     sync.Mutex
+
+	progress *util.Progress
+	input    util.Input
+	format   string
+	log      *log.Logger
+	summary  *util.Summary
+	frameMap *util.FrameMap
+	timestep string
+	cfg      int
+	err      error
+	mux      sync.Mutex
+	wg       sync.WaitGroup
 }
 
 // New returns an instance of the Volume structure. It reads and parses
@@ -79,84 +159,256 @@ func New(path string) (*Volume, error) {
 		return nil, errors.New("CfgStart is greater or equal than CfgEnd")
 	}
 
+	volume.coords, err = util.CoordColumnsScaled(volume.CoordinateColumns, util.Wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("CoordinateColumns: %w", err)
+	}
+
+	if volume.Radii != "" {
+		if volume.Sigma == nil {
+			volume.Sigma = make(map[string]float64, len(volume.TypeToElement))
+		}
+
+		for typ, element := range volume.TypeToElement {
+			if _, ok := volume.Sigma[typ]; ok {
+				continue
+			}
+
+			radius, err := util.Radius(volume.Radii, element)
+			if err != nil {
+				return nil, fmt.Errorf("Radius: %w", err)
+			}
+			volume.Sigma[typ] = 2. * radius
+		}
+	}
+
+	volume.sigma = make(map[string]float64, len(volume.Sigma))
 	volume.sigma2 = make(map[string]float64, len(volume.Sigma))
-	for atom, sigma := range volume.Sigma {
-		var found bool
-		for _, i := range volume.Atoms {
-			if i == atom {
-				found = true
-				break
+	switch volume.OthersAre {
+	case "", OthersSigma:
+		for atom, sigma := range volume.Sigma {
+			if !volume.isAtom(atom) {
+				volume.atOther = append(volume.atOther, atom)
 			}
+			volume.addSigma(atom, sigma)
 		}
+	case OthersRest:
+		for _, atom := range volume.Atoms {
+			sigma, ok := volume.Sigma[atom]
+			if !ok {
+				sigma = volume.SigmaDefault
+			}
 
-		if !found {
-			volume.atOther = append(volume.atOther, atom)
+			if sigma <= 0 {
+				return nil, fmt.Errorf("no sigma for atom type `%s`", atom)
+			}
+			volume.addSigma(atom, sigma)
 		}
+	default:
+		return nil, fmt.Errorf("OthersAre `%s` doesn't exist", volume.OthersAre)
+	}
 
-		volume.sigma2[atom] = util.Pow(sigma, 2)
+	if volume.FileOutFrames != "" {
+		volume.frameMap = util.NewFrameMap()
 	}
 
 	if len(volume.Bloc) != 3 || len(volume.Blocs) != 3 {
 		return nil, errors.New("length of Blocs or Bloc is not equal to 3")
 	}
 
+	if volume.Threads < 0 {
+		return nil, errors.New("Threads must be positive")
+	}
+
+	if volume.WriteXYZEvery < 0 {
+		return nil, errors.New("WriteXYZEvery must be positive")
+	}
+
+	if volume.Select != "" {
+		volume.sel, err = util.NewSelection(volume.Select)
+		if err != nil {
+			return nil, fmt.Errorf("NewSelection: %w", err)
+		}
+	}
+
 	return &volume, nil
 }
 
+// isAtom returns true if the atom type is in Atoms.
+func (v *Volume) isAtom(typ string) bool {
+	for _, i := range v.Atoms {
+		if i == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// addSigma saves sigma and its square for the atom type.
+func (v *Volume) addSigma(typ string, sigma float64) {
+	v.sigma[typ] = sigma
+	v.sigma2[typ] = util.Pow(sigma, 2)
+}
+
+// addOther adds an atom type found in the trajectory to the solvent. It uses
+// SigmaDefault if the type is not in Sigma.
+func (v *Volume) addOther(typ string) error {
+	sigma, ok := v.Sigma[typ]
+	if !ok {
+		sigma = v.SigmaDefault
+	}
+
+	if sigma <= 0 {
+		return fmt.Errorf("no sigma for atom type `%s`", typ)
+	}
+
+	v.atOther = append(v.atOther, typ)
+	v.addSigma(typ, sigma)
+	return nil
+}
+
+// SetOutputDir sets the directory of the output files. If FileOut or FileOutXYZ
+// are empty, they are named after FileIn and the type of calculation (see
+// util.FileOut).
+func (v *Volume) SetOutputDir(dir string) {
+	v.FileOut = util.FileOut(v.FileOut, dir, v.FileIn, Type, ".dat")
+	v.FileOutXYZ = util.FileOut(v.FileOutXYZ, dir, v.FileIn, Type, ".xyz")
+}
+
+// SetOutputFormat sets the format of the output files (see util.WriteFormat).
+func (v *Volume) SetOutputFormat(format string) {
+	v.format = format
+}
+
+// SetProgress sets the progress reporter of the calculation.
+func (v *Volume) SetProgress(p *util.Progress) {
+	v.progress = p
+}
+
+// SetInput sets the options applied to the reading of the trajectory.
+func (v *Volume) SetInput(in util.Input) {
+	v.input = in
+}
+
+// SetSyncEvery sets the number of configurations between two syncs of the
+// output file (see util.Syncer).
+func (v *Volume) SetSyncEvery(every int) {
+	v.syncEvery = every
+}
+
+// SetLog sets the logger of the warnings of the calculation.
+func (v *Volume) SetLog(log *log.Logger) {
+	v.log = log
+}
+
 // Start performs the calculation. It is a thread blocking method. This
-// calculation will use all the threads available.
+// calculation will use all the threads available unless Threads is set.
 func (v *Volume) Start() error {
-	f, err := os.Open(v.FileIn)
+	f, traj, err := util.OpenTrajectory(v.FileIn)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	r := bufio.NewReader(f)
+	r := bufio.NewReader(v.input.Reader(traj))
 
-	out, err := util.Write(v.FileOut, v)
+	out, err := util.WriteFormat(v.FileOut, v, v.format)
 	if err != nil {
 		return fmt.Errorf("Write: %w", err)
 	}
 	defer out.Close()
-	out.WriteString("cfg t vol(atoms) vol(other)\n")
+	v.syncer = util.NewSyncer(out, v.syncEvery)
+	out.WriteString("cfg t vol(atoms) vol(other) area_xy area_xz area_yz")
+	for _, atom := range v.Atoms {
+		fmt.Fprintf(out, " vol(%s)", atom)
+	}
+	out.WriteString("\n")
+
+	xyzOut, err := os.Create(v.FileOutXYZ)
+	if err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	defer xyzOut.Close()
+	xyzBuf := bufio.NewWriter(xyzOut)
+	v.xyzOut = xyzBuf
+	v.xyzPending = make(map[int][]byte)
 
 	tFirst := time.Now()
 
-	err = util.ReadCfgNonCvg(r, v.CfgStart)
+	err = v.input.SkipTo(f, r, 0, v.CfgStart)
 	if err != nil {
-		return fmt.Errorf("ReadCfgNonCvg: %w", err)
+		return fmt.Errorf("SkipTo: %w", err)
 	}
 
-	xyz, box, err := v.readCfgFirst(r)
+	xyz, box, tilt, err := v.readCfgFirst(r)
 	if err != nil {
 		return fmt.Errorf("readCfgFirst: %w", err)
 	}
-	v.calc(out, v.CfgStart, box, xyz)
+	v.summary.Log(v.log, Type)
+	v.summary = nil
+	v.frameMap.Add(v.CfgStart, v.timestep)
+	v.boxVol = append(v.boxVol, box[0]*box[1]*box[2])
+	v.calc(out, v.CfgStart, box, tilt, xyz)
 	v.cfg = v.CfgStart
 
 	tFirstDur := time.Since(tFirst)
 	tOther := time.Now()
 
-	for i := 0; i < (runtime.NumCPU() - 1); i++ {
+	threads := v.Threads
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+
+	for i := 0; i < (threads - 1); i++ {
 		v.wg.Add(1)
-		go v.start(r, out)
+		go v.start(f, r, out)
 	}
 
 	v.wg.Add(1)
-	v.start(r, out)
+	v.start(f, r, out)
 	v.wg.Wait()
 
-	tOtherDur := time.Since(tOther)
-	fmt.Fprintf(out, "\nTime (first): %s\nTime (other): %s\nTime (total): %s\n", tFirstDur, tOtherDur, (tFirstDur + tOtherDur))
+	if v.Threads != 1 {
+		tOtherDur := time.Since(tOther)
+		fmt.Fprintf(out, "\nTime (first): %s\nTime (other): %s\nTime (total): %s\n", tFirstDur, tOtherDur, (tFirstDur + tOtherDur))
+	}
 
 	if v.err != nil {
 		return v.err
 	}
 
+	requested := (v.CfgEnd-v.CfgStart-1)/(v.CfgSpacing+1) + 1
+	if len(v.boxVol) < requested {
+		util.LogEndOfTrajectory(v.log, Type, v.CfgStart+len(v.boxVol)*(v.CfgSpacing+1),
+			v.CfgStart+(requested-1)*(v.CfgSpacing+1), len(v.boxVol))
+	}
+
+	err = v.flushXYZ(xyzBuf)
+	if err != nil {
+		return fmt.Errorf("flushXYZ: %w", err)
+	}
+
+	if v.BoxBins > 0 {
+		v.writeBoxVolume(out)
+	}
+
+	frames := make(util.Frames, len(v.boxVol))
+	for i := range frames {
+		frames[i] = v.CfgStart + i*(v.CfgSpacing+1)
+	}
+	err = v.input.WriteVolumeStats(f, frames, util.NewVolumeStats(v.boxVol))
+	if err != nil {
+		return fmt.Errorf("WriteVolumeStats: %w", err)
+	}
+
+	err = v.frameMap.Write(v.FileOutFrames)
+	if err != nil {
+		return fmt.Errorf("FrameMap: %w", err)
+	}
+
 	return nil
 }
 
-func (v *Volume) start(r *bufio.Reader, out io.Writer) {
+func (v *Volume) start(f *os.File, r *bufio.Reader, out io.Writer) {
 	for {
 		v.mux.Lock()
 		v.cfg += v.CfgSpacing + 1
@@ -164,15 +416,18 @@ func (v *Volume) start(r *bufio.Reader, out io.Writer) {
 			break
 		}
 
-		err := util.ReadCfgNonCvg(r, v.CfgSpacing)
-		if err != nil {
+		err := v.input.SkipTo(f, r, v.cfg-v.CfgSpacing, v.cfg)
+		if errors.Is(err, util.ErrEndOfTrajectory) {
+			v.cfg = v.CfgEnd // the other threads stop as well
+			break
+		} else if err != nil {
 			if v.err == nil {
-				v.err = fmt.Errorf("ReadCfgNonCvg (step %d): %w", v.cfg, err)
+				v.err = fmt.Errorf("SkipTo (step %d): %w", v.cfg, err)
 			}
 			break
 		}
 
-		xyz, box, err := v.readCfg(r)
+		xyz, box, tilt, err := v.readCfg(r)
 		if err != nil {
 			if v.err == nil {
 				v.err = fmt.Errorf("readCfg (step %d): %w", v.cfg, err)
@@ -181,31 +436,137 @@ func (v *Volume) start(r *bufio.Reader, out io.Writer) {
 		}
 
 		currentCfg := v.cfg // copy
+		v.frameMap.Add(currentCfg, v.timestep)
+		v.boxVol = append(v.boxVol, box[0]*box[1]*box[2])
+		v.progress.Update(v.cfg-v.CfgStart+1, v.CfgEnd-v.CfgStart)
 		v.mux.Unlock()
 
-		v.calc(out, currentCfg, box, xyz)
+		v.calc(out, currentCfg, box, tilt, xyz)
+
+		err = v.syncer.Frame()
+		if err != nil {
+			v.mux.Lock()
+			if v.err == nil {
+				v.err = fmt.Errorf("Sync (step %d): %w", currentCfg, err)
+			}
+			break
+		}
 	}
 
 	v.mux.Unlock()
 	v.wg.Done()
 }
 
-// calc calculates the volume and writes the result into a file
-func (v *Volume) calc(w io.Writer, cfg int, box [3]float64, xyz XYZ) {
+// Summary returns the mean volume of the atoms and the mean volume of the box
+// over the processed configurations.
+func (v *Volume) Summary() string {
+	var box float64
+	for _, vol := range v.boxVol {
+		box += vol
+	}
+	nb := float64(len(v.boxVol))
+	return fmt.Sprintf("mean vol(atoms) %g, mean box volume %g (%d configurations)",
+		v.volAt/nb, box/nb, len(v.boxVol))
+}
+
+// writeBoxVolume writes the probability density of the volume of the box and
+// its mean, standard deviation, and skewness.
+func (v *Volume) writeBoxVolume(w io.Writer) {
+	vmin, vmax := math.Inf(1), math.Inf(-1)
+	var mean float64
+	for _, vol := range v.boxVol {
+		vmin = math.Min(vmin, vol)
+		vmax = math.Max(vmax, vol)
+		mean += vol
+	}
+	nb := float64(len(v.boxVol))
+	mean /= nb
+
+	if vmin == vmax { // constant volume
+		vmin -= 0.5
+		vmax += 0.5
+	}
+
+	width := (vmax - vmin) / float64(v.BoxBins)
+	hstg := make([]float64, v.BoxBins)
+	var m2, m3 float64
+	for _, vol := range v.boxVol {
+		bin := int((vol - vmin) / width)
+		if bin == v.BoxBins { // largest volume
+			bin--
+		}
+		hstg[bin]++
+
+		m2 += util.Pow(vol-mean, 2)
+		m3 += util.Pow(vol-mean, 3)
+	}
+
+	std := math.Sqrt(m2 / nb)
+	var skewness float64
+	if std > 0 {
+		skewness = m3 / nb / util.Pow(std, 3)
+	}
+
+	fmt.Fprint(w, "\nV P(V)\n")
+	for i, n := range hstg {
+		fmt.Fprintf(w, "%g %g\n", vmin+(float64(i)+0.5)*width, n/(nb*width))
+	}
+
+	fmt.Fprintf(w, "\nmean std skewness\n%g %g %g\n", mean, std, skewness)
+}
+
+// calc calculates the volume and writes the result into a file. The volume of
+// the atoms is also split according to the type of the nearest atom of each
+// bloc.
+func (v *Volume) calc(w io.Writer, cfg int, box, tilt [3]float64, xyz XYZ) {
+	ptsX, ptsY, ptsZ := v.candidates(box, tilt, xyz)
+	pts, ptsTyp := v.classify(box, tilt, xyz, ptsX, ptsY, ptsZ)
+
+	volBloc := v.Bloc[0] * v.Bloc[1] * v.Bloc[2]
+	volAt := volBloc * float64(len(pts))
+	volOt := (box[0] * box[1] * box[2]) - volAt
+	area := v.area(pts)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d %g %g %g %g %g %g", cfg, float64(cfg)*v.Dt, volAt, volOt,
+		area[0], area[1], area[2])
+	for _, atom := range v.Atoms {
+		fmt.Fprintf(&buf, " %g", volBloc*float64(ptsTyp[atom]))
+	}
+	buf.WriteByte('\n')
+	w.Write(buf.Bytes())
+
+	v.mux.Lock()
+	v.volAt += volAt
+	v.mux.Unlock()
+
+	if frame, ok := v.xyzFrame(cfg); ok {
+		var buf bytes.Buffer
+		v.xyz(&buf, cfg, box, tilt, pts)
+		v.addXYZ(frame, buf.Bytes())
+	}
+}
+
+// candidates returns the indices of the blocs along x, y, and z that are within
+// Blocs of an atom of Atoms. Only the blocs made of these indices can belong to
+// the atoms. In a triclinic box, the blocs are along the edges of the box (see
+// util.Shear).
+func (v *Volume) candidates(box, tilt [3]float64, xyz XYZ) (ptsX, ptsY, ptsZ map[float64]bool) {
 	var boxBlocs [3]int
 	for k := 0; k < 3; k++ {
 		boxBlocs[k] = int(math.Round(box[k] / v.Bloc[k]))
 	}
 
-	ptsX := make(map[float64]bool) // float64 to avoid casting
-	ptsY := make(map[float64]bool)
-	ptsZ := make(map[float64]bool)
+	ptsX = make(map[float64]bool) // float64 to avoid casting
+	ptsY = make(map[float64]bool)
+	ptsZ = make(map[float64]bool)
 
 	for _, atom := range v.Atoms {
 		for _, xyzt := range xyz[atom] {
+			u := util.Unshear(xyzt, box, tilt)
 			var bloc [3]int // In which bloc is the molecule
 			for k := 0; k < 3; k++ {
-				bloc[k] = int(xyzt[k] / v.Bloc[k])
+				bloc[k] = int(u[k] / v.Bloc[k])
 			}
 
 			for x := (bloc[0] - v.Blocs[0]); x <= (bloc[0] + v.Blocs[0]); x++ {
@@ -243,92 +604,233 @@ func (v *Volume) calc(w io.Writer, cfg int, box [3]float64, xyz XYZ) {
 		}
 	}
 
-	pts := make(map[[3]float64]bool, (len(ptsX) * len(ptsY) * len(ptsZ))) // true if atoms
+	return ptsX, ptsY, ptsZ
+}
+
+// classify returns the blocs made of the indices ptsX, ptsY, and ptsZ that
+// belong to the atoms of Atoms, and their number for each atom type. A bloc
+// belongs to the atoms if no solvent atom is nearer than its nearest atom of
+// Atoms, the distances being divided by sigma.
+func (v *Volume) classify(box, tilt [3]float64, xyz XYZ, ptsX, ptsY, ptsZ map[float64]bool) (pts map[[3]float64]bool, ptsTyp map[string]int) {
+	// The atoms and the solvent are indexed by cell lists so that only the
+	// atoms close to a bloc are visited. The atoms are flattened in the order
+	// of Atoms so that the nearest atom is the same as when looping over them.
+	// In a triclinic box, the cell lists are built along the edges of the box
+	// (atU and otU) and their bounds are shortened by the ratio of the width
+	// of the box to the length of its edge (see util.Widths).
+	var (
+		atXYZ, otXYZ        [][3]float64
+		atU, otU            [][3]float64
+		atTyp               []string
+		atSigma2, otSigma   []float64
+		atSigma2M, otSigmaM float64
+	)
+	for _, atom := range v.Atoms {
+		for _, xyzt := range xyz[atom] {
+			atXYZ = append(atXYZ, xyzt)
+			atU = append(atU, util.Unshear(xyzt, box, tilt))
+			atTyp = append(atTyp, atom)
+			atSigma2 = append(atSigma2, v.sigma2[atom])
+		}
+		atSigma2M = math.Max(atSigma2M, v.sigma2[atom])
+	}
+	for _, atom := range v.atOther {
+		for _, xyzt := range xyz[atom] {
+			otXYZ = append(otXYZ, xyzt)
+			otU = append(otU, util.Unshear(xyzt, box, tilt))
+			otSigma = append(otSigma, v.sigma[atom])
+		}
+		otSigmaM = math.Max(otSigmaM, v.sigma[atom])
+	}
+	atCells := util.NewCellList(box, atU, cellEdge(box, len(atU)))
+	otCells := util.NewCellList(box, otU, cellEdge(box, len(otU)))
+
+	ratio := 1.
+	widths := util.Widths(box, tilt)
+	for k := 0; k < 3; k++ {
+		ratio = math.Min(ratio, widths[k]/box[k])
+	}
+
+	pts = make(map[[3]float64]bool, (len(ptsX) * len(ptsY) * len(ptsZ))) // true if atoms
+	ptsTyp = make(map[string]int, len(v.Atoms))
 	for x := range ptsX {
 		for y := range ptsY {
 			for z := range ptsZ {
 				lit := [3]float64{x, y, z}
-				distTmp := math.MaxFloat64
-				var ptsTmp bool // true => atoms. false = other
 
-				var pos [3]float64
+				var u [3]float64
 				for k := 0; k < 3; k++ {
-					pos[k] = (v.Bloc[k] * lit[k]) + (v.Bloc[k] / 2.)
+					u[k] = (v.Bloc[k] * lit[k]) + (v.Bloc[k] / 2.)
 				}
+				pos := util.Shear(u, box, tilt)
 
-				for _, atom := range v.Atoms {
-					for _, xyzt := range xyz[atom] {
-						var dist float64
-						for k := 0; k < 3; k++ {
-							distatt := xyzt[k] - pos[k]
-							dist += util.Pow((distatt - box[k]*math.Round(distatt/box[k])), 2)
-						}
-						dist /= v.sigma2[atom]
-
-						if dist < distTmp {
-							distTmp = dist
-							ptsTmp = true
-						}
+				// Nearest atom. The ties are broken by the order of the atoms.
+				distTmp := math.MaxFloat64
+				idTmp := -1
+				atCells.Search(u, func(i int) {
+					dist := util.MinImageDist2Tilt(atXYZ[i], pos, box, tilt)
+					dist /= atSigma2[i]
+
+					if dist < distTmp || (dist == distTmp && i < idTmp) {
+						distTmp = dist
+						idTmp = i
 					}
+				}, func(bound float64) bool {
+					bound *= ratio
+					return bound*bound/atSigma2M > distTmp
+				})
+
+				if idTmp < 0 {
+					continue
 				}
 
-				for _, atom := range v.atOther {
-					for _, xyzt := range xyz[atom] {
-						var dist float64
-						for k := 0; k < 3; k++ {
-							distatt := xyzt[k] - pos[k]
-							dist += util.Pow((distatt - box[k]*math.Round(distatt/box[k])), 2)
-						}
-						dist = math.Sqrt(dist)
-						dist /= v.Sigma[atom]
-
-						if dist < distTmp {
-							distTmp = dist
-							ptsTmp = false
-							break // We don't longer need to check
-						}
+				// The bloc belongs to the solvent if any solvent atom is nearer.
+				var other bool
+				otCells.Search(u, func(i int) {
+					if other {
+						return
 					}
 
-					if !ptsTmp {
-						break // We don't longer need to check because it's sure that ptsTmp is false.
+					dist := util.MinImageDist2Tilt(otXYZ[i], pos, box, tilt)
+					dist = math.Sqrt(dist)
+					dist /= otSigma[i]
+
+					if dist < distTmp {
+						other = true
 					}
-				}
+				}, func(bound float64) bool {
+					return other || bound*ratio/otSigmaM >= distTmp
+				})
 
-				if ptsTmp {
-					pts[lit] = ptsTmp
+				if !other {
+					pts[lit] = true
+					ptsTyp[atTyp[idTmp]]++
 				}
 			}
 		}
 	}
 
-	volBloc := v.Bloc[0] * v.Bloc[1] * v.Bloc[2]
-	volAt := volBloc * float64(len(pts))
-	volOt := (box[0] * box[1] * box[2]) - volAt
+	return pts, ptsTyp
+}
 
-	fmt.Fprintf(w, "%d %g %g %g\n", cfg, float64(cfg)*v.Dt, volAt, volOt)
+// cellEdge returns the edge of the cells of a cell list containing atoms atoms
+// so that there are about two atoms per cell.
+func cellEdge(box [3]float64, atoms int) float64 {
+	if atoms == 0 {
+		return math.Max(box[0], math.Max(box[1], box[2]))
+	}
+	return math.Cbrt(2. * box[0] * box[1] * box[2] / float64(atoms))
+}
 
-	if cfg == v.CfgStart {
-		v.xyz(pts)
+// area returns the areas of the projections of the blocs onto the xy, xz, and
+// yz planes. In a triclinic box, the blocs are projected along the edges of
+// the box.
+func (v *Volume) area(pts map[[3]float64]bool) [3]float64 {
+	xy := make(map[[2]float64]bool)
+	xz := make(map[[2]float64]bool)
+	yz := make(map[[2]float64]bool)
+	for k := range pts {
+		xy[[2]float64{k[0], k[1]}] = true
+		xz[[2]float64{k[0], k[2]}] = true
+		yz[[2]float64{k[1], k[2]}] = true
+	}
+
+	return [3]float64{
+		float64(len(xy)) * v.Bloc[0] * v.Bloc[1],
+		float64(len(xz)) * v.Bloc[0] * v.Bloc[2],
+		float64(len(yz)) * v.Bloc[1] * v.Bloc[2],
 	}
 }
 
-// for test purpose only.
-func (v *Volume) xyz(pts map[[3]float64]bool) error {
-	f, err := os.Create(v.FileOutXYZ)
-	if err != nil {
-		return err
+// xyzFrame returns the frame of FileOutXYZ of the configuration cfg, and false
+// if the configuration is not written (see WriteXYZEvery).
+func (v *Volume) xyzFrame(cfg int) (int, bool) {
+	n := (cfg - v.CfgStart) / (v.CfgSpacing + 1)
+	if n == 0 {
+		return 0, true
 	}
-	defer f.Close()
 
-	fmt.Fprintln(f, len(pts), "\n Atom C == solvent")
+	if v.WriteXYZEvery == 0 || n%v.WriteXYZEvery != 0 {
+		return 0, false
+	}
+	return n / v.WriteXYZEvery, true
+}
+
+// addXYZ writes the frame frame of FileOutXYZ once the previous frames are
+// written. It is safe for concurrent use.
+func (v *Volume) addXYZ(frame int, b []byte) {
+	v.xyzMux.Lock()
+	defer v.xyzMux.Unlock()
+
+	v.xyzPending[frame] = b
+	for {
+		b, ok := v.xyzPending[v.xyzNext]
+		if !ok {
+			return
+		}
+
+		delete(v.xyzPending, v.xyzNext)
+		v.xyzNext++
+		if _, err := v.xyzOut.Write(b); err != nil && v.xyzErr == nil {
+			v.xyzErr = err
+		}
+	}
+}
 
-	for k, val := range pts {
+// flushXYZ writes the frames still waiting for a previous one, which is
+// missing if the trajectory ended early, and flushes w, the buffer of
+// FileOutXYZ.
+func (v *Volume) flushXYZ(w *bufio.Writer) error {
+	frames := make([]int, 0, len(v.xyzPending))
+	for frame := range v.xyzPending {
+		frames = append(frames, frame)
+	}
+	sort.Ints(frames)
+
+	for _, frame := range frames {
+		if _, err := w.Write(v.xyzPending[frame]); err != nil {
+			return err
+		}
+	}
+	v.xyzPending = nil
+
+	if v.xyzErr != nil {
+		return v.xyzErr
+	}
+	return w.Flush()
+}
+
+// xyz writes the blocs of the atoms of the configuration cfg as a frame of the
+// XYZ format. The blocs are sorted so that the frame is the same every time.
+// The position of a bloc is its center in the box of size box and tilt factors
+// tilt.
+func (v *Volume) xyz(w io.Writer, cfg int, box, tilt [3]float64, pts map[[3]float64]bool) {
+	fmt.Fprintf(w, "%d\n Atom C == solvent, cfg %d\n", len(pts), cfg)
+
+	keys := make([][3]float64, 0, len(pts))
+	for k := range pts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if keys[i][k] != keys[j][k] {
+				return keys[i][k] < keys[j][k]
+			}
+		}
+		return false
+	})
+
+	for _, k := range keys {
+		val := pts[k]
 		at := "C"
 		if val {
 			at = "O"
 		}
-		fmt.Fprintln(f, at, (k[0]*v.Bloc[0] + v.Bloc[0]/2.), (k[1]*v.Bloc[1] + v.Bloc[1]/2.), (k[2]*v.Bloc[2] + v.Bloc[2]/2.))
+		var u [3]float64
+		for j := 0; j < 3; j++ {
+			u[j] = k[j]*v.Bloc[j] + v.Bloc[j]/2.
+		}
+		pos := util.Shear(u, box, tilt)
+		fmt.Fprintln(w, at, pos[0], pos[1], pos[2])
 	}
-
-	return nil
 }
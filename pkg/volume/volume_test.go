@@ -0,0 +1,720 @@
+package volume
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kpotier/molsolvent/pkg/util"
+)
+
+// atom is an atom of a test trajectory.
+type atom struct {
+	typ string
+	xyz [3]float64
+}
+
+// trajectory returns a LAMMPS trajectory with the columns id, type, x, y, and
+// z. Each configuration is in a cubic box of length box.
+func trajectory(box float64, cfgs ...[]atom) string {
+	var b strings.Builder
+	for i, atoms := range cfgs {
+		fmt.Fprintf(&b, "ITEM: TIMESTEP\n%d\nITEM: NUMBER OF ATOMS\n%d\n", i, len(atoms))
+		fmt.Fprintf(&b, "ITEM: BOX BOUNDS pp pp pp\n0 %g\n0 %g\n0 %g\n", box, box, box)
+		b.WriteString("ITEM: ATOMS id type x y z\n")
+		for j, at := range atoms {
+			fmt.Fprintf(&b, "%d %s %g %g %g\n", j+1, at.typ, at.xyz[0], at.xyz[1], at.xyz[2])
+		}
+	}
+	return b.String()
+}
+
+// newVolume writes the trajectory traj and the configuration file made of the
+// parameters params (without the table [volume]) into a temporary directory,
+// and returns the calculation read from this file by New.
+func newVolume(t *testing.T, params, traj string) (*Volume, error) {
+	dir, err := ioutil.TempDir("", "volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "volume.toml")
+	cfg := fmt.Sprintf("[volume]\nfile_in = %q\nfile_out = %q\nfile_out_xyz = %q\n%s",
+		filepath.Join(dir, "traj.lammpstrj"), filepath.Join(dir, "volume.dat"),
+		filepath.Join(dir, "volume.xyz"), params)
+
+	err = ioutil.WriteFile(path, []byte(cfg), 0644)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "traj.lammpstrj"), []byte(traj), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(path)
+}
+
+// run runs the calculation returned by newVolume. It returns the output file,
+// whose first line (the date) is removed.
+func run(t *testing.T, params, traj string) (string, error) {
+	v, err := newVolume(t, params, traj)
+	if err != nil {
+		return "", fmt.Errorf("New: %w", err)
+	}
+
+	err = v.Start()
+	if err != nil {
+		return "", err
+	}
+
+	b, err := ioutil.ReadFile(v.FileOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	return out[strings.Index(out, "\n")+1:], nil
+}
+
+func TestAtomsChanged(t *testing.T) {
+	first := []atom{{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{5, 5, 5}}}
+	second := []atom{{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{5, 5, 5}}, {"2", [3]float64{7, 7, 7}}}
+
+	tests := []struct {
+		name   string
+		cfgs   [][]atom
+		errMsg string // empty if no error is expected
+	}{
+		{"constant", [][]atom{first, first, first}, ""},
+		{"more atoms", [][]atom{first, first, second}, "number of atoms changed: 3 (2 in the first configuration)"},
+		{"less atoms", [][]atom{second, first}, "number of atoms changed: 2 (3 in the first configuration)"},
+	}
+
+	for _, tt := range tests {
+		params := fmt.Sprintf("cfg_end = %d\ncfg_spacing = 0\nbloc = [1.0, 1.0, 1.0]\nblocs = [2, 2, 2]\n"+
+			"atoms = [\"1\"]\nsigma = {1 = 1.0, 2 = 1.0}\ndt = 1.0\nthreads = 1\n", len(tt.cfgs))
+		_, err := run(t, params, trajectory(10, tt.cfgs...))
+
+		switch {
+		case tt.errMsg == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.errMsg != "" && (err == nil || !strings.Contains(err.Error(), tt.errMsg)):
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+		}
+	}
+}
+
+// classifyBrute is like classify but every atom is visited for each bloc, as
+// before the cell lists.
+func (v *Volume) classifyBrute(box, tilt [3]float64, xyz XYZ, ptsX, ptsY, ptsZ map[float64]bool) (map[[3]float64]bool, map[string]int) {
+	pts := make(map[[3]float64]bool)
+	ptsTyp := make(map[string]int)
+	for x := range ptsX {
+		for y := range ptsY {
+			for z := range ptsZ {
+				lit := [3]float64{x, y, z}
+
+				var u [3]float64
+				for k := 0; k < 3; k++ {
+					u[k] = (v.Bloc[k] * lit[k]) + (v.Bloc[k] / 2.)
+				}
+				pos := util.Shear(u, box, tilt)
+
+				distTmp := math.MaxFloat64
+				var typTmp string
+				for _, atom := range v.Atoms {
+					for _, xyzt := range xyz[atom] {
+						dist := util.MinImageDist2Tilt(xyzt, pos, box, tilt) / v.sigma2[atom]
+						if dist < distTmp {
+							distTmp = dist
+							typTmp = atom
+						}
+					}
+				}
+
+				other := typTmp == ""
+				for _, atom := range v.atOther {
+					for _, xyzt := range xyz[atom] {
+						if other {
+							break
+						}
+						other = math.Sqrt(util.MinImageDist2Tilt(xyzt, pos, box, tilt))/v.sigma[atom] < distTmp
+					}
+				}
+
+				if !other {
+					pts[lit] = true
+					ptsTyp[typTmp]++
+				}
+			}
+		}
+	}
+	return pts, ptsTyp
+}
+
+func TestClassify(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tests := []struct {
+		box   [3]float64
+		tilt  [3]float64
+		bloc  float64
+		blocs int
+		atoms map[string]int // number of atoms of each type
+	}{
+		{[3]float64{10, 10, 10}, [3]float64{}, 0.5, 3, map[string]int{"1": 4, "2": 2, "3": 200}},
+		{[3]float64{12, 8, 10}, [3]float64{}, 0.4, 4, map[string]int{"1": 10, "2": 0, "3": 100}},
+		{[3]float64{10, 10, 10}, [3]float64{}, 1, 2, map[string]int{"1": 1, "2": 1, "3": 0}},
+		{[3]float64{6, 6, 6}, [3]float64{}, 0.5, 5, map[string]int{"1": 30, "2": 30, "3": 30}},
+		{[3]float64{10, 10, 10}, [3]float64{5, 0, 0}, 0.5, 3, map[string]int{"1": 4, "2": 2, "3": 200}},
+		{[3]float64{12, 8, 10}, [3]float64{-3, 4, 2.5}, 0.4, 4, map[string]int{"1": 10, "2": 5, "3": 100}},
+	}
+	sigma := map[string]float64{"1": 1.5, "2": 0.8, "3": 1}
+
+	for _, tt := range tests {
+		v := &Volume{Atoms: []string{"1", "2"}, atOther: []string{"3"},
+			Bloc: []float64{tt.bloc, tt.bloc, tt.bloc}, Blocs: []int{tt.blocs, tt.blocs, tt.blocs},
+			sigma: make(map[string]float64), sigma2: make(map[string]float64)}
+		for typ, s := range sigma {
+			v.addSigma(typ, s)
+		}
+
+		xyz := make(XYZ)
+		for typ, n := range tt.atoms {
+			for i := 0; i < n; i++ {
+				var u [3]float64
+				for k := 0; k < 3; k++ {
+					u[k] = rnd.Float64() * tt.box[k]
+				}
+				xyz[typ] = append(xyz[typ], util.Shear(u, tt.box, tt.tilt))
+			}
+		}
+
+		ptsX, ptsY, ptsZ := v.candidates(tt.box, tt.tilt, xyz)
+		pts, ptsTyp := v.classify(tt.box, tt.tilt, xyz, ptsX, ptsY, ptsZ)
+		ptsBrute, ptsTypBrute := v.classifyBrute(tt.box, tt.tilt, xyz, ptsX, ptsY, ptsZ)
+
+		if len(pts) != len(ptsBrute) {
+			t.Errorf("box %v tilt %v, atoms %v: %d blocs with the cell lists, %d without", tt.box, tt.tilt, tt.atoms, len(pts), len(ptsBrute))
+			continue
+		}
+		for lit := range ptsBrute {
+			if !pts[lit] {
+				t.Errorf("box %v tilt %v, atoms %v: bloc %v not classified as atoms with the cell lists", tt.box, tt.tilt, tt.atoms, lit)
+			}
+		}
+		for _, typ := range v.Atoms {
+			if ptsTyp[typ] != ptsTypBrute[typ] {
+				t.Errorf("box %v tilt %v, atoms %v: %d blocs of type %s with the cell lists, %d without",
+					tt.box, tt.tilt, tt.atoms, ptsTyp[typ], typ, ptsTypBrute[typ])
+			}
+		}
+	}
+}
+
+func BenchmarkClassify(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	box := [3]float64{20, 20, 20}
+	v := &Volume{Atoms: []string{"1"}, atOther: []string{"2"},
+		Bloc: []float64{0.5, 0.5, 0.5}, Blocs: []int{3, 3, 3},
+		sigma: make(map[string]float64), sigma2: make(map[string]float64)}
+	v.addSigma("1", 1)
+	v.addSigma("2", 1)
+
+	xyz := make(XYZ)
+	for _, n := range []struct {
+		typ string
+		nb  int
+	}{{"1", 10}, {"2", 800}} {
+		for i := 0; i < n.nb; i++ {
+			xyz[n.typ] = append(xyz[n.typ], [3]float64{rnd.Float64() * 20, rnd.Float64() * 20, rnd.Float64() * 20})
+		}
+	}
+	ptsX, ptsY, ptsZ := v.candidates(box, [3]float64{}, xyz)
+
+	b.Run("CellList", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			v.classify(box, [3]float64{}, xyz, ptsX, ptsY, ptsZ)
+		}
+	})
+	b.Run("BruteForce", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			v.classifyBrute(box, [3]float64{}, xyz, ptsX, ptsY, ptsZ)
+		}
+	})
+}
+
+// results returns the lines of the output out from the header of the columns.
+func results(out string) string {
+	return out[strings.Index(out, "cfg t "):]
+}
+
+func TestTriclinic(t *testing.T) {
+	// The solvent atom is 1.8 away from the atom through a tilted edge of the
+	// box of length 10. The blocs are the same once both atoms are moved by
+	// 5 blocs along this edge, where they are in the middle of the box.
+	tests := []struct {
+		name         string
+		bounds       string
+		at, ot       [3]float64 // atom and solvent across the edge
+		atMid, otMid [3]float64 // same atoms in the middle of the box
+	}{
+		{"xy", "xy xz yz pp pp pp\n0 15 5\n0 10 0\n0 10 0\n",
+			[3]float64{1, 1, 1}, [3]float64{6, 9.2, 1}, [3]float64{3.5, 6, 1}, [3]float64{3.5, 4.2, 1}},
+		{"yz", "xy xz yz pp pp pp\n0 10 0\n0 15 0\n0 10 5\n",
+			[3]float64{1, 1, 1}, [3]float64{1, 6, 9.2}, [3]float64{1, 3.5, 6}, [3]float64{1, 3.5, 4.2}},
+	}
+
+	for _, tt := range tests {
+		var vol [2][2]float64
+		for i, pos := range [2][2][3]float64{{tt.at, tt.ot}, {tt.atMid, tt.otMid}} {
+			traj := "ITEM: TIMESTEP\n0\nITEM: NUMBER OF ATOMS\n2\nITEM: BOX BOUNDS " + tt.bounds +
+				"ITEM: ATOMS id type x y z\n" +
+				fmt.Sprintf("1 1 %g %g %g\n2 2 %g %g %g\n", pos[0][0], pos[0][1], pos[0][2], pos[1][0], pos[1][1], pos[1][2])
+			out, err := run(t, "cfg_end = 1\ncfg_spacing = 0\nbloc = [0.5, 0.5, 0.5]\nblocs = [4, 4, 4]\n"+
+				"atoms = [\"1\"]\nsigma = {1 = 1.0, 2 = 1.0}\ndt = 1.0\nthreads = 1\n", traj)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+
+			fields := strings.Fields(strings.Split(results(out), "\n")[1])
+			for k := 0; k < 2; k++ {
+				vol[i][k], err = strconv.ParseFloat(fields[2+k], 64)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		if vol[0] != vol[1] {
+			t.Errorf("%s: vol(atoms) and vol(other) are %v across the edge, %v in the middle of the box", tt.name, vol[0], vol[1])
+		}
+		if vol[0][0] >= 9*9*9*0.125 { // the solvent takes blocs
+			t.Errorf("%s: vol(atoms) = %g ignores the solvent across the edge", tt.name, vol[0][0])
+		}
+		if math.Abs(vol[0][0]+vol[0][1]-1000) > 1e-9 {
+			t.Errorf("%s: vol(atoms) + vol(other) = %g, want the volume of the box 1000", tt.name, vol[0][0]+vol[0][1])
+		}
+	}
+}
+
+func TestOthersRest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var cfgs [][]atom
+	for i := 0; i < 3; i++ {
+		atoms := []atom{{"1", [3]float64{5, 5, 5}}, {"1", [3]float64{6, 5.5, 5}}}
+		for j := 0; j < 40; j++ {
+			typ := []string{"2", "3", "4"}[j%3]
+			atoms = append(atoms, atom{typ, [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	common := "cfg_end = 3\ncfg_spacing = 0\nbloc = [0.5, 0.5, 0.5]\nblocs = [4, 4, 4]\n" +
+		"atoms = [\"1\"]\ndt = 1.0\nthreads = 1\n"
+
+	tests := []struct {
+		name   string
+		rest   string // parameters with others_are = "rest"
+		sigma  string // same solvent with others_are = "sigma"
+		errMsg string
+	}{
+		{"default sigma",
+			"sigma = {1 = 1.5}\nsigma_default = 1.0\n",
+			"sigma = {1 = 1.5, 2 = 1.0, 3 = 1.0, 4 = 1.0}\n", ""},
+		{"per-type sigma",
+			"sigma = {1 = 1.5, 3 = 0.6}\nsigma_default = 1.2\n",
+			"sigma = {1 = 1.5, 2 = 1.2, 3 = 0.6, 4 = 1.2}\n", ""},
+		{"every sigma",
+			"sigma = {1 = 1.5, 2 = 0.7, 3 = 0.8, 4 = 0.9}\n",
+			"sigma = {1 = 1.5, 2 = 0.7, 3 = 0.8, 4 = 0.9}\n", ""},
+		{"missing sigma",
+			"sigma = {1 = 1.5, 2 = 0.7, 4 = 0.9}\n",
+			"", "no sigma for atom type `3`"},
+	}
+
+	for _, tt := range tests {
+		rest, err := run(t, common+"others_are = \"rest\"\n"+tt.rest, traj)
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		sigma, err := run(t, common+tt.sigma, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if results(rest) != results(sigma) {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, results(rest), results(sigma))
+		}
+	}
+}
+
+func TestThreads(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	var cfgs [][]atom
+	for i := 0; i < 12; i++ {
+		atoms := []atom{{"1", [3]float64{5, 5, 5}}, {"1", [3]float64{6, 5.5, 5}}}
+		for j := 0; j < 60; j++ {
+			atoms = append(atoms, atom{"2", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	params := func(threads int) string {
+		return fmt.Sprintf("cfg_end = %d\ncfg_spacing = 0\nbloc = [0.5, 0.5, 0.5]\nblocs = [4, 4, 4]\n"+
+			"atoms = [\"1\"]\nsigma = {1 = 1.5, 2 = 1.0}\ndt = 1.0\nbox_bins = 4\nthreads = %d\n", len(cfgs), threads)
+	}
+
+	// One thread: the same results, including the density of the volume of
+	// the box. The parameters differ only by the temporary directory.
+	first, err := run(t, params(1), traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		out, err := run(t, params(1), traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results(out) != results(first) {
+			t.Fatalf("run %d: got\n%s\nwant\n%s", i+1, results(out), results(first))
+		}
+	}
+
+	// Several threads: the rows of the configurations may be in another order
+	// and the timings are written, but the results are the same.
+	rows := func(out string) []string {
+		var lines []string
+		for _, l := range strings.Split(results(out), "\n")[1:] {
+			if l == "" {
+				break
+			}
+			lines = append(lines, l)
+		}
+		sort.Strings(lines)
+		return lines
+	}
+	want := rows(first)
+	if len(want) != len(cfgs) {
+		t.Fatalf("%d rows, want %d", len(want), len(cfgs))
+	}
+
+	for _, threads := range []int{2, 4, 8} {
+		out, err := run(t, params(threads), traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rows(out); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%d threads: got rows\n%s\nwant\n%s", threads, strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	}
+}
+
+// slab returns the blocs of indices [0, n[0]) × [0, n[1]) × [0, n[2]) shifted
+// by off.
+func slab(n [3]int, off [3]float64) map[[3]float64]bool {
+	pts := make(map[[3]float64]bool)
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			for k := 0; k < n[2]; k++ {
+				pts[[3]float64{off[0] + float64(i), off[1] + float64(j), off[2] + float64(k)}] = true
+			}
+		}
+	}
+	return pts
+}
+
+func TestArea(t *testing.T) {
+	// Two slabs of 4×3×1 blocs stacked along z, and a bar of 1×1×5 blocs
+	// along z beside them.
+	stack := slab([3]int{4, 3, 1}, [3]float64{})
+	for lit := range slab([3]int{4, 3, 1}, [3]float64{0, 0, 1}) {
+		stack[lit] = true
+	}
+	bar := slab([3]int{4, 3, 2}, [3]float64{})
+	for lit := range slab([3]int{1, 1, 5}, [3]float64{10, 10, 0}) {
+		bar[lit] = true
+	}
+
+	tests := []struct {
+		name string
+		bloc []float64
+		pts  map[[3]float64]bool
+		want [3]float64
+	}{
+		{"slab xy", []float64{1, 1, 1}, slab([3]int{10, 6, 1}, [3]float64{}), [3]float64{60, 10, 6}},
+		{"slab yz", []float64{0.5, 0.5, 0.5}, slab([3]int{1, 8, 4}, [3]float64{3, 0, -2}), [3]float64{2, 1, 8}},
+		{"anisotropic blocs", []float64{0.5, 1, 2}, slab([3]int{2, 3, 4}, [3]float64{}), [3]float64{3, 8, 24}},
+		{"stacked slabs", []float64{1, 1, 1}, stack, [3]float64{12, 8, 6}},
+		{"slab and bar", []float64{1, 1, 1}, bar, [3]float64{13, 13, 11}},
+		{"empty", []float64{1, 1, 1}, nil, [3]float64{}},
+	}
+
+	for _, tt := range tests {
+		v := &Volume{Bloc: tt.bloc}
+		if got := v.area(tt.pts); got != tt.want {
+			t.Errorf("%s: areas %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRadii(t *testing.T) {
+	common := "cfg_end = 1\nbloc = [1.0, 1.0, 1.0]\nblocs = [2, 2, 2]\natoms = [\"1\"]\ndt = 1.0\n"
+
+	tests := []struct {
+		name   string
+		params string
+		sigma  map[string]float64
+		errMsg string
+	}{
+		{"elements", "radii = \"vdw\"\ntype_to_element = {1 = \"C\", 2 = \"O\", 3 = \"H\"}\n",
+			map[string]float64{"1": 3.4, "2": 3.04, "3": 2.4}, ""},
+		{"override", "radii = \"vdw\"\ntype_to_element = {1 = \"C\", 2 = \"O\"}\nsigma = {2 = 2.5, 4 = 1.0}\n",
+			map[string]float64{"1": 3.4, "2": 2.5, "4": 1}, ""},
+		{"without radii", "type_to_element = {1 = \"C\", 2 = \"O\"}\nsigma = {1 = 1.0, 2 = 1.5}\n",
+			map[string]float64{"1": 1, "2": 1.5}, ""},
+		{"unknown element", "radii = \"vdw\"\ntype_to_element = {1 = \"C\", 2 = \"Xx\"}\n",
+			nil, "no radius for element `Xx` in table `vdw`"},
+		{"unknown table", "radii = \"ionic\"\ntype_to_element = {1 = \"C\"}\n",
+			nil, "table of radii `ionic` doesn't exist"},
+	}
+
+	for _, tt := range tests {
+		v, err := newVolume(t, common+tt.params, "")
+		if tt.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if len(v.sigma) != len(tt.sigma) {
+			t.Errorf("%s: sigma %v, want %v", tt.name, v.sigma, tt.sigma)
+			continue
+		}
+		for typ, want := range tt.sigma {
+			if math.Abs(v.sigma[typ]-want) > 1e-12 {
+				t.Errorf("%s: sigma %v, want %v", tt.name, v.sigma, tt.sigma)
+				break
+			}
+		}
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	var cfgs [][]atom
+	for i := 0; i < 3; i++ {
+		atoms := []atom{{"1", [3]float64{5, 5, 5 + 0.3*float64(i)}}}
+		for j := 0; j < 40; j++ {
+			atoms = append(atoms, atom{"2", [3]float64{rnd.Float64() * 10, rnd.Float64() * 10, rnd.Float64() * 10}})
+		}
+		cfgs = append(cfgs, atoms)
+	}
+	traj := trajectory(10, cfgs...)
+	params := "cfg_end = 3\ncfg_spacing = 0\nbloc = [0.5, 0.5, 0.5]\nblocs = [4, 4, 4]\n" +
+		"atoms = [\"1\"]\nsigma = {1 = 1.5, 2 = 1.0}\ndt = 1.0\nthreads = 1\n"
+
+	lf, err := run(t, params, traj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf, err := run(t, params, strings.ReplaceAll(traj, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results(crlf) != results(lf) {
+		t.Errorf("CRLF: got\n%s\nwant\n%s", results(crlf), results(lf))
+	}
+}
+
+func TestSplitByType(t *testing.T) {
+	// Without solvent, every candidate bloc belongs to the atoms, e.g. with
+	// atoms in the blocs 5 and 8 along x, the blocs from 3 to 10 along x
+	// (Blocs = 2) and from 3 to 7 along y and z: 8×5×5 blocs of 1. They are
+	// split by the nearest atom, the distances being divided by sigma.
+	tests := []struct {
+		name  string
+		atoms []atom
+		sigma string
+		vol   float64
+		vol1  float64
+		vol2  float64
+	}{
+		{"halves", []atom{{"1", [3]float64{5.5, 5.5, 5.5}}, {"2", [3]float64{8.5, 5.5, 5.5}}},
+			"{1 = 1.0, 2 = 1.0}", 200, 100, 100},
+		{"reversed", []atom{{"2", [3]float64{5.5, 5.5, 5.5}}, {"1", [3]float64{8.5, 5.5, 5.5}}},
+			"{1 = 1.0, 2 = 1.0}", 200, 100, 100},
+		// The blocs at x = 7.5 are as far from both atoms: the ties go to the
+		// first type of Atoms.
+		{"ties", []atom{{"1", [3]float64{5.5, 5.5, 5.5}}, {"2", [3]float64{9.5, 5.5, 5.5}}},
+			"{1 = 1.0, 2 = 1.0}", 225, 125, 100},
+		// With a sigma of 3, the distances to the atom of type 2 are divided
+		// by 3: only the bloc of the atom of type 1 and its 5 neighbors that
+		// are not toward the other atom remain nearer to it.
+		{"large sigma", []atom{{"1", [3]float64{5.5, 5.5, 5.5}}, {"2", [3]float64{8.5, 5.5, 5.5}}},
+			"{1 = 1.0, 2 = 3.0}", 200, 6, 194},
+	}
+
+	for _, tt := range tests {
+		params := "cfg_end = 1\nbloc = [1.0, 1.0, 1.0]\nblocs = [2, 2, 2]\natoms = [\"1\", \"2\"]\n" +
+			"sigma = " + tt.sigma + "\ndt = 1.0\nthreads = 1\n"
+		out, err := run(t, params, trajectory(20, tt.atoms))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var cfg, step, vol, volOther, xy, xz, yz, vol1, vol2 float64
+		_, err = fmt.Sscan(strings.Split(results(out), "\n")[1], &cfg, &step, &vol, &volOther, &xy, &xz, &yz, &vol1, &vol2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if vol != tt.vol || vol1 != tt.vol1 || vol2 != tt.vol2 {
+			t.Errorf("%s: vol(atoms) %g, vol(1) %g, vol(2) %g, want %g, %g, %g",
+				tt.name, vol, vol1, vol2, tt.vol, tt.vol1, tt.vol2)
+		}
+	}
+}
+
+func TestFileOutFrames(t *testing.T) {
+	var cfgs [][]atom
+	for i := 0; i < 10; i++ {
+		cfgs = append(cfgs, []atom{{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{5, 5, 5}}})
+	}
+	// The timestep of the configuration i is 1000 + 50·i.
+	var lines []string
+	for _, l := range strings.Split(trajectory(10, cfgs...), "\n") {
+		if len(lines) > 0 && lines[len(lines)-1] == "ITEM: TIMESTEP" {
+			n, _ := strconv.Atoi(l)
+			l = fmt.Sprint(1000 + 50*n)
+		}
+		lines = append(lines, l)
+	}
+	traj := strings.Join(lines, "\n")
+
+	dir, err := ioutil.TempDir("", "volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		params  string
+		threads int
+		want    string
+	}{
+		{"range", "cfg_start = 2\ncfg_end = 5\ncfg_spacing = 0\n", 1, "cfg timestep\n2 1100\n3 1150\n4 1200\n"},
+		{"spacing", "cfg_start = 1\ncfg_end = 10\ncfg_spacing = 2\n", 1, "cfg timestep\n1 1050\n4 1200\n7 1350\n"},
+		{"threads", "cfg_start = 1\ncfg_end = 10\ncfg_spacing = 2\n", 4, "cfg timestep\n1 1050\n4 1200\n7 1350\n"},
+	}
+
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		params := fmt.Sprintf("%sfile_out_frames = %q\nbloc = [1.0, 1.0, 1.0]\nblocs = [2, 2, 2]\n"+
+			"atoms = [\"1\"]\nsigma = {1 = 1.0, 2 = 1.0}\ndt = 1.0\nthreads = %d\n", tt.params, path, tt.threads)
+		if _, err := run(t, params, traj); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestShortTrajectory(t *testing.T) {
+	// The trajectory has 3 configurations.
+	var cfgs [][]atom
+	for i := 0; i < 3; i++ {
+		cfgs = append(cfgs, []atom{{"1", [3]float64{1, 1, 1}}, {"2", [3]float64{5, 5, 5}}})
+	}
+	traj := trajectory(10, cfgs...)
+
+	tests := []struct {
+		params  string
+		threads int
+		rows    []string // first column of the rows
+		log     string
+	}{
+		{"cfg_end = 3\ncfg_spacing = 0\n", 1, []string{"0", "1", "2"}, ""},
+		{"cfg_end = 10\ncfg_spacing = 0\n", 1, []string{"0", "1", "2"},
+			"volume: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+		{"cfg_end = 10\ncfg_spacing = 0\n", 3, []string{"0", "1", "2"},
+			"volume: the trajectory ends before the configuration 3 (requested up to 9), 3 configurations used\n"},
+		{"cfg_end = 10\ncfg_spacing = 1\n", 1, []string{"0", "2"},
+			"volume: the trajectory ends before the configuration 4 (requested up to 8), 2 configurations used\n"},
+	}
+
+	for _, tt := range tests {
+		params := fmt.Sprintf("%sbloc = [1.0, 1.0, 1.0]\nblocs = [2, 2, 2]\n"+
+			"atoms = [\"1\"]\nsigma = {1 = 1.0, 2 = 1.0}\ndt = 1.0\nthreads = %d\n", tt.params, tt.threads)
+		v, err := newVolume(t, params, traj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var logs strings.Builder
+		v.SetLog(log.New(&logs, "", 0))
+
+		err = v.Start()
+		if err != nil {
+			t.Errorf("%q: %v", tt.params, err)
+			continue
+		}
+
+		var got string
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if strings.Contains(line, "the trajectory ends") {
+				got += line + "\n"
+			}
+		}
+		if got != tt.log {
+			t.Errorf("%q (%d threads): logged %q, want %q", tt.params, tt.threads, got, tt.log)
+		}
+
+		b, err := ioutil.ReadFile(v.FileOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []string
+		for _, line := range strings.Split(results(string(b)), "\n")[1:] {
+			if line == "" {
+				break
+			}
+			rows = append(rows, strings.Fields(line)[0])
+		}
+		sort.Strings(rows)
+		if strings.Join(rows, " ") != strings.Join(tt.rows, " ") {
+			t.Errorf("%q (%d threads): got the configurations %v, want %v", tt.params, tt.threads, rows, tt.rows)
+		}
+
+		if want := fmt.Sprintf("(%d configurations)", len(tt.rows)); !strings.HasSuffix(v.Summary(), want) {
+			t.Errorf("%q (%d threads): summary %q doesn't end with %q", tt.params, tt.threads, v.Summary(), want)
+		}
+	}
+}